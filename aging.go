@@ -0,0 +1,158 @@
+package emulator
+
+import (
+	"errors"
+	"math/rand/v2"
+
+	"github.com/synaptecltd/emulator/mathfuncs"
+)
+
+// AgingProfile degrades a sensor over a long horizon, gradually increasing its noise, gain error and
+// probability of dropped samples. Degradation follows a curve evaluated with an amplitude of 1 over
+// the lifetime of the sensor, and holds its final value once the lifetime has elapsed.
+type AgingProfile struct {
+	lifetime           float64 // time over which the sensor degrades in seconds
+	NoiseIncrease      float64 // increase of noise magnitude at the end of the lifetime, in the same units as NoiseMag
+	Drift              float64 // gain error of the sensor at the end of the lifetime in pu, e.g. 0.02 for a 2% over-read
+	dropoutProbability float64 // probability of each sample being dropped at the end of the lifetime
+	curveFuncName      string  // name of the function giving the degradation level over the lifetime, defaults to "linear" if empty
+
+	// internal state
+	curveFunction mathfuncs.MathsFunction // returns the degradation level for a given elapsed time; set internally from curveFuncName
+	elapsedIndex  int                     // number of time steps since the start of the emulation, up to the end of the lifetime
+	level         float64                 // degradation level in the latest time step
+
+	// random numbers of a stochastic curve
+	funcSource *mathfuncs.SwitchableSource // source of the random numbers of curveFunction, switched to the random number generator of each time step
+}
+
+// Parameters used to request an aging profile. These map onto the fields of AgingProfile.
+type AgingParams struct {
+	Lifetime           float64 `yaml:"Lifetime"`           // time over which the sensor degrades in seconds, must be greater than 0
+	NoiseIncrease      float64 `yaml:"NoiseIncrease"`      // increase of noise magnitude at the end of the lifetime, in the same units as NoiseMag
+	Drift              float64 `yaml:"Drift"`              // gain error of the sensor at the end of the lifetime in pu, e.g. 0.02 for a 2% over-read
+	DropoutProbability float64 `yaml:"DropoutProbability"` // probability of each sample being dropped at the end of the lifetime, between 0 and 1
+	CurveFuncName      string  `yaml:"Curve"`              // name of the function giving the degradation level over the lifetime, defaults to "linear" if empty
+}
+
+// Initialise the internal fields of AgingProfile when it is unmarshalled from yaml.
+func (a *AgingProfile) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params AgingParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	agingProfile, err := NewAgingProfile(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to a
+	*a = *agingProfile
+
+	return nil
+}
+
+// Returns the parameters of AgingProfile when it is marshalled to yaml.
+func (a *AgingProfile) MarshalYAML() (interface{}, error) {
+	return a.GetParams(), nil
+}
+
+// Returns an AgingProfile pointer with the requested parameters, checking for invalid values.
+func NewAgingProfile(params AgingParams) (*AgingProfile, error) {
+	agingProfile := &AgingProfile{}
+
+	// Invalid values checked by setters
+	if err := agingProfile.SetLifetime(params.Lifetime); err != nil {
+		return nil, err
+	}
+	if err := agingProfile.SetDropoutProbability(params.DropoutProbability); err != nil {
+		return nil, err
+	}
+	if err := agingProfile.SetCurveFunctionByName(params.CurveFuncName); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	agingProfile.NoiseIncrease = params.NoiseIncrease
+	agingProfile.Drift = params.Drift
+
+	return agingProfile, nil
+}
+
+// Returns the degradation level of the sensor this time step, and steps the profile forward by Ts.
+// Once the lifetime has elapsed, the level of the final time step within the lifetime is held. A
+// stochastic curve draws its random numbers from r.
+func (a *AgingProfile) stepLevel(r *rand.Rand, Ts float64) float64 {
+	t := float64(a.elapsedIndex) * Ts
+	if t < a.lifetime {
+		if a.funcSource != nil {
+			a.funcSource.Set(r)
+		}
+		a.level = a.curveFunction(t, 1.0, a.lifetime)
+		a.elapsedIndex += 1
+	}
+	return a.level
+}
+
+// Setters
+
+// Sets the lifetime of the sensor in seconds if lifetime > 0.
+func (a *AgingProfile) SetLifetime(lifetime float64) error {
+	if lifetime <= 0 {
+		return errors.New("lifetime must be greater than 0")
+	}
+	a.lifetime = lifetime
+	return nil
+}
+
+// Sets the probability of each sample being dropped at the end of the lifetime if it is between 0 and 1.
+func (a *AgingProfile) SetDropoutProbability(probability float64) error {
+	if probability < 0 || probability > 1 {
+		return errors.New("dropout probability must be between 0 and 1")
+	}
+	a.dropoutProbability = probability
+	return nil
+}
+
+// Sets the function giving the degradation level over the lifetime by name, defaulting to "linear".
+func (a *AgingProfile) SetCurveFunctionByName(name string) error {
+	if name == "" {
+		name = "linear" // default to linear if no name is provided
+	}
+	source := &mathfuncs.SwitchableSource{}
+	trendFunc, err := mathfuncs.GetTrendFunctionWithRand(name, rand.New(source))
+	if err != nil {
+		return err
+	}
+	a.curveFunction = trendFunc
+	a.funcSource = source
+	a.curveFuncName = name
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define AgingProfile, such that NewAgingProfile returns an identical profile.
+func (a *AgingProfile) GetParams() AgingParams {
+	return AgingParams{
+		Lifetime:           a.lifetime,
+		NoiseIncrease:      a.NoiseIncrease,
+		Drift:              a.Drift,
+		DropoutProbability: a.dropoutProbability,
+		CurveFuncName:      a.curveFuncName,
+	}
+}
+
+func (a *AgingProfile) GetLifetime() float64 {
+	return a.lifetime
+}
+
+func (a *AgingProfile) GetDropoutProbability() float64 {
+	return a.dropoutProbability
+}
+
+func (a *AgingProfile) GetCurveFuncName() string {
+	return a.curveFuncName
+}
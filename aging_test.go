@@ -0,0 +1,75 @@
+package emulator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/synaptecltd/emulator/anomaly"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that invalid aging parameters are rejected
+func TestNewAgingProfile_InvalidParams(t *testing.T) {
+	_, err := NewAgingProfile(AgingParams{Lifetime: 0})
+	assert.Error(t, err)
+
+	_, err = NewAgingProfile(AgingParams{Lifetime: 1, DropoutProbability: 1.5})
+	assert.Error(t, err)
+
+	_, err = NewAgingProfile(AgingParams{Lifetime: 1, CurveFuncName: "not_a_function"})
+	assert.Error(t, err)
+
+	agingProfile, err := NewAgingProfile(AgingParams{Lifetime: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "linear", agingProfile.GetCurveFuncName())
+}
+
+// Assert that the gain error of an aging sensor follows the degradation curve, and holds after the lifetime
+func TestAgingProfile_Drift(t *testing.T) {
+	agingProfile, err := NewAgingProfile(AgingParams{
+		Lifetime: 100,
+		Drift:    0.1,
+	})
+	assert.NoError(t, err)
+
+	emulator := NewEmulator(1, 50.0)
+	emulator.T = &TemperatureEmulation{
+		MeanTemperature: 20.0,
+		Aging:           agingProfile,
+	}
+
+	for i := 0; i < 200; i++ {
+		emulator.Step()
+		level := math.Min(float64(i), 99) / 100
+		assert.InDelta(t, 20.0*(1+0.1*level), emulator.T.T, 1e-9)
+	}
+}
+
+// Assert that the dropout probability of an aging sensor rises over its lifetime
+func TestAgingProfile_Dropout(t *testing.T) {
+	yamlStr := `
+MeanTemperature: 20.0
+Aging:
+  Lifetime: 1000
+  DropoutProbability: 1.0
+  Curve: step
+`
+	var temperature TemperatureEmulation
+	err := yaml.Unmarshal([]byte(yamlStr), &temperature)
+	assert.NoError(t, err)
+
+	emulator := NewEmulator(1, 50.0)
+	emulator.T = &temperature
+
+	// step function is 0 for the first half of the lifetime, then 1
+	for i := 0; i < 2000; i++ {
+		emulator.Step()
+		if i < 500 {
+			assert.Equal(t, anomaly.QualityGood, emulator.T.Quality)
+		} else {
+			assert.Equal(t, anomaly.QualityMissing, emulator.T.Quality)
+			assert.True(t, math.IsNaN(emulator.T.T))
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package anomaly
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+)
+
+// Amplitude distributions, from which the factor by which the magnitude of each spike is scaled is drawn.
+// Each has a typical factor of 1, with a spread set by AmplitudeSpread, or 1 if AmplitudeSpread is 0.
+// Different sensor fault modes have recognisably different amplitude statistics.
+const (
+	AmplitudeConstant    = "constant"    // every spike has the same magnitude
+	AmplitudeUniform     = "uniform"     // factors are uniformly distributed between 1-spread and 1+spread
+	AmplitudeNormal      = "normal"      // factors are normally distributed with a mean of 1 and a standard deviation of spread
+	AmplitudeLognormal   = "lognormal"   // factors are lognormally distributed with a median of 1, i.e. exp of a normal distribution with a standard deviation of spread
+	AmplitudeExponential = "exponential" // factors are exponentially distributed with a mean of 1, so most spikes are small with occasional large ones; spread is unused
+)
+
+// Sets the distribution from which the factor by which the magnitude of each spike is scaled is drawn, and its
+// spread, if distribution is an amplitude distribution or "" for AmplitudeConstant, and spread >= 0.
+func (s *spikeAnomaly) SetAmplitudeDistribution(distribution string, spread float64) error {
+	switch distribution {
+	case "", AmplitudeConstant, AmplitudeUniform, AmplitudeNormal, AmplitudeLognormal, AmplitudeExponential:
+	default:
+		return errors.New("amplitude distribution must be constant, uniform, normal, lognormal or exponential")
+	}
+	if spread < 0 {
+		return errors.New("amplitude spread must be greater than or equal to 0")
+	}
+	s.amplitudeDistribution = distribution
+	s.amplitudeSpread = spread
+	return nil
+}
+
+// Returns the distribution from which the factor by which the magnitude of each spike is scaled is drawn.
+func (s *spikeAnomaly) GetAmplitudeDistribution() string {
+	if s.amplitudeDistribution == "" {
+		return AmplitudeConstant
+	}
+	return s.amplitudeDistribution
+}
+
+// Returns the spread of the amplitude distribution, 0 for the default spread of 1.
+func (s *spikeAnomaly) GetAmplitudeSpread() float64 {
+	return s.amplitudeSpread
+}
+
+// Returns a factor drawn from the amplitude distribution, by which the magnitude of a spike is scaled.
+func (s *spikeAnomaly) amplitudeFactor(r *rand.Rand) float64 {
+	spread := s.amplitudeSpread
+	if spread == 0 {
+		spread = 1
+	}
+	switch s.amplitudeDistribution {
+	case AmplitudeUniform:
+		return 1 + spread*(2*r.Float64()-1)
+	case AmplitudeNormal:
+		return 1 + spread*r.NormFloat64()
+	case AmplitudeLognormal:
+		return math.Exp(spread * r.NormFloat64())
+	case AmplitudeExponential:
+		return r.ExpFloat64()
+	default:
+		return 1
+	}
+}
@@ -1,8 +1,15 @@
 package anomaly
 
 import (
+	"encoding/json"
+	"errors"
 	"fmt"
+	"iter"
 	"math/rand/v2"
+	"slices"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/synaptecltd/emulator/mathfuncs"
@@ -15,21 +22,72 @@ type Container map[string]AnomalyInterface
 // AnomalyInterface is the interface for all anomaly Types (trends, instantaneous, etc).
 type AnomalyInterface interface {
 	UnmarshalYAML(unmarshal func(interface{}) error) error // Unmarshals an anomaly entry into the correct type based on the type field
+	MarshalYAML() (interface{}, error)                     // Marshals the parameters of an anomaly, including the type field
+	UnmarshalJSON(data []byte) error                       // Unmarshals the parameters of an anomaly from json
+	MarshalJSON() ([]byte, error)                          // Marshals the parameters of an anomaly to json, including the type field
 
 	// Inherited from AnomalyBase
-	GetTypeAsString() string          // Returns the type of anomaly as a string
-	GetStartDelay() float64           // Returns the start time of anomalies in seconds
-	GetDuration() float64             // Returns the duration of each anomaly in seconds
-	GetIsAnomalyActive() bool         // Returns whether the anomaly is active this timestep
-	GetStartDelayIndex() int          // Returns the start delay of the anomaly in time steps
-	GetElapsedActivatedIndex() int    // Returns the number of time steps since the start of the active anomaly trend/burst
-	GetElapsedActivatedTime() float64 // Returns the time elapsed since the start of the active anomaly trend/burst
-	GetCountRepeats() uint64          // Returns the number of times the anomaly trend/burst has repeated so far
-	SetStartDelay(float64) error      // Sets the start time of anomalies in seconds if delay >= 0
+	GetTypeAsString() string                // Returns the type of anomaly as a string
+	GetStartDelay() float64                 // Returns the start time of anomalies in seconds
+	GetDuration() float64                   // Returns the duration of each anomaly in seconds
+	GetIsAnomalyActive() bool               // Returns whether the anomaly is active this timestep
+	GetStartDelayIndex() int                // Returns the start delay of the anomaly in time steps
+	GetElapsedActivatedIndex() int          // Returns the number of time steps since the start of the active anomaly trend/burst
+	GetElapsedActivatedTime() float64       // Returns the time elapsed since the start of the active anomaly trend/burst
+	GetCountRepeats() uint64                // Returns the number of times the anomaly trend/burst has repeated so far
+	GetProgress() float64                   // Returns the fraction of the duration of the present repeat elapsed, 0 if inactive or continuous
+	GetRemainingRepeats() uint64            // Returns the number of repeats yet to complete, math.MaxUint64 if the anomaly repeats indefinitely
+	GetTotalElapsedTime() float64           // Returns the time in seconds for which the anomaly has been stepped, including delays and all repeats
+	GetTotalActiveTime() float64            // Returns the time in seconds for which the anomaly has been active, over all repeats
+	GetStats() AnomalyStats                 // Returns statistics of the activity of the anomaly and the deltas it has applied
+	GetStartTime() time.Time                // Returns the wall-clock time at which the anomaly starts, zero if unused
+	GetEndTime() time.Time                  // Returns the wall-clock time at which the anomaly ends, zero if unused
+	GetMaxSlewRate() float64                // Returns the maximum rate of change of the delta applied by the anomaly in units per second, 0 if unlimited
+	GetSeed() uint64                        // Returns the seed of the anomaly's own random number generator, 0 if it uses the emulator's
+	GetBlendMode() string                   // Returns how the delta of the anomaly is combined with the channel
+	GetExclusiveGroup() string              // Returns the name of the exclusive group of the anomaly, "" if none
+	GetTriggeredBy() string                 // Returns the name of the anomaly which triggers the anomaly, "" if none
+	GetTriggerOn() string                   // Returns the event of the trigger which starts the anomaly
+	GetUUID() uuid.UUID                     // Returns the UUID which identifies the anomaly stably across restarts, uuid.Nil if none
+	SetStartDelay(float64) error            // Sets the start time of anomalies in seconds if delay >= 0
+	SetSchedule(time.Time, time.Time) error // Schedules the anomaly against wall-clock start and end times
+	SetMaxSlewRate(float64) error           // Sets the maximum rate of change of the delta applied by the anomaly if rate >= 0
+	SetSeed(uint64)                         // Gives the anomaly its own random number generator with the given seed, or shares the emulator's if 0
+	SetBlendMode(string) error              // Sets how the delta of the anomaly is combined with the channel
+	SetExclusiveGroup(string)               // Sets the name of the exclusive group of the anomaly, "" for none
+	SetUUID(uuid.UUID)                      // Sets the UUID which identifies the anomaly, uuid.Nil for none
+	SetTrigger(string, string) error        // Sets the anomaly which triggers the anomaly, and on which of its events
+	SetOnRepeat(func(repeat uint64))        // Sets a function called each time the anomaly completes a repeat, nil for none
+	ExportState() ([]byte, error)           // Returns the internal state of the anomaly as json, e.g. to checkpoint a long-running emulation
+	ImportState([]byte) error               // Restores the internal state of the anomaly from json returned by ExportState
+	Pause()                                 // Freezes the anomaly from the next time step, so that it continues where it left off when resumed
+	Resume()                                // Resumes the anomaly from the next time step if it is paused
+	IsPaused() bool                         // Returns whether the anomaly is paused
 	SetFunctionByName(
 		string, func(string) (mathfuncs.MathsFunction, error), *string, *mathfuncs.MathsFunction) error // Sets the function used to vary the parameters of an anomaly using a name string (see mathfuncs for available functions)
+	SetFunction(
+		mathfuncs.MathsFunction, string, *string, *mathfuncs.MathsFunction) error // Sets the function used to vary the parameters of an anomaly to a custom function identified by a name string
 
 	stepAnomaly(r *rand.Rand, Ts float64) float64 // Steps the internal time state of an anomaly and returns the change in signal caused by the anomaly
+	limitSlew(delta float64, Ts float64) float64  // Limits the rate of change of the delta applied by the anomaly
+	resolveSchedule(epoch time.Time) error        // Converts the wall-clock schedule of the anomaly into a start delay and duration
+	requestOff(off bool)                          // Requests that the anomaly is switched off or on at the start of the next time step, safe for concurrent use
+	applyOffRequest()                             // Applies the latest pending request to switch the anomaly off or on, if any
+	skipStep()                                    // Marks the anomaly as inactive in a timestep in which it is not stepped
+	updateTrigger(trigger AnomalyInterface)       // Arms the anomaly if its trigger completed a repeat or became active in the previous time step
+	waitingForTrigger() bool                      // Returns whether the anomaly is waiting for its trigger
+	notifyRepeats()                               // Calls the function set by SetOnRepeat for each repeat completed since it was last called
+	recordStep(Ts float64)                        // Adds a time step to the total elapsed time of the anomaly, and its total active time and statistics if it was active
+	recordDelta(delta float64)                    // Records the delta applied by the anomaly in the present time step, for its statistics
+	getStepIndex() int                            // Returns the position of the anomaly in the step order of its container in the previous time step
+	setStepIndex(i int)                           // Records the position of the anomaly in the step order of its container
+}
+
+// Pairs the parameters of an anomaly with its type name, so that a marshalled anomaly is unmarshalled as the same type.
+type typedParams[P any] struct {
+	Type   string `yaml:"Type"`
+	Uuid   string `yaml:"Uuid,omitempty"`
+	Params P      `yaml:",inline"`
 }
 
 // Attempts to cast an AnomalyInterface to a trendAnomaly. Returns the anomaly as a trendAnomaly and boolean indicating success.
@@ -44,59 +102,968 @@ func AsSpikeAnomaly(a AnomalyInterface) (*spikeAnomaly, bool) {
 	return spikeAnomaly, ok
 }
 
-// Unmarshals a generic anomaly entry into the correct type base on the anomaly "Type" field.
+// Attempts to cast an AnomalyInterface to a harmonicAnomaly. Returns the anomaly as a harmonicAnomaly and boolean indicating success.
+func AsHarmonicAnomaly(a AnomalyInterface) (*harmonicAnomaly, bool) {
+	harmonicAnomaly, ok := a.(*harmonicAnomaly)
+	return harmonicAnomaly, ok
+}
+
+// Attempts to cast an AnomalyInterface to a clockDriftAnomaly. Returns the anomaly as a clockDriftAnomaly and boolean indicating success.
+func AsClockDriftAnomaly(a AnomalyInterface) (*clockDriftAnomaly, bool) {
+	clockDriftAnomaly, ok := a.(*clockDriftAnomaly)
+	return clockDriftAnomaly, ok
+}
+
+// Attempts to cast an AnomalyInterface to an invalidAnomaly. Returns the anomaly as an invalidAnomaly and boolean indicating success.
+func AsInvalidAnomaly(a AnomalyInterface) (*invalidAnomaly, bool) {
+	invalidAnomaly, ok := a.(*invalidAnomaly)
+	return invalidAnomaly, ok
+}
+
+// Attempts to cast an AnomalyInterface to a phaseSwapAnomaly. Returns the anomaly as a phaseSwapAnomaly and boolean indicating success.
+func AsPhaseSwapAnomaly(a AnomalyInterface) (*phaseSwapAnomaly, bool) {
+	phaseSwapAnomaly, ok := a.(*phaseSwapAnomaly)
+	return phaseSwapAnomaly, ok
+}
+
+// Attempts to cast an AnomalyInterface to an undersampleAnomaly. Returns the anomaly as an undersampleAnomaly and boolean indicating success.
+func AsUndersampleAnomaly(a AnomalyInterface) (*undersampleAnomaly, bool) {
+	undersampleAnomaly, ok := a.(*undersampleAnomaly)
+	return undersampleAnomaly, ok
+}
+
+// Attempts to cast an AnomalyInterface to a compositeAnomaly. Returns the anomaly as a compositeAnomaly and boolean indicating success.
+func AsCompositeAnomaly(a AnomalyInterface) (*compositeAnomaly, bool) {
+	compositeAnomaly, ok := a.(*compositeAnomaly)
+	return compositeAnomaly, ok
+}
+
+// Attempts to cast an AnomalyInterface to a budgetAnomaly. Returns the anomaly as a budgetAnomaly and boolean indicating success.
+func AsBudgetAnomaly(a AnomalyInterface) (*budgetAnomaly, bool) {
+	budgetAnomaly, ok := a.(*budgetAnomaly)
+	return budgetAnomaly, ok
+}
+
+// Attempts to cast an AnomalyInterface to a correlatedAnomaly. Returns the anomaly as a correlatedAnomaly and boolean indicating success.
+func AsCorrelatedAnomaly(a AnomalyInterface) (*correlatedAnomaly, bool) {
+	correlatedAnomaly, ok := a.(*correlatedAnomaly)
+	return correlatedAnomaly, ok
+}
+
+// Unmarshals a generic anomaly entry into the correct type base on the anomaly "Type" field, after upgrading
+// the entries from the Version of the container, see CurrentConfigVersion.
 func (c *Container) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	// Create the container if passed an empty pointer
 	if *c == nil {
 		*c = make(Container)
 	}
 
-	var raw map[string]map[string]interface{}
-	if err := unmarshal(&raw); err != nil {
+	var doc map[string]interface{}
+	if err := unmarshal(&doc); err != nil {
 		return err
 	}
-	// Match on the definition of the anomaly type
-	for key, value := range raw {
-		var anomaly AnomalyInterface
-		switch value["Type"].(string) {
-		case "spike":
-			anomaly = &spikeAnomaly{}
-		case "trend":
-			anomaly = &trendAnomaly{}
-		default:
-			return fmt.Errorf("unknown anomaly type: %s", value["Type"].(string))
+	raw, err := containerEntries(doc)
+	if err != nil {
+		return err
+	}
+	entries, err := expandGroups(raw)
+	if err != nil {
+		return err
+	}
+
+	// Match on the definition of the anomaly type, reporting the problems with every entry
+	var errs []error
+	for key, value := range entries {
+		anomaly, err := unmarshalAnomaly(value)
+		if err != nil {
+			errs = append(errs, FieldErrors(key, err)...)
+			continue
 		}
+		(*c)[key] = anomaly
+	}
+	errs = append(errs, c.duplicateUUIDs()...)
+
+	return errors.Join(errs...)
+}
 
-		// Convert the value map into YAML for unmarshalling into an anomaly
-		valueYAML, err := yaml.Marshal(value)
+// Returns the entries of a container with any groups replaced by their members, see expandGroup.
+func expandGroups(raw map[string]map[string]interface{}) (map[string]map[string]interface{}, error) {
+	entries := make(map[string]map[string]interface{}, len(raw))
+	for key, value := range raw {
+		if value["Type"] != "group" {
+			entries[key] = value
+		}
+	}
+	for key, value := range raw {
+		if value["Type"] != "group" {
+			continue
+		}
+		members, err := expandGroup(key, value)
 		if err != nil {
-			return err
+			return nil, err
+		}
+		for name, member := range members {
+			if _, ok := entries[name]; ok {
+				return nil, fmt.Errorf("duplicate anomaly name: %s", name)
+			}
+			entries[name] = member
 		}
+	}
+	return entries, nil
+}
 
-		// Unmarshal the YAML into the anomaly
-		if err := yaml.Unmarshal(valueYAML, anomaly); err != nil {
+// Marshals the anomalies within a container, including the "Type" field of each, so that the container
+// can be unmarshalled identically. Targets of a Correlation are omitted, as they are defined by the Correlation.
+func (c Container) MarshalYAML() (interface{}, error) {
+	return c.withoutCorrelationTargets(), nil
+}
+
+// Returns the anomalies within a container, excluding targets of a Correlation.
+func (c Container) withoutCorrelationTargets() map[string]AnomalyInterface {
+	anomalies := make(map[string]AnomalyInterface, len(c))
+	for key, anomaly := range c {
+		if _, ok := anomaly.(*correlatedAnomaly); ok {
+			continue
+		}
+		anomalies[key] = anomaly
+	}
+	return anomalies
+}
+
+// Returns an uninitialised anomaly of the type with the given name, to be unmarshalled into.
+func newAnomalyOfType(typeName string) (AnomalyInterface, error) {
+	switch typeName {
+	case "spike":
+		return &spikeAnomaly{}, nil
+	case "trend":
+		return &trendAnomaly{}, nil
+	case "harmonic":
+		return &harmonicAnomaly{}, nil
+	case "clockdrift":
+		return &clockDriftAnomaly{}, nil
+	case "invalid":
+		return &invalidAnomaly{}, nil
+	case "phaseswap":
+		return &phaseSwapAnomaly{}, nil
+	case "undersample":
+		return &undersampleAnomaly{}, nil
+	case "composite":
+		return &compositeAnomaly{}, nil
+	case "budget":
+		return &budgetAnomaly{}, nil
+	default:
+		return nil, fmt.Errorf("unknown anomaly type: %s", typeName)
+	}
+}
+
+// Unmarshals a single generic anomaly entry into the correct type based on the anomaly "Type" field.
+// Entries with an "AnomalyRef" field are first resolved from their library file, see UnmarshalWithOptions, and
+// then entries with a "Preset" field from the named preset, see PresetNames.
+func unmarshalAnomaly(value map[string]interface{}) (AnomalyInterface, error) {
+	value, err := resolveAnomalyRef(value)
+	if err != nil {
+		return nil, err
+	}
+	value, err = resolvePreset(value)
+	if err != nil {
+		return nil, err
+	}
+	typeName, _ := value["Type"].(string)
+
+	anomaly, err := newAnomalyOfType(typeName)
+	if err != nil {
+		return nil, err
+	}
+
+	// Convert the value map into YAML for unmarshalling into an anomaly
+	valueYAML, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+
+	// Unmarshal the YAML into the anomaly
+	if err := yaml.Unmarshal(valueYAML, anomaly); err != nil {
+		return nil, err
+	}
+
+	if id, ok := value["Uuid"]; ok {
+		if err := setUUIDFromString(anomaly, fmt.Sprint(id)); err != nil {
+			return nil, err
+		}
+	}
+	return anomaly, nil
+}
+
+// Sets the UUID of anomaly, as given by the "Uuid" field of its entry, returning an error if it is invalid.
+func setUUIDFromString(anomaly AnomalyInterface, s string) error {
+	id, err := uuid.Parse(s)
+	if err != nil {
+		return &FieldError{Path: "Uuid", Err: err}
+	}
+	anomaly.SetUUID(id)
+	return nil
+}
+
+// Returns an error for each anomaly within a container with the same UUID as an anomaly of an earlier name,
+// as UUIDs must identify anomalies uniquely.
+func (c Container) duplicateUUIDs() []error {
+	var errs []error
+	names := make(map[uuid.UUID]string)
+	for _, name := range c.Names() {
+		id := c[name].GetUUID()
+		if id == uuid.Nil {
+			continue
+		}
+		if other, ok := names[id]; ok {
+			errs = append(errs, &FieldError{Path: name + ".Uuid", Err: fmt.Errorf("duplicate UUID %s, also used by %s", id, other)})
+			continue
+		}
+		names[id] = name
+	}
+	return errs
+}
+
+// Unmarshals a container from json, with each anomaly unmarshalled into the correct type based on its "Type" field
+// after upgrading the entries from the Version of the container, see CurrentConfigVersion.
+func (c *Container) UnmarshalJSON(data []byte) error {
+	// Create the container if passed an empty pointer
+	if *c == nil {
+		*c = make(Container)
+	}
+
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if err := migrateJSONEntries(raw); err != nil {
+		return err
+	}
+	var errs []error
+	groups := make(map[string]map[string]interface{})
+	for key, value := range raw {
+		var group map[string]interface{}
+		if err := json.Unmarshal(value, &group); err != nil {
 			return err
 		}
+		// Groups are expanded in the same way as yaml groups, after all other entries
+		if group["Type"] == "group" {
+			groups[key] = group
+			continue
+		}
+		anomaly, err := unmarshalAnomalyJSON(value)
+		if err != nil {
+			errs = append(errs, FieldErrors(key, err)...)
+			continue
+		}
+		(*c)[key] = anomaly
+	}
 
+	members, err := expandGroups(groups)
+	if err != nil {
+		return err
+	}
+	for key, value := range members {
+		if _, ok := raw[key]; ok {
+			return fmt.Errorf("duplicate anomaly name: %s", key)
+		}
+		anomaly, err := unmarshalAnomaly(value)
+		if err != nil {
+			errs = append(errs, FieldErrors(key, err)...)
+			continue
+		}
 		(*c)[key] = anomaly
 	}
+	errs = append(errs, c.duplicateUUIDs()...)
+
+	return errors.Join(errs...)
+}
+
+// Upgrades the json anomaly entries of a container in place from the Version of the container to the latest
+// version, see popConfigVersion, and removes the Version field.
+func migrateJSONEntries(raw map[string]json.RawMessage) error {
+	doc := make(map[string]interface{}, 1)
+	if versionJSON, ok := raw["Version"]; ok {
+		var value interface{}
+		if err := json.Unmarshal(versionJSON, &value); err != nil {
+			return err
+		}
+		doc["Version"] = value
+	}
+	version, err := popConfigVersion(doc)
+	if err != nil {
+		return err
+	}
+	if _, ok := doc["Version"]; !ok {
+		delete(raw, "Version") // unless it is an anomaly named Version
+	}
+	if version == latestConfigVersion() {
+		return nil
+	}
 
+	for key, value := range raw {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(value, &entry); err != nil {
+			return err
+		}
+		if err := migrateEntry(entry, version, latestConfigVersion()); err != nil {
+			return &FieldError{Path: key, Err: err}
+		}
+		migrated, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		raw[key] = migrated
+	}
 	return nil
 }
 
-// Steps all anomalies within a container and returns the sum of their effects.
+// Unmarshals a single json anomaly entry into the correct type based on the anomaly "Type" field.
+func unmarshalAnomalyJSON(data []byte) (AnomalyInterface, error) {
+	var typed struct {
+		Type       string `json:"Type"`
+		Uuid       string `json:"Uuid"`
+		AnomalyRef string `json:"AnomalyRef"`
+		Preset     string `json:"Preset"`
+	}
+	if err := json.Unmarshal(data, &typed); err != nil {
+		return nil, err
+	}
+
+	// References to library entries and presets are resolved in the same way as yaml entries
+	if typed.AnomalyRef != "" || typed.Preset != "" {
+		var value map[string]interface{}
+		if err := json.Unmarshal(data, &value); err != nil {
+			return nil, err
+		}
+		return unmarshalAnomaly(value)
+	}
+	anomaly, err := newAnomalyOfType(typed.Type)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, anomaly); err != nil {
+		return nil, err
+	}
+	if typed.Uuid != "" {
+		if err := setUUIDFromString(anomaly, typed.Uuid); err != nil {
+			return nil, err
+		}
+	}
+	return anomaly, nil
+}
+
+// Marshals the anomalies within a container to json, including the "Type" field of each. Targets of
+// a Correlation are omitted, as they are defined by the Correlation.
+func (c Container) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.withoutCorrelationTargets())
+}
+
+// Marshals the parameters of an anomaly to json as a single object, with its type name in the "Type" field
+// and its UUID, if any, in the "Uuid" field.
+func marshalTypedJSON(typeName string, id uuid.UUID, params interface{}) ([]byte, error) {
+	paramsJSON, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(paramsJSON, &fields); err != nil {
+		return nil, err
+	}
+	typeJSON, err := json.Marshal(typeName)
+	if err != nil {
+		return nil, err
+	}
+	fields["Type"] = typeJSON
+	if id != uuid.Nil {
+		if fields["Uuid"], err = json.Marshal(id); err != nil {
+			return nil, err
+		}
+	}
+	return json.Marshal(fields)
+}
+
+// Steps all anomalies within a container and returns the sum of their effects, each limited to
+// its maximum slew rate. This is the value of a channel of 0 once the effects are blended, so only
+// additive anomalies contribute; see StepAllBlend for channels with other blend modes.
 func (c Container) StepAll(r *rand.Rand, Ts float64) float64 {
-	value := 0.0
+	return c.StepAllBlend(r, Ts, 0)
+}
+
+// Steps all anomalies within a container and returns the value of a channel with the given base value
+// once their effects, each limited to its maximum slew rate, are combined according to their blend modes.
+func (c Container) StepAllBlend(r *rand.Rand, Ts float64, base float64) float64 {
+	blend := newBlend()
+	c.stepEach(Ts, func(_ string, anomaly AnomalyInterface, stepped bool) {
+		if stepped {
+			blend.add(anomaly, anomaly.limitSlew(anomaly.stepAnomaly(r, Ts), Ts))
+		}
+	})
+	return blend.apply(base)
+}
+
+// AnomalyLabel is the ground truth of a single anomaly in a single time step.
+type AnomalyLabel struct {
+	Name   string  // name of the anomaly within its container, i.e. its UUID if added by AddAnomaly
+	Type   string  // type of the anomaly, e.g. "spike"
+	Active bool    // whether the anomaly was active this time step
+	Delta  float64 // delta of the anomaly after slew rate limiting, which is combined according to its blend mode
+}
+
+// Steps all anomalies within a container as StepAll, and also returns a label for each anomaly recording
+// whether it was active and its contribution this time step. Labels are appended to labels in order of
+// name, and the extended slice is returned. Pass a reused slice of zero length to avoid allocating each
+// time step.
+func (c Container) StepAllWithLabels(r *rand.Rand, Ts float64, labels []AnomalyLabel) (float64, []AnomalyLabel) {
+	blend := newBlend()
+	first := len(labels)
+	c.stepEach(Ts, func(key string, anomaly AnomalyInterface, stepped bool) {
+		delta := 0.0
+		if stepped {
+			delta = anomaly.limitSlew(anomaly.stepAnomaly(r, Ts), Ts)
+			blend.add(anomaly, delta)
+		}
+		labels = append(labels, AnomalyLabel{
+			Name:   key,
+			Type:   anomaly.GetTypeAsString(),
+			Active: anomaly.GetIsAnomalyActive(),
+			Delta:  delta,
+		})
+	})
+	slices.SortFunc(labels[first:], func(a, b AnomalyLabel) int {
+		return strings.Compare(a.Name, b.Name)
+	})
+	return blend.apply(0), labels
+}
+
+// Steps all anomalies within a container as StepAll, and also returns the contribution of each anomaly to the
+// total this time step as a label, in order of name, e.g. to attribute the disturbance caused by overlapping
+// anomalies. This allocates the labels each time step; use StepAllWithLabels with a reused slice instead when
+// stepping at high rates.
+func (c Container) StepAllDetailed(r *rand.Rand, Ts float64) (float64, []AnomalyLabel) {
+	return c.StepAllWithLabels(r, Ts, make([]AnomalyLabel, 0, len(c)))
+}
+
+// Steps all anomalies within a container and returns the given base value once their scalar effects
+// are blended as StepAllBlend, e.g. a base of 1 gives the factor by which harmonics are scaled. Harmonics
+// injected by anomalies implementing HarmonicInjector are appended to injections, which is returned.
+// Pass a reused slice of zero length to avoid allocating each time step.
+func (c Container) StepAllHarmonics(r *rand.Rand, Ts float64, base float64, injections []HarmonicInjection) (float64, []HarmonicInjection) {
+	blend := newBlend()
+	c.stepEach(Ts, func(_ string, anomaly AnomalyInterface, stepped bool) {
+		if !stepped {
+			return
+		}
+		injector, ok := anomaly.(HarmonicInjector)
+		if !ok {
+			blend.add(anomaly, anomaly.limitSlew(anomaly.stepAnomaly(r, Ts), Ts))
+			return
+		}
+		if injection, active := injector.stepHarmonic(r, Ts); active {
+			injections = append(injections, injection)
+		}
+	})
+	return blend.apply(base), injections
+}
+
+// Steps all anomalies within a container and returns the index of the phase assigned to each of the
+// A, B and C outputs this time step, combining the phase orders of all active anomalies implementing
+// PhaseMapper. Other anomalies are stepped, but have no effect. Phase orders of simultaneously active
+// anomalies are combined in an unspecified order, so only one should be active at a time, e.g. by
+// making them members of the same exclusive group.
+func (c Container) StepAllPhaseOrder(r *rand.Rand, Ts float64) [3]int {
+	order := [3]int{0, 1, 2}
+	c.stepEach(Ts, func(_ string, anomaly AnomalyInterface, stepped bool) {
+		if !stepped {
+			return
+		}
+		mapper, ok := anomaly.(PhaseMapper)
+		if !ok {
+			anomaly.stepAnomaly(r, Ts)
+			return
+		}
+		if mapping, active := mapper.stepPhaseOrder(r, Ts); active {
+			order = [3]int{order[mapping[0]], order[mapping[1]], order[mapping[2]]}
+		}
+	})
+	return order
+}
+
+// An anomaly within a container and its name, in the order in which the anomalies of the container are stepped.
+type containerEntry struct {
+	key     string
+	anomaly AnomalyInterface
+	pending bool // whether the anomaly is a member of an exclusive group which is yet to be stepped this time step
+}
+
+// Buffers of the entries of containers, reused between time steps so that stepping a container does not allocate.
+var entryBuffers = sync.Pool{New: func() any { return new([]containerEntry) }}
+
+// Returns the entries of a container in order of name, in buffer if it has the capacity. The position of each
+// anomaly in the order is recorded in the anomaly, so that the names are only sorted again when the anomalies
+// of the container change.
+func (c Container) sortedEntries(buffer []containerEntry) []containerEntry {
+	entries := slices.Grow(buffer[:0], len(c))[:len(c)]
+	clear(entries)
+	ordered := true
+	for key, anomaly := range c {
+		i := anomaly.getStepIndex()
+		if i < 0 || i >= len(entries) || entries[i].anomaly != nil {
+			ordered = false
+			break
+		}
+		entries[i] = containerEntry{key: key, anomaly: anomaly}
+	}
+	// every entry is filled if each anomaly has its own position, but the order is stale if the names changed
+	for i := 1; ordered && i < len(entries); i++ {
+		ordered = entries[i-1].key < entries[i].key
+	}
+	if ordered {
+		return entries
+	}
+
+	entries = entries[:0]
+	for key, anomaly := range c {
+		entries = append(entries, containerEntry{key: key, anomaly: anomaly})
+	}
+	slices.SortFunc(entries, func(a, b containerEntry) int {
+		return strings.Compare(a.key, b.key)
+	})
+	for i, entry := range entries {
+		entry.anomaly.setStepIndex(i)
+	}
+	return entries
+}
+
+// Calls step once for each anomaly within a container this time step, after applying any pending requests to
+// switch anomalies off or on. Anomalies which must not be stepped this time step,
+// because they or their container are paused by Pause or a budget, are waiting for their trigger or another
+// member of their exclusive group is active, are marked as inactive and passed to step with stepped false.
+// Otherwise step must step the anomaly. Anomalies are stepped in order of name, so that they draw from a
+// shared random number generator in the same order each run.
+// Functions set by SetOnRepeat are called once every anomaly has been stepped.
+func (c Container) stepEach(Ts float64, step func(key string, anomaly AnomalyInterface, stepped bool)) {
+	buffer := entryBuffers.Get().(*[]containerEntry)
+	entries := c.sortedEntries(*buffer)
+	c.stepEntries(entries, Ts, step)
+	clear(entries) // do not keep the anomalies alive
+	*buffer = entries[:0]
+	entryBuffers.Put(buffer)
+}
+
+// Steps the entries of a container, in order of name, see stepEach.
+func (c Container) stepEntries(entries []containerEntry, Ts float64, step func(key string, anomaly AnomalyInterface, stepped bool)) {
+	budgeted := false
+	for _, entry := range entries {
+		entry.anomaly.applyOffRequest()
+		if trigger := entry.anomaly.GetTriggeredBy(); trigger != "" {
+			entry.anomaly.updateTrigger(c[trigger])
+		}
+		if _, ok := entry.anomaly.(budgetLimiter); ok {
+			budgeted = true
+		}
+	}
+
+	if budgeted && pausedByBudget(entries, Ts) {
+		for _, entry := range entries {
+			entry.anomaly.skipStep()
+			step(entry.key, entry.anomaly, false)
+		}
+		recordBudget(entries)
+		endStep(entries, Ts)
+		return
+	}
+
+	grouped := false
+	for i := range entries {
+		entry := &entries[i]
+		switch {
+		case entry.anomaly.IsPaused(), entry.anomaly.waitingForTrigger():
+			entry.anomaly.skipStep()
+			step(entry.key, entry.anomaly, false)
+		case entry.anomaly.GetExclusiveGroup() != "":
+			entry.pending = true
+			grouped = true
+		default:
+			step(entry.key, entry.anomaly, true)
+		}
+	}
+	if grouped {
+		stepExclusive(entries, step)
+	}
+	if budgeted {
+		recordBudget(entries)
+	}
+	endStep(entries, Ts)
+}
+
+// Updates the lifetime and statistics of each anomaly within a container at the end of a time step, once every
+// anomaly has been stepped, and calls the functions set by SetOnRepeat.
+func endStep(entries []containerEntry, Ts float64) {
+	for _, entry := range entries {
+		entry.anomaly.recordStep(Ts)
+		entry.anomaly.notifyRepeats()
+	}
+}
+
+// Steps the members of exclusive groups, the entries which are pending, such that at most one member of each
+// group is active at a time. A member which was active in the previous time step holds its group until it is
+// inactive, then the other members are stepped in order of name until one of them is active. Members which are
+// not stepped are deferred, as their schedules do not progress while another member holds the group.
+func stepExclusive(entries []containerEntry, step func(key string, anomaly AnomalyInterface, stepped bool)) {
+	var heldBuffer [8]string
+	held := heldBuffer[:0] // groups with a member which is active this time step
+
+	// members active in the previous time step are stepped first
+	for i := range entries {
+		entry := &entries[i]
+		group := entry.anomaly.GetExclusiveGroup()
+		if entry.pending && entry.anomaly.GetIsAnomalyActive() && !slices.Contains(held, group) {
+			step(entry.key, entry.anomaly, true)
+			entry.pending = false
+			if entry.anomaly.GetIsAnomalyActive() {
+				held = append(held, group)
+			}
+		}
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		if !entry.pending {
+			continue
+		}
+		entry.pending = false
+		group := entry.anomaly.GetExclusiveGroup()
+		if slices.Contains(held, group) {
+			entry.anomaly.skipStep()
+			step(entry.key, entry.anomaly, false)
+			continue
+		}
+		step(entry.key, entry.anomaly, true)
+		if entry.anomaly.GetIsAnomalyActive() {
+			held = append(held, group)
+		}
+	}
+}
+
+// Returns whether the anomalies within a container, given by their entries, are paused this time step because
+// the limit of a budget anomaly within the container has been reached.
+func pausedByBudget(entries []containerEntry, Ts float64) bool {
+	paused := false
+	for _, entry := range entries {
+		if budget, ok := entry.anomaly.(budgetLimiter); ok && budget.exhausted(Ts) {
+			paused = true
+		}
+	}
+	return paused
+}
+
+// Records whether any anomaly within a container, given by their entries, was active this time step in each of
+// its budget anomalies.
+func recordBudget(entries []containerEntry) {
+	active := false
+	for _, entry := range entries {
+		if _, ok := entry.anomaly.(budgetLimiter); !ok && entry.anomaly.GetIsAnomalyActive() {
+			active = true
+			break
+		}
+	}
+	for _, entry := range entries {
+		if budget, ok := entry.anomaly.(budgetLimiter); ok {
+			budget.record(active)
+		}
+	}
+}
+
+// Returns the worst quality of samples marked by anomalies within a container this time step,
+// i.e. QualityMissing takes precedence over QualityInvalid. Should be called after StepAll.
+func (c Container) GetQuality() Quality {
+	quality := QualityGood
+	for key := range c {
+		if marker, ok := c[key].(qualityMarker); ok {
+			quality = max(quality, marker.getQuality())
+		}
+	}
+	return quality
+}
+
+// Returns whether any anomaly within a container holds the present sample, i.e. the output should
+// repeat the previous sample. Should be called after StepAll.
+func (c Container) GetHold() bool {
+	for key := range c {
+		if holder, ok := c[key].(sampleHolder); ok && holder.getHold() {
+			return true
+		}
+	}
+	return false
+}
+
+// magnitudeResolver is implemented by anomalies whose magnitude can be specified as a percentage of the nominal value of the channel.
+type magnitudeResolver interface {
+	resolveMagnitude(nominal float64) // Sets the magnitude of the anomaly from its percentage of nominal
+}
+
+// Resolves the magnitudes of anomalies within a container which are specified as a percentage of the
+// nominal value of the channel, e.g. MeanTemperature or PosSeqMag, so that one anomaly definition can be
+// reused across channels with very different scales. Targets of a Correlation are not resolved.
+func (c Container) ResolveMagnitudes(nominal float64) {
+	for key := range c {
+		if resolver, ok := c[key].(magnitudeResolver); ok {
+			resolver.resolveMagnitude(nominal)
+		}
+	}
+}
+
+// clockFollower is implemented by anomalies whose behaviour depends on the local time of day of the emulator clock.
+type clockFollower interface {
+	followsClock() bool             // Returns whether the anomaly depends on the time of day
+	setTimeOfDay(timeOfDay float64) // Sets the local time of day of the present time step in hours
+}
+
+// Returns whether any anomaly within the container depends on the local time of day, see SetTimeOfDay.
+func (c Container) FollowsClock() bool {
 	for key := range c {
-		// Do by index to not work on copy
-		value += c[key].stepAnomaly(r, Ts)
+		if follower, ok := c[key].(clockFollower); ok && follower.followsClock() {
+			return true
+		}
 	}
-	return value
+	return false
 }
 
-// Add anomaly to container with a UUID and returns the UUID.
+// Sets the local time of day of the present time step in hours, in the range [0, 24), for anomalies within
+// the container which depend on it, e.g. spikes with a time-of-day probability profile. The emulator sets
+// this every time step from its clock.
+func (c Container) SetTimeOfDay(timeOfDay float64) {
+	for key := range c {
+		if follower, ok := c[key].(clockFollower); ok {
+			follower.setTimeOfDay(timeOfDay)
+		}
+	}
+}
+
+// Converts the wall-clock schedules of anomalies within a container into start delays and durations
+// relative to the epoch, the time of the first sample. Anomalies without a wall-clock schedule are
+// unchanged. Returns an error, and switches off scheduled anomalies, if the epoch is zero.
+func (c Container) ResolveSchedules(epoch time.Time) error {
+	var errs []error
+	for key := range c {
+		if err := c[key].resolveSchedule(epoch); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Switches the named anomaly off or on at the start of the next time step. This is safe to call from a
+// control goroutine while another goroutine is stepping the emulator, unlike setting Off directly,
+// provided that anomalies are not added to or removed from the container concurrently.
+func (c Container) SetOffByName(name string, off bool) error {
+	anomaly, ok := c[name]
+	if !ok {
+		return fmt.Errorf("anomaly not found: %s", name)
+	}
+	anomaly.requestOff(off)
+	return nil
+}
+
+// Pauses every anomaly within the container from the start of the next time step, freezing their progress
+// until Resume is called, e.g. while an operator temporarily suspends fault injection. See AnomalyBase.Pause.
+func (c Container) Pause() {
+	for _, anomaly := range c {
+		anomaly.Pause()
+	}
+}
+
+// Resumes every anomaly within the container from the start of the next time step, including anomalies
+// which were paused individually.
+func (c Container) Resume() {
+	for _, anomaly := range c {
+		anomaly.Resume()
+	}
+}
+
+// Add anomaly to container with a UUID and returns the UUID. The existing UUID of the anomaly is used if it
+// has one, e.g. from its configuration, or else a new UUID is generated and set on the anomaly. If another
+// anomaly within the container already has the UUID, a new UUID is generated so that no anomaly is replaced,
+// see TryAddAnomaly.
 func (c *Container) AddAnomaly(anomaly AnomalyInterface) uuid.UUID {
-	uuid := uuid.New()
-	(*c)[uuid.String()] = anomaly
-	return uuid
+	id, err := c.TryAddAnomaly(anomaly)
+	if err != nil {
+		id = uuid.New()
+		anomaly.SetUUID(id)
+		(*c)[id.String()] = anomaly
+	}
+	return id
+}
+
+// Adds anomaly to container with a UUID and returns the UUID, as for AddAnomaly, but returns an error instead
+// if another anomaly within the container already has the UUID of anomaly.
+func (c *Container) TryAddAnomaly(anomaly AnomalyInterface) (uuid.UUID, error) {
+	if *c == nil {
+		*c = make(Container)
+	}
+	id := anomaly.GetUUID()
+	if id == uuid.Nil {
+		id = uuid.New()
+		anomaly.SetUUID(id)
+	}
+	if name, ok := c.nameOfUUID(id); ok {
+		if (*c)[name] == anomaly && name == id.String() {
+			return id, nil
+		}
+		return uuid.Nil, fmt.Errorf("uuid %s is already used by anomaly %s", id, name)
+	}
+	(*c)[id.String()] = anomaly
+	return id, nil
+}
+
+// Returns the name of the anomaly within the container with the given UUID, which is its name if it was
+// added by AddAnomaly, and whether it was found.
+func (c Container) nameOfUUID(id uuid.UUID) (string, bool) {
+	if anomaly, ok := c[id.String()]; ok && anomaly.GetUUID() == id {
+		return id.String(), true
+	}
+	for name, anomaly := range c {
+		if anomaly.GetUUID() == id {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// Returns the anomaly with the given UUID, whether it was added by AddAnomaly or given a "Uuid" in its
+// configuration, and whether it was found.
+func (c Container) GetAnomalyByUUID(id uuid.UUID) (AnomalyInterface, bool) {
+	name, ok := c.nameOfUUID(id)
+	if !ok {
+		return nil, false
+	}
+	return c[name], true
+}
+
+// Replaces the anomaly with the given UUID by anomaly, under the same name, and gives anomaly that UUID.
+// Returns an error if the container does not hold an anomaly with the given UUID, or already holds anomaly
+// under another name, which would then share the UUID.
+func (c Container) UpdateAnomalyByUUID(id uuid.UUID, anomaly AnomalyInterface) error {
+	name, ok := c.nameOfUUID(id)
+	if !ok {
+		return fmt.Errorf("anomaly not found: %s", id)
+	}
+	for other, held := range c {
+		if held == anomaly && other != name {
+			return fmt.Errorf("anomaly is already in the container as %s", other)
+		}
+	}
+	anomaly.SetUUID(id)
+	c[name] = anomaly
+	return nil
+}
+
+// Replaces the named anomaly by anomaly, or adds anomaly under name if the container has no anomaly of that
+// name. Returns an error if the container already holds anomaly under another name, or another anomaly has
+// the UUID of anomaly, as for UpdateAnomalyByUUID and TryAddAnomaly.
+func (c Container) updateAnomalyByName(name string, anomaly AnomalyInterface) error {
+	id := anomaly.GetUUID()
+	for other, held := range c {
+		if other == name {
+			continue
+		}
+		if held == anomaly {
+			return fmt.Errorf("anomaly is already in the container as %s", other)
+		}
+		if id != uuid.Nil && held.GetUUID() == id {
+			return fmt.Errorf("uuid %s is already used by anomaly %s", id, other)
+		}
+	}
+	c[name] = anomaly
+	return nil
+}
+
+// Removes the named anomaly from the container, so that it has no effect on subsequent time steps.
+// Returns an error if the container does not hold an anomaly with the given name.
+func (c Container) RemoveAnomalyByName(name string) error {
+	if _, ok := c[name]; !ok {
+		return fmt.Errorf("anomaly not found: %s", name)
+	}
+	delete(c, name)
+	return nil
+}
+
+// Removes the anomaly with the given UUID, as returned by AddAnomaly or given in its configuration, from the container.
+func (c Container) RemoveAnomalyByUUID(id uuid.UUID) error {
+	name, ok := c.nameOfUUID(id)
+	if !ok {
+		return fmt.Errorf("anomaly not found: %s", id)
+	}
+	return c.RemoveAnomalyByName(name)
+}
+
+// Removes all anomalies from the container.
+func (c Container) Clear() {
+	clear(c)
+}
+
+// Returns the number of anomalies within the container.
+func (c Container) Len() int {
+	return len(c)
+}
+
+// Returns the names of the anomalies within the container, in sorted order.
+func (c Container) Names() []string {
+	names := make([]string, 0, len(c))
+	for key := range c {
+		names = append(names, key)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Returns a container holding the anomalies of the given type, e.g. "spike", keyed by the same names.
+// The anomalies are shared with c, not copied.
+func (c Container) GetAnomaliesByType(typeName string) Container {
+	anomalies := Container{}
+	for key := range c {
+		if c[key].GetTypeAsString() == typeName {
+			anomalies[key] = c[key]
+		}
+	}
+	return anomalies
+}
+
+// Returns a container holding the anomalies which were active in the latest time step, keyed by the
+// same names. The anomalies are shared with c, not copied.
+func (c Container) GetActiveAnomalies() Container {
+	anomalies := Container{}
+	for key := range c {
+		if c[key].GetIsAnomalyActive() {
+			anomalies[key] = c[key]
+		}
+	}
+	return anomalies
+}
+
+// Returns an iterator over the names and anomalies within the container, in order of name.
+func (c Container) All() iter.Seq2[string, AnomalyInterface] {
+	return c.filter(func(AnomalyInterface) bool { return true })
+}
+
+// Returns an iterator over the names and anomalies which were active in the latest time step, in order of name.
+func (c Container) Active() iter.Seq2[string, AnomalyInterface] {
+	return c.filter(AnomalyInterface.GetIsAnomalyActive)
+}
+
+// Returns an iterator over the names and anomalies of the given type, e.g. "spike", in order of name.
+func (c Container) ByType(typeName string) iter.Seq2[string, AnomalyInterface] {
+	return c.filter(func(anomaly AnomalyInterface) bool { return anomaly.GetTypeAsString() == typeName })
+}
+
+// Returns an iterator over the names and anomalies within the container for which keep returns true, in
+// order of name.
+func (c Container) filter(keep func(AnomalyInterface) bool) iter.Seq2[string, AnomalyInterface] {
+	return func(yield func(string, AnomalyInterface) bool) {
+		for _, name := range c.Names() {
+			if keep(c[name]) && !yield(name, c[name]) {
+				return
+			}
+		}
+	}
 }
@@ -1,15 +1,35 @@
 package anomaly_test
 
 import (
+	"encoding/json"
 	"fmt"
+	"iter"
+	"math"
 	"math/rand/v2"
+	"os"
+	"path/filepath"
+	"slices"
 	"testing"
 
+	"github.com/google/uuid"
 	"github.com/stretchr/testify/assert"
 	"github.com/synaptecltd/emulator/anomaly"
 	"gopkg.in/yaml.v2"
 )
 
+// Benchmark stepping a container of several anomalies, which must not allocate each time step
+func BenchmarkContainer_StepAll(b *testing.B) {
+	trend, _ := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 10, MagFuncName: "sine"})
+	spike, _ := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 0.1, Magnitude: 1})
+	other, _ := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 2, Duration: 5})
+	container := anomaly.Container{"trend": trend, "spike": spike, "other": other}
+	r := rand.New(rand.NewPCG(1, 2))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		container.StepAll(r, 0.001)
+	}
+}
+
 // Test anomalies can be unmarshalled from yaml
 func TestUnmarshalYAML(t *testing.T) {
 	startDelay := rand.Float64()
@@ -66,6 +86,10 @@ func TestGetTypeAsString(t *testing.T) {
 	trendAnomaly, _ := anomaly.NewTrendAnomaly(anomaly.TrendParams{})
 	expected = "trend"
 	assert.Equal(t, expected, trendAnomaly.GetTypeAsString())
+
+	harmonicAnomaly, _ := anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{Order: 5})
+	expected = "harmonic"
+	assert.Equal(t, expected, harmonicAnomaly.GetTypeAsString())
 }
 
 // Test converting AnomalyInterface to trendAnomaly
@@ -93,3 +117,1622 @@ func TestAsSpikeAnomaly(t *testing.T) {
 	assert.True(t, ok)
 	assert.NotNil(t, result)
 }
+
+// Test converting AnomalyInterface to harmonicAnomaly
+func TestAsHarmonicAnomaly(t *testing.T) {
+	trendAnomaly, _ := anomaly.NewTrendAnomaly(anomaly.TrendParams{})
+	result, ok := anomaly.AsHarmonicAnomaly(trendAnomaly)
+	assert.False(t, ok)
+	assert.Nil(t, result)
+
+	harmonicAnomaly, _ := anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{Order: 5})
+	result, ok = anomaly.AsHarmonicAnomaly(harmonicAnomaly)
+	assert.True(t, ok)
+	assert.NotNil(t, result)
+}
+
+// Test harmonic anomalies reject invalid harmonic orders and functional dependence without a duration
+func TestNewHarmonicAnomaly_InvalidParams(t *testing.T) {
+	_, err := anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{Order: 0})
+	assert.Error(t, err)
+
+	_, err = anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{Order: 5, MagFuncName: "sine"})
+	assert.Error(t, err)
+
+	_, err = anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{Order: 5, MagFuncName: "sine", Duration: 1.0})
+	assert.NoError(t, err)
+}
+
+// Test harmonic anomalies can be unmarshalled from yaml
+func TestUnmarshalYAML_Harmonic(t *testing.T) {
+	yamlStr := `
+fifth:
+  Type: harmonic
+  Order: 5
+  Magnitude: 0.1
+  Angle: 0.5
+`
+	container := make(anomaly.Container)
+	err := yaml.Unmarshal([]byte(yamlStr), &container)
+	assert.NoError(t, err)
+
+	harmonicAnomaly, ok := anomaly.AsHarmonicAnomaly(container["fifth"])
+	assert.True(t, ok)
+	assert.Equal(t, 5.0, harmonicAnomaly.GetOrder())
+	assert.Equal(t, 0.1, harmonicAnomaly.Magnitude)
+	assert.Equal(t, 0.5, harmonicAnomaly.Angle)
+}
+
+// Test harmonic injections are returned separately from scalar anomaly effects
+func TestStepAllHarmonics(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 1))
+
+	harmonicAnomaly, err := anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{
+		Order:     7,
+		Magnitude: 0.05,
+		Angle:     1.0,
+	})
+	assert.NoError(t, err)
+
+	trendAnomaly, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{
+		Magnitude: 1.0,
+		Duration:  1.0,
+	})
+	assert.NoError(t, err)
+
+	container := anomaly.Container{
+		"harmonic": harmonicAnomaly,
+		"trend":    trendAnomaly,
+	}
+
+	var injections []anomaly.HarmonicInjection
+	for i := 0; i < 10; i++ {
+		var value float64
+		value, injections = container.StepAllHarmonics(r, 0.1, 0, injections[:0])
+		assert.InDelta(t, 0.1*float64(i), value, 1e-9) // only the trend contributes a scalar value
+		assert.Equal(t, []anomaly.HarmonicInjection{{Order: 7, Magnitude: 0.05, Angle: 1.0}}, injections)
+	}
+}
+
+// Test clock drift anomalies accumulate time error over each repeat, and reset when the repeat completes
+func TestClockDriftAnomaly(t *testing.T) {
+	_, err := anomaly.NewClockDriftAnomaly(anomaly.ClockDriftParams{Jitter: -1.0})
+	assert.Error(t, err)
+
+	clockDrift, err := anomaly.NewClockDriftAnomaly(anomaly.ClockDriftParams{
+		DriftPPM: 100,
+		Duration: 1.0,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "clockdrift", clockDrift.GetTypeAsString())
+
+	container := anomaly.Container{"drift": clockDrift}
+	r := rand.New(rand.NewPCG(1, 1))
+	Ts := 0.001
+	for i := 0; i < 1000; i++ {
+		timeError := container.StepAll(r, Ts)
+		assert.InDelta(t, 100e-6*float64(i)*Ts, timeError, 1e-12)
+	}
+	assert.Equal(t, uint64(1), clockDrift.GetCountRepeats())
+	assert.Equal(t, 0.0, clockDrift.GetDriftError())
+}
+
+// Test invalid data anomalies mark sample quality for their active window only
+func TestInvalidAnomaly_GetQuality(t *testing.T) {
+	missing, err := anomaly.NewInvalidAnomaly(anomaly.InvalidParams{
+		StartDelay: 0.5,
+		Duration:   0.2,
+		Repeats:    1,
+	})
+	assert.NoError(t, err)
+	flagged, err := anomaly.NewInvalidAnomaly(anomaly.InvalidParams{KeepValue: true})
+	assert.NoError(t, err)
+
+	r := rand.New(rand.NewPCG(1, 1))
+	Ts := 0.1
+
+	container := anomaly.Container{"missing": missing}
+	var qualities []anomaly.Quality
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, 0.0, container.StepAll(r, Ts))
+		qualities = append(qualities, container.GetQuality())
+	}
+	good, bad := anomaly.QualityGood, anomaly.QualityMissing
+	assert.Equal(t, []anomaly.Quality{good, good, good, good, bad, bad, good, good, good, good}, qualities)
+
+	container = anomaly.Container{"flagged": flagged}
+	container.StepAll(r, Ts)
+	assert.Equal(t, anomaly.QualityInvalid, container.GetQuality())
+
+	// missing takes precedence over invalid
+	container["missing"], _ = anomaly.NewInvalidAnomaly(anomaly.InvalidParams{})
+	container.StepAll(r, Ts)
+	assert.Equal(t, anomaly.QualityMissing, container.GetQuality())
+}
+
+// Test a correlated anomaly drives several containers with a shared state and per-target scale factors
+func TestCorrelation(t *testing.T) {
+	_, err := anomaly.NewCorrelation(nil)
+	assert.Error(t, err)
+
+	trendAnomaly, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{
+		Magnitude: 1.0,
+		Duration:  1.0,
+	})
+	assert.NoError(t, err)
+
+	correlation, err := anomaly.NewCorrelation(trendAnomaly)
+	assert.NoError(t, err)
+
+	first := anomaly.Container{"shared": correlation.NewTarget(1.0)}
+	second := anomaly.Container{"shared": correlation.NewTarget(-2.0)}
+
+	r := rand.New(rand.NewPCG(1, 1))
+	Ts := 0.1
+	for i := 0; i < 5; i++ {
+		assert.InDelta(t, 0.1*float64(i), first.StepAll(r, Ts), 1e-9)
+		assert.InDelta(t, -0.2*float64(i), second.StepAll(r, Ts), 1e-9)
+	}
+
+	// source is stepped once per time step, and its state is shared by the targets
+	assert.Equal(t, 5, trendAnomaly.GetElapsedActivatedIndex())
+	assert.Equal(t, 5, second["shared"].GetElapsedActivatedIndex())
+	assert.Equal(t, "trend", second["shared"].GetTypeAsString())
+}
+
+// Test phase swap anomalies reject invalid phase orders and return their phase order while active
+func TestPhaseSwapAnomaly(t *testing.T) {
+	for _, order := range []string{"AB", "ABD", "AAB", "ABCA"} {
+		_, err := anomaly.NewPhaseSwapAnomaly(anomaly.PhaseSwapParams{Order: order})
+		assert.Error(t, err, order)
+	}
+
+	phaseSwap, err := anomaly.NewPhaseSwapAnomaly(anomaly.PhaseSwapParams{})
+	assert.NoError(t, err)
+	assert.Equal(t, "ACB", phaseSwap.GetOrder())
+
+	rotate, err := anomaly.NewPhaseSwapAnomaly(anomaly.PhaseSwapParams{
+		Order:      "bca",
+		StartDelay: 0.2,
+		Duration:   0.2,
+		Repeats:    1,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, "BCA", rotate.GetOrder())
+
+	r := rand.New(rand.NewPCG(1, 1))
+	container := anomaly.Container{"rotate": rotate}
+	var orders [][3]int
+	for i := 0; i < 5; i++ {
+		orders = append(orders, container.StepAllPhaseOrder(r, 0.1))
+	}
+	identity, rotated := [3]int{0, 1, 2}, [3]int{1, 2, 0}
+	assert.Equal(t, [][3]int{identity, rotated, rotated, identity, identity}, orders)
+}
+
+// Test undersample anomalies hold all but every factor-th sample while active
+func TestUndersampleAnomaly_GetHold(t *testing.T) {
+	_, err := anomaly.NewUndersampleAnomaly(anomaly.UndersampleParams{Factor: 1})
+	assert.Error(t, err)
+
+	undersample, err := anomaly.NewUndersampleAnomaly(anomaly.UndersampleParams{
+		Factor:     3,
+		StartDelay: 0.2,
+	})
+	assert.NoError(t, err)
+
+	r := rand.New(rand.NewPCG(1, 1))
+	container := anomaly.Container{"undersample": undersample}
+	var holds []bool
+	for i := 0; i < 8; i++ {
+		container.StepAll(r, 0.1)
+		holds = append(holds, container.GetHold())
+	}
+	assert.Equal(t, []bool{false, false, true, true, false, true, true, false}, holds)
+}
+
+// Assert that a budget limits the fraction of samples in any window at which the other anomalies are active
+func TestBudgetAnomaly(t *testing.T) {
+	for _, params := range []anomaly.BudgetParams{{MaxFraction: 1.5, Window: 1}, {MaxFraction: 0.2}} {
+		_, err := anomaly.NewBudgetAnomaly(params)
+		assert.Error(t, err)
+	}
+
+	yamlStr := `
+spikes:
+  Type: spike
+  Probability: 1
+  Magnitude: 1
+  Sign: 1
+budget:
+  Type: budget
+  MaxFraction: 0.2
+  Window: 1
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	budget, ok := anomaly.AsBudgetAnomaly(container["budget"])
+	assert.True(t, ok)
+	assert.Equal(t, anomaly.BudgetParams{MaxFraction: 0.2, Window: 1}, budget.GetParams())
+
+	r := rand.New(rand.NewPCG(1, 1))
+	var active []bool
+	for i := 0; i < 30; i++ {
+		value := container.StepAll(r, 0.1)
+		active = append(active, len(container.GetActiveAnomalies()) > 0)
+		assert.Equal(t, active[i], value != 0)
+		assert.False(t, budget.GetIsAnomalyActive())
+	}
+
+	// at most 2 of any 10 consecutive samples are anomalous, and the budget is used in full
+	total, inWindow := 0, 0
+	for i := range active {
+		if active[i] {
+			total += 1
+			inWindow += 1
+		}
+		if i >= 10 && active[i-10] {
+			inWindow -= 1
+		}
+		assert.LessOrEqual(t, inWindow, 2)
+	}
+	assert.Equal(t, 6, total)
+}
+
+// Assert that at most one member of an exclusive group is active at a time, and that others are deferred
+func TestContainer_ExclusiveGroup(t *testing.T) {
+	yamlStr := `
+first:
+  Type: trend
+  Magnitude: 1
+  Duration: 1
+  Repeats: 1
+  ExclusiveGroup: drift
+second:
+  Type: trend
+  Magnitude: 2
+  Duration: 1
+  Repeats: 1
+  ExclusiveGroup: drift
+independent:
+  Type: trend
+  Magnitude: 4
+  Duration: 1
+  Repeats: 1
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	assert.Equal(t, "drift", container["first"].GetExclusiveGroup())
+
+	r := rand.New(rand.NewPCG(1, 1))
+	for i := 0; i < 25; i++ {
+		_, labels := container.StepAllWithLabels(r, 0.1, nil)
+		assert.False(t, labels[0].Active && labels[2].Active, i)
+		assert.Equal(t, i < 10, labels[0].Active, i)
+		assert.Equal(t, i >= 10 && i < 20, labels[2].Active, i)
+		assert.Equal(t, i < 10, labels[1].Active, i)
+	}
+
+	// stepping exclusive groups does not allocate each time step
+	assert.Zero(t, testing.AllocsPerRun(10, func() { container.StepAll(r, 0.1) }))
+}
+
+// Assert that the exclusive group of every type of anomaly is preserved when it is marshalled and unmarshalled
+func TestContainer_ExclusiveGroupAllTypes(t *testing.T) {
+	yamlStr := `
+harmonic: {Type: harmonic, Order: 5, ExclusiveGroup: group}
+clockdrift: {Type: clockdrift, ExclusiveGroup: group}
+invalid: {Type: invalid, ExclusiveGroup: group}
+phaseswap: {Type: phaseswap, ExclusiveGroup: group}
+undersample: {Type: undersample, Factor: 2, ExclusiveGroup: group}
+budget: {Type: budget, MaxFraction: 0.5, Window: 1, ExclusiveGroup: group}
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	data, err := yaml.Marshal(container)
+	assert.NoError(t, err)
+	var fromYAML anomaly.Container
+	assert.NoError(t, yaml.Unmarshal(data, &fromYAML))
+	data, err = json.Marshal(container)
+	assert.NoError(t, err)
+	var fromJSON anomaly.Container
+	assert.NoError(t, json.Unmarshal(data, &fromJSON))
+	for name := range container {
+		assert.Equal(t, "group", container[name].GetExclusiveGroup(), name)
+		assert.Equal(t, "group", fromYAML[name].GetExclusiveGroup(), name)
+		assert.Equal(t, "group", fromJSON[name].GetExclusiveGroup(), name)
+	}
+}
+
+// Assert that the trigger of every type of anomaly is preserved when it is marshalled, and budgets cannot be triggered
+func TestContainer_TriggerAllTypes(t *testing.T) {
+	yamlStr := `
+ramp: {Type: trend, Magnitude: 1, Duration: 1}
+harmonic: {Type: harmonic, Order: 5, TriggeredBy: ramp}
+clockdrift: {Type: clockdrift, TriggeredBy: ramp, TriggerOn: activate}
+invalid: {Type: invalid, TriggeredBy: ramp}
+phaseswap: {Type: phaseswap, TriggeredBy: ramp}
+undersample: {Type: undersample, Factor: 2, TriggeredBy: ramp}
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	data, err := yaml.Marshal(container)
+	assert.NoError(t, err)
+	var fromYAML anomaly.Container
+	assert.NoError(t, yaml.Unmarshal(data, &fromYAML))
+	for name := range container {
+		if name != "ramp" {
+			assert.Equal(t, "ramp", fromYAML[name].GetTriggeredBy(), name)
+		}
+	}
+	assert.Equal(t, anomaly.TriggerOnActivate, fromYAML["clockdrift"].GetTriggerOn())
+
+	budget, err := anomaly.NewBudgetAnomaly(anomaly.BudgetParams{MaxFraction: 0.5, Window: 1})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, budget.SetTrigger("ramp", ""), "budget anomalies do not support TriggeredBy")
+	assert.NoError(t, budget.SetTrigger("", ""))
+}
+
+// Assert that a triggered anomaly starts one repeat at each completion or activation of its trigger
+func TestContainer_Trigger(t *testing.T) {
+	yamlStr := `
+ramp:
+  Type: trend
+  Magnitude: 1
+  StartDelay: 0.5
+  Duration: 1
+  Repeats: 2
+burst:
+  Type: trend
+  Magnitude: 2
+  Duration: 0.3
+  TriggeredBy: ramp
+onset:
+  Type: spike
+  Probability: 1
+  Magnitude: 4
+  Sign: 1
+  Duration: 0.2
+  StartDelay: 0.1
+  TriggeredBy: ramp
+  TriggerOn: activate
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	assert.Equal(t, "ramp", container["burst"].GetTriggeredBy())
+	assert.Equal(t, anomaly.TriggerOnComplete, container["burst"].GetTriggerOn())
+
+	r := rand.New(rand.NewPCG(1, 1))
+	var bursts, onsets, ramps []int
+	for i := 0; i < 50; i++ {
+		_, labels := container.StepAllWithLabels(r, 0.1, nil)
+		for j, active := range []*[]int{&bursts, &onsets, &ramps} {
+			if labels[j].Active {
+				*active = append(*active, i)
+			}
+		}
+	}
+	// each repeat starts from the time step after the ramp completes or activates
+	assert.Equal(t, []int{4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 18, 19, 20, 21, 22, 23, 24, 25, 26, 27}, ramps)
+	assert.Equal(t, []int{14, 15, 28, 29}, bursts)
+	assert.Equal(t, []int{5, 19}, onsets)
+
+	_, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Duration: 1, TriggeredBy: "ramp", TriggerOn: "deactivate"})
+	assert.Error(t, err)
+}
+
+// Assert that members of a group inherit its schedule unless they override it
+func TestContainer_Group(t *testing.T) {
+	yamlStr := `
+fault:
+  Type: group
+  StartDelay: 10
+  Duration: 5
+  Repeats: 2
+  Members:
+    dip:
+      Type: trend
+      Magnitude: -10
+    noise:
+      Type: spike
+      Probability: 0.1
+      Magnitude: 1
+      Duration: 2
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	assert.Equal(t, []string{"fault.dip", "fault.noise"}, container.Names())
+	for name, duration := range map[string]float64{"fault.dip": 5, "fault.noise": 2} {
+		assert.Equal(t, 10.0, container[name].GetStartDelay(), name)
+		assert.Equal(t, duration, container[name].GetDuration(), name)
+	}
+	dip, _ := anomaly.AsTrendAnomaly(container["fault.dip"])
+	assert.Equal(t, uint64(2), dip.Repeats)
+
+	// groups are also expanded from json
+	var loaded anomaly.Container
+	jsonStr := `{"fault": {"Type": "group", "Duration": 5, "Members": {"dip": {"Type": "trend", "Magnitude": -10}}}}`
+	assert.NoError(t, json.Unmarshal([]byte(jsonStr), &loaded))
+	assert.Equal(t, 5.0, loaded["fault.dip"].GetDuration())
+
+	for _, invalid := range []string{
+		"fault:\n  Type: group\n  Duration: 5\n",
+		"fault:\n  Type: group\n  Magnitude: 5\n  Members:\n    dip:\n      Type: trend\n",
+		"fault:\n  Type: group\n  Members:\n    dip:\n      Type: trend\nfault.dip:\n  Type: trend\n",
+	} {
+		var c anomaly.Container
+		assert.Error(t, yaml.Unmarshal([]byte(invalid), &c), invalid)
+	}
+}
+
+// Assert that Validate reports every problem with its field path, rather than the first
+func TestValidate(t *testing.T) {
+	assert.NoError(t, anomaly.TrendParams{Duration: 1, MagFuncName: "sine"}.Validate())
+
+	err := anomaly.TrendParams{Duration: -1, StartDelay: -1, MagFuncName: "unknown"}.Validate()
+	var fieldErr *anomaly.FieldError
+	assert.ErrorAs(t, err, &fieldErr)
+	assert.Equal(t, "Duration", fieldErr.Path)
+	assert.Len(t, anomaly.FieldErrors("drift", err), 3)
+
+	err = anomaly.SpikeParams{Probability: -1, BlendMode: "xor"}.Validate()
+	assert.EqualError(t, err, "BlendMode: blend mode must be add, multiply, replace or clamp\nProbability: probability must be greater than or equal to 0")
+
+	// problems between anomalies are reported by the container
+	burst, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Duration: 1, TriggeredBy: "missing"})
+	assert.NoError(t, err)
+	loop, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Duration: 1, TriggeredBy: "loop"})
+	assert.NoError(t, err)
+	container := anomaly.Container{"burst": burst, "loop": loop}
+	assert.EqualError(t, container.Validate(),
+		"burst.TriggeredBy: anomaly not found in container: missing\nloop.TriggeredBy: anomaly cannot trigger itself")
+
+	// unmarshalling reports the problems with every entry
+	yamlStr := `
+first:
+  Type: trend
+  Duration: -1
+  StartDelay: -1
+second:
+  Type: spike
+  Probability: -1
+`
+	err = yaml.Unmarshal([]byte(yamlStr), &container)
+	assert.Len(t, anomaly.FieldErrors("", err), 3)
+	assert.ErrorContains(t, err, "first.StartDelay: ")
+	assert.ErrorContains(t, err, "second.Probability: ")
+}
+
+// Assert that anomalies can be created from presets, with parameter overrides
+func TestNewFromPreset(t *testing.T) {
+	for _, name := range anomaly.PresetNames() {
+		_, err := anomaly.NewFromPreset(name, nil)
+		assert.NoError(t, err, name)
+	}
+
+	anom, err := anomaly.NewFromPreset("storm_spikes", map[string]interface{}{"Probability": 0.01})
+	assert.NoError(t, err)
+	spikes, ok := anomaly.AsSpikeAnomaly(anom)
+	assert.True(t, ok)
+	assert.Equal(t, 0.01, spikes.GetProbability())
+	assert.Equal(t, 10.0, spikes.MagnitudePercent)
+
+	yamlStr := `
+drift:
+  Preset: slow_drift_1pct_per_day
+  Repeats: 0
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	drift, ok := anomaly.AsTrendAnomaly(container["drift"])
+	assert.True(t, ok)
+	assert.Equal(t, 86400.0, drift.GetDuration())
+	assert.Equal(t, uint64(0), drift.Repeats)
+
+	assert.NoError(t, json.Unmarshal([]byte(`{"dropout": {"Preset": "sensor_dropout_short", "Duration": 2}}`), &container))
+	assert.Equal(t, 2.0, container["dropout"].GetDuration())
+
+	_, err = anomaly.NewFromPreset("missing", nil)
+	assert.Error(t, err)
+	_, err = anomaly.NewFromPreset("storm_spikes", map[string]interface{}{"Type": "trend"})
+	assert.Error(t, err)
+}
+
+// Assert that consecutive spikes are separated by at least MinGap
+func TestSpikeAnomaly_MinGap(t *testing.T) {
+	_, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, MinGap: -1})
+	assert.Error(t, err)
+
+	spikes, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1, MinGap: 0.3})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.3, spikes.GetParams().MinGap)
+
+	r := rand.New(rand.NewPCG(1, 1))
+	container := anomaly.Container{"spikes": spikes}
+	var spikeIndices []int
+	for i := 0; i < 10; i++ {
+		if container.StepAll(r, 0.1) != 0 {
+			spikeIndices = append(spikeIndices, i)
+		}
+	}
+	assert.Equal(t, []int{0, 3, 6, 9}, spikeIndices)
+}
+
+// Assert that the magnitude and probability functions of spikes can cycle independently of the burst duration
+func TestSpikeAnomaly_FuncPeriods(t *testing.T) {
+	_, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, MagFuncPeriod: -1})
+	assert.Error(t, err)
+	_, err = anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, ProbFuncPeriod: -1})
+	assert.Error(t, err)
+
+	// a continuous burst is allowed with a magnitude function if it has its own period
+	_, err = anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, MagFuncName: "step"})
+	assert.Error(t, err)
+	_, err = anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, MagFuncName: "step", MagFuncPeriod: 0.4})
+	assert.NoError(t, err)
+
+	spikes, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{
+		Probability: 1, Magnitude: 1, SpikeSign: 1, Duration: 2, MagFuncName: "sine", MagFuncPeriod: 0.4, ProbFuncPeriod: 0.5,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, 0.4, spikes.GetParams().MagFuncPeriod)
+	assert.Equal(t, 0.5, spikes.GetParams().ProbFuncPeriod)
+
+	r := rand.New(rand.NewPCG(1, 1))
+	container := anomaly.Container{"spikes": spikes}
+	values := make([]float64, 12)
+	for i := range values {
+		values[i] = container.StepAll(r, 0.1)
+	}
+	for i, value := range values {
+		assert.InDelta(t, math.Sin(2*math.Pi*float64(i)*0.1/0.4), value, 1e-3)
+	}
+}
+
+// Assert that spike magnitudes are drawn from their amplitude distribution
+func TestSpikeAnomaly_AmplitudeDistribution(t *testing.T) {
+	_, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, AmplitudeDistribution: "cauchy"})
+	assert.Error(t, err)
+	_, err = anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, AmplitudeDistribution: "normal", AmplitudeSpread: -1})
+	assert.Error(t, err)
+
+	for _, test := range []struct {
+		distribution string
+		spread       float64
+		min, max     float64
+		median       float64
+	}{
+		{"constant", 0, 2, 2, 2},
+		{"uniform", 0.5, 1, 3, 2},
+		{"normal", 0.1, 1, 3, 2},
+		{"lognormal", 0.5, 0, math.Inf(1), 2},
+		{"exponential", 0, 0, math.Inf(1), 2 * math.Ln2},
+	} {
+		spikes, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{
+			Probability: 1, Magnitude: 2, SpikeSign: 1, AmplitudeDistribution: test.distribution, AmplitudeSpread: test.spread,
+		})
+		assert.NoError(t, err)
+		assert.Equal(t, test.distribution, spikes.GetAmplitudeDistribution())
+
+		r := rand.New(rand.NewPCG(1, 1))
+		deltas := make([]float64, 2001)
+		for i := range deltas {
+			deltas[i] = anomaly.Container{"spikes": spikes}.StepAll(r, 0.1)
+		}
+		slices.Sort(deltas)
+		assert.GreaterOrEqual(t, deltas[0], test.min, test.distribution)
+		assert.LessOrEqual(t, deltas[len(deltas)-1], test.max, test.distribution)
+		assert.InDelta(t, test.median, deltas[len(deltas)/2], 0.1, test.distribution)
+	}
+}
+
+// Assert that a container built programmatically is unmarshalled identically after marshalling to yaml
+func TestContainer_MarshalYAML(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{
+		StartDelay: 1.5, Duration: 3, Magnitude: 2, MagFuncName: "sine", InvertTrend: true, Repeats: 4,
+	})
+	assert.NoError(t, err)
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{
+		Probability: 0.2, Magnitude: 5, SpikeSign: -0.5, VaryMagnitude: true, ProbFuncName: "cosine", Duration: 1,
+	})
+	assert.NoError(t, err)
+	continuous, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 0.1, Magnitude: 1})
+	assert.NoError(t, err)
+	swap, err := anomaly.NewPhaseSwapAnomaly(anomaly.PhaseSwapParams{Order: "cab", Duration: 2})
+	assert.NoError(t, err)
+
+	container := anomaly.Container{"trend": trend, "spike": spike, "continuous": continuous, "swap": swap}
+	correlation, err := anomaly.NewCorrelation(trend)
+	assert.NoError(t, err)
+	container["correlated"] = correlation.NewTarget(2)
+
+	containerYAML, err := yaml.Marshal(container)
+	assert.NoError(t, err)
+	assert.Contains(t, string(containerYAML), "Type: trend")
+
+	var loaded anomaly.Container
+	assert.NoError(t, yaml.Unmarshal(containerYAML, &loaded))
+	assert.NotContains(t, loaded, "correlated") // targets are defined by their correlation
+	delete(container, "correlated")
+	assert.Len(t, loaded, len(container))
+
+	loadedTrend, ok := anomaly.AsTrendAnomaly(loaded["trend"])
+	assert.True(t, ok)
+	assert.Equal(t, trend.GetParams(), loadedTrend.GetParams())
+	loadedSpike, ok := anomaly.AsSpikeAnomaly(loaded["spike"])
+	assert.True(t, ok)
+	assert.Equal(t, spike.GetParams(), loadedSpike.GetParams())
+	loadedContinuous, ok := anomaly.AsSpikeAnomaly(loaded["continuous"])
+	assert.True(t, ok)
+	assert.Equal(t, continuous.GetDuration(), loadedContinuous.GetDuration())
+	loadedSwap, ok := anomaly.AsPhaseSwapAnomaly(loaded["swap"])
+	assert.True(t, ok)
+	assert.Equal(t, "CAB", loadedSwap.GetOrder())
+
+	// loaded anomalies behave identically
+	r1 := rand.New(rand.NewPCG(1, 2))
+	r2 := rand.New(rand.NewPCG(1, 2))
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, anomaly.Container{"spike": spike}.StepAll(r1, 0.1), anomaly.Container{"spike": loadedSpike}.StepAll(r2, 0.1))
+	}
+}
+
+// Assert that only anomalies with a percentage magnitude are resolved
+func TestContainer_ResolveMagnitudes(t *testing.T) {
+	percent, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Magnitude: 1, MagnitudePercent: 50})
+	assert.NoError(t, err)
+	absolute, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 3, Duration: 1})
+	assert.NoError(t, err)
+
+	container := anomaly.Container{"percent": percent, "absolute": absolute}
+	container.ResolveMagnitudes(8)
+	assert.Equal(t, 4.0, percent.Magnitude)
+	assert.Equal(t, 3.0, absolute.Magnitude)
+}
+
+// Assert that anomalies are unmarshalled from json into the correct type, and round-trip identically
+func TestContainer_JSON(t *testing.T) {
+	jsonStr := `{
+		"ramp": {"Type": "trend", "Magnitude": 2, "Duration": 5, "MagFunc": "sine", "Invert": true},
+		"blips": {"Type": "spike", "Probability": 0.1, "Magnitude": 3, "Sign": 0.5},
+		"swap": {"Type": "phaseswap", "Order": "BAC"}
+	}`
+
+	var container anomaly.Container
+	assert.NoError(t, json.Unmarshal([]byte(jsonStr), &container))
+	assert.Len(t, container, 3)
+
+	trend, ok := anomaly.AsTrendAnomaly(container["ramp"])
+	assert.True(t, ok)
+	assert.Equal(t, anomaly.TrendParams{Magnitude: 2, Duration: 5, MagFuncName: "sine", InvertTrend: true}, trend.GetParams())
+	spike, ok := anomaly.AsSpikeAnomaly(container["blips"])
+	assert.True(t, ok)
+	assert.Equal(t, 0.5, spike.GetSpikeSign())
+	_, ok = anomaly.AsPhaseSwapAnomaly(container["swap"])
+	assert.True(t, ok)
+
+	containerJSON, err := json.Marshal(container)
+	assert.NoError(t, err)
+	assert.Contains(t, string(containerJSON), `"Type":"trend"`)
+
+	var loaded anomaly.Container
+	assert.NoError(t, json.Unmarshal(containerJSON, &loaded))
+	loadedTrend, _ := anomaly.AsTrendAnomaly(loaded["ramp"])
+	assert.Equal(t, trend.GetParams(), loadedTrend.GetParams())
+	loadedSpike, _ := anomaly.AsSpikeAnomaly(loaded["blips"])
+	assert.Equal(t, spike.GetParams(), loadedSpike.GetParams())
+
+	// unknown types and invalid parameters are rejected
+	assert.Error(t, json.Unmarshal([]byte(`{"a": {"Type": "unknown"}}`), &loaded))
+	assert.Error(t, json.Unmarshal([]byte(`{"a": {"Type": "spike", "Probability": -1}}`), &loaded))
+}
+
+// Assert that the delta applied by an anomaly changes no faster than its maximum slew rate
+func TestStepAll_MaxSlewRate(t *testing.T) {
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 10, SpikeSign: 1, MaxSlewRate: 10})
+	assert.NoError(t, err)
+	container := anomaly.Container{"spike": spike}
+
+	r := rand.New(rand.NewPCG(1, 2))
+	for i := 1; i <= 15; i++ {
+		assert.InDelta(t, math.Min(float64(i), 10), container.StepAll(r, 0.1), 1e-9)
+	}
+
+	// the delta also decays at the limited rate once the anomaly stops
+	spike.Off = true
+	assert.InDelta(t, 9.0, container.StepAll(r, 0.1), 1e-9)
+
+	_, err = anomaly.NewTrendAnomaly(anomaly.TrendParams{MaxSlewRate: -1})
+	assert.Error(t, err)
+
+	// types whose parameters do not carry a slew rate are unlimited
+	invalid, err := anomaly.NewInvalidAnomaly(anomaly.InvalidParams{})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, invalid.SetMaxSlewRate(1), "invalid anomalies do not support MaxSlewRate")
+	assert.NoError(t, invalid.SetMaxSlewRate(0))
+}
+
+// Assert that anomalies can be switched off and on by name while another goroutine steps the container
+func TestContainer_SetOffByName(t *testing.T) {
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1, SpikeSign: 1})
+	assert.NoError(t, err)
+	container := anomaly.Container{"spike": spike}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	assert.NoError(t, container.SetOffByName("spike", true))
+	assert.Equal(t, 0.0, container.StepAll(r, 0.1))
+	assert.NoError(t, container.SetOffByName("spike", false))
+	assert.Equal(t, 1.0, container.StepAll(r, 0.1))
+	assert.Error(t, container.SetOffByName("missing", true))
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 1000; i++ {
+			container.SetOffByName("spike", i%2 == 0)
+		}
+	}()
+	for i := 0; i < 1000; i++ {
+		container.StepAll(r, 0.1)
+	}
+	<-done
+
+	container.SetOffByName("spike", false)
+	assert.Equal(t, 1.0, container.StepAll(r, 0.1))
+}
+
+// Assert that paused anomalies have no effect and continue where they left off when resumed
+func TestContainer_Pause(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 1})
+	assert.NoError(t, err)
+	container := anomaly.Container{"trend": trend}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	step := func(n int) []float64 {
+		deltas := make([]float64, n)
+		for i := range deltas {
+			deltas[i] = container.StepAll(r, 0.1)
+		}
+		return deltas
+	}
+	assert.InDeltaSlice(t, []float64{0, 0.1, 0.2}, step(3), 1e-9)
+
+	container.Pause()
+	assert.True(t, trend.IsPaused())
+	assert.Equal(t, []float64{0, 0, 0}, step(3))
+	assert.False(t, trend.GetIsAnomalyActive())
+	assert.Equal(t, 3, trend.GetElapsedActivatedIndex())
+
+	container.Resume()
+	assert.False(t, trend.IsPaused())
+	assert.InDeltaSlice(t, []float64{0.3, 0.4}, step(2), 1e-9)
+
+	trend.Pause()
+	assert.Equal(t, []float64{0}, step(1))
+	trend.Resume()
+	assert.InDeltaSlice(t, []float64{0.5}, step(1), 1e-9)
+}
+
+// Assert that the progress of an anomaly through its present repeat and its remaining repeats are reported
+func TestAnomaly_Progress(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 0.5, StartDelay: 0.2, Repeats: 2})
+	assert.NoError(t, err)
+	container := anomaly.Container{"trend": trend}
+	r := rand.New(rand.NewPCG(1, 2))
+	assert.Equal(t, uint64(2), trend.GetRemainingRepeats())
+
+	var progress []float64
+	var remaining []uint64
+	for i := 0; i < 8; i++ {
+		container.StepAll(r, 0.1)
+		progress = append(progress, trend.GetProgress())
+		remaining = append(remaining, trend.GetRemainingRepeats())
+	}
+	assert.InDeltaSlice(t, []float64{0, 0, 0.2, 0.4, 0.6, 0.8, 0, 0}, progress, 1e-9)
+	assert.Equal(t, []uint64{2, 2, 2, 2, 2, 1, 1, 1}, remaining)
+
+	assert.InDelta(t, 0.8, trend.GetTotalElapsedTime(), 1e-9)
+	assert.InDelta(t, 0.6, trend.GetTotalActiveTime(), 1e-9)
+
+	for i := 0; i < 10; i++ {
+		container.StepAll(r, 0.1)
+	}
+	assert.InDelta(t, 1.8, trend.GetTotalElapsedTime(), 1e-9)
+	assert.InDelta(t, 1.0, trend.GetTotalActiveTime(), 1e-9)
+
+	infinite, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 0.5})
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(math.MaxUint64), infinite.GetRemainingRepeats())
+}
+
+// Assert that the function set by SetOnRepeat is called with the number of each completed repeat
+func TestAnomaly_OnRepeat(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, MagFuncName: "step", Duration: 0.2, Repeats: 3})
+	assert.NoError(t, err)
+	container := anomaly.Container{"trend": trend}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	var repeats []uint64
+	trend.SetOnRepeat(func(repeat uint64) {
+		repeats = append(repeats, repeat)
+		trend.Magnitude *= 2 // escalate after each repeat
+	})
+
+	var deltas []float64
+	for i := 0; i < 10; i++ {
+		deltas = append(deltas, container.StepAll(r, 0.1))
+	}
+	assert.Equal(t, []uint64{1, 2, 3}, repeats)
+	assert.Equal(t, []float64{0, 1, 0, 2, 0, 4, 0, 0, 0, 0}, deltas)
+}
+
+// Assert that control messages pending on a channel are applied to a container in order
+func TestContainer_ApplyControl(t *testing.T) {
+	newSpike := func(magnitude float64) anomaly.AnomalyInterface {
+		spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: magnitude, SpikeSign: 1})
+		assert.NoError(t, err)
+		return spike
+	}
+	container := anomaly.Container{"spike": newSpike(1)}
+	r := rand.New(rand.NewPCG(1, 2))
+	messages := make(chan anomaly.ControlMessage, 10)
+
+	errs := make(chan error, 10)
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlDisable, Err: errs}
+	assert.True(t, container.ApplyControl(messages))
+	assert.Equal(t, 0.0, container.StepAll(r, 0.1))
+	assert.NoError(t, <-errs)
+
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlEnable}
+	messages <- anomaly.ControlMessage{Name: "other", Action: anomaly.ControlUpdate, Anomaly: newSpike(2)}
+	assert.True(t, container.ApplyControl(messages))
+	assert.Equal(t, 3.0, container.StepAll(r, 0.1))
+
+	messages <- anomaly.ControlMessage{Name: "missing", Action: anomaly.ControlEnable, Err: errs}
+	messages <- anomaly.ControlMessage{Name: "spike", Action: "explode", Err: errs}
+	messages <- anomaly.ControlMessage{Name: "other", Action: anomaly.ControlUpdate, Err: errs}
+	container.ApplyControl(messages)
+	assert.ErrorContains(t, <-errs, "anomaly not found: missing")
+	assert.ErrorContains(t, <-errs, "unknown control action")
+	assert.ErrorContains(t, <-errs, "must not be nil")
+
+	// updates cannot hold an anomaly under two names or give two anomalies the same UUID
+	container["spike"].SetUUID(uuid.New())
+	duplicate := newSpike(5)
+	duplicate.SetUUID(container["spike"].GetUUID())
+	messages <- anomaly.ControlMessage{Name: "other", Action: anomaly.ControlUpdate, Anomaly: container["spike"], Err: errs}
+	messages <- anomaly.ControlMessage{Name: "third", Action: anomaly.ControlUpdate, Anomaly: duplicate, Err: errs}
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlUpdate, Anomaly: duplicate, Err: errs}
+	container.ApplyControl(messages)
+	assert.ErrorContains(t, <-errs, "already in the container as spike")
+	assert.ErrorContains(t, <-errs, "is already used by anomaly spike")
+	assert.NoError(t, <-errs)
+	assert.Len(t, container, 2)
+	assert.Same(t, duplicate, container["spike"])
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlUpdate, Anomaly: newSpike(1)}
+	container.ApplyControl(messages)
+
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlUpdate, Anomaly: newSpike(1), Err: errs}
+	anomaly.Container(nil).ApplyControl(messages)
+	assert.ErrorContains(t, <-errs, "nil container")
+
+	// a closed channel is reported after its pending messages are applied
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlDisable}
+	close(messages)
+	assert.False(t, container.ApplyControl(messages))
+	assert.Equal(t, 2.0, container.StepAll(r, 0.1))
+}
+
+// Assert that anomalies can be removed from a container by name or UUID, or all at once
+func TestContainer_RemoveAnomaly(t *testing.T) {
+	newSpike := func() anomaly.AnomalyInterface {
+		spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1, SpikeSign: 1})
+		assert.NoError(t, err)
+		return spike
+	}
+	container := anomaly.Container{"named": newSpike()}
+	id := container.AddAnomaly(newSpike())
+	r := rand.New(rand.NewPCG(1, 2))
+	assert.Equal(t, 2.0, container.StepAll(r, 0.1))
+
+	assert.NoError(t, container.RemoveAnomalyByName("named"))
+	assert.Equal(t, 1.0, container.StepAll(r, 0.1))
+	assert.Error(t, container.RemoveAnomalyByName("named"))
+
+	assert.NoError(t, container.RemoveAnomalyByUUID(id))
+	assert.Equal(t, 0.0, container.StepAll(r, 0.1))
+	assert.Empty(t, container)
+
+	container.AddAnomaly(newSpike())
+	container.Clear()
+	assert.Empty(t, container)
+	assert.Equal(t, 0.0, container.StepAll(r, 0.1))
+}
+
+// Assert that UUIDs given in configurations are preserved, can be used to find anomalies and must be unique
+func TestContainer_UUID(t *testing.T) {
+	const id = "6f1c2b7e-3d4a-4b8e-9f10-2a3b4c5d6e7f"
+	config := `
+drift:
+  Type: trend
+  Uuid: ` + id + `
+  Magnitude: 1
+  Duration: 1
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(config), &container))
+	found, ok := container.GetAnomalyByUUID(uuid.MustParse(id))
+	assert.True(t, ok)
+	assert.Same(t, container["drift"], found)
+
+	// preserved through yaml and json
+	data, err := yaml.Marshal(container)
+	assert.NoError(t, err)
+	var fromYAML anomaly.Container
+	assert.NoError(t, yaml.Unmarshal(data, &fromYAML))
+	assert.Equal(t, uuid.MustParse(id), fromYAML["drift"].GetUUID())
+	data, err = json.Marshal(container)
+	assert.NoError(t, err)
+	var fromJSON anomaly.Container
+	assert.NoError(t, json.Unmarshal(data, &fromJSON))
+	assert.Equal(t, uuid.MustParse(id), fromJSON["drift"].GetUUID())
+
+	// replaced under the same name, keeping the UUID
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, container.UpdateAnomalyByUUID(uuid.MustParse(id), spike))
+	assert.Same(t, spike, container["drift"])
+	assert.Equal(t, uuid.MustParse(id), spike.GetUUID())
+	assert.Error(t, container.UpdateAnomalyByUUID(uuid.New(), spike))
+	_, ok = container.GetAnomalyByUUID(uuid.New())
+	assert.False(t, ok)
+
+	assert.NoError(t, container.RemoveAnomalyByUUID(uuid.MustParse(id)))
+	assert.Empty(t, container)
+
+	// AddAnomaly uses the existing UUID of an anomaly, or else gives it a new one
+	assert.Equal(t, uuid.MustParse(id), container.AddAnomaly(fromJSON["drift"]))
+	spike.SetUUID(uuid.Nil)
+	added := container.AddAnomaly(spike)
+	assert.NotEqual(t, uuid.Nil, added)
+	assert.Equal(t, added, spike.GetUUID())
+	assert.Len(t, container, 2)
+
+	err = yaml.Unmarshal([]byte(config+`
+copy:
+  Type: spike
+  Uuid: `+id+`
+`), &anomaly.Container{})
+	assert.ErrorContains(t, err, "drift.Uuid: duplicate UUID")
+	err = yaml.Unmarshal([]byte("bad:\n  Type: spike\n  Uuid: not-a-uuid\n"), &anomaly.Container{})
+	assert.ErrorContains(t, err, "bad.Uuid")
+}
+
+// Assert that adding or updating anomalies never replaces another anomaly or duplicates its UUID
+func TestContainer_DuplicateUUID(t *testing.T) {
+	newSpike := func(id uuid.UUID) anomaly.AnomalyInterface {
+		spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1})
+		assert.NoError(t, err)
+		spike.SetUUID(id)
+		return spike
+	}
+	id := uuid.New()
+	first := newSpike(id)
+	container := anomaly.Container{"named": first}
+
+	_, err := container.TryAddAnomaly(newSpike(id))
+	assert.ErrorContains(t, err, "named")
+	assert.Len(t, container, 1)
+
+	// AddAnomaly gives the anomaly a new UUID instead
+	second := newSpike(id)
+	added := container.AddAnomaly(second)
+	assert.NotEqual(t, id, added)
+	assert.Equal(t, added, second.GetUUID())
+	assert.Len(t, container, 2)
+	found, _ := container.GetAnomalyByUUID(id)
+	assert.Same(t, first, found)
+
+	// adding the same anomaly again leaves it in place
+	again, err := container.TryAddAnomaly(second)
+	assert.NoError(t, err)
+	assert.Equal(t, added, again)
+	assert.Len(t, container, 2)
+
+	// an anomaly already in the container cannot take the UUID of another
+	assert.Error(t, container.UpdateAnomalyByUUID(id, second))
+	assert.Equal(t, added, second.GetUUID())
+	found, _ = container.GetAnomalyByUUID(id)
+	assert.Same(t, first, found)
+}
+
+// Assert that a container restored from an exported state continues exactly where the original left off
+func TestContainer_ExportState(t *testing.T) {
+	newContainer := func() anomaly.Container {
+		spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 0.3, Magnitude: 1, Seed: 7, AmplitudeDistribution: "normal", MinGap: 0.2})
+		assert.NoError(t, err)
+		trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 0.7, StartDelay: 0.3, Repeats: 3, HoldAtEnd: true})
+		assert.NoError(t, err)
+		budget, err := anomaly.NewBudgetAnomaly(anomaly.BudgetParams{MaxFraction: 0.8, Window: 1})
+		assert.NoError(t, err)
+		return anomaly.Container{"spike": spike, "trend": trend, "budget": budget}
+	}
+	r := rand.New(rand.NewPCG(1, 2))
+	original := newContainer()
+	for i := 0; i < 25; i++ {
+		original.StepAll(r, 0.1)
+	}
+
+	state, err := original.ExportState()
+	assert.NoError(t, err)
+	restored := newContainer()
+	assert.NoError(t, restored.ImportState(state))
+	assert.Equal(t, original["trend"].GetCountRepeats(), restored["trend"].GetCountRepeats())
+
+	for i := 0; i < 50; i++ {
+		assert.Equal(t, original.StepAll(r, 0.1), restored.StepAll(r, 0.1))
+	}
+
+	delete(restored, "budget")
+	restored["other"] = original["spike"]
+	err = restored.ImportState(state)
+	assert.ErrorContains(t, err, "budget: anomaly not found in container")
+	assert.ErrorContains(t, err, "other: anomaly not found in state")
+}
+
+// Assert that the state of anomalies using stateful functions, which cannot be restored exactly, is not exported
+func TestAnomaly_ExportStateStatefulFunction(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 1, MagFuncName: "sum(linear, random_walk)"})
+	assert.NoError(t, err)
+	_, err = trend.ExportState()
+	assert.EqualError(t, err, "state of stateful function sum(linear, random_walk) cannot be exported")
+
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 0.5, Magnitude: 1, ProbFuncName: "pink_noise"})
+	assert.NoError(t, err)
+	_, err = anomaly.Container{"spike": spike}.ExportState()
+	assert.ErrorContains(t, err, "spike: state of stateful function pink_noise cannot be exported")
+
+	harmonic, err := anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{Order: 5, Magnitude: 1, Duration: 1, MagFuncName: "ar(0.9)"})
+	assert.NoError(t, err)
+	_, err = harmonic.ExportState()
+	assert.Error(t, err)
+
+	// stateless functions are exported
+	assert.NoError(t, harmonic.SetMagFunctionByName("gaussian_noise"))
+	_, err = harmonic.ExportState()
+	assert.NoError(t, err)
+}
+
+// Assert that statistics record the activations of an anomaly and the deltas it applied
+func TestAnomaly_GetStats(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: -1, Duration: 0.5, StartDelay: 0.3, Repeats: 2})
+	assert.NoError(t, err)
+	container := anomaly.Container{"trend": trend}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	total := 0.0
+	for i := 0; i < 20; i++ {
+		total += container.StepAll(r, 0.1)
+	}
+	stats := trend.GetStats()
+	assert.Equal(t, uint64(2), stats.Activations)
+	assert.Equal(t, uint64(10), stats.ActiveSamples)
+	assert.InDelta(t, total, stats.SumDelta, 1e-9)
+	assert.InDelta(t, -0.8, stats.PeakDelta, 1e-9)
+
+	// the source of a correlation is recorded once per time step, however many targets there are
+	correlation, err := anomaly.NewCorrelation(trend)
+	assert.NoError(t, err)
+	targets := anomaly.Container{"a": correlation.NewTarget(1), "b": correlation.NewTarget(2)}
+	targets.StepAll(r, 0.1)
+	assert.InDelta(t, 2.1, trend.GetTotalElapsedTime(), 1e-9)
+}
+
+// Assert that previews render the delta of an anomaly without changing its live state
+func TestPreview(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 0.5, StartDelay: 0.3, Repeats: 1})
+	assert.NoError(t, err)
+	container := anomaly.Container{"trend": trend}
+	container.StepAll(rand.New(rand.NewPCG(1, 2)), 0.1)
+
+	samples := anomaly.Preview(trend, 0.1, 8, 1)
+	assert.InDeltaSlice(t, []float64{0, 0, 0.2, 0.4, 0.6, 0.8, 0, 0}, samples, 1e-9)
+	assert.Equal(t, 1, trend.GetStartDelayIndex())
+
+	// triggered anomalies follow their own schedule
+	assert.NoError(t, trend.SetTrigger("other", anomaly.TriggerOnComplete))
+	assert.Equal(t, samples, anomaly.Preview(trend, 0.1, 8, 1))
+	assert.Equal(t, "other", trend.GetTriggeredBy())
+
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 0.5, Magnitude: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, anomaly.Preview(spike, 0.1, 20, 3), anomaly.Preview(spike, 0.1, 20, 3))
+
+	correlation, err := anomaly.NewCorrelation(trend)
+	assert.NoError(t, err)
+	samples = anomaly.Preview(correlation.NewTarget(-2), 0.1, 8, 1)
+	assert.InDeltaSlice(t, []float64{0, 0, -0.4, -0.8, -1.2, -1.6, 0, 0}, samples, 1e-9)
+
+	assert.Nil(t, anomaly.Preview(spike, 0, 10, 1))
+	assert.Nil(t, anomaly.Preview(spike, 0.1, -1, 1))
+}
+
+// Assert that anomalies using custom Go functions, which are not registered by name, can be previewed
+func TestPreview_CustomFunction(t *testing.T) {
+	double := func(t float64, amplitude float64, period float64) float64 { return 2 * amplitude }
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 0.5, Repeats: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, trend.SetMagFunction(double, "double"))
+	assert.InDeltaSlice(t, []float64{2, 2, 2, 2, 2, 0}, anomaly.Preview(trend, 0.1, 6, 1), 1e-9)
+
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1, SpikeSign: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, spike.SetMagFunction(double, "double"))
+	assert.InDeltaSlice(t, []float64{2, 2}, anomaly.Preview(spike, 0.1, 2, 1), 1e-9)
+
+	harmonic, err := anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{Order: 5, Magnitude: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, harmonic.SetMagFunction(double, "double"))
+	assert.Len(t, anomaly.Preview(harmonic, 0.1, 2, 1), 2)
+
+	composite, err := anomaly.NewCompositeAnomaly(anomaly.CompositeParams{Children: anomaly.List{trend}})
+	assert.NoError(t, err)
+	assert.InDeltaSlice(t, []float64{2, 2, 2, 2, 2, 0}, anomaly.Preview(composite, 0.1, 6, 1), 1e-9)
+	assert.Equal(t, "double", trend.GetParams().MagFuncName)
+}
+
+// Assert that anomalies within a container can be queried by name, type and activity
+func TestContainer_Queries(t *testing.T) {
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1})
+	assert.NoError(t, err)
+	delayed, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1, StartDelay: 10})
+	assert.NoError(t, err)
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 1})
+	assert.NoError(t, err)
+	container := anomaly.Container{"spike": spike, "delayed": delayed, "trend": trend}
+
+	assert.Equal(t, 3, container.Len())
+	assert.Equal(t, []string{"delayed", "spike", "trend"}, container.Names())
+	assert.Equal(t, []string{"delayed", "spike"}, container.GetAnomaliesByType("spike").Names())
+	assert.Empty(t, container.GetAnomaliesByType("harmonic"))
+
+	container.StepAll(rand.New(rand.NewPCG(1, 2)), 0.1)
+	assert.Equal(t, []string{"spike", "trend"}, container.GetActiveAnomalies().Names())
+
+	names := func(seq iter.Seq2[string, anomaly.AnomalyInterface]) []string {
+		var names []string
+		for name, a := range seq {
+			assert.Same(t, container[name], a)
+			names = append(names, name)
+		}
+		return names
+	}
+	assert.Equal(t, []string{"delayed", "spike", "trend"}, names(container.All()))
+	assert.Equal(t, []string{"spike", "trend"}, names(container.Active()))
+	assert.Equal(t, []string{"delayed", "spike"}, names(container.ByType("spike")))
+	assert.Empty(t, names(container.ByType("harmonic")))
+
+	for name := range container.All() {
+		assert.Equal(t, "delayed", name) // stops when the loop breaks
+		break
+	}
+}
+
+// Assert that labels record the activity and contribution of each anomaly every time step
+func TestStepAllWithLabels(t *testing.T) {
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 2, SpikeSign: 1})
+	assert.NoError(t, err)
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 1, StartDelay: 0.3})
+	assert.NoError(t, err)
+	container := anomaly.Container{"spike": spike, "trend": trend}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	var labels []anomaly.AnomalyLabel
+	var trendActive []bool
+	for i := 0; i < 5; i++ {
+		var value float64
+		value, labels = container.StepAllWithLabels(r, 0.1, labels[:0])
+		assert.Len(t, labels, 2)
+		assert.Equal(t, anomaly.AnomalyLabel{Name: "spike", Type: "spike", Active: true, Delta: 2}, labels[0])
+		assert.Equal(t, "trend", labels[1].Name)
+		assert.Equal(t, trend.GetIsAnomalyActive(), labels[1].Active)
+		assert.Equal(t, value, labels[0].Delta+labels[1].Delta)
+		trendActive = append(trendActive, labels[1].Active)
+	}
+	assert.False(t, trendActive[0])
+	assert.True(t, trendActive[4])
+}
+
+// Assert that anomalies are stepped in order of name, also after the anomalies of a container change
+func TestContainer_StepOrder(t *testing.T) {
+	var order []string
+	newTrend := func(name string) anomaly.AnomalyInterface {
+		trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 0.1})
+		assert.NoError(t, err)
+		trend.SetOnRepeat(func(uint64) { order = append(order, name) })
+		return trend
+	}
+	first, second := newTrend("first"), newTrend("second")
+	container := anomaly.Container{"b": first, "c": second}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	container.StepAll(r, 0.1)
+	container.StepAll(r, 0.1)
+	assert.Equal(t, []string{"first", "second", "first", "second"}, order)
+
+	// renamed, so that the order recorded in the anomalies is stale
+	order = nil
+	delete(container, "c")
+	container["a"] = second
+	container.StepAll(r, 0.1)
+	assert.Equal(t, []string{"second", "first"}, order)
+
+	order = nil
+	container["ab"] = newTrend("third")
+	container.StepAll(r, 0.1)
+	assert.Equal(t, []string{"second", "third", "first"}, order)
+}
+
+// Assert that StepAllDetailed attributes the total to the anomalies which contributed to it
+func TestStepAllDetailed(t *testing.T) {
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 2, SpikeSign: 1})
+	assert.NoError(t, err)
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, MagFuncName: "step", Duration: 0.2})
+	assert.NoError(t, err)
+	container := anomaly.Container{"spike": spike, "trend": trend}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	container.StepAll(r, 0.1)
+	total, contributions := container.StepAllDetailed(r, 0.1)
+	assert.Equal(t, 3.0, total)
+	assert.Equal(t, []anomaly.AnomalyLabel{
+		{Name: "spike", Type: "spike", Active: true, Delta: 2},
+		{Name: "trend", Type: "trend", Active: true, Delta: 1},
+	}, contributions)
+}
+
+// Assert that the effects of anomalies are combined with the channel according to their blend modes
+func TestStepAllBlend(t *testing.T) {
+	newSpike := func(magnitude float64, mode string) anomaly.AnomalyInterface {
+		spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: magnitude, SpikeSign: 1, BlendMode: mode})
+		assert.NoError(t, err)
+		return spike
+	}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	container := anomaly.Container{"add": newSpike(2, ""), "multiply": newSpike(0.5, anomaly.BlendMultiply)}
+	assert.Equal(t, 18.0, container.StepAllBlend(r, 0.1, 10))
+	assert.Equal(t, 3.0, container.StepAll(r, 0.1)) // (0 + 2) * 1.5
+
+	container["clamp"] = newSpike(-15, anomaly.BlendClamp)
+	assert.Equal(t, 15.0, container.StepAllBlend(r, 0.1, 10))
+	assert.Equal(t, -15.0, container.StepAllBlend(r, 0.1, -20))
+
+	container["replace"] = newSpike(4, anomaly.BlendReplace)
+	assert.Equal(t, 4.0, container.StepAllBlend(r, 0.1, 10))
+
+	// replacing and clamping anomalies have no effect while inactive
+	container.SetOffByName("replace", true)
+	container.SetOffByName("clamp", true)
+	assert.Equal(t, 18.0, container.StepAllBlend(r, 0.1, 10))
+
+	_, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{BlendMode: "divide"})
+	assert.Error(t, err)
+
+	// types whose parameters do not carry a blend mode only add
+	harmonic, err := anomaly.NewHarmonicAnomaly(anomaly.HarmonicParams{Order: 5, Magnitude: 0.1})
+	assert.NoError(t, err)
+	assert.ErrorContains(t, harmonic.SetBlendMode(anomaly.BlendMultiply), "harmonic anomalies do not support BlendMode")
+	assert.NoError(t, harmonic.SetBlendMode(anomaly.BlendAdd))
+	assert.Equal(t, anomaly.BlendAdd, harmonic.GetBlendMode())
+}
+
+// Assert that ramp times fade the delta of an anomaly in and out at the edges of each repeat
+func TestAnomaly_Ramp(t *testing.T) {
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: 1, SpikeSign: 1, Duration: 1, RampIn: 0.4, RampOut: 0.2})
+	assert.NoError(t, err)
+	container := anomaly.Container{"spike": spike}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	deltas := make([]float64, 9)
+	for i := range deltas {
+		deltas[i] = container.StepAll(r, 0.1)
+	}
+	assert.InDeltaSlice(t, []float64{0, 0.25, 0.5, 0.75, 1, 1, 1, 1, 0.5}, deltas, 1e-9)
+
+	_, err = anomaly.NewTrendAnomaly(anomaly.TrendParams{Duration: 1, RampIn: -1})
+	assert.Error(t, err)
+}
+
+// Assert that a trend anomaly holds its final delta between repeats and after its last repeat
+func TestTrendAnomaly_HoldAtEnd(t *testing.T) {
+	for _, test := range []struct {
+		holdAtEnd bool
+		expected  []float64
+	}{
+		{false, []float64{0, 0, 0.2, 0.4, 0.6, 0.8, 0, 0, 0.2, 0.4, 0.6, 0.8, 0, 0}},
+		{true, []float64{0, 0, 0.2, 0.4, 0.6, 0.8, 0.8, 0, 0.2, 0.4, 0.6, 0.8, 0.8, 0.8}},
+	} {
+		trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 0.5, StartDelay: 0.3, Repeats: 2, HoldAtEnd: test.holdAtEnd})
+		assert.NoError(t, err)
+		assert.Equal(t, test.holdAtEnd, trend.GetParams().HoldAtEnd)
+		container := anomaly.Container{"trend": trend}
+		r := rand.New(rand.NewPCG(1, 1))
+
+		deltas := make([]float64, len(test.expected))
+		for i := range deltas {
+			deltas[i] = container.StepAll(r, 0.1)
+		}
+		assert.InDeltaSlice(t, test.expected, deltas, 1e-9)
+	}
+}
+
+// Assert that the repeats of a trend anomaly accumulate, each starting from the end of the previous repeat
+func TestTrendAnomaly_Accumulate(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{
+		Magnitude: 1, MagFuncName: "step", Duration: 0.4, StartDelay: 0.2, Repeats: 3, Accumulate: true, HoldAtEnd: true,
+	})
+	assert.NoError(t, err)
+	assert.True(t, trend.GetParams().Accumulate)
+	container := anomaly.Container{"trend": trend}
+	r := rand.New(rand.NewPCG(1, 1))
+
+	deltas := make([]float64, 16)
+	for i := range deltas {
+		deltas[i] = container.StepAll(r, 0.1)
+	}
+	assert.InDeltaSlice(t, []float64{0, 0, 0, 1, 1, 1, 1, 1, 2, 2, 2, 2, 2, 3, 3, 3}, deltas, 1e-9)
+}
+
+// Assert that anomalies can use custom functions which are not registered by name
+func TestAnomaly_SetMagFunction(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 2, Duration: 1})
+	assert.NoError(t, err)
+	assert.Error(t, trend.SetMagFunction(nil, "constant"))
+	assert.Error(t, trend.SetMagFunction(func(t, A, T float64) float64 { return A }, ""))
+
+	constant := func(t, A, T float64) float64 { return A }
+	assert.NoError(t, trend.SetMagFunction(constant, "constant"))
+	assert.Equal(t, "constant", trend.GetParams().MagFuncName)
+
+	container := anomaly.Container{"trend": trend}
+	r := rand.New(rand.NewPCG(1, 1))
+	for i := 0; i < 5; i++ {
+		assert.Equal(t, 2.0, container.StepAll(r, 0.1))
+	}
+
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Magnitude: 1, SpikeSign: 1, Duration: 1})
+	assert.NoError(t, err)
+	assert.NoError(t, spike.SetProbFunction(func(t, A, T float64) float64 { return 1 }, "always"))
+	assert.Equal(t, 1.0, anomaly.Container{"spike": spike}.StepAll(r, 0.1))
+}
+
+// Assert that the delay before each repeat is perturbed within the range of the start delay jitter
+func TestAnomaly_StartDelayJitter(t *testing.T) {
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 0.5, StartDelay: 1, StartDelayJitter: 0.5})
+	assert.NoError(t, err)
+	container := anomaly.Container{"trend": trend}
+	r := rand.New(rand.NewPCG(1, 2))
+
+	var gaps []int
+	gap := 0
+	for i := 0; i < 1000; i++ {
+		container.StepAll(r, 0.1)
+		if trend.GetIsAnomalyActive() {
+			if gap > 0 {
+				gaps = append(gaps, gap)
+			}
+			gap = 0
+		} else {
+			gap++
+		}
+	}
+	assert.Greater(t, len(gaps), 10)
+	for _, gap := range gaps {
+		assert.GreaterOrEqual(t, gap, 4) // 1 - 0.5 seconds, less the sample at which the delay is checked
+		assert.LessOrEqual(t, gap, 15)
+	}
+	assert.NotEqual(t, slices.Min(gaps), slices.Max(gaps))
+
+	_, err = anomaly.NewSpikeAnomaly(anomaly.SpikeParams{StartDelayJitter: -1})
+	assert.Error(t, err)
+}
+
+// Assert that the probability of spikes follows the daily probability function and profile at the time of day set by the clock
+func TestSpikeAnomaly_TimeOfDay(t *testing.T) {
+	spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 0.5, DailyProbFuncName: "square"})
+	assert.NoError(t, err)
+	container := anomaly.Container{"spike": spike}
+	assert.True(t, container.FollowsClock())
+
+	container.SetTimeOfDay(6)
+	assert.Equal(t, 0.5, spike.FetchProbability())
+	container.SetTimeOfDay(18)
+	assert.Equal(t, 0.5, math.Abs(spike.FetchProbability()))
+
+	profile := []anomaly.HourProbability{{Hour: 12, Probability: 0.2}, {Hour: 3, Probability: 0.1}}
+	assert.NoError(t, spike.SetProbProfile(profile))
+	assert.NoError(t, spike.SetDailyProbFunctionByName(""))
+	for hour, expected := range map[float64]float64{0: 0.2, 3: 0.1, 11.9: 0.1, 12: 0.2, 23: 0.2} {
+		container.SetTimeOfDay(hour)
+		assert.Equal(t, expected, spike.FetchProbability())
+	}
+	assert.Equal(t, 12.0, profile[0].Hour) // the profile is sorted without modifying the argument
+	assert.Equal(t, 3.0, spike.GetParams().ProbProfile[0].Hour)
+
+	assert.Error(t, spike.SetProbProfile([]anomaly.HourProbability{{Hour: 24, Probability: 0.1}}))
+	assert.Error(t, spike.SetProbProfile([]anomaly.HourProbability{{Hour: 1, Probability: -0.1}}))
+	trend, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1, Duration: 1})
+	assert.NoError(t, err)
+	assert.False(t, anomaly.Container{"trend": trend}.FollowsClock())
+}
+
+// Assert that a spike with its own seed behaves identically regardless of other users of the emulator's random number generator
+func TestSpikeAnomaly_Seed(t *testing.T) {
+	params := anomaly.SpikeParams{Probability: 0.3, Magnitude: 1, VaryMagnitude: true, Seed: 42}
+	outputs := func(r *rand.Rand, noiseProbability float64) []float64 {
+		spike, err := anomaly.NewSpikeAnomaly(params)
+		assert.NoError(t, err)
+		noise, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: noiseProbability, Magnitude: 1})
+		assert.NoError(t, err)
+		seeded := anomaly.Container{"spike": spike}
+		shared := anomaly.Container{"noise": noise}
+
+		values := make([]float64, 100)
+		for i := range values {
+			shared.StepAll(r, 0.01)
+			values[i] = seeded.StepAll(r, 0.01)
+		}
+		return values
+	}
+
+	expected := outputs(rand.New(rand.NewPCG(1, 2)), 0.5)
+	assert.Equal(t, expected, outputs(rand.New(rand.NewPCG(3, 4)), 0.9))
+	assert.NotEqual(t, make([]float64, 100), expected)
+
+	spike, err := anomaly.NewSpikeAnomaly(params)
+	assert.NoError(t, err)
+	assert.Equal(t, uint64(42), spike.GetParams().Seed)
+}
+
+// Assert that a composite anomaly combines its children under a shared schedule
+func TestCompositeAnomaly(t *testing.T) {
+	yamlStr := `
+signature:
+  Type: composite
+  StartDelay: 1
+  Duration: 1
+  Repeats: 1
+  Mode: product
+  Children:
+    - Type: trend
+      Magnitude: 10
+      Duration: 1
+    - Type: spike
+      Probability: 1
+      Magnitude: 2
+      Sign: 1
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	composite, ok := anomaly.AsCompositeAnomaly(container["signature"])
+	assert.True(t, ok)
+	assert.Equal(t, "product", composite.GetMode())
+	assert.Len(t, composite.Children, 2)
+
+	// children are only stepped while the composite is active
+	r := rand.New(rand.NewPCG(1, 2))
+	Ts := 0.1
+	var values []float64
+	for i := 0; i < 40; i++ {
+		values = append(values, container.StepAll(r, Ts))
+	}
+	assert.Equal(t, 0.0, values[0])
+	for i, value := range values[9:19] {
+		assert.InDelta(t, 2*10*float64(i)/10, value, 1e-9) // ramp of the trend child, doubled by the spike child
+	}
+	assert.Equal(t, 0.0, values[19])
+	assert.Equal(t, uint64(1), composite.GetCountRepeats())
+
+	// composites round-trip through json with their children
+	compositeJSON, err := json.Marshal(container)
+	assert.NoError(t, err)
+	var loaded anomaly.Container
+	assert.NoError(t, json.Unmarshal(compositeJSON, &loaded))
+	loadedComposite, ok := anomaly.AsCompositeAnomaly(loaded["signature"])
+	assert.True(t, ok)
+	assert.Len(t, loadedComposite.Children, 2)
+	_, ok = anomaly.AsTrendAnomaly(loadedComposite.Children[0])
+	assert.True(t, ok)
+
+	// invalid composites are rejected
+	_, err = anomaly.NewCompositeAnomaly(anomaly.CompositeParams{})
+	assert.Error(t, err)
+	_, err = anomaly.NewCompositeAnomaly(anomaly.CompositeParams{Children: anomaly.List{composite}, Mode: "min"})
+	assert.Error(t, err)
+}
+
+// Assert that anomalies can reference entries in a library file, with parameter overrides
+func TestUnmarshalYAML_AnomalyRef(t *testing.T) {
+	library := `
+slow_drift:
+  Type: trend
+  Magnitude: 2
+  Duration: 600
+  MagFunc: sine
+cycle_a:
+  AnomalyRef: lib.yaml#cycle_b
+cycle_b:
+  AnomalyRef: lib.yaml#cycle_a
+`
+	dir := t.TempDir()
+	libPath := filepath.Join(dir, "lib.yaml")
+	assert.NoError(t, os.WriteFile(libPath, []byte(library), 0o644))
+
+	yamlStr := `
+drift:
+  AnomalyRef: "` + libPath + `#slow_drift"
+stronger_drift:
+  AnomalyRef: "` + libPath + `#slow_drift"
+  Magnitude: 5
+`
+	var container anomaly.Container
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &container))
+	drift, ok := anomaly.AsTrendAnomaly(container["drift"])
+	assert.True(t, ok)
+	assert.Equal(t, anomaly.TrendParams{Magnitude: 2, Duration: 600, MagFuncName: "sine"}, drift.GetParams())
+	stronger, ok := anomaly.AsTrendAnomaly(container["stronger_drift"])
+	assert.True(t, ok)
+	assert.Equal(t, 5.0, stronger.Magnitude)
+	assert.Equal(t, "sine", stronger.GetMagFuncName())
+
+	// references are also resolved from json
+	assert.NoError(t, json.Unmarshal([]byte(`{"drift": {"AnomalyRef": "`+libPath+`#slow_drift", "Repeats": 3}}`), &container))
+	drift, _ = anomaly.AsTrendAnomaly(container["drift"])
+	assert.Equal(t, uint64(3), drift.Repeats)
+
+	// the cyclic references are relative to the library file, so are found but never resolve
+	for _, ref := range []string{libPath + "#missing", "missing.yaml#slow_drift", libPath, libPath + "#cycle_a"} {
+		err := yaml.Unmarshal([]byte("bad:\n  AnomalyRef: \""+ref+"\""), &container)
+		assert.Error(t, err, ref)
+	}
+}
+
+// Assert that relative library paths are resolved against the LibraryDir option, and references within a library
+// against the directory of the library file
+func TestUnmarshalWithOptions(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, os.Mkdir(filepath.Join(dir, "lib"), 0o755))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "base.yaml"), []byte(`
+slow_drift:
+  Type: trend
+  Magnitude: 2
+  Duration: 600
+  MagFunc: sine
+`), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "lib", "lib.yaml"), []byte(`
+drift:
+  AnomalyRef: base.yaml#slow_drift
+  Magnitude: 3
+both:
+  Type: composite
+  Children:
+    - AnomalyRef: base.yaml#slow_drift
+`), 0o644))
+
+	yamlStr := `
+drift:
+  AnomalyRef: lib/lib.yaml#drift
+both:
+  AnomalyRef: lib/lib.yaml#both
+`
+	var container anomaly.Container
+	assert.NoError(t, anomaly.UnmarshalWithOptions([]byte(yamlStr), &container, anomaly.LoadOptions{LibraryDir: dir}))
+	drift, ok := anomaly.AsTrendAnomaly(container["drift"])
+	assert.True(t, ok)
+	assert.Equal(t, anomaly.TrendParams{Magnitude: 3, Duration: 600, MagFuncName: "sine"}, drift.GetParams())
+	assert.Equal(t, "composite", container["both"].GetTypeAsString())
+
+	// without the option, the library is not found in the working directory
+	assert.Error(t, anomaly.UnmarshalWithOptions([]byte(yamlStr), &container, anomaly.LoadOptions{}))
+}
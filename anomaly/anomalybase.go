@@ -2,7 +2,14 @@ package anomaly
 
 import (
 	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync/atomic"
+	"time"
 
+	"github.com/google/uuid"
 	"github.com/synaptecltd/emulator/mathfuncs"
 )
 
@@ -12,18 +19,64 @@ type AnomalyBase struct {
 	Off     bool   // true: anomaly deactivated, false: activated
 
 	// Setters with error checking should be provided for private fields below
-	typeName   string  // the type of anomaly as a string, e.g. "trend", "spike".
-	startDelay float64 // the delay before anomalies begin (and between anomaly repeats) in seconds
-	duration   float64 // the duration of anomaly each anomaly repeat in seconds
+	typeName         string  // the type of anomaly as a string, e.g. "trend", "spike".
+	startDelay       float64 // the delay before anomalies begin (and between anomaly repeats) in seconds
+	startDelayJitter float64 // maximum random perturbation of the start delay of each repeat in seconds, 0 for perfectly periodic repeats
+	duration         float64 // the duration of anomaly each anomaly repeat in seconds
+
+	startTime time.Time // wall-clock time at which the anomaly starts, resolved into startDelay against the emulator epoch, zero if unused
+	endTime   time.Time // wall-clock time at which the anomaly ends, resolved into duration against the emulator epoch, zero if unused
+
+	maxSlewRate float64 // maximum rate of change of the delta applied by the anomaly in units per second, 0 for unlimited
+	seed        uint64  // seed of the anomaly's own random number generator, 0 to use the random number generator of the emulator
+	blendMode   string  // how the delta of the anomaly is combined with the channel, see Blend modes, "" for BlendAdd
+	rampIn      float64 // time in seconds over which the delta fades in at the start of each anomaly repeat, 0 for an instantaneous start
+	rampOut     float64 // time in seconds over which the delta fades out at the end of each anomaly repeat, 0 for an instantaneous end
+
+	exclusiveGroup string    // name of the group of anomalies within a container of which at most one is active at a time, "" for none
+	triggeredBy    string    // name of the anomaly within the same container whose events start the anomaly, "" to follow its own schedule
+	triggerOn      string    // event of the trigger which starts the anomaly, see Trigger events, "" for TriggerOnComplete
+	uuid           uuid.UUID // identifies the anomaly stably across restarts, e.g. for external systems, uuid.Nil for none
 
 	// internal state
-	isAnomalyActive       bool    // whether the anomaly is actively modulating the waveform in this timestep
-	startDelayIndex       int     // startDelay converted to time steps, used to track delay period between anomaly repeats
-	elapsedActivatedIndex int     // number of time steps since start of this active anomaly repeat, used to track the progress within an anomaly burst/trend
-	elapsedActivatedTime  float64 // time elapsed since the start of this active anomaly repeat
-	countRepeats          uint64  // counter for number of times the anomaly trend/burst has repeated
+	isAnomalyActive       bool                // whether the anomaly is actively modulating the waveform in this timestep
+	startDelayIndex       int                 // startDelay converted to time steps, used to track delay period between anomaly repeats
+	elapsedActivatedIndex int                 // number of time steps since start of this active anomaly repeat, used to track the progress within an anomaly burst/trend
+	elapsedActivatedTime  float64             // time elapsed since the start of this active anomaly repeat
+	countRepeats          uint64              // counter for number of times the anomaly trend/burst has repeated
+	slewLimitedDelta      float64             // delta applied by the anomaly in the latest time step, after slew rate limiting
+	r                     *rand.Rand          // the anomaly's own random number generator, nil to use the random number generator of the emulator
+	pcg                   *rand.PCG           // source of r, kept so that its state can be exported, nil if r is nil
+	startDelayOffset      float64             // random perturbation of the start delay of the present repeat in seconds, drawn from startDelayJitter
+	startDelayDrawn       bool                // whether startDelayOffset has been drawn for the present repeat
+	offRequest            int32               // pending request to switch the anomaly off or on, accessed atomically as it may be set by other goroutines
+	paused                int32               // 1 if the anomaly is paused by Pause until Resume, accessed atomically as it may be set by other goroutines
+	armed                 bool                // whether an event of the trigger has started a repeat of the anomaly which is not yet complete
+	armedRepeats          uint64              // countRepeats when the anomaly was armed, so that the end of the triggered repeat is detected
+	triggerCount          uint64              // number of repeats of the trigger seen so far
+	triggerActive         bool                // whether the trigger was active in the previous time step
+	onRepeat              func(repeat uint64) // called by the container each time the anomaly completes a repeat, nil for none
+	notifiedRepeats       uint64              // countRepeats when onRepeat was last called
+	totalElapsedTime      float64             // time in seconds for which the anomaly has been stepped by its container, including delays and all repeats
+	totalActiveTime       float64             // time in seconds for which the anomaly has been active, over all repeats
+	stats                 AnomalyStats        // statistics of the activity of the anomaly and the deltas it has applied
+	stepDelta             float64             // delta applied by the anomaly in the present time step, 0 if none
+	stepIndex             int                 // position of the anomaly in the step order of its container, so that the order is only sorted when it changes
+
+	// random numbers of stochastic functions, nil until one is looked up
+	funcSource *mathfuncs.SwitchableSource // source of funcRand, switched to the random number generator of each time step
+	funcRand   *rand.Rand                  // random number generator from which the stochastic functions of the anomaly draw
+
+	customFunctions map[string]mathfuncs.MathsFunction // functions set by SetFunction keyed by name, which cannot be looked up by name when the anomaly is copied
 }
 
+// Values of AnomalyBase.offRequest
+const (
+	offRequestNone int32 = iota // no pending request
+	offRequestOff               // switch the anomaly off at the next time step
+	offRequestOn                // switch the anomaly on at the next time step
+)
+
 // Returns the type of anomaly as a string.
 func (a *AnomalyBase) GetTypeAsString() string {
 	return a.typeName
@@ -34,6 +87,11 @@ func (a *AnomalyBase) GetStartDelay() float64 {
 	return a.startDelay
 }
 
+// Returns the maximum random perturbation of the start delay of each repeat in seconds.
+func (a *AnomalyBase) GetStartDelayJitter() float64 {
+	return a.startDelayJitter
+}
+
 // Returns the duration of the anomaly in seconds.
 func (a *AnomalyBase) GetDuration() float64 {
 	return a.duration
@@ -59,11 +117,137 @@ func (a *AnomalyBase) GetElapsedActivatedTime() float64 {
 	return a.elapsedActivatedTime
 }
 
+// Returns the wall-clock time at which the anomaly starts, or the zero time if it is scheduled relative to the start of the emulation.
+func (a *AnomalyBase) GetStartTime() time.Time {
+	return a.startTime
+}
+
+// Returns the wall-clock time at which the anomaly ends, or the zero time if it is scheduled relative to the start of the emulation.
+func (a *AnomalyBase) GetEndTime() time.Time {
+	return a.endTime
+}
+
+// Returns the maximum rate of change of the delta applied by the anomaly in units per second, 0 if unlimited.
+func (a *AnomalyBase) GetMaxSlewRate() float64 {
+	return a.maxSlewRate
+}
+
+// Returns the seed of the anomaly's own random number generator, or 0 if it uses the random number generator of the emulator.
+func (a *AnomalyBase) GetSeed() uint64 {
+	return a.seed
+}
+
+// Returns how the delta of the anomaly is combined with the channel: BlendAdd, BlendMultiply, BlendReplace or BlendClamp.
+func (a *AnomalyBase) GetBlendMode() string {
+	if a.blendMode == "" {
+		return BlendAdd
+	}
+	return a.blendMode
+}
+
+// Returns the times in seconds over which the delta of the anomaly fades in and out at the start and end of each repeat.
+func (a *AnomalyBase) GetRamp() (rampIn float64, rampOut float64) {
+	return a.rampIn, a.rampOut
+}
+
+// Returns the name of the exclusive group of the anomaly, or "" if it is not a member of a group.
+func (a *AnomalyBase) GetExclusiveGroup() string {
+	return a.exclusiveGroup
+}
+
+// Returns the UUID which identifies the anomaly, uuid.Nil if none.
+func (a *AnomalyBase) GetUUID() uuid.UUID {
+	return a.uuid
+}
+
+// Returns the UUID of the anomaly as a string for its parameters, "" if none.
+func (a *AnomalyBase) uuidString() string {
+	if a.uuid == uuid.Nil {
+		return ""
+	}
+	return a.uuid.String()
+}
+
 // Returns the number of times the anomaly trend/burst has repeated so far.
 func (a *AnomalyBase) GetCountRepeats() uint64 {
 	return a.countRepeats
 }
 
+// Returns the fraction of the duration of the present repeat which had elapsed at the start of the latest
+// time step, in the range [0, 1), or 0 if the anomaly is inactive or continuous.
+func (a *AnomalyBase) GetProgress() float64 {
+	if !a.isAnomalyActive || a.duration <= 0 {
+		return 0
+	}
+	return min(a.elapsedActivatedTime/a.duration, 1)
+}
+
+// Returns the number of repeats of the anomaly which are yet to complete, including the present repeat if
+// it is active, or math.MaxUint64 if the anomaly repeats indefinitely.
+func (a *AnomalyBase) GetRemainingRepeats() uint64 {
+	if a.Repeats == 0 {
+		return math.MaxUint64
+	}
+	if a.countRepeats >= a.Repeats {
+		return 0
+	}
+	return a.Repeats - a.countRepeats
+}
+
+// Returns the time in seconds for which the anomaly has been stepped by its container over its whole lifetime,
+// including start delays, the delays between repeats and time steps in which it was paused or deferred.
+func (a *AnomalyBase) GetTotalElapsedTime() float64 {
+	return a.totalElapsedTime
+}
+
+// Returns the time in seconds for which the anomaly has been active over its whole lifetime, across all repeats.
+func (a *AnomalyBase) GetTotalActiveTime() float64 {
+	return a.totalActiveTime
+}
+
+// Sets the UUID which identifies the anomaly stably across restarts, or removes it if uuid.Nil. The UUID is
+// marshalled with the parameters of the anomaly as "Uuid".
+func (a *AnomalyBase) SetUUID(id uuid.UUID) {
+	a.uuid = id
+}
+
+// Makes the anomaly a member of the named exclusive group, so that it is never active at the same time as
+// another member of the group within its container, or removes it from any group if group is "".
+func (a *AnomalyBase) SetExclusiveGroup(group string) {
+	a.exclusiveGroup = group
+}
+
+// Sets a function called each time the anomaly completes a repeat, or removes it if nil. It is passed the
+// number of the completed repeat, 1 for the first, and is called by the goroutine stepping the container at the
+// end of the time step, so it may safely change the parameters of the anomaly, e.g. to escalate its magnitude.
+func (a *AnomalyBase) SetOnRepeat(onRepeat func(repeat uint64)) {
+	a.onRepeat = onRepeat
+}
+
+// Adds the time step Ts to the total elapsed time of the anomaly, and to its total active time and statistics
+// if it was active in the time step.
+func (a *AnomalyBase) recordStep(Ts float64) {
+	a.totalElapsedTime += Ts
+	if a.isAnomalyActive {
+		a.totalActiveTime += Ts
+	}
+	a.stats.record(a.isAnomalyActive, a.stepDelta)
+	a.stepDelta = 0
+}
+
+// Calls onRepeat for each repeat completed since it was last called.
+func (a *AnomalyBase) notifyRepeats() {
+	if a.notifiedRepeats > a.countRepeats {
+		a.notifiedRepeats = a.countRepeats // repeats were reset
+	}
+	for a.notifiedRepeats < a.countRepeats {
+		a.notifiedRepeats++
+		if a.onRepeat != nil {
+			a.onRepeat(a.notifiedRepeats)
+		}
+	}
+}
+
 // Sets the start time of anomalies in seconds if delay >= 0.
 func (a *AnomalyBase) SetStartDelay(startDelay float64) error {
 	if startDelay < 0 {
@@ -74,6 +258,270 @@ func (a *AnomalyBase) SetStartDelay(startDelay float64) error {
 	return nil
 }
 
+// Sets the maximum random perturbation of the start delay of each repeat in seconds if jitter >= 0. The
+// delay before each repeat is StartDelay plus a perturbation drawn uniformly between -jitter and +jitter,
+// so that repeats are not perfectly periodic. If jitter=0, repeats are periodic.
+func (a *AnomalyBase) SetStartDelayJitter(jitter float64) error {
+	if jitter < 0 {
+		return errors.New("start delay jitter must be greater than or equal to 0")
+	}
+
+	a.startDelayJitter = jitter
+	a.startDelayOffset = 0
+	a.startDelayDrawn = false
+	return nil
+}
+
+// Draws the random perturbation of the start delay of the present repeat, if it has not been drawn already.
+// The perturbed delay is never negative.
+func (a *AnomalyBase) jitterStartDelay(r *rand.Rand) {
+	if a.startDelayJitter == 0 || a.startDelayDrawn {
+		return
+	}
+	a.startDelayOffset = max(-a.startDelay, (2*r.Float64()-1)*a.startDelayJitter)
+	a.startDelayDrawn = true
+}
+
+// Fields of AnomalyBase which only some types of anomaly support, with the names of those types. The parameters
+// of other types do not carry these fields, so their setters return an error rather than a value which would be
+// lost when the anomaly is marshalled or copied.
+var partialFields = map[string][]string{
+	"BlendMode":   {"trend", "spike", "composite"},
+	"MaxSlewRate": {"trend", "spike", "composite"},
+	"TriggeredBy": {"trend", "spike", "composite", "harmonic", "clockdrift", "invalid", "phaseswap", "undersample"},
+}
+
+// Returns an error if the type of the anomaly does not support the named field of AnomalyBase, see partialFields.
+// Anomalies whose type is not yet set, e.g. while they are constructed, support every field.
+func (a *AnomalyBase) checkSupported(field string) error {
+	if a.typeName == "" || slices.Contains(partialFields[field], a.typeName) {
+		return nil
+	}
+	return fmt.Errorf("%s anomalies do not support %s", a.typeName, field)
+}
+
+// Sets how the delta of the anomaly is combined with the channel, if mode is BlendAdd, BlendMultiply,
+// BlendReplace or BlendClamp. An empty mode defaults to BlendAdd. Only trend, spike and composite anomalies
+// support modes other than BlendAdd.
+func (a *AnomalyBase) SetBlendMode(mode string) error {
+	switch mode {
+	case "", BlendAdd:
+	case BlendMultiply, BlendReplace, BlendClamp:
+		if err := a.checkSupported("BlendMode"); err != nil {
+			return err
+		}
+	default:
+		return errors.New("blend mode must be add, multiply, replace or clamp")
+	}
+	a.blendMode = mode
+	return nil
+}
+
+// Sets the times in seconds over which the delta of the anomaly fades in and out at the start and end of
+// each repeat if both are >= 0, so that it does not switch on and off instantaneously. If both are 0,
+// the delta has hard edges.
+func (a *AnomalyBase) SetRamp(rampIn float64, rampOut float64) error {
+	if rampIn < 0 || rampOut < 0 {
+		return errors.New("ramp times must be greater than or equal to 0")
+	}
+
+	a.rampIn = rampIn
+	a.rampOut = rampOut
+	return nil
+}
+
+// Returns the gain, between 0 and 1, of the attack/release envelope at the present time step of the active
+// anomaly repeat. The gain rises linearly from 0 over rampIn, and falls linearly to 0 over the rampOut before
+// the end of the repeat, if the repeat has a duration.
+func (a *AnomalyBase) envelopeGain(Ts float64) float64 {
+	gain := 1.0
+	if a.rampIn > 0 {
+		gain = min(gain, a.elapsedActivatedTime/a.rampIn)
+	}
+	if a.rampOut > 0 && a.duration > 0 {
+		gain = min(gain, (a.duration-a.elapsedActivatedTime-Ts)/a.rampOut)
+	}
+	return max(0, gain)
+}
+
+// Gives the anomaly its own random number generator with the given seed, so that its behaviour is
+// reproducible regardless of other stochastic parts of the emulation. If seed=0, the anomaly uses
+// the random number generator of the emulator.
+func (a *AnomalyBase) SetSeed(seed uint64) {
+	a.seed = seed
+	a.r = nil
+	a.pcg = nil
+	if seed != 0 {
+		a.pcg = rand.NewPCG(seed, seed)
+		a.r = rand.New(a.pcg)
+	}
+}
+
+// Returns the anomaly's own random number generator if it has a seed, or else shared.
+func (a *AnomalyBase) randSource(shared *rand.Rand) *rand.Rand {
+	if a.r != nil {
+		return a.r
+	}
+	return shared
+}
+
+// Returns the function of the given name, with stochastic functions drawing their random numbers from the
+// random number generator used to step the anomaly, so that they are reproducible if the emulator or the
+// anomaly has a seed.
+func (a *AnomalyBase) lookupFunction(name string) (mathfuncs.MathsFunction, error) {
+	if a.funcRand == nil {
+		a.funcSource = &mathfuncs.SwitchableSource{}
+		a.funcRand = rand.New(a.funcSource)
+	}
+	return mathfuncs.GetTrendFunctionWithRand(name, a.funcRand)
+}
+
+// Switches the stochastic functions of the anomaly to draw from r this time step.
+func (a *AnomalyBase) setFunctionRand(r *rand.Rand) {
+	if a.funcSource != nil {
+		a.funcSource.Set(r)
+	}
+}
+
+// Schedules the anomaly against wall-clock times rather than relative to the start of the emulation, if
+// endTime is after startTime. Either may be zero: a zero startTime starts the anomaly after StartDelay, and a
+// zero endTime leaves the duration unchanged. Times are resolved against the emulator epoch by ResolveSchedules.
+func (a *AnomalyBase) SetSchedule(startTime time.Time, endTime time.Time) error {
+	if !startTime.IsZero() && !endTime.IsZero() && !endTime.After(startTime) {
+		return errors.New("end time must be after start time")
+	}
+
+	a.startTime = startTime
+	a.endTime = endTime
+	return nil
+}
+
+// Converts the wall-clock schedule of the anomaly, if any, into a start delay and duration relative to the
+// epoch, the time of the first sample. Anomalies scheduled at wall-clock times occur once; anomalies which
+// end before the epoch are switched off.
+func (a *AnomalyBase) resolveSchedule(epoch time.Time) error {
+	if a.startTime.IsZero() && a.endTime.IsZero() {
+		return nil
+	}
+	if epoch.IsZero() {
+		a.Off = true
+		return errors.New("anomalies scheduled at wall-clock times require an emulator epoch")
+	}
+
+	start := epoch.Add(time.Duration(a.startDelay * float64(time.Second)))
+	if !a.startTime.IsZero() {
+		start = a.startTime
+	}
+	if start.Before(epoch) {
+		start = epoch // anomalies which started before the epoch are active from the first sample
+	}
+	a.startDelay = start.Sub(epoch).Seconds()
+
+	if !a.endTime.IsZero() {
+		if !a.endTime.After(start) {
+			a.Off = true
+			return nil
+		}
+		a.duration = a.endTime.Sub(start).Seconds()
+	}
+	a.Repeats = 1
+	return nil
+}
+
+// Sets the maximum rate of change of the delta applied by the anomaly in units per second if maxSlewRate >= 0.
+// If maxSlewRate=0, the rate of change is unlimited. Only trend, spike and composite anomalies support a limit.
+func (a *AnomalyBase) SetMaxSlewRate(maxSlewRate float64) error {
+	if maxSlewRate < 0 {
+		return errors.New("max slew rate must be greater than or equal to 0")
+	}
+	if maxSlewRate > 0 {
+		if err := a.checkSupported("MaxSlewRate"); err != nil {
+			return err
+		}
+	}
+
+	a.maxSlewRate = maxSlewRate
+	return nil
+}
+
+// Requests that the anomaly is switched off or on at the start of the next time step. Unlike setting Off
+// directly, this is safe to call while another goroutine is stepping the anomaly.
+func (a *AnomalyBase) requestOff(off bool) {
+	request := offRequestOn
+	if off {
+		request = offRequestOff
+	}
+	atomic.StoreInt32(&a.offRequest, request)
+}
+
+// Applies the latest pending request to switch the anomaly off or on, if any. Called by the goroutine stepping the anomaly.
+func (a *AnomalyBase) applyOffRequest() {
+	switch atomic.SwapInt32(&a.offRequest, offRequestNone) {
+	case offRequestOff:
+		a.Off = true
+		a.isAnomalyActive = false
+	case offRequestOn:
+		a.Off = false
+	}
+}
+
+// Pauses the anomaly from the start of the next time step until Resume is called. Unlike switching the
+// anomaly off, its elapsed time, start delay and repeats are frozen, so that it continues exactly where it
+// left off when resumed. It has no effect on the channel while paused. This is safe to call from a control
+// goroutine while another goroutine is stepping the emulator.
+func (a *AnomalyBase) Pause() {
+	atomic.StoreInt32(&a.paused, 1)
+}
+
+// Resumes the anomaly from the start of the next time step if it is paused.
+func (a *AnomalyBase) Resume() {
+	atomic.StoreInt32(&a.paused, 0)
+}
+
+// Returns whether the anomaly is paused.
+func (a *AnomalyBase) IsPaused() bool {
+	return atomic.LoadInt32(&a.paused) == 1
+}
+
+// Returns the position of the anomaly in the step order of its container in the previous time step.
+func (a *AnomalyBase) getStepIndex() int {
+	return a.stepIndex
+}
+
+// Records the position of the anomaly in the step order of its container.
+func (a *AnomalyBase) setStepIndex(i int) {
+	a.stepIndex = i
+}
+
+// Marks the anomaly as inactive in a time step in which it is not stepped, e.g. while its container is paused by a budget.
+func (a *AnomalyBase) skipStep() {
+	a.isAnomalyActive = false
+}
+
+// Returns delta limited so that the delta applied by the anomaly changes by no more than maxSlewRate
+// per second from the previous time step, e.g. so that a spike rises and decays at a plausible rate.
+func (a *AnomalyBase) limitSlew(delta float64, Ts float64) float64 {
+	a.slewLimitedDelta = LimitSlew(a.slewLimitedDelta, delta, a.maxSlewRate, Ts)
+	a.recordDelta(a.slewLimitedDelta)
+	return a.slewLimitedDelta
+}
+
+// Records the delta applied by the anomaly in the present time step, for its statistics.
+func (a *AnomalyBase) recordDelta(delta float64) {
+	a.stepDelta = delta
+}
+
+// Returns target if it is within maxRate*Ts of previous, or else previous moved towards target by
+// maxRate*Ts, limiting the slew rate of a signal, e.g. the total anomaly delta of a channel. If maxRate=0,
+// target is returned.
+func LimitSlew(previous float64, target float64, maxRate float64, Ts float64) float64 {
+	if maxRate == 0 {
+		return target
+	}
+	maxStep := maxRate * Ts
+	return previous + max(-maxStep, min(maxStep, target-previous))
+}
+
 // Returns whether anomalies should be active this timestep. This is true if:
 //  1. Enough time has elapsed for the anomaly to start, and;
 //  2. The anomaly has not yet completed all repetitions.
@@ -84,10 +532,44 @@ func (a *AnomalyBase) CheckAnomalyActive(Ts float64) bool {
 		return false
 	}
 
-	hasAnomalyStarted := a.startDelayIndex >= int(a.startDelay/Ts)-1
+	hasAnomalyStarted := a.startDelayIndex >= int((a.startDelay+a.startDelayOffset)/Ts)-1
 	return hasAnomalyStarted
 }
 
+// Set the fields funcName and funcVar of an anomaly to a function which need not be registered in mathfuncs,
+// such as one defined by a library user. The name identifies the function in the parameters of the anomaly.
+func (a *AnomalyBase) SetFunction(f mathfuncs.MathsFunction, name string, funcName *string, funcVar *mathfuncs.MathsFunction) error {
+	if f == nil {
+		return errors.New("function must not be nil")
+	}
+	if name == "" {
+		return errors.New("function name must not be empty")
+	}
+	*funcVar = f
+	*funcName = name
+	if a.customFunctions == nil {
+		a.customFunctions = make(map[string]mathfuncs.MathsFunction)
+	}
+	a.customFunctions[name] = f
+	return nil
+}
+
+// Returns name, or "" if it identifies a function set by SetFunction, which cannot be looked up by name.
+func (a *AnomalyBase) registeredName(name string) string {
+	if _, ok := a.customFunctions[name]; ok {
+		return ""
+	}
+	return name
+}
+
+// Sets a function of a copy of the anomaly with set, if name identifies a function set by SetFunction.
+func (a *AnomalyBase) copyFunction(name string, set func(f mathfuncs.MathsFunction, name string) error) error {
+	if f, ok := a.customFunctions[name]; ok {
+		return set(f, name)
+	}
+	return nil
+}
+
 // Set the fields funcName and funcVar of an anomaly by looking up a function name.
 func (a *AnomalyBase) SetFunctionByName(name string, funcSetter func(string) (mathfuncs.MathsFunction, error), funcName *string, funcVar *mathfuncs.MathsFunction) error {
 	if name == "" {
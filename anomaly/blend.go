@@ -0,0 +1,56 @@
+package anomaly
+
+import "math"
+
+// Blend modes, which determine how the delta of an anomaly is combined with the value of a channel.
+// Within a container, the deltas of additive anomalies are summed and added to the channel, which is
+// then scaled by multiplicative anomalies, replaced by active replacing anomalies, and finally clamped
+// by active clamping anomalies, regardless of the order of the anomalies.
+const (
+	BlendAdd      = "add"      // the delta is added to the channel
+	BlendMultiply = "multiply" // the channel is scaled by 1+delta, e.g. 0.1 for a 10% increase
+	BlendReplace  = "replace"  // the channel is replaced by the delta while the anomaly is active, summed if several are active
+	BlendClamp    = "clamp"    // the magnitude of the channel is limited to the magnitude of the delta while the anomaly is active
+)
+
+// blend accumulates the deltas of the anomalies within a container according to their blend modes.
+type blend struct {
+	sum         float64 // sum of the deltas of additive anomalies
+	factor      float64 // product of the scale factors of multiplicative anomalies
+	replacement float64 // sum of the deltas of active replacing anomalies
+	limit       float64 // smallest magnitude of the deltas of active clamping anomalies
+	replaced    bool    // whether any replacing anomaly is active
+}
+
+// Returns a blend with no effect on a channel.
+func newBlend() blend {
+	return blend{factor: 1, limit: math.Inf(1)}
+}
+
+// Accumulates the delta of an anomaly this time step according to its blend mode.
+func (b *blend) add(anomaly AnomalyInterface, delta float64) {
+	switch anomaly.GetBlendMode() {
+	case BlendMultiply:
+		b.factor *= 1 + delta
+	case BlendReplace:
+		if anomaly.GetIsAnomalyActive() {
+			b.replacement += delta
+			b.replaced = true
+		}
+	case BlendClamp:
+		if anomaly.GetIsAnomalyActive() {
+			b.limit = min(b.limit, math.Abs(delta))
+		}
+	default:
+		b.sum += delta
+	}
+}
+
+// Returns the value of a channel with the given base value, once the accumulated deltas are applied.
+func (b *blend) apply(base float64) float64 {
+	value := (base + b.sum) * b.factor
+	if b.replaced {
+		value = b.replacement
+	}
+	return max(-b.limit, min(b.limit, value))
+}
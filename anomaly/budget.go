@@ -0,0 +1,190 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand/v2"
+)
+
+// Limits the fraction of samples within a rolling window at which the other anomalies of its container may
+// be active, e.g. to guarantee the class balance of a labelled dataset regardless of how the probabilities
+// of individual anomalies interact. Once the limit is reached, the other anomalies of the container are
+// paused, and are inactive, until enough anomalous samples have left the window. The budget itself never
+// changes the signal and is never active.
+type budgetAnomaly struct {
+	AnomalyBase
+
+	maxFraction float64 // maximum fraction of samples within the window at which anomalies may be active
+	window      float64 // duration of the rolling window in seconds
+
+	// internal state
+	history []bool // whether anomalies were active at each sample of the window, as a ring buffer starting at next
+	next    int    // index within history of the oldest sample of the window
+	count   int    // number of samples within the window at which anomalies were active
+}
+
+// budgetLimiter is implemented by anomalies which limit how often the other anomalies of their container may be active.
+type budgetLimiter interface {
+	exhausted(Ts float64) bool // Returns whether the other anomalies of the container must be paused this timestep
+	record(active bool)        // Records whether any other anomaly of the container was active this timestep
+}
+
+// Parameters used to request a budget anomaly. These map onto the fields of budgetAnomaly.
+type BudgetParams struct {
+	// Defined in AnomalyBase
+
+	Off            bool   `yaml:"Off" json:"Off"`                                           // true: budget deactivated, false: activated
+	ExclusiveGroup string `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"` // name of a group of anomalies within the container of which at most one is active at a time, empty for none; a budget is never active, so never holds its group
+
+	// Defined in budgetAnomaly
+
+	MaxFraction float64 `yaml:"MaxFraction" json:"MaxFraction"` // maximum fraction of samples within the window at which anomalies may be active, between 0 and 1
+	Window      float64 `yaml:"Window" json:"Window"`           // duration of the rolling window in seconds, must be greater than 0
+}
+
+// Initialise the internal fields of budgetAnomaly when it is unmarshalled from yaml.
+func (b *budgetAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params BudgetParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	budgetAnomaly, err := NewBudgetAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to b
+	*b = *budgetAnomaly
+
+	return nil
+}
+
+// Returns the parameters of budgetAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (b *budgetAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[BudgetParams]{Type: b.typeName, Uuid: b.uuidString(), Params: b.GetParams()}, nil
+}
+
+// Initialise the internal fields of budgetAnomaly when it is unmarshalled from json.
+func (b *budgetAnomaly) UnmarshalJSON(data []byte) error {
+	var params BudgetParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	budgetAnomaly, err := NewBudgetAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to b
+	*b = *budgetAnomaly
+
+	return nil
+}
+
+// Returns the parameters of budgetAnomaly, including its "Type" field, when it is marshalled to json.
+func (b *budgetAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(b.typeName, b.uuid, b.GetParams())
+}
+
+// Returns a budgetAnomaly pointer with the requested parameters, checking for invalid values.
+func NewBudgetAnomaly(params BudgetParams) (*budgetAnomaly, error) {
+	budgetAnomaly := &budgetAnomaly{}
+
+	// Invalid values checked by setters
+	if err := budgetAnomaly.SetMaxFraction(params.MaxFraction); err != nil {
+		return nil, err
+	}
+	if err := budgetAnomaly.SetWindow(params.Window); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	budgetAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
+	budgetAnomaly.typeName = "budget"
+	budgetAnomaly.Off = params.Off
+
+	return budgetAnomaly, nil
+}
+
+// Budget anomalies do not change the signal value, so always return 0. The budget is enforced by the
+// container, see exhausted.
+func (b *budgetAnomaly) stepAnomaly(_ *rand.Rand, _ float64) float64 {
+	return 0.0
+}
+
+// Returns whether the other anomalies of the container must be paused this timestep, because another
+// active sample would exceed the maximum fraction of the window.
+func (b *budgetAnomaly) exhausted(Ts float64) bool {
+	if b.Off {
+		return false
+	}
+	if b.history == nil {
+		b.history = make([]bool, max(1, int(math.Round(b.window/Ts))))
+	}
+	return float64(b.count+1) > b.maxFraction*float64(len(b.history))
+}
+
+// Records whether any other anomaly of the container was active this timestep, moving the window on by one sample.
+func (b *budgetAnomaly) record(active bool) {
+	if b.history == nil {
+		return
+	}
+	if b.history[b.next] {
+		b.count -= 1
+	}
+	if active {
+		b.count += 1
+	}
+	b.history[b.next] = active
+	b.next = (b.next + 1) % len(b.history)
+}
+
+// Setters
+
+// Sets the maximum fraction of samples within the window at which anomalies may be active if it is between 0 and 1.
+func (b *budgetAnomaly) SetMaxFraction(maxFraction float64) error {
+	if maxFraction < 0 || maxFraction > 1 {
+		return errors.New("budget max fraction must be between 0 and 1")
+	}
+	b.maxFraction = maxFraction
+	return nil
+}
+
+// Sets the duration of the rolling window in seconds if window > 0, clearing the record of past samples.
+func (b *budgetAnomaly) SetWindow(window float64) error {
+	if window <= 0 {
+		return errors.New("budget window must be greater than 0")
+	}
+	b.window = window
+	b.history = nil
+	b.next = 0
+	b.count = 0
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define budgetAnomaly, such that NewBudgetAnomaly returns an identical anomaly.
+func (b *budgetAnomaly) GetParams() BudgetParams {
+	return BudgetParams{
+		Off:            b.Off,
+		ExclusiveGroup: b.exclusiveGroup,
+		MaxFraction:    b.maxFraction,
+		Window:         b.window,
+	}
+}
+
+// Returns the maximum fraction of samples within the window at which anomalies may be active.
+func (b *budgetAnomaly) GetMaxFraction() float64 {
+	return b.maxFraction
+}
+
+// Returns the duration of the rolling window in seconds.
+func (b *budgetAnomaly) GetWindow() float64 {
+	return b.window
+}
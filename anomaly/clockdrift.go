@@ -0,0 +1,202 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Models drift and jitter of a sampling clock. Rather than changing a signal value, the anomaly returns
+// the time error of each sample in seconds, which can be applied to sample timestamps.
+type clockDriftAnomaly struct {
+	AnomalyBase
+
+	DriftPPM float64 // drift of the sampling clock in parts per million, positive values make timestamps run fast, default 0
+	jitter   float64 // standard deviation of Gaussian jitter added to each timestamp in seconds, default 0
+
+	// internal state
+	driftError float64 // time error accumulated due to drift since the start of this active anomaly repeat
+}
+
+// Parameters used to request a clock drift anomaly. These map onto the fields of clockDriftAnomaly.
+type ClockDriftParams struct {
+	// Defined in AnomalyBase
+
+	Repeats        uint64    `yaml:"Repeats" json:"Repeats"`                                   // the number of times the clock drift repeats, 0 for infinite
+	Off            bool      `yaml:"Off" json:"Off"`                                           // true: anomaly deactivated, false: activated
+	StartDelay     float64   `yaml:"StartDelay" json:"StartDelay"`                             // the delay before clock drift begins (and between anomaly repeats) in seconds
+	Duration       float64   `yaml:"Duration" json:"Duration"`                                 // the duration of each period of drift in seconds, after which the clock is resynchronised, 0 for continuous
+	StartTime      time.Time `yaml:"StartTime,omitempty" json:"StartTime,omitempty"`           // wall-clock time at which the anomaly starts, overriding StartDelay, requires an emulator epoch, optional
+	EndTime        time.Time `yaml:"EndTime,omitempty" json:"EndTime,omitempty"`               // wall-clock time at which the anomaly ends, overriding Duration, requires an emulator epoch, optional
+	ExclusiveGroup string    `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"` // name of a group of anomalies within the container of which at most one is active at a time, empty for none
+	TriggeredBy    string    `yaml:"TriggeredBy,omitempty" json:"TriggeredBy,omitempty"`       // name of an anomaly within the container whose events each start one repeat of this anomaly, after StartDelay, empty to follow its own schedule
+	TriggerOn      string    `yaml:"TriggerOn,omitempty" json:"TriggerOn,omitempty"`           // event of TriggeredBy which starts a repeat: "complete" or "activate", defaults to "complete" if empty
+
+	// Defined in clockDriftAnomaly
+
+	DriftPPM float64 `yaml:"DriftPPM" json:"DriftPPM"` // drift of the sampling clock in parts per million, positive values make timestamps run fast, default 0
+	Jitter   float64 `yaml:"Jitter" json:"Jitter"`     // standard deviation of Gaussian jitter added to each timestamp in seconds, default 0
+}
+
+// Initialise the internal fields of clockDriftAnomaly when it is unmarshalled from yaml.
+func (c *clockDriftAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params ClockDriftParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	clockDriftAnomaly, err := NewClockDriftAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to c
+	*c = *clockDriftAnomaly
+
+	return nil
+}
+
+// Returns the parameters of clockDriftAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (c *clockDriftAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[ClockDriftParams]{Type: c.typeName, Uuid: c.uuidString(), Params: c.GetParams()}, nil
+}
+
+// Initialise the internal fields of clockDriftAnomaly when it is unmarshalled from json.
+func (c *clockDriftAnomaly) UnmarshalJSON(data []byte) error {
+	var params ClockDriftParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	clockDriftAnomaly, err := NewClockDriftAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to c
+	*c = *clockDriftAnomaly
+
+	return nil
+}
+
+// Returns the parameters of clockDriftAnomaly, including its "Type" field, when it is marshalled to json.
+func (c *clockDriftAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(c.typeName, c.uuid, c.GetParams())
+}
+
+// Returns a clockDriftAnomaly pointer with the requested parameters, checking for invalid values.
+func NewClockDriftAnomaly(params ClockDriftParams) (*clockDriftAnomaly, error) {
+	clockDriftAnomaly := &clockDriftAnomaly{}
+
+	// Invalid values checked by setters
+	if err := clockDriftAnomaly.SetStartDelay(params.StartDelay); err != nil {
+		return nil, err
+	}
+	if err := clockDriftAnomaly.SetSchedule(params.StartTime, params.EndTime); err != nil {
+		return nil, err
+	}
+	if err := clockDriftAnomaly.SetTrigger(params.TriggeredBy, params.TriggerOn); err != nil {
+		return nil, err
+	}
+	if err := clockDriftAnomaly.SetDuration(params.Duration); err != nil {
+		return nil, err
+	}
+	if err := clockDriftAnomaly.SetJitter(params.Jitter); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	clockDriftAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
+	clockDriftAnomaly.typeName = "clockdrift"
+	clockDriftAnomaly.DriftPPM = params.DriftPPM
+	clockDriftAnomaly.Repeats = params.Repeats
+	clockDriftAnomaly.Off = params.Off
+
+	return clockDriftAnomaly, nil
+}
+
+// Returns the time error in seconds of the sample this timestep. Drift accumulates over each active
+// anomaly repeat and is cleared when the repeat completes, emulating the clock being resynchronised.
+func (c *clockDriftAnomaly) stepAnomaly(r *rand.Rand, Ts float64) float64 {
+	if c.Off {
+		return 0.0
+	}
+
+	// Check if the clock drift anomaly is active this timestep
+	c.isAnomalyActive = c.CheckAnomalyActive(Ts)
+	if !c.isAnomalyActive {
+		c.startDelayIndex += 1 // increment to keep track of the delay between drift repeats
+		return 0.0
+	}
+
+	// Update the index after logging the current time
+	c.elapsedActivatedTime = float64(c.elapsedActivatedIndex) * Ts
+	c.elapsedActivatedIndex += 1
+
+	c.driftError = c.DriftPPM * 1e-6 * c.elapsedActivatedTime
+	timeError := c.driftError
+	if c.jitter > 0 {
+		timeError += r.NormFloat64() * c.jitter
+	}
+
+	// If the drift period is complete, reset the index and increment the repeat counter
+	if c.duration > 0 && c.elapsedActivatedIndex == int(c.duration/Ts) {
+		c.elapsedActivatedIndex = 0
+		c.startDelayIndex = 0
+		c.countRepeats += 1
+		c.driftError = 0
+	}
+
+	return timeError
+}
+
+// Setters
+
+// Sets the duration of each period of drift in seconds if duration >= 0. If duration=0, drift is continuous.
+func (c *clockDriftAnomaly) SetDuration(duration float64) error {
+	if duration < 0 {
+		return errors.New("duration must be positive value")
+	}
+	c.duration = duration
+	return nil
+}
+
+// Sets the standard deviation of timestamp jitter in seconds if jitter >= 0.
+func (c *clockDriftAnomaly) SetJitter(jitter float64) error {
+	if jitter < 0 {
+		return errors.New("jitter must be greater than or equal to 0")
+	}
+	c.jitter = jitter
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define clockDriftAnomaly, such that NewClockDriftAnomaly returns an identical anomaly.
+func (c *clockDriftAnomaly) GetParams() ClockDriftParams {
+	return ClockDriftParams{
+		Repeats:        c.Repeats,
+		Off:            c.Off,
+		StartDelay:     c.startDelay,
+		Duration:       c.duration,
+		StartTime:      c.startTime,
+		EndTime:        c.endTime,
+		ExclusiveGroup: c.exclusiveGroup,
+		TriggeredBy:    c.triggeredBy,
+		TriggerOn:      c.triggerOn,
+		DriftPPM:       c.DriftPPM,
+		Jitter:         c.jitter,
+	}
+}
+
+func (c *clockDriftAnomaly) GetJitter() float64 {
+	return c.jitter
+}
+
+// Returns the time error accumulated due to drift in the present anomaly repeat, excluding jitter.
+func (c *clockDriftAnomaly) GetDriftError() float64 {
+	return c.driftError
+}
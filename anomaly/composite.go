@@ -0,0 +1,307 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Combines the outputs of a list of child anomalies under a shared schedule, so that a complex
+// disturbance signature can be packaged and reused as a single container entry. Children are only
+// stepped while the composite is active, so their start delays and durations are relative to the
+// time the composite becomes active.
+type compositeAnomaly struct {
+	AnomalyBase
+
+	Children List   // anomalies whose outputs are combined
+	mode     string // how the outputs of the children are combined: "sum", "product" or "max", defaults to "sum" if empty
+}
+
+// List is a list of anomalies, which are unmarshalled into the correct types based on their "Type" fields.
+type List []AnomalyInterface
+
+// Parameters used to request a composite anomaly. These map onto the fields of compositeAnomaly.
+type CompositeParams struct {
+	// Defined in AnomalyBase
+
+	Repeats        uint64    `yaml:"Repeats" json:"Repeats"`                                   // the number of times the composite anomaly repeats, 0 for infinite
+	Off            bool      `yaml:"Off" json:"Off"`                                           // true: anomaly deactivated, false: activated
+	StartDelay     float64   `yaml:"StartDelay" json:"StartDelay"`                             // the delay before the composite anomaly begins (and between anomaly repeats) in seconds
+	Duration       float64   `yaml:"Duration" json:"Duration"`                                 // the duration of each composite anomaly in seconds, 0 for continuous
+	StartTime      time.Time `yaml:"StartTime,omitempty" json:"StartTime,omitempty"`           // wall-clock time at which the anomaly starts, overriding StartDelay, requires an emulator epoch, optional
+	EndTime        time.Time `yaml:"EndTime,omitempty" json:"EndTime,omitempty"`               // wall-clock time at which the anomaly ends, overriding Duration, requires an emulator epoch, optional
+	MaxSlewRate    float64   `yaml:"MaxSlewRate" json:"MaxSlewRate"`                           // maximum rate of change of the applied delta in units per second, 0 for unlimited
+	BlendMode      string    `yaml:"BlendMode,omitempty" json:"BlendMode,omitempty"`           // how the delta is combined with the channel: "add", "multiply" (scales by 1+delta), "replace" or "clamp", defaults to "add" if empty
+	ExclusiveGroup string    `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"` // name of a group of anomalies within the container of which at most one is active at a time, empty for none
+	TriggeredBy    string    `yaml:"TriggeredBy,omitempty" json:"TriggeredBy,omitempty"`       // name of an anomaly within the container whose events each start one repeat of this anomaly, after StartDelay, empty to follow its own schedule
+	TriggerOn      string    `yaml:"TriggerOn,omitempty" json:"TriggerOn,omitempty"`           // event of TriggeredBy which starts a repeat: "complete" or "activate", defaults to "complete" if empty
+
+	// Defined in compositeAnomaly
+
+	Children List   `yaml:"Children" json:"Children"` // anomalies whose outputs are combined, must not be empty
+	Mode     string `yaml:"Mode" json:"Mode"`         // how the outputs of the children are combined: "sum", "product" or "max", defaults to "sum" if empty
+}
+
+// Initialise the internal fields of compositeAnomaly when it is unmarshalled from yaml.
+func (c *compositeAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params CompositeParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	compositeAnomaly, err := NewCompositeAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to c
+	*c = *compositeAnomaly
+
+	return nil
+}
+
+// Returns the parameters of compositeAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (c *compositeAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[CompositeParams]{Type: c.typeName, Uuid: c.uuidString(), Params: c.GetParams()}, nil
+}
+
+// Initialise the internal fields of compositeAnomaly when it is unmarshalled from json.
+func (c *compositeAnomaly) UnmarshalJSON(data []byte) error {
+	var params CompositeParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	compositeAnomaly, err := NewCompositeAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to c
+	*c = *compositeAnomaly
+
+	return nil
+}
+
+// Returns the parameters of compositeAnomaly, including its "Type" field, when it is marshalled to json.
+func (c *compositeAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(c.typeName, c.uuid, c.GetParams())
+}
+
+// Returns a compositeAnomaly pointer with the requested parameters, checking for invalid values.
+func NewCompositeAnomaly(params CompositeParams) (*compositeAnomaly, error) {
+	compositeAnomaly := &compositeAnomaly{}
+
+	// Invalid values checked by setters
+	if err := compositeAnomaly.SetStartDelay(params.StartDelay); err != nil {
+		return nil, err
+	}
+	if err := compositeAnomaly.SetSchedule(params.StartTime, params.EndTime); err != nil {
+		return nil, err
+	}
+	if err := compositeAnomaly.SetMaxSlewRate(params.MaxSlewRate); err != nil {
+		return nil, err
+	}
+	if err := compositeAnomaly.SetBlendMode(params.BlendMode); err != nil {
+		return nil, err
+	}
+	if err := compositeAnomaly.SetTrigger(params.TriggeredBy, params.TriggerOn); err != nil {
+		return nil, err
+	}
+	if err := compositeAnomaly.SetDuration(params.Duration); err != nil {
+		return nil, err
+	}
+	if err := compositeAnomaly.SetChildren(params.Children); err != nil {
+		return nil, err
+	}
+	if err := compositeAnomaly.SetMode(params.Mode); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	compositeAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
+	compositeAnomaly.typeName = "composite"
+	compositeAnomaly.Repeats = params.Repeats
+	compositeAnomaly.Off = params.Off
+
+	return compositeAnomaly, nil
+}
+
+// Returns the combined change in signal caused by the children this timestep, or 0 if the composite is inactive.
+// Manages internal indices to track the progress of composite repeats, and delays between repeats.
+func (c *compositeAnomaly) stepAnomaly(r *rand.Rand, Ts float64) float64 {
+	if c.Off {
+		c.isAnomalyActive = false
+		return 0.0
+	}
+
+	// Check if the composite anomaly is active this timestep
+	c.isAnomalyActive = c.CheckAnomalyActive(Ts)
+	if !c.isAnomalyActive {
+		c.startDelayIndex += 1 // increment to keep track of the delay between composite repeats
+		return 0.0
+	}
+
+	// Update the index after logging the current time
+	c.elapsedActivatedTime = float64(c.elapsedActivatedIndex) * Ts
+	c.elapsedActivatedIndex += 1
+
+	value := c.stepChildren(r, Ts)
+
+	// If the composite anomaly is complete, reset the index and increment the repeat counter
+	if c.duration > 0 && c.elapsedActivatedIndex == int(c.duration/Ts) {
+		c.elapsedActivatedIndex = 0
+		c.startDelayIndex = 0
+		c.countRepeats += 1
+	}
+
+	return value
+}
+
+// Steps all children and returns their outputs combined according to mode.
+func (c *compositeAnomaly) stepChildren(r *rand.Rand, Ts float64) float64 {
+	var value float64
+	for i, child := range c.Children {
+		delta := child.limitSlew(child.stepAnomaly(r, Ts), Ts)
+		switch {
+		case i == 0:
+			value = delta
+		case c.mode == "product":
+			value *= delta
+		case c.mode == "max":
+			value = max(value, delta)
+		default:
+			value += delta
+		}
+	}
+	return value
+}
+
+// Resolves the magnitudes of children which are specified as a percentage of the nominal value of the channel.
+func (c *compositeAnomaly) resolveMagnitude(nominal float64) {
+	for _, child := range c.Children {
+		if resolver, ok := child.(magnitudeResolver); ok {
+			resolver.resolveMagnitude(nominal)
+		}
+	}
+}
+
+// Unmarshals a list of generic anomaly entries into the correct types based on their "Type" fields.
+func (l *List) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var raw []map[string]interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	*l = make(List, 0, len(raw))
+	for _, value := range raw {
+		anomaly, err := unmarshalAnomaly(value)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, anomaly)
+	}
+	return nil
+}
+
+// Unmarshals a list of json anomaly entries into the correct types based on their "Type" fields.
+func (l *List) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*l = make(List, 0, len(raw))
+	for _, value := range raw {
+		anomaly, err := unmarshalAnomalyJSON(value)
+		if err != nil {
+			return err
+		}
+		*l = append(*l, anomaly)
+	}
+	return nil
+}
+
+// Setters
+
+// Sets the duration of each composite anomaly in seconds if duration >= 0. If duration=0, the composite is continuous.
+func (c *compositeAnomaly) SetDuration(duration float64) error {
+	if duration < 0 {
+		return errors.New("duration must be positive value")
+	}
+	c.duration = duration
+	return nil
+}
+
+// Sets the anomalies whose outputs are combined, if there is at least one and none are nil.
+func (c *compositeAnomaly) SetChildren(children List) error {
+	if len(children) == 0 {
+		return errors.New("composite anomaly must have at least one child")
+	}
+	for _, child := range children {
+		if child == nil {
+			return errors.New("composite anomaly children must not be nil")
+		}
+	}
+	c.Children = children
+	return nil
+}
+
+// Sets how the outputs of the children are combined, if mode is "sum", "product" or "max". An empty mode defaults to "sum".
+func (c *compositeAnomaly) SetMode(mode string) error {
+	if mode == "" {
+		mode = "sum" // default to summing the children if no mode is provided
+	}
+	switch mode {
+	case "sum", "product", "max":
+		c.mode = mode
+		return nil
+	default:
+		return errors.New("composite mode must be sum, product or max")
+	}
+}
+
+// Returns a new compositeAnomaly with the same parameters, at the start of its schedule, with copies of its
+// children, see copyAnomaly.
+func (c *compositeAnomaly) clone() (AnomalyInterface, error) {
+	params := c.GetParams()
+	params.Children = make(List, len(c.Children))
+	for i, child := range c.Children {
+		copied, err := copyAnomaly(child)
+		if err != nil {
+			return nil, err
+		}
+		params.Children[i] = copied
+	}
+	clone, err := NewCompositeAnomaly(params)
+	if err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// Getters
+
+// Returns the parameters which define compositeAnomaly, such that NewCompositeAnomaly returns an identical anomaly.
+func (c *compositeAnomaly) GetParams() CompositeParams {
+	return CompositeParams{
+		Repeats:        c.Repeats,
+		Off:            c.Off,
+		StartDelay:     c.startDelay,
+		Duration:       c.duration,
+		StartTime:      c.startTime,
+		EndTime:        c.endTime,
+		MaxSlewRate:    c.maxSlewRate,
+		BlendMode:      c.blendMode,
+		ExclusiveGroup: c.exclusiveGroup,
+		TriggeredBy:    c.triggeredBy,
+		TriggerOn:      c.triggerOn,
+		Children:       c.Children,
+		Mode:           c.mode,
+	}
+}
+
+func (c *compositeAnomaly) GetMode() string {
+	return c.mode
+}
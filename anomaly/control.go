@@ -0,0 +1,72 @@
+package anomaly
+
+import (
+	"fmt"
+)
+
+// Control actions, the actions of a ControlMessage.
+const (
+	ControlEnable  = "enable"  // switches the named anomaly on
+	ControlDisable = "disable" // switches the named anomaly off
+	ControlUpdate  = "update"  // replaces the named anomaly by Anomaly, or adds it if there is no anomaly of that name, unless Anomaly or its UUID is held under another name
+)
+
+// ControlMessage requests a change to an anomaly within a container, see ApplyControl.
+type ControlMessage struct {
+	Name    string           // name of the anomaly within the container
+	Action  string           // action to apply, see Control actions
+	Anomaly AnomalyInterface // anomaly which replaces the named anomaly for ControlUpdate, ignored otherwise
+	Err     chan<- error     // receives the result of applying the message, nil on success, if not nil; must be buffered, as results are dropped rather than block stepping
+}
+
+// Applies the control messages pending on a channel to the container, in order, without waiting for further
+// messages, and returns false if the channel is closed. This must be called by the goroutine which steps the
+// container, e.g. at the start of each time step, so that messages sent from an external orchestrator can switch
+// anomalies on or off, replace or add them without locking. See Emulator.Subscribe, which does so for the
+// containers of an emulator.
+func (c Container) ApplyControl(messages <-chan ControlMessage) bool {
+	for {
+		select {
+		case message, open := <-messages:
+			if !open {
+				return false
+			}
+			err := c.applyControlMessage(message)
+			if message.Err != nil {
+				select {
+				case message.Err <- err:
+				default:
+				}
+			}
+		default:
+			return true
+		}
+	}
+}
+
+// Applies a single control message to the container.
+func (c Container) applyControlMessage(message ControlMessage) error {
+	if message.Action == ControlUpdate {
+		if message.Anomaly == nil {
+			return fmt.Errorf("anomaly to update %s must not be nil", message.Name)
+		}
+		if c == nil {
+			return fmt.Errorf("cannot add anomaly %s to a nil container", message.Name)
+		}
+		return c.updateAnomalyByName(message.Name, message.Anomaly)
+	}
+
+	anomaly, ok := c[message.Name]
+	if !ok {
+		return fmt.Errorf("anomaly not found: %s", message.Name)
+	}
+	switch message.Action {
+	case ControlEnable:
+		anomaly.requestOff(false)
+	case ControlDisable:
+		anomaly.requestOff(true)
+	default:
+		return fmt.Errorf("unknown control action: %s", message.Action)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package anomaly
+
+import (
+	"errors"
+	"math"
+	"math/rand/v2"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Correlation shares a single source anomaly between several containers, e.g. across channels, so that
+// one anomaly definition produces correlated effects with a shared activation state. Each container is
+// given a target anomaly from NewTarget, which applies the effect of the source multiplied by a scale factor.
+type Correlation struct {
+	Targets map[string]float64 `yaml:"Targets"` // scale factors applied to the source anomaly, keyed by the name of the target container
+
+	source AnomalyInterface // the anomaly which drives all targets
+
+	// internal state
+	steps uint64  // number of time steps the source anomaly has been stepped
+	value float64 // change in signal caused by the source anomaly in the latest time step
+}
+
+// Returns a Correlation pointer driven by the given source anomaly.
+func NewCorrelation(source AnomalyInterface) (*Correlation, error) {
+	if source == nil {
+		return nil, errors.New("source anomaly must not be nil")
+	}
+	return &Correlation{source: source}, nil
+}
+
+// Initialise a Correlation when it is unmarshalled from yaml. The source anomaly is defined inline,
+// in the same way as container entries, alongside the Targets field, and is upgraded from the Version
+// recorded alongside them, see CurrentConfigVersion.
+func (c *Correlation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var targets struct {
+		Targets map[string]float64 `yaml:"Targets"`
+	}
+	if err := unmarshal(&targets); err != nil {
+		return err
+	}
+
+	var raw map[string]interface{}
+	if err := unmarshal(&raw); err != nil {
+		return err
+	}
+	delete(raw, "Targets")
+	version, err := popConfigVersion(raw)
+	if err != nil {
+		return err
+	}
+	if err := migrateEntry(raw, version, latestConfigVersion()); err != nil {
+		return err
+	}
+
+	source, err := unmarshalAnomaly(raw)
+	if err != nil {
+		return err
+	}
+
+	*c = Correlation{
+		Targets: targets.Targets,
+		source:  source,
+	}
+	return nil
+}
+
+// Marshals a Correlation with its source anomaly inline, alongside the Targets field.
+func (c *Correlation) MarshalYAML() (interface{}, error) {
+	sourceYAML, err := yaml.Marshal(c.source)
+	if err != nil {
+		return nil, err
+	}
+	var fields yaml.MapSlice
+	if err := yaml.Unmarshal(sourceYAML, &fields); err != nil {
+		return nil, err
+	}
+	return append(fields, yaml.MapItem{Key: "Targets", Value: c.Targets}), nil
+}
+
+// Returns the source anomaly which drives all targets.
+func (c *Correlation) GetSource() AnomalyInterface {
+	return c.source
+}
+
+// Returns an anomaly, to be added to a container, which applies the effect of the source anomaly
+// multiplied by scale. The source anomaly is stepped once per time step however many targets there are,
+// so all targets must be stepped once per time step and added before the first step.
+func (c *Correlation) NewTarget(scale float64) AnomalyInterface {
+	return &correlatedAnomaly{
+		AnomalyInterface: c.source,
+		Scale:            scale,
+		correlation:      c,
+	}
+}
+
+// Applies the effect of a shared source anomaly to a container. Getters and setters are promoted
+// from the source anomaly, so the activation state of all targets of a Correlation is the same.
+type correlatedAnomaly struct {
+	AnomalyInterface // the source anomaly
+
+	Scale float64 // scale factor applied to the effect of the source anomaly
+
+	correlation      *Correlation // the correlation which owns the source anomaly
+	steps            uint64       // number of time steps this target has been stepped
+	slewLimitedDelta float64      // delta applied by this target in the latest time step, after slew rate limiting
+	steppedSource    bool         // whether this target stepped the source anomaly in the latest time step
+}
+
+// Returns the change in signal caused by the source anomaly this timestep multiplied by Scale, stepping
+// the source anomaly if this is the first target to be stepped this time step.
+func (c *correlatedAnomaly) stepAnomaly(r *rand.Rand, Ts float64) float64 {
+	c.steps++
+	c.steppedSource = c.steps > c.correlation.steps
+	if c.steppedSource {
+		c.correlation.value = c.AnomalyInterface.stepAnomaly(r, Ts)
+		c.correlation.steps = c.steps
+		c.AnomalyInterface.recordDelta(c.correlation.value)
+	}
+	return c.correlation.value * c.Scale
+}
+
+// Updates the lifetime and statistics of the source anomaly, if this target stepped it in the present time step,
+// so that they are updated once per time step however many targets there are.
+func (c *correlatedAnomaly) recordStep(Ts float64) {
+	if c.steppedSource {
+		c.AnomalyInterface.recordStep(Ts)
+		c.steppedSource = false
+	}
+}
+
+// Limits the rate of change of the delta applied by this target to the maximum slew rate of the source
+// anomaly multiplied by Scale, independently of other targets.
+func (c *correlatedAnomaly) limitSlew(delta float64, Ts float64) float64 {
+	c.slewLimitedDelta = LimitSlew(c.slewLimitedDelta, delta, c.GetMaxSlewRate()*math.Abs(c.Scale), Ts)
+	return c.slewLimitedDelta
+}
+
+// Returns the quality of samples marked by the source anomaly, if it marks samples as invalid.
+func (c *correlatedAnomaly) getQuality() Quality {
+	if marker, ok := c.AnomalyInterface.(qualityMarker); ok {
+		return marker.getQuality()
+	}
+	return QualityGood
+}
+
+// Returns whether the source anomaly holds the present sample, if it holds samples.
+func (c *correlatedAnomaly) getHold() bool {
+	if holder, ok := c.AnomalyInterface.(sampleHolder); ok {
+		return holder.getHold()
+	}
+	return false
+}
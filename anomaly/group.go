@@ -0,0 +1,67 @@
+package anomaly
+
+import (
+	"fmt"
+	"slices"
+)
+
+// scheduleFields are the fields of a group entry which are inherited by each of its members, unless overridden.
+var scheduleFields = []string{"Repeats", "StartDelay", "Duration", "StartTime", "EndTime"}
+
+// Expands a group entry of a container, with "Type: group", into its members. A group holds its members in a
+// "Members" field, keyed by name in the same format as a container, and each member is added to the container
+// named "group.member". Members inherit the schedule fields of the group, i.e. Repeats, StartDelay, Duration,
+// StartTime and EndTime, unless they set the field themselves. Returns the entries of the members keyed by
+// their names within the container.
+func expandGroup(name string, value map[string]interface{}) (map[string]map[string]interface{}, error) {
+	for key := range value {
+		if key != "Type" && key != "Members" && !slices.Contains(scheduleFields, key) {
+			return nil, fmt.Errorf("group %s: unknown field %s, groups only set Members and schedule fields", name, key)
+		}
+	}
+	members, ok := toStringMap(value["Members"])
+	if !ok || len(members) == 0 {
+		return nil, fmt.Errorf("group %s must have at least one member", name)
+	}
+
+	entries := make(map[string]map[string]interface{}, len(members))
+	for memberName, member := range members {
+		entry, ok := toStringMap(member)
+		if !ok {
+			return nil, fmt.Errorf("group %s: member %s must be an anomaly entry", name, memberName)
+		}
+
+		// Fields of the member override the schedule of the group
+		merged := make(map[string]interface{}, len(entry)+len(scheduleFields))
+		for _, key := range scheduleFields {
+			if field, ok := value[key]; ok {
+				merged[key] = field
+			}
+		}
+		for key, field := range entry {
+			merged[key] = field
+		}
+		entries[name+"."+memberName] = merged
+	}
+	return entries, nil
+}
+
+// Converts a map unmarshalled from yaml, which has keys of type interface{}, or from json into a map with string keys.
+func toStringMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		converted := make(map[string]interface{}, len(m))
+		for key, field := range m {
+			keyString, ok := key.(string)
+			if !ok {
+				return nil, false
+			}
+			converted[keyString] = field
+		}
+		return converted, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,305 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"time"
+
+	"github.com/synaptecltd/emulator/mathfuncs"
+)
+
+// Injects a single harmonic order into three-phase waveform data, with its own magnitude and angle profiles.
+type harmonicAnomaly struct {
+	AnomalyBase
+
+	// Private fields have setters for invalid value checking
+
+	order       float64 // harmonic order to inject, e.g. 5 for the 5th harmonic
+	Magnitude   float64 // magnitude of the injected harmonic in pu, relative to PosSeqMag, default 0
+	magFuncName string  // name of the function used to vary the magnitude of the harmonic, empty defaults to constant =Magnitude
+	Angle       float64 // angle of the injected harmonic in radians, default 0
+	angFuncName string  // name of the function used to vary the angle of the harmonic, empty defaults to constant =Angle
+
+	// internal state
+	magFunction mathfuncs.MathsFunction // returns harmonic magnitude for a given elapsed time, magnitude and period; set internally from magFuncName
+	angFunction mathfuncs.MathsFunction // returns harmonic angle for a given elapsed time, angle and period; set internally from angFuncName
+}
+
+// HarmonicInjection describes the harmonic injected by a harmonic anomaly in a single time step.
+type HarmonicInjection struct {
+	Order     float64 // harmonic order
+	Magnitude float64 // magnitude in pu, relative to PosSeqMag
+	Angle     float64 // angle in radians
+}
+
+// HarmonicInjector is implemented by anomalies which inject harmonics into three-phase waveforms
+// rather than contributing a scalar change to the signal.
+type HarmonicInjector interface {
+	AnomalyInterface
+
+	stepHarmonic(r *rand.Rand, Ts float64) (HarmonicInjection, bool) // Steps the internal time state of the anomaly and returns the harmonic injected this timestep, if any
+}
+
+// Parameters used to request a harmonic anomaly. These map onto the fields of harmonicAnomaly.
+type HarmonicParams struct {
+	// Defined in AnomalyBase
+
+	Repeats        uint64    `yaml:"Repeats" json:"Repeats"`                                   // the number of times the harmonic injection repeats, 0 for infinite
+	Off            bool      `yaml:"Off" json:"Off"`                                           // true: anomaly deactivated, false: activated
+	StartDelay     float64   `yaml:"StartDelay" json:"StartDelay"`                             // the delay before harmonic injection begins (and between anomaly repeats) in seconds
+	Duration       float64   `yaml:"Duration" json:"Duration"`                                 // the duration of each harmonic injection in seconds, 0 for continuous
+	StartTime      time.Time `yaml:"StartTime,omitempty" json:"StartTime,omitempty"`           // wall-clock time at which the anomaly starts, overriding StartDelay, requires an emulator epoch, optional
+	EndTime        time.Time `yaml:"EndTime,omitempty" json:"EndTime,omitempty"`               // wall-clock time at which the anomaly ends, overriding Duration, requires an emulator epoch, optional
+	ExclusiveGroup string    `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"` // name of a group of anomalies within the container of which at most one is active at a time, empty for none
+	TriggeredBy    string    `yaml:"TriggeredBy,omitempty" json:"TriggeredBy,omitempty"`       // name of an anomaly within the container whose events each start one repeat of this anomaly, after StartDelay, empty to follow its own schedule
+	TriggerOn      string    `yaml:"TriggerOn,omitempty" json:"TriggerOn,omitempty"`           // event of TriggeredBy which starts a repeat: "complete" or "activate", defaults to "complete" if empty
+
+	// Defined in harmonicAnomaly
+
+	Order       float64 `yaml:"Order" json:"Order"`         // harmonic order to inject, must be greater than 0
+	Magnitude   float64 `yaml:"Magnitude" json:"Magnitude"` // magnitude of the injected harmonic in pu, relative to PosSeqMag, default 0
+	MagFuncName string  `yaml:"MagFunc" json:"MagFunc"`     // name of the function used to vary the magnitude of the harmonic, empty defaults to constant =Magnitude
+	Angle       float64 `yaml:"Angle" json:"Angle"`         // angle of the injected harmonic in radians, default 0
+	AngFuncName string  `yaml:"AngFunc" json:"AngFunc"`     // name of the function used to vary the angle of the harmonic, empty defaults to constant =Angle
+}
+
+// Initialise the internal fields of harmonicAnomaly when it is unmarshalled from yaml.
+func (h *harmonicAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params HarmonicParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	harmonicAnomaly, err := NewHarmonicAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to h
+	*h = *harmonicAnomaly
+
+	return nil
+}
+
+// Returns the parameters of harmonicAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (h *harmonicAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[HarmonicParams]{Type: h.typeName, Uuid: h.uuidString(), Params: h.GetParams()}, nil
+}
+
+// Initialise the internal fields of harmonicAnomaly when it is unmarshalled from json.
+func (h *harmonicAnomaly) UnmarshalJSON(data []byte) error {
+	var params HarmonicParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	harmonicAnomaly, err := NewHarmonicAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to h
+	*h = *harmonicAnomaly
+
+	return nil
+}
+
+// Returns the parameters of harmonicAnomaly, including its "Type" field, when it is marshalled to json.
+func (h *harmonicAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(h.typeName, h.uuid, h.GetParams())
+}
+
+// Returns a harmonicAnomaly pointer with the requested parameters, checking for invalid values.
+func NewHarmonicAnomaly(params HarmonicParams) (*harmonicAnomaly, error) {
+	harmonicAnomaly := &harmonicAnomaly{}
+
+	// Invalid values checked by setters
+	if err := harmonicAnomaly.SetStartDelay(params.StartDelay); err != nil {
+		return nil, err
+	}
+	if err := harmonicAnomaly.SetSchedule(params.StartTime, params.EndTime); err != nil {
+		return nil, err
+	}
+	if err := harmonicAnomaly.SetTrigger(params.TriggeredBy, params.TriggerOn); err != nil {
+		return nil, err
+	}
+	if err := harmonicAnomaly.SetOrder(params.Order); err != nil {
+		return nil, err
+	}
+	if err := harmonicAnomaly.SetMagFunctionByName(params.MagFuncName); err != nil {
+		return nil, err
+	}
+	if err := harmonicAnomaly.SetAngFunctionByName(params.AngFuncName); err != nil {
+		return nil, err
+	}
+	if err := harmonicAnomaly.SetDuration(params.Duration); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	harmonicAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
+	harmonicAnomaly.typeName = "harmonic"
+	harmonicAnomaly.Magnitude = params.Magnitude
+	harmonicAnomaly.Angle = params.Angle
+	harmonicAnomaly.Repeats = params.Repeats
+	harmonicAnomaly.Off = params.Off
+
+	return harmonicAnomaly, nil
+}
+
+// Harmonic anomalies do not contribute a scalar change to the signal. The internal time state
+// is still stepped so that the anomaly remains in sync if placed in a scalar container.
+func (h *harmonicAnomaly) stepAnomaly(r *rand.Rand, Ts float64) float64 {
+	h.stepHarmonic(r, Ts)
+	return 0.0
+}
+
+// Returns the harmonic injected by the anomaly this timestep, and whether the injection is active.
+// Manages internal indices to track the progress of injections, and delays between injections.
+func (h *harmonicAnomaly) stepHarmonic(r *rand.Rand, Ts float64) (HarmonicInjection, bool) {
+	if h.Off {
+		return HarmonicInjection{}, false
+	}
+	h.setFunctionRand(h.randSource(r))
+
+	// Check if the harmonic anomaly is active this timestep
+	h.isAnomalyActive = h.CheckAnomalyActive(Ts)
+	if !h.isAnomalyActive {
+		h.startDelayIndex += 1 // increment to keep track of the delay between injection repeats
+		return HarmonicInjection{}, false
+	}
+
+	// Update the index after logging the current time
+	h.elapsedActivatedTime = float64(h.elapsedActivatedIndex) * Ts
+	h.elapsedActivatedIndex += 1
+
+	injection := HarmonicInjection{
+		Order:     h.order,
+		Magnitude: h.Magnitude,
+		Angle:     h.Angle,
+	}
+	if h.magFunction != nil {
+		injection.Magnitude = h.magFunction(h.elapsedActivatedTime, h.Magnitude, h.duration)
+	}
+	if h.angFunction != nil {
+		injection.Angle = h.angFunction(h.elapsedActivatedTime, h.Angle, h.duration)
+	}
+
+	// If the injection is complete, reset the index and increment the repeat counter
+	if h.duration > 0 && h.elapsedActivatedIndex == int(h.duration/Ts) {
+		h.elapsedActivatedIndex = 0
+		h.startDelayIndex = 0
+		h.countRepeats += 1
+	}
+
+	return injection, true
+}
+
+// Setters
+
+// Sets the duration of each harmonic injection in seconds. If duration=0, the injection is continuous.
+func (h *harmonicAnomaly) SetDuration(duration float64) error {
+	if duration < 0 {
+		return errors.New("duration must be positive value")
+	}
+	if duration == 0 && (h.magFunction != nil || h.angFunction != nil) {
+		return errors.New("duration must be greater than 0 when using a functional dependence for magnitude or angle")
+	}
+	h.duration = duration
+	return nil
+}
+
+// Sets the harmonic order to inject if order > 0.
+func (h *harmonicAnomaly) SetOrder(order float64) error {
+	if order <= 0 {
+		return errors.New("harmonic order must be greater than 0")
+	}
+	h.order = order
+	return nil
+}
+
+// Sets the field magFunction to the function with the given name.
+func (h *harmonicAnomaly) SetMagFunctionByName(name string) error {
+	return h.SetFunctionByName(name, h.lookupFunction, &h.magFuncName, &h.magFunction)
+}
+
+// Sets the field angFunction to the function with the given name.
+func (h *harmonicAnomaly) SetAngFunctionByName(name string) error {
+	return h.SetFunctionByName(name, h.lookupFunction, &h.angFuncName, &h.angFunction)
+}
+
+// Sets the field magFunction to f, which need not be registered in mathfuncs. The name identifies f in the
+// parameters of the anomaly, so must be registered for these to be unmarshalled.
+func (h *harmonicAnomaly) SetMagFunction(f mathfuncs.MathsFunction, name string) error {
+	return h.SetFunction(f, name, &h.magFuncName, &h.magFunction)
+}
+
+// Sets the field angFunction to f, which need not be registered in mathfuncs. The name identifies f in the
+// parameters of the anomaly, so must be registered for these to be unmarshalled.
+func (h *harmonicAnomaly) SetAngFunction(f mathfuncs.MathsFunction, name string) error {
+	return h.SetFunction(f, name, &h.angFuncName, &h.angFunction)
+}
+
+// Returns a new harmonicAnomaly with the same parameters, at the start of its schedule, including functions set
+// by SetMagFunction or SetAngFunction.
+func (h *harmonicAnomaly) clone() (AnomalyInterface, error) {
+	params := h.GetParams()
+	params.MagFuncName = h.registeredName(params.MagFuncName)
+	params.AngFuncName = h.registeredName(params.AngFuncName)
+	clone, err := NewHarmonicAnomaly(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := h.copyFunction(h.magFuncName, clone.SetMagFunction); err != nil {
+		return nil, err
+	}
+	if err := h.copyFunction(h.angFuncName, clone.SetAngFunction); err != nil {
+		return nil, err
+	}
+	return clone, nil
+}
+
+// Getters
+
+// Returns the parameters which define harmonicAnomaly, such that NewHarmonicAnomaly returns an identical anomaly.
+func (h *harmonicAnomaly) GetParams() HarmonicParams {
+	return HarmonicParams{
+		Repeats:        h.Repeats,
+		Off:            h.Off,
+		StartDelay:     h.startDelay,
+		Duration:       h.duration,
+		StartTime:      h.startTime,
+		EndTime:        h.endTime,
+		ExclusiveGroup: h.exclusiveGroup,
+		TriggeredBy:    h.triggeredBy,
+		TriggerOn:      h.triggerOn,
+		Order:          h.order,
+		Magnitude:      h.Magnitude,
+		MagFuncName:    h.magFuncName,
+		Angle:          h.Angle,
+		AngFuncName:    h.angFuncName,
+	}
+}
+
+func (h *harmonicAnomaly) GetOrder() float64 {
+	return h.order
+}
+
+func (h *harmonicAnomaly) GetMagFuncName() string {
+	return h.magFuncName
+}
+
+func (h *harmonicAnomaly) GetAngFuncName() string {
+	return h.angFuncName
+}
+
+func (h *harmonicAnomaly) GetMagFunction() mathfuncs.MathsFunction {
+	return h.magFunction
+}
+
+func (h *harmonicAnomaly) GetAngFunction() mathfuncs.MathsFunction {
+	return h.angFunction
+}
@@ -0,0 +1,193 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Quality describes the validity of a sample.
+type Quality int
+
+const (
+	QualityGood    Quality = iota // sample is valid
+	QualityInvalid                // sample is flagged as invalid, but its value is retained
+	QualityMissing                // sample is flagged as invalid, and its value is replaced with NaN
+)
+
+// Marks samples as invalid for the duration of the anomaly, emulating missing or untrustworthy data.
+type invalidAnomaly struct {
+	AnomalyBase
+
+	KeepValue bool // true: samples are flagged invalid but retain their values, false: sample values are replaced with NaN
+}
+
+// qualityMarker is implemented by anomalies which mark samples as invalid rather than changing their value.
+type qualityMarker interface {
+	getQuality() Quality // Returns the quality of samples marked by the anomaly this timestep
+}
+
+// Parameters used to request an invalid data anomaly. These map onto the fields of invalidAnomaly.
+type InvalidParams struct {
+	// Defined in AnomalyBase
+
+	Repeats        uint64    `yaml:"Repeats" json:"Repeats"`                                   // the number of times the invalid data window repeats, 0 for infinite
+	Off            bool      `yaml:"Off" json:"Off"`                                           // true: anomaly deactivated, false: activated
+	StartDelay     float64   `yaml:"StartDelay" json:"StartDelay"`                             // the delay before invalid data begins (and between anomaly repeats) in seconds
+	Duration       float64   `yaml:"Duration" json:"Duration"`                                 // the duration of each invalid data window in seconds, 0 for continuous
+	StartTime      time.Time `yaml:"StartTime,omitempty" json:"StartTime,omitempty"`           // wall-clock time at which the anomaly starts, overriding StartDelay, requires an emulator epoch, optional
+	EndTime        time.Time `yaml:"EndTime,omitempty" json:"EndTime,omitempty"`               // wall-clock time at which the anomaly ends, overriding Duration, requires an emulator epoch, optional
+	ExclusiveGroup string    `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"` // name of a group of anomalies within the container of which at most one is active at a time, empty for none
+	TriggeredBy    string    `yaml:"TriggeredBy,omitempty" json:"TriggeredBy,omitempty"`       // name of an anomaly within the container whose events each start one repeat of this anomaly, after StartDelay, empty to follow its own schedule
+	TriggerOn      string    `yaml:"TriggerOn,omitempty" json:"TriggerOn,omitempty"`           // event of TriggeredBy which starts a repeat: "complete" or "activate", defaults to "complete" if empty
+
+	// Defined in invalidAnomaly
+
+	KeepValue bool `yaml:"KeepValue" json:"KeepValue"` // true: samples are flagged invalid but retain their values, false: sample values are replaced with NaN
+}
+
+// Initialise the internal fields of invalidAnomaly when it is unmarshalled from yaml.
+func (i *invalidAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params InvalidParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	invalidAnomaly, err := NewInvalidAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to i
+	*i = *invalidAnomaly
+
+	return nil
+}
+
+// Returns the parameters of invalidAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (i *invalidAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[InvalidParams]{Type: i.typeName, Uuid: i.uuidString(), Params: i.GetParams()}, nil
+}
+
+// Initialise the internal fields of invalidAnomaly when it is unmarshalled from json.
+func (i *invalidAnomaly) UnmarshalJSON(data []byte) error {
+	var params InvalidParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	invalidAnomaly, err := NewInvalidAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to i
+	*i = *invalidAnomaly
+
+	return nil
+}
+
+// Returns the parameters of invalidAnomaly, including its "Type" field, when it is marshalled to json.
+func (i *invalidAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(i.typeName, i.uuid, i.GetParams())
+}
+
+// Returns an invalidAnomaly pointer with the requested parameters, checking for invalid values.
+func NewInvalidAnomaly(params InvalidParams) (*invalidAnomaly, error) {
+	invalidAnomaly := &invalidAnomaly{}
+
+	// Invalid values checked by setters
+	if err := invalidAnomaly.SetStartDelay(params.StartDelay); err != nil {
+		return nil, err
+	}
+	if err := invalidAnomaly.SetSchedule(params.StartTime, params.EndTime); err != nil {
+		return nil, err
+	}
+	if err := invalidAnomaly.SetTrigger(params.TriggeredBy, params.TriggerOn); err != nil {
+		return nil, err
+	}
+	if err := invalidAnomaly.SetDuration(params.Duration); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	invalidAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
+	invalidAnomaly.typeName = "invalid"
+	invalidAnomaly.KeepValue = params.KeepValue
+	invalidAnomaly.Repeats = params.Repeats
+	invalidAnomaly.Off = params.Off
+
+	return invalidAnomaly, nil
+}
+
+// Invalid data anomalies do not change the signal value, so always return 0. Whether samples are
+// marked invalid this timestep is available from the container using GetQuality.
+func (i *invalidAnomaly) stepAnomaly(_ *rand.Rand, Ts float64) float64 {
+	if i.Off {
+		i.isAnomalyActive = false
+		return 0.0
+	}
+
+	// Check if the invalid data anomaly is active this timestep
+	i.isAnomalyActive = i.CheckAnomalyActive(Ts)
+	if !i.isAnomalyActive {
+		i.startDelayIndex += 1 // increment to keep track of the delay between invalid data repeats
+		return 0.0
+	}
+
+	// Update the index after logging the current time
+	i.elapsedActivatedTime = float64(i.elapsedActivatedIndex) * Ts
+	i.elapsedActivatedIndex += 1
+
+	// If the invalid data window is complete, reset the index and increment the repeat counter
+	if i.duration > 0 && i.elapsedActivatedIndex == int(i.duration/Ts) {
+		i.elapsedActivatedIndex = 0
+		i.startDelayIndex = 0
+		i.countRepeats += 1
+	}
+
+	return 0.0
+}
+
+// Returns the quality of samples marked by the anomaly this timestep.
+func (i *invalidAnomaly) getQuality() Quality {
+	if !i.isAnomalyActive {
+		return QualityGood
+	}
+	if i.KeepValue {
+		return QualityInvalid
+	}
+	return QualityMissing
+}
+
+// Setters
+
+// Sets the duration of each invalid data window in seconds if duration >= 0. If duration=0, data is invalid continuously.
+func (i *invalidAnomaly) SetDuration(duration float64) error {
+	if duration < 0 {
+		return errors.New("duration must be positive value")
+	}
+	i.duration = duration
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define invalidAnomaly, such that NewInvalidAnomaly returns an identical anomaly.
+func (i *invalidAnomaly) GetParams() InvalidParams {
+	return InvalidParams{
+		Repeats:        i.Repeats,
+		Off:            i.Off,
+		StartDelay:     i.startDelay,
+		Duration:       i.duration,
+		StartTime:      i.startTime,
+		EndTime:        i.endTime,
+		ExclusiveGroup: i.exclusiveGroup,
+		TriggeredBy:    i.triggeredBy,
+		TriggerOn:      i.triggerOn,
+		KeepValue:      i.KeepValue,
+	}
+}
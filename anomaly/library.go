@@ -0,0 +1,182 @@
+package anomaly
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// LoadOptions control how anomalies are loaded by UnmarshalWithOptions.
+type LoadOptions struct {
+	LibraryDir string // directory against which relative library file paths in AnomalyRef fields are resolved, or the working directory if empty
+}
+
+// maxRefDepth is the maximum number of nested references followed when resolving an AnomalyRef,
+// which guards against cyclic references between library entries.
+const maxRefDepth = 16
+
+// Unmarshals yaml or json data, such as an anomaly container or a whole emulator, into out after resolving
+// every "AnomalyRef" field within it with options, see resolveAnomalyRef. Unmarshalling data directly resolves
+// relative library file paths against the working directory.
+func UnmarshalWithOptions(data []byte, out interface{}, options LoadOptions) error {
+	var document interface{}
+	if err := yaml.Unmarshal(data, &document); err != nil {
+		return err
+	}
+	// Library entries are upgraded to the version of the document, which upgrades them with its own entries
+	version := 1
+	if fields, ok := toStringMap(document); ok && fields["Version"] != nil {
+		var err error
+		if version, err = popConfigVersion(map[string]interface{}{"Version": fields["Version"]}); err != nil {
+			return err
+		}
+	}
+	resolved, err := resolveAnomalyRefs(document, options.LibraryDir, 0, version)
+	if err != nil {
+		return err
+	}
+	resolvedYAML, err := yaml.Marshal(resolved)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(resolvedYAML, out)
+}
+
+// Resolves the "AnomalyRef" field of an anomaly entry, if present, against the working directory. A reference
+// of the form "lib.yaml#name" is replaced by the entry with the given name in the library file, which holds
+// anomaly entries keyed by name in the same format as a container, including its Version. Any other fields of
+// the entry override the fields of the library entry. Library entries may themselves contain references, which
+// are resolved against the directory of their library file.
+func resolveAnomalyRef(value map[string]interface{}) (map[string]interface{}, error) {
+	resolved, err := resolveAnomalyRefs(value, "", 0, latestConfigVersion())
+	if err != nil {
+		return nil, err
+	}
+	return resolved.(map[string]interface{}), nil
+}
+
+// Returns node, a value unmarshalled from yaml or json, with every anomaly entry within it which has an
+// "AnomalyRef" field replaced by its resolved entry, see resolveAnomalyRef. Relative library file paths are
+// resolved against dir, or the working directory if dir is empty, depth is the number of references already
+// followed, and library entries are upgraded to version, the version of the entries of node.
+func resolveAnomalyRefs(node interface{}, dir string, depth int, version int) (interface{}, error) {
+	switch node := node.(type) {
+	case map[string]interface{}:
+		if ref, ok := node["AnomalyRef"]; ok {
+			return resolveEntry(ref, node, dir, depth, version)
+		}
+		resolved := make(map[string]interface{}, len(node))
+		for key, field := range node {
+			field, err := resolveAnomalyRefs(field, dir, depth, version)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = field
+		}
+		return resolved, nil
+	case map[interface{}]interface{}:
+		if ref, ok := node["AnomalyRef"]; ok {
+			value := make(map[string]interface{}, len(node))
+			for key, field := range node {
+				value[fmt.Sprint(key)] = field
+			}
+			return resolveEntry(ref, value, dir, depth, version)
+		}
+		resolved := make(map[interface{}]interface{}, len(node))
+		for key, field := range node {
+			field, err := resolveAnomalyRefs(field, dir, depth, version)
+			if err != nil {
+				return nil, err
+			}
+			resolved[key] = field
+		}
+		return resolved, nil
+	case []interface{}:
+		resolved := make([]interface{}, len(node))
+		for i, element := range node {
+			element, err := resolveAnomalyRefs(element, dir, depth, version)
+			if err != nil {
+				return nil, err
+			}
+			resolved[i] = element
+		}
+		return resolved, nil
+	default:
+		return node, nil
+	}
+}
+
+// Returns the entry referenced by ref, upgraded to version and with its own references resolved against the
+// directory of its library file, merged with the other fields of the referencing entry value.
+func resolveEntry(ref interface{}, value map[string]interface{}, dir string, depth int, version int) (map[string]interface{}, error) {
+	if depth == maxRefDepth {
+		return nil, fmt.Errorf("too many nested anomaly references: %v", ref)
+	}
+	refString, ok := ref.(string)
+	if !ok {
+		return nil, fmt.Errorf("anomaly reference must be a string: %v", ref)
+	}
+	entry, path, err := loadLibraryEntry(refString, dir, version)
+	if err != nil {
+		return nil, err
+	}
+	resolved, err := resolveAnomalyRefs(entry, filepath.Dir(path), depth+1, version)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fields of the referencing entry override those of the library entry
+	merged := resolved.(map[string]interface{})
+	for key, field := range value {
+		if key == "AnomalyRef" {
+			continue
+		}
+		field, err := resolveAnomalyRefs(field, dir, depth, version)
+		if err != nil {
+			return nil, err
+		}
+		merged[key] = field
+	}
+	return merged, nil
+}
+
+// Returns the anomaly entry referenced by ref, of the form "lib.yaml#name", and the path of its library file,
+// resolving a relative path against dir, or the working directory if dir is empty. The entry is upgraded from
+// the Version of the library file to version, the version of the document which references it.
+func loadLibraryEntry(ref string, dir string, version int) (map[string]interface{}, string, error) {
+	path, name, ok := strings.Cut(ref, "#")
+	if !ok || path == "" || name == "" {
+		return nil, "", fmt.Errorf("anomaly reference must be of the form file#name: %s", ref)
+	}
+	if !filepath.IsAbs(path) && dir != "" {
+		path = filepath.Join(dir, path)
+	}
+
+	fileBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, "", fmt.Errorf("loading anomaly library: %w", err)
+	}
+	var library map[string]interface{}
+	if err := yaml.Unmarshal(fileBytes, &library); err != nil {
+		return nil, "", fmt.Errorf("loading anomaly library %s: %w", path, err)
+	}
+	libraryVersion, err := popConfigVersion(library)
+	if err != nil {
+		return nil, "", fmt.Errorf("loading anomaly library %s: %w", path, err)
+	}
+	if libraryVersion > version {
+		return nil, "", fmt.Errorf("anomaly library %s has config version %d, newer than version %d of the configuration which references it", path, libraryVersion, version)
+	}
+
+	entry, ok := toStringMap(library[name])
+	if !ok {
+		return nil, "", fmt.Errorf("anomaly not found in library %s: %s", path, name)
+	}
+	if err := migrateEntry(entry, libraryVersion, version); err != nil {
+		return nil, "", fmt.Errorf("loading anomaly library %s: %s: %w", path, name, err)
+	}
+	return entry, path, nil
+}
@@ -0,0 +1,115 @@
+package anomaly
+
+import (
+	"fmt"
+	"math"
+)
+
+// CurrentConfigVersion is the version of the configuration schema of anomaly entries, which is recorded in the
+// Version field of containers, library files and the emulator configurations which contain them. Changing the
+// name or structure of a field of an anomaly requires incrementing CurrentConfigVersion and appending a
+// migration to entryMigrations, so that existing configuration files still load.
+const CurrentConfigVersion = 1
+
+// entryMigration upgrades an anomaly entry, unmarshalled from yaml or json, in place by one version. Entries
+// may be partial, e.g. those which override fields of a library entry, so a migration must only change the
+// fields which are present.
+type entryMigration func(entry map[string]interface{}) error
+
+// entryMigrations[i] upgrades anomaly entries from version i+1 to version i+2, so there must be
+// CurrentConfigVersion-1 migrations.
+var entryMigrations []entryMigration
+
+// Returns the version to which anomaly entries are upgraded, which is CurrentConfigVersion.
+func latestConfigVersion() int {
+	return len(entryMigrations) + 1
+}
+
+// Returns the version recorded by the "Version" field of a container or library document, unmarshalled from
+// yaml or json, and removes the field from the document so that only anomaly entries remain. Documents
+// without a Version are version 1, and a "Version" field which is a map is an anomaly of that name rather
+// than a version. Returns an error if the version is not supported.
+func popConfigVersion(doc map[string]interface{}) (int, error) {
+	value, ok := doc["Version"]
+	if !ok {
+		return 1, nil
+	}
+	if _, isEntry := toStringMap(value); isEntry {
+		return 1, nil
+	}
+	delete(doc, "Version")
+
+	version := 0
+	switch v := value.(type) {
+	case int:
+		version = v
+	case float64: // json numbers
+		if v == math.Trunc(v) {
+			version = int(v)
+		}
+	}
+	if version < 1 {
+		return 0, fmt.Errorf("config version must be a positive integer: %v", value)
+	}
+	if latest := latestConfigVersion(); version > latest {
+		return 0, fmt.Errorf("config version %d is newer than the latest supported version %d", version, latest)
+	}
+	return version, nil
+}
+
+// Upgrades an anomaly entry in place from version to target, including the members of a group and the
+// children of a composite anomaly, which are entries of the same version.
+func migrateEntry(entry map[string]interface{}, version int, target int) error {
+	if version == target || entry == nil {
+		return nil
+	}
+	for v := version; v < target; v++ {
+		if err := entryMigrations[v-1](entry); err != nil {
+			return fmt.Errorf("migrating anomaly from version %d: %w", v, err)
+		}
+	}
+
+	if members, ok := toStringMap(entry["Members"]); ok && entry["Type"] == "group" {
+		for name, member := range members {
+			if member, ok := toStringMap(member); ok {
+				if err := migrateEntry(member, version, target); err != nil {
+					return err
+				}
+				members[name] = member
+			}
+		}
+		entry["Members"] = members
+	}
+	if children, ok := entry["Children"].([]interface{}); ok {
+		for i, child := range children {
+			if child, ok := toStringMap(child); ok {
+				if err := migrateEntry(child, version, target); err != nil {
+					return err
+				}
+				children[i] = child
+			}
+		}
+	}
+	return nil
+}
+
+// Returns the anomaly entries of a container document, unmarshalled from yaml, upgraded from the Version of the
+// document to the latest version, see popConfigVersion.
+func containerEntries(doc map[string]interface{}) (map[string]map[string]interface{}, error) {
+	version, err := popConfigVersion(doc)
+	if err != nil {
+		return nil, err
+	}
+	entries := make(map[string]map[string]interface{}, len(doc))
+	for key, value := range doc {
+		entry, ok := toStringMap(value)
+		if !ok && value != nil {
+			return nil, fmt.Errorf("%s must be an anomaly entry", key)
+		}
+		if err := migrateEntry(entry, version, latestConfigVersion()); err != nil {
+			return nil, &FieldError{Path: key, Err: err}
+		}
+		entries[key] = entry
+	}
+	return entries, nil
+}
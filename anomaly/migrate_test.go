@@ -0,0 +1,92 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that the migrations of anomaly entries upgrade them to CurrentConfigVersion
+func TestCurrentConfigVersion(t *testing.T) {
+	assert.Equal(t, CurrentConfigVersion, latestConfigVersion())
+}
+
+// Assert that anomaly entries of earlier versions are upgraded wherever they are unmarshalled from
+func TestContainer_ConfigVersion(t *testing.T) {
+	// a hypothetical version 2 which renamed Mag of trend anomalies to Magnitude
+	defer func(migrations []entryMigration) { entryMigrations = migrations }(entryMigrations)
+	entryMigrations = append(entryMigrations, func(entry map[string]interface{}) error {
+		if mag, ok := entry["Mag"]; ok {
+			entry["Magnitude"] = mag
+			delete(entry, "Mag")
+		}
+		return nil
+	})
+	magnitude := func(a AnomalyInterface) float64 {
+		trend, ok := AsTrendAnomaly(a)
+		assert.True(t, ok)
+		return trend.GetParams().Magnitude
+	}
+
+	// containers without a Version are version 1, including the members of groups and children of composites
+	var container Container
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+drift: {Type: trend, Mag: 2}
+drifts:
+  Type: group
+  Members:
+    a: {Type: trend, Mag: 3}
+both:
+  Type: composite
+  Children:
+    - {Type: trend, Mag: 4}
+`), &container))
+	assert.Equal(t, 2.0, magnitude(container["drift"]))
+	assert.Equal(t, 3.0, magnitude(container["drifts.a"]))
+	assert.Equal(t, 4.0, magnitude(container["both"].(*compositeAnomaly).Children[0]))
+
+	container = nil
+	assert.NoError(t, yaml.Unmarshal([]byte("Version: 2\ndrift: {Type: trend, Magnitude: 2}\n"), &container))
+	assert.Len(t, container, 1)
+	assert.Equal(t, 2.0, magnitude(container["drift"]))
+
+	container = nil
+	assert.NoError(t, json.Unmarshal([]byte(`{"drift": {"Type": "trend", "Mag": 2}}`), &container))
+	assert.Equal(t, 2.0, magnitude(container["drift"]))
+	container = nil
+	assert.NoError(t, json.Unmarshal([]byte(`{"Version": 2, "drift": {"Type": "trend", "Magnitude": 2}}`), &container))
+	assert.Equal(t, 2.0, magnitude(container["drift"]))
+
+	var correlation Correlation
+	assert.NoError(t, yaml.Unmarshal([]byte("Version: 1\nType: trend\nMag: 2\nTargets: {V: 1}\n"), &correlation))
+	assert.Equal(t, 2.0, magnitude(correlation.GetSource()))
+
+	// library entries are upgraded to the version of the document which references them
+	dir := t.TempDir()
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "v1.yaml"), []byte("drift: {Type: trend, Mag: 2}\n"), 0o644))
+	assert.NoError(t, os.WriteFile(filepath.Join(dir, "v2.yaml"), []byte("Version: 2\ndrift: {Type: trend, Magnitude: 2}\n"), 0o644))
+	for _, yamlStr := range []string{
+		"drift: {AnomalyRef: v1.yaml#drift, Mag: 3}\n",
+		"Version: 2\ndrift: {AnomalyRef: v1.yaml#drift, Magnitude: 3}\n",
+		"Version: 2\ndrift: {AnomalyRef: v2.yaml#drift, Magnitude: 3}\n",
+	} {
+		container = nil
+		assert.NoError(t, UnmarshalWithOptions([]byte(yamlStr), &container, LoadOptions{LibraryDir: dir}), yamlStr)
+		assert.Equal(t, 3.0, magnitude(container["drift"]), yamlStr)
+	}
+	err := UnmarshalWithOptions([]byte("drift: {AnomalyRef: v2.yaml#drift}\n"), &container, LoadOptions{LibraryDir: dir})
+	assert.ErrorContains(t, err, "newer than version 1")
+
+	// unsupported versions are rejected, and a map is an anomaly named Version
+	for _, yamlStr := range []string{"Version: 3\n", "Version: 0\n", "Version: two\n"} {
+		assert.Error(t, yaml.Unmarshal([]byte(yamlStr), &container), yamlStr)
+	}
+	assert.Error(t, json.Unmarshal([]byte(`{"Version": 2.5}`), &container))
+	container = nil
+	assert.NoError(t, yaml.Unmarshal([]byte("Version: {Type: trend, Mag: 2}\n"), &container))
+	assert.Equal(t, 2.0, magnitude(container["Version"]))
+}
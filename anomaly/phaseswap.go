@@ -0,0 +1,221 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"strings"
+	"time"
+)
+
+// Reassigns the phases of three-phase waveform data to different outputs, e.g. swapping phases B and C,
+// emulating wiring errors. Rather than changing a signal value, the anomaly returns a phase order.
+type phaseSwapAnomaly struct {
+	AnomalyBase
+
+	order string // order in which phases are assigned to the A, B and C outputs while active, e.g. "ACB" swaps B and C
+
+	// internal state
+	mapping [3]int // index of the phase assigned to each output; set internally from order
+}
+
+// PhaseMapper is implemented by anomalies which reassign the phases of three-phase waveforms to
+// different outputs, rather than contributing a scalar change to the signal.
+type PhaseMapper interface {
+	AnomalyInterface
+
+	stepPhaseOrder(r *rand.Rand, Ts float64) ([3]int, bool) // Steps the internal time state of the anomaly and returns the index of the phase assigned to each output this timestep, if active
+}
+
+// Parameters used to request a phase swap anomaly. These map onto the fields of phaseSwapAnomaly.
+type PhaseSwapParams struct {
+	// Defined in AnomalyBase
+
+	Repeats        uint64    `yaml:"Repeats" json:"Repeats"`                                   // the number of times the phase swap repeats, 0 for infinite
+	Off            bool      `yaml:"Off" json:"Off"`                                           // true: anomaly deactivated, false: activated
+	StartDelay     float64   `yaml:"StartDelay" json:"StartDelay"`                             // the delay before the phase swap begins (and between anomaly repeats) in seconds
+	Duration       float64   `yaml:"Duration" json:"Duration"`                                 // the duration of each phase swap in seconds, 0 for continuous
+	StartTime      time.Time `yaml:"StartTime,omitempty" json:"StartTime,omitempty"`           // wall-clock time at which the anomaly starts, overriding StartDelay, requires an emulator epoch, optional
+	EndTime        time.Time `yaml:"EndTime,omitempty" json:"EndTime,omitempty"`               // wall-clock time at which the anomaly ends, overriding Duration, requires an emulator epoch, optional
+	ExclusiveGroup string    `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"` // name of a group of anomalies within the container of which at most one is active at a time, empty for none
+	TriggeredBy    string    `yaml:"TriggeredBy,omitempty" json:"TriggeredBy,omitempty"`       // name of an anomaly within the container whose events each start one repeat of this anomaly, after StartDelay, empty to follow its own schedule
+	TriggerOn      string    `yaml:"TriggerOn,omitempty" json:"TriggerOn,omitempty"`           // event of TriggeredBy which starts a repeat: "complete" or "activate", defaults to "complete" if empty
+
+	// Defined in phaseSwapAnomaly
+
+	Order string `yaml:"Order" json:"Order"` // order in which phases are assigned to the A, B and C outputs, a permutation of "ABC", defaults to "ACB" (B and C swapped) if empty
+}
+
+// Initialise the internal fields of phaseSwapAnomaly when it is unmarshalled from yaml.
+func (p *phaseSwapAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params PhaseSwapParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	phaseSwapAnomaly, err := NewPhaseSwapAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to p
+	*p = *phaseSwapAnomaly
+
+	return nil
+}
+
+// Returns the parameters of phaseSwapAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (p *phaseSwapAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[PhaseSwapParams]{Type: p.typeName, Uuid: p.uuidString(), Params: p.GetParams()}, nil
+}
+
+// Initialise the internal fields of phaseSwapAnomaly when it is unmarshalled from json.
+func (p *phaseSwapAnomaly) UnmarshalJSON(data []byte) error {
+	var params PhaseSwapParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	phaseSwapAnomaly, err := NewPhaseSwapAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to p
+	*p = *phaseSwapAnomaly
+
+	return nil
+}
+
+// Returns the parameters of phaseSwapAnomaly, including its "Type" field, when it is marshalled to json.
+func (p *phaseSwapAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(p.typeName, p.uuid, p.GetParams())
+}
+
+// Returns a phaseSwapAnomaly pointer with the requested parameters, checking for invalid values.
+func NewPhaseSwapAnomaly(params PhaseSwapParams) (*phaseSwapAnomaly, error) {
+	phaseSwapAnomaly := &phaseSwapAnomaly{}
+
+	// Invalid values checked by setters
+	if err := phaseSwapAnomaly.SetStartDelay(params.StartDelay); err != nil {
+		return nil, err
+	}
+	if err := phaseSwapAnomaly.SetSchedule(params.StartTime, params.EndTime); err != nil {
+		return nil, err
+	}
+	if err := phaseSwapAnomaly.SetTrigger(params.TriggeredBy, params.TriggerOn); err != nil {
+		return nil, err
+	}
+	if err := phaseSwapAnomaly.SetDuration(params.Duration); err != nil {
+		return nil, err
+	}
+	if err := phaseSwapAnomaly.SetOrder(params.Order); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	phaseSwapAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
+	phaseSwapAnomaly.typeName = "phaseswap"
+	phaseSwapAnomaly.Repeats = params.Repeats
+	phaseSwapAnomaly.Off = params.Off
+
+	return phaseSwapAnomaly, nil
+}
+
+// Phase swap anomalies do not contribute a scalar change to the signal. The internal time state
+// is still stepped so that the anomaly remains in sync if placed in a scalar container.
+func (p *phaseSwapAnomaly) stepAnomaly(r *rand.Rand, Ts float64) float64 {
+	p.stepPhaseOrder(r, Ts)
+	return 0.0
+}
+
+// Returns the index of the phase assigned to each output this timestep, and whether the swap is active.
+// Manages internal indices to track the progress of swaps, and delays between swaps.
+func (p *phaseSwapAnomaly) stepPhaseOrder(_ *rand.Rand, Ts float64) ([3]int, bool) {
+	if p.Off {
+		p.isAnomalyActive = false
+		return [3]int{0, 1, 2}, false
+	}
+
+	// Check if the phase swap anomaly is active this timestep
+	p.isAnomalyActive = p.CheckAnomalyActive(Ts)
+	if !p.isAnomalyActive {
+		p.startDelayIndex += 1 // increment to keep track of the delay between swap repeats
+		return [3]int{0, 1, 2}, false
+	}
+
+	// Update the index after logging the current time
+	p.elapsedActivatedTime = float64(p.elapsedActivatedIndex) * Ts
+	p.elapsedActivatedIndex += 1
+
+	// If the phase swap is complete, reset the index and increment the repeat counter
+	if p.duration > 0 && p.elapsedActivatedIndex == int(p.duration/Ts) {
+		p.elapsedActivatedIndex = 0
+		p.startDelayIndex = 0
+		p.countRepeats += 1
+	}
+
+	return p.mapping, true
+}
+
+// Setters
+
+// Sets the duration of each phase swap in seconds if duration >= 0. If duration=0, the swap is continuous.
+func (p *phaseSwapAnomaly) SetDuration(duration float64) error {
+	if duration < 0 {
+		return errors.New("duration must be positive value")
+	}
+	p.duration = duration
+	return nil
+}
+
+// Sets the order in which phases are assigned to the A, B and C outputs, if order is a permutation of "ABC".
+// An empty order defaults to "ACB", which swaps phases B and C.
+func (p *phaseSwapAnomaly) SetOrder(order string) error {
+	if order == "" {
+		order = "ACB" // default to swapping B and C if no order is provided
+	}
+	order = strings.ToUpper(order)
+
+	var mapping [3]int
+	var used [3]bool
+	if len(order) != 3 {
+		return errors.New("phase order must be a permutation of ABC")
+	}
+	for i := range order {
+		phase := int(order[i]) - 'A'
+		if phase < 0 || phase > 2 || used[phase] {
+			return errors.New("phase order must be a permutation of ABC")
+		}
+		used[phase] = true
+		mapping[i] = phase
+	}
+
+	p.order = order
+	p.mapping = mapping
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define phaseSwapAnomaly, such that NewPhaseSwapAnomaly returns an identical anomaly.
+func (p *phaseSwapAnomaly) GetParams() PhaseSwapParams {
+	return PhaseSwapParams{
+		Repeats:        p.Repeats,
+		Off:            p.Off,
+		StartDelay:     p.startDelay,
+		Duration:       p.duration,
+		StartTime:      p.startTime,
+		EndTime:        p.endTime,
+		ExclusiveGroup: p.exclusiveGroup,
+		TriggeredBy:    p.triggeredBy,
+		TriggerOn:      p.triggerOn,
+		Order:          p.order,
+	}
+}
+
+func (p *phaseSwapAnomaly) GetOrder() string {
+	return p.order
+}
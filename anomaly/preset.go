@@ -0,0 +1,72 @@
+package anomaly
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Curated anomaly entries, in the same format as the entries of a container, which standardise common
+// scenarios. Magnitudes are given as a percentage of the nominal value of the channel where possible, so
+// that presets can be used in containers of any channel.
+var presets = map[string]map[string]interface{}{
+	// samples are missing for half a second, a minute into the emulation
+	"sensor_dropout_short": {"Type": "invalid", "StartDelay": 60.0, "Duration": 0.5, "Repeats": 1},
+	// the channel drifts linearly by 1% of its nominal value over a day
+	"slow_drift_1pct_per_day": {"Type": "trend", "MagnitudePercent": 1.0, "MagFunc": "linear", "Duration": 86400.0, "Repeats": 1},
+	// half an hour of frequent spikes, mostly small with occasional large ones, of 10% of the nominal value on average, e.g. due to lightning
+	"storm_spikes": {"Type": "spike", "Probability": 0.002, "MagnitudePercent": 10.0, "AmplitudeDistribution": "exponential", "Duration": 1800.0, "Repeats": 1},
+	// the sampling clock runs fast by 10 parts per million
+	"clock_drift_10ppm": {"Type": "clockdrift", "DriftPPM": 10.0},
+	// phases B and C are swapped, e.g. due to a wiring error during commissioning
+	"wiring_swap_bc": {"Type": "phaseswap", "Order": "ACB"},
+}
+
+// Returns the names of the available presets, in order.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// Returns a new anomaly with the parameters of the named preset, see PresetNames, overridden by overrides,
+// which are keyed by the yaml names of the fields, e.g. "Magnitude". overrides may be nil.
+func NewFromPreset(name string, overrides map[string]interface{}) (AnomalyInterface, error) {
+	value := make(map[string]interface{}, len(overrides)+1)
+	for key, field := range overrides {
+		value[key] = field
+	}
+	value["Preset"] = name
+	return unmarshalAnomaly(value)
+}
+
+// Resolves the "Preset" field of an anomaly entry, if present, replacing it by the fields of the named
+// preset. Any other fields of the entry override the fields of the preset, except for its type.
+func resolvePreset(value map[string]interface{}) (map[string]interface{}, error) {
+	name, ok := value["Preset"]
+	if !ok {
+		return value, nil
+	}
+	nameString, _ := name.(string)
+	preset, ok := presets[nameString]
+	if !ok {
+		return nil, fmt.Errorf("unknown anomaly preset: %v", name)
+	}
+	if typeName, ok := value["Type"]; ok && typeName != preset["Type"] {
+		return nil, fmt.Errorf("type of anomaly preset %s cannot be overridden", nameString)
+	}
+
+	// Fields of the entry override those of the preset
+	merged := make(map[string]interface{}, len(preset)+len(value))
+	for key, field := range preset {
+		merged[key] = field
+	}
+	for key, field := range value {
+		if key != "Preset" {
+			merged[key] = field
+		}
+	}
+	return merged, nil
+}
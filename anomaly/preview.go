@@ -0,0 +1,66 @@
+package anomaly
+
+import (
+	"math/rand/v2"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Returns the delta of an anomaly at each of nSamples time steps of Ts from the start of its schedule, rendered
+// in isolation from a copy of the anomaly so that its live state is unchanged, e.g. to plot what a configuration
+// will do before it is attached to an emulator. Random numbers are drawn from a generator seeded by seed, unless
+// the anomaly has its own Seed. The copy is not triggered by other anomalies, so follows its own schedule. Functions
+// set by SetMagFunction or similar are shared with the copy, so the state of such a function is not isolated.
+// Returns nil if Ts <= 0 or nSamples <= 0, or if the anomaly cannot be copied.
+func Preview(a AnomalyInterface, Ts float64, nSamples int, seed uint64) []float64 {
+	if Ts <= 0 || nSamples <= 0 {
+		return nil
+	}
+
+	// Targets of a Correlation are previewed as their source anomaly multiplied by their scale factor
+	scale := 1.0
+	if target, ok := a.(*correlatedAnomaly); ok {
+		a = target.AnomalyInterface
+		scale = target.Scale
+	}
+	preview, err := copyAnomaly(a)
+	if err != nil {
+		return nil
+	}
+	if err := preview.SetTrigger("", ""); err != nil {
+		return nil
+	}
+
+	container := Container{"preview": preview}
+	r := rand.New(rand.NewPCG(seed, seed))
+	samples := make([]float64, nSamples)
+	labels := make([]AnomalyLabel, 0, 1)
+	for i := range samples {
+		_, labels = container.StepAllWithLabels(r, Ts, labels[:0])
+		samples[i] = labels[0].Delta * scale
+	}
+	return samples
+}
+
+// Implemented by anomalies which may have functions set by SetMagFunction or similar, which cannot be copied by
+// marshalling their parameters, as their names are not registered in mathfuncs.
+type cloner interface {
+	clone() (AnomalyInterface, error) // Returns a new anomaly with the same parameters and functions, at the start of its schedule
+}
+
+// Returns a new anomaly with the same parameters as a, at the start of its schedule, by cloning a, or else by
+// marshalling the parameters of a and unmarshalling them as a container entry.
+func copyAnomaly(a AnomalyInterface) (AnomalyInterface, error) {
+	if c, ok := a.(cloner); ok {
+		return c.clone()
+	}
+	data, err := yaml.Marshal(a)
+	if err != nil {
+		return nil, err
+	}
+	var value map[string]interface{}
+	if err := yaml.Unmarshal(data, &value); err != nil {
+		return nil, err
+	}
+	return unmarshalAnomaly(value)
+}
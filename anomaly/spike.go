@@ -1,9 +1,13 @@
 package anomaly
 
 import (
+	"cmp"
+	"encoding/json"
 	"errors"
 	"math"
 	"math/rand/v2"
+	"slices"
+	"time"
 
 	"github.com/synaptecltd/emulator/mathfuncs"
 )
@@ -14,37 +18,75 @@ type spikeAnomaly struct {
 
 	// Private fields have setters for invalid value checking
 
-	Magnitude     float64 // magnitude of spikes, default 0
-	magFuncName   string  // name of the function used to vary the magnitude of the spikes, empty defaults to no functional modulation
-	VaryMagnitude bool    // whether to apply Gaussian variation to magnitude of spikes, default false
-	spikeSign     float64 // the probability of spikes being positive or negative. default 0 (equally likely +/-). negative numbers favour negative spikes, positive numbers favour positive spikes
+	Magnitude        float64 // magnitude of spikes, default 0
+	MagnitudePercent float64 // magnitude of spikes as a percentage of the nominal value of the channel, overrides Magnitude when resolved, 0 to use Magnitude
+	magFuncName      string  // name of the function used to vary the magnitude of the spikes, empty defaults to no functional modulation
+	VaryMagnitude    bool    // whether to apply Gaussian variation to magnitude of spikes, default false; superseded by amplitudeDistribution
+	spikeSign        float64 // the probability of spikes being positive or negative. default 0 (equally likely +/-). negative numbers favour negative spikes, positive numbers favour positive spikes
 
-	probability  float64 // magnitude of probability of spike in each time step, default 0
-	probFuncName string  // name of the function used to vary the probability of the spikes, empty defaults to constant =probability
+	probability       float64           // magnitude of probability of spike in each time step, default 0
+	probFuncName      string            // name of the function used to vary the probability of the spikes, empty defaults to constant =probability
+	probProfile       []HourProbability // probability of spikes by local hour of day, sorted by hour, overriding probability if not empty
+	dailyProbFuncName string            // name of the function used to vary the probability of the spikes over a 24 hour period of the emulator clock, empty for none
+	minGap            float64           // minimum time between consecutive spikes in seconds, 0 for no refractory period
+	magFuncPeriod     float64           // period in seconds passed to the magnitude function, 0 to use the duration of the burst
+	probFuncPeriod    float64           // period in seconds passed to the probability function, 0 to use the duration of the burst
+
+	amplitudeDistribution string  // distribution of the factor by which the magnitude of each spike is scaled, see Amplitude distributions, "" for AmplitudeConstant
+	amplitudeSpread       float64 // spread of the amplitude distribution, 0 for the default spread of 1
 
 	// internal state
-	magFunction  mathfuncs.MathsFunction // returns spike anomaly magnitude for a given elapsed time, magntiude and period; set internally from magFuncName
-	probFunction mathfuncs.MathsFunction // returns spike anomaly probability for a given elapsed time, magntiude and period; set internally from probFuncName
+	magFunction       mathfuncs.MathsFunction // returns spike anomaly magnitude for a given elapsed time, magntiude and period; set internally from magFuncName
+	probFunction      mathfuncs.MathsFunction // returns spike anomaly probability for a given elapsed time, magntiude and period; set internally from probFuncName
+	dailyProbFunction mathfuncs.MathsFunction // returns spike anomaly probability for a given time of day in seconds, magnitude and period of a day; set internally from dailyProbFuncName
+	timeOfDay         float64                 // local time of day of the present time step in hours, set by the emulator clock
+	gapRemaining      int                     // number of time steps remaining in the refractory period after the latest spike
+}
+
+// HourProbability is the probability of spikes from a local hour of the day until the next hour of a profile.
+type HourProbability struct {
+	Hour        float64 `yaml:"Hour" json:"Hour"`               // local hour of the day from which the probability applies, in the range [0, 24)
+	Probability float64 `yaml:"Probability" json:"Probability"` // probability of a spike in each time step, must be greater than or equal to 0
 }
 
 // Parameters used to request a spike anomaly. These map onto the fields of spikeAnomaly.
 type SpikeParams struct {
 	// Defined in AnomalyBase
 
-	Repeats    uint64  `yaml:"Repeats"`    // the number of times spike bursts repeat, 0 for infinite
-	Off        bool    `yaml:"Off"`        // true: anomaly deactivated, false: activated
-	StartDelay float64 `yaml:"StartDelay"` // the delay before spike bursts begin (and time between bursts) in seconds
-	Duration   float64 `yaml:"Duration"`   // the duration of burst of spikes in seconds, 0 for continuous
+	Repeats          uint64    `yaml:"Repeats" json:"Repeats"`                                       // the number of times spike bursts repeat, 0 for infinite
+	Off              bool      `yaml:"Off" json:"Off"`                                               // true: anomaly deactivated, false: activated
+	StartDelay       float64   `yaml:"StartDelay" json:"StartDelay"`                                 // the delay before spike bursts begin (and time between bursts) in seconds
+	StartDelayJitter float64   `yaml:"StartDelayJitter,omitempty" json:"StartDelayJitter,omitempty"` // maximum random perturbation of the delay before each repeat in seconds, drawn uniformly from +/- this value, 0 for periodic repeats
+	Duration         float64   `yaml:"Duration" json:"Duration"`                                     // the duration of burst of spikes in seconds, 0 for continuous
+	StartTime        time.Time `yaml:"StartTime,omitempty" json:"StartTime,omitempty"`               // wall-clock time at which the anomaly starts, overriding StartDelay, requires an emulator epoch, optional
+	EndTime          time.Time `yaml:"EndTime,omitempty" json:"EndTime,omitempty"`                   // wall-clock time at which the anomaly ends, overriding Duration, requires an emulator epoch, optional
+	MaxSlewRate      float64   `yaml:"MaxSlewRate" json:"MaxSlewRate"`                               // maximum rate of change of the applied delta in units per second, 0 for unlimited
+	Seed             uint64    `yaml:"Seed,omitempty" json:"Seed,omitempty"`                         // seed of the anomaly's own random number generator for spike timing, sign and magnitude variation, 0 to use the emulator's
+	BlendMode        string    `yaml:"BlendMode,omitempty" json:"BlendMode,omitempty"`               // how the delta is combined with the channel: "add", "multiply" (scales by 1+delta), "replace" or "clamp", defaults to "add" if empty
+	ExclusiveGroup   string    `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"`     // name of a group of anomalies within the container of which at most one is active at a time, empty for none
+	TriggeredBy      string    `yaml:"TriggeredBy,omitempty" json:"TriggeredBy,omitempty"`           // name of an anomaly within the container whose events each start one repeat of this anomaly, after StartDelay, empty to follow its own schedule
+	TriggerOn        string    `yaml:"TriggerOn,omitempty" json:"TriggerOn,omitempty"`               // event of TriggeredBy which starts a repeat: "complete" or "activate", defaults to "complete" if empty
+	RampIn           float64   `yaml:"RampIn,omitempty" json:"RampIn,omitempty"`                     // time in seconds over which the delta fades in at the start of each repeat, 0 for an instantaneous start
+	RampOut          float64   `yaml:"RampOut,omitempty" json:"RampOut,omitempty"`                   // time in seconds over which the delta fades out at the end of each repeat, 0 for an instantaneous end
 
 	// Defined in spikeAnomaly
 
-	Magnitude     float64 `yaml:"Magnitude"`     // magnitude of spikes, default 0
-	MagFuncName   string  `yaml:"MagFunc"`       // name of the function used to vary the magnitude of the spikes, empty defaults to no functional modulation
-	VaryMagnitude bool    `yaml:"VaryMagnitude"` // whether apply Gaussian variation to magnitude of spikes, default false
-	SpikeSign     float64 `yaml:"Sign"`          // the probability of spikes being positive or negative. default 0 (equally likely +/-). negative numbers favour negative spikes, positive numbers favour positive spikes
-
-	Probability  float64 `yaml:"Probability"` // magnitude of probability of spike in each time step, default 0
-	ProbFuncName string  `yaml:"ProbFunc"`    // name of the function used to vary the probability of the spikes, empty defaults to constant =probability
+	Magnitude        float64 `yaml:"Magnitude" json:"Magnitude"`               // magnitude of spikes, default 0
+	MagnitudePercent float64 `yaml:"MagnitudePercent" json:"MagnitudePercent"` // magnitude of spikes as a percentage of the nominal value of the channel, e.g. MeanTemperature or PosSeqMag, 0 to use Magnitude
+	MagFuncName      string  `yaml:"MagFunc" json:"MagFunc"`                   // name of the function used to vary the magnitude of the spikes, empty defaults to no functional modulation
+	VaryMagnitude    bool    `yaml:"VaryMagnitude" json:"VaryMagnitude"`       // whether apply Gaussian variation to magnitude of spikes, default false; prefer AmplitudeDistribution, which can also vary magnitudes with a mean of 1
+	SpikeSign        float64 `yaml:"Sign" json:"Sign"`                         // the probability of spikes being positive or negative. default 0 (equally likely +/-). negative numbers favour negative spikes, positive numbers favour positive spikes
+
+	Probability       float64           `yaml:"Probability" json:"Probability"`                           // magnitude of probability of spike in each time step, default 0
+	ProbFuncName      string            `yaml:"ProbFunc" json:"ProbFunc"`                                 // name of the function used to vary the probability of the spikes, empty defaults to constant =probability
+	ProbProfile       []HourProbability `yaml:"ProbProfile,omitempty" json:"ProbProfile,omitempty"`       // probability of spikes by local hour of day of the emulator clock, overriding Probability, optional
+	DailyProbFuncName string            `yaml:"DailyProbFunc,omitempty" json:"DailyProbFunc,omitempty"`   // name of the function used to vary the probability over a 24 hour period of the emulator clock, optional
+	MinGap            float64           `yaml:"MinGap,omitempty" json:"MinGap,omitempty"`                 // minimum time between consecutive spikes in seconds, so that they do not merge, 0 for no refractory period
+	MagFuncPeriod     float64           `yaml:"MagFuncPeriod,omitempty" json:"MagFuncPeriod,omitempty"`   // period in seconds of the function used to vary the magnitude of the spikes, 0 to use Duration
+	ProbFuncPeriod    float64           `yaml:"ProbFuncPeriod,omitempty" json:"ProbFuncPeriod,omitempty"` // period in seconds of the function used to vary the probability of the spikes, 0 to use Duration
+
+	AmplitudeDistribution string  `yaml:"AmplitudeDistribution,omitempty" json:"AmplitudeDistribution,omitempty"` // distribution of the factor by which the magnitude of each spike is scaled: "constant", "uniform", "normal", "lognormal" or "exponential", defaults to "constant" if empty
+	AmplitudeSpread       float64 `yaml:"AmplitudeSpread,omitempty" json:"AmplitudeSpread,omitempty"`             // spread of the amplitude distribution around a factor of 1, 0 for the default spread of 1
 }
 
 // Initialise the internal fields of SpikeAnomaly when it is unmarshalled from yaml.
@@ -53,6 +95,9 @@ func (s *spikeAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err := unmarshal(&params); err != nil {
 		return err
 	}
+	if err := params.Validate(); err != nil {
+		return err // reports every invalid value, rather than the first
+	}
 
 	// This performs checking for invalid values
 	spikeAnomaly, err := NewSpikeAnomaly(params)
@@ -66,6 +111,38 @@ func (s *spikeAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// Returns the parameters of spikeAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (s *spikeAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[SpikeParams]{Type: s.typeName, Uuid: s.uuidString(), Params: s.GetParams()}, nil
+}
+
+// Initialise the internal fields of spikeAnomaly when it is unmarshalled from json.
+func (s *spikeAnomaly) UnmarshalJSON(data []byte) error {
+	var params SpikeParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+	if err := params.Validate(); err != nil {
+		return err // reports every invalid value, rather than the first
+	}
+
+	// This performs checking for invalid values
+	spikeAnomaly, err := NewSpikeAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to s
+	*s = *spikeAnomaly
+
+	return nil
+}
+
+// Returns the parameters of spikeAnomaly, including its "Type" field, when it is marshalled to json.
+func (s *spikeAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(s.typeName, s.uuid, s.GetParams())
+}
+
 // Returns a spikeAnomaly pointer with the requested parameters, checking for invalid values.
 func NewSpikeAnomaly(params SpikeParams) (*spikeAnomaly, error) {
 	spikeAnomaly := &spikeAnomaly{}
@@ -74,6 +151,24 @@ func NewSpikeAnomaly(params SpikeParams) (*spikeAnomaly, error) {
 	if err := spikeAnomaly.SetStartDelay(params.StartDelay); err != nil {
 		return nil, err
 	}
+	if err := spikeAnomaly.SetStartDelayJitter(params.StartDelayJitter); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetSchedule(params.StartTime, params.EndTime); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetMaxSlewRate(params.MaxSlewRate); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetBlendMode(params.BlendMode); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetTrigger(params.TriggeredBy, params.TriggerOn); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetRamp(params.RampIn, params.RampOut); err != nil {
+		return nil, err
+	}
 	if err := spikeAnomaly.SetProbability(params.Probability); err != nil {
 		return nil, err
 	}
@@ -83,16 +178,37 @@ func NewSpikeAnomaly(params SpikeParams) (*spikeAnomaly, error) {
 	if err := spikeAnomaly.SetProbFunctionByName(params.ProbFuncName); err != nil {
 		return nil, err
 	}
+	if err := spikeAnomaly.SetProbProfile(params.ProbProfile); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetDailyProbFunctionByName(params.DailyProbFuncName); err != nil {
+		return nil, err
+	}
 	if err := spikeAnomaly.SetSpikeSign(params.SpikeSign); err != nil {
 		return nil, err
 	}
+	if err := spikeAnomaly.SetMinGap(params.MinGap); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetAmplitudeDistribution(params.AmplitudeDistribution, params.AmplitudeSpread); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetMagFuncPeriod(params.MagFuncPeriod); err != nil {
+		return nil, err
+	}
+	if err := spikeAnomaly.SetProbFuncPeriod(params.ProbFuncPeriod); err != nil {
+		return nil, err
+	}
 	if err := spikeAnomaly.SetDuration(params.Duration); err != nil {
 		return nil, err
 	}
 
 	// Fields that can never be invalid set directly
+	spikeAnomaly.SetSeed(params.Seed)
+	spikeAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
 	spikeAnomaly.typeName = "spike"
 	spikeAnomaly.Magnitude = params.Magnitude
+	spikeAnomaly.MagnitudePercent = params.MagnitudePercent
 	spikeAnomaly.VaryMagnitude = params.VaryMagnitude
 	spikeAnomaly.Repeats = params.Repeats
 	spikeAnomaly.Off = params.Off
@@ -105,6 +221,15 @@ func (s *spikeAnomaly) stepAnomaly(r *rand.Rand, Ts float64) float64 {
 	if s.Off {
 		return 0.0
 	}
+	r = s.randSource(r)
+	s.jitterStartDelay(r)
+	s.setFunctionRand(r)
+
+	// No spike occurs within MinGap of the previous spike
+	refractory := s.gapRemaining > 0
+	if refractory {
+		s.gapRemaining -= 1
+	}
 
 	// Check if the spike anomaly is active this timestep
 	s.isAnomalyActive = s.CheckAnomalyActive(Ts)
@@ -118,49 +243,93 @@ func (s *spikeAnomaly) stepAnomaly(r *rand.Rand, Ts float64) float64 {
 	s.elapsedActivatedIndex += 1
 
 	// Don't trigger if the probability is not met
-	if r.Float64() > s.FetchProbability() {
+	if refractory || r.Float64() > s.FetchProbability() {
 		s.isAnomalyActive = false
 		return 0.0
 	}
 
 	s.isAnomalyActive = true
+	s.gapRemaining = int(math.Round(s.minGap/Ts)) - 1
 
 	// Default value for delta can be...
 	spikeAnomalyDelta := s.Magnitude
 	if s.magFunction != nil {
 		// ...overwritten by functions
-		spikeAnomalyDelta = s.magFunction(s.elapsedActivatedTime, s.Magnitude, s.duration)
+		spikeAnomalyDelta = s.magFunction(s.elapsedActivatedTime, s.Magnitude, s.funcPeriod(s.magFuncPeriod))
 	}
 	spikeAnomalyDelta *= s.getSign(r) // ... flipped by sign
 	if s.VaryMagnitude {
 		spikeAnomalyDelta *= r.NormFloat64() // ... or modulated with a Gaussian
 	}
+	if s.amplitudeDistribution != "" {
+		spikeAnomalyDelta *= s.amplitudeFactor(r) // ... scaled by a random amplitude
+	}
+	spikeAnomalyDelta *= s.envelopeGain(Ts) // ... and faded in and out at the edges of the burst
 
 	// If the spike anomaly is complete, reset the index and increment the repeat counter
 	if s.elapsedActivatedIndex >= int(s.duration/Ts)-1 {
 		s.elapsedActivatedIndex = 0
 		s.startDelayIndex = 0
 		s.countRepeats += 1
+		s.startDelayDrawn = false // the next repeat has a new start delay
 	}
 
 	return spikeAnomalyDelta
 }
 
 // Fetches the probability of a spike anomaly occurring this timestep. This probability
-// is based on the probability magnitude, and the output of probability function if one is set.
+// is based on the probability magnitude, or the probability profile at the present time of
+// day if one is set, modulated by the daily and probability functions if they are set.
 // For the function to work correctly with a probability function, the elapsedActivatedTime
 // field must be up to date.
 func (s *spikeAnomaly) FetchProbability() float64 {
+	prob := s.probability
+	if len(s.probProfile) > 0 {
+		prob = s.profileProbability()
+	}
+	if s.dailyProbFunction != nil {
+		prob = math.Abs(s.dailyProbFunction(s.timeOfDay*3600, prob, 24*3600))
+	}
 	if s.probFunction == nil {
-		return s.probability
+		return prob
 	}
 
-	prob := s.probFunction(s.elapsedActivatedTime, s.probability, s.duration)
+	prob = s.probFunction(s.elapsedActivatedTime, prob, s.funcPeriod(s.probFuncPeriod))
 	prob = math.Abs(prob) // take positive values only
 
 	return prob
 }
 
+// Returns the probability of the profile at the present time of day: that of the latest hour of the
+// profile at or before the time of day, or of the last hour of the profile before its first hour.
+func (s *spikeAnomaly) profileProbability() float64 {
+	prob := s.probProfile[len(s.probProfile)-1].Probability
+	for _, entry := range s.probProfile {
+		if entry.Hour > s.timeOfDay {
+			break
+		}
+		prob = entry.Probability
+	}
+	return prob
+}
+
+// Returns whether the probability of spikes depends on the time of day.
+func (s *spikeAnomaly) followsClock() bool {
+	return len(s.probProfile) > 0 || s.dailyProbFunction != nil
+}
+
+// Sets the local time of day of the present time step in hours.
+func (s *spikeAnomaly) setTimeOfDay(timeOfDay float64) {
+	s.timeOfDay = timeOfDay
+}
+
+// Sets Magnitude to MagnitudePercent of the nominal value of the channel, if MagnitudePercent is set.
+func (s *spikeAnomaly) resolveMagnitude(nominal float64) {
+	if s.MagnitudePercent != 0 {
+		s.Magnitude = s.MagnitudePercent / 100 * nominal
+	}
+}
+
 // Returns -1.0 or +1.0 with a probability based on the spikeSign parameter.
 // If SpikeSign is 0, -1.0 and +1.0 are returned with equal probability.
 func (s *spikeAnomaly) getSign(r *rand.Rand) float64 {
@@ -171,14 +340,23 @@ func (s *spikeAnomaly) getSign(r *rand.Rand) float64 {
 	}
 }
 
+// Returns the period passed to a magnitude or probability function, which is period if it is set or
+// the duration of the burst otherwise.
+func (s *spikeAnomaly) funcPeriod(period float64) float64 {
+	if period > 0 {
+		return period
+	}
+	return s.duration
+}
+
 // Setters
 
 // Sets the duration of each spike anomaly in seconds. If duration=0, the spike anomaly
 // defined as is continuous (duration=-1.0).
 func (s *spikeAnomaly) SetDuration(duration float64) error {
 	if duration == 0 {
-		if s.magFunction != nil {
-			return errors.New("duration must be greater than 0 when using a functional dependence for magntiude")
+		if s.magFunction != nil && s.magFuncPeriod == 0 {
+			return errors.New("duration or magnitude function period must be greater than 0 when using a functional dependence for magntiude")
 		}
 		duration = -1.0 // continuous burst
 	}
@@ -206,16 +384,149 @@ func (s *spikeAnomaly) SetSpikeSign(spikeSign float64) error {
 
 // Sets the field magFunction to the function with the given name.
 func (s *spikeAnomaly) SetMagFunctionByName(name string) error {
-	return s.SetFunctionByName(name, mathfuncs.GetTrendFunctionFromName, &s.magFuncName, &s.magFunction)
+	return s.SetFunctionByName(name, s.lookupFunction, &s.magFuncName, &s.magFunction)
 }
 
 // Sets the field probFunction to the function with the given name.
 func (s *spikeAnomaly) SetProbFunctionByName(name string) error {
-	return s.SetFunctionByName(name, mathfuncs.GetTrendFunctionFromName, &s.probFuncName, &s.probFunction)
+	return s.SetFunctionByName(name, s.lookupFunction, &s.probFuncName, &s.probFunction)
+}
+
+// Sets the probability of spikes by local hour of day of the emulator clock, if every hour is in the range
+// [0, 24) and every probability is >= 0. The probability of each entry applies from its hour until the next
+// hour of the profile, wrapping around midnight. An empty profile uses Probability at all times of day.
+func (s *spikeAnomaly) SetProbProfile(profile []HourProbability) error {
+	for _, entry := range profile {
+		if entry.Hour < 0 || entry.Hour >= 24 {
+			return errors.New("probability profile hours must be in the range 0 to 24")
+		}
+		if entry.Probability < 0 {
+			return errors.New("probability must be greater than or equal to 0")
+		}
+	}
+
+	s.probProfile = slices.Clone(profile)
+	slices.SortFunc(s.probProfile, func(a, b HourProbability) int { return cmp.Compare(a.Hour, b.Hour) })
+	return nil
+}
+
+// Sets the function used to vary the probability of spikes over a 24 hour period of the emulator clock by
+// name. The function is evaluated with the time of day in seconds, an amplitude of the probability and a
+// period of one day. An empty name removes the function.
+func (s *spikeAnomaly) SetDailyProbFunctionByName(name string) error {
+	return s.SetFunctionByName(name, s.lookupFunction, &s.dailyProbFuncName, &s.dailyProbFunction)
+}
+
+// Sets the field magFunction to f, which need not be registered in mathfuncs. The name identifies f in the
+// parameters of the anomaly, so must be registered for these to be unmarshalled.
+func (s *spikeAnomaly) SetMagFunction(f mathfuncs.MathsFunction, name string) error {
+	return s.SetFunction(f, name, &s.magFuncName, &s.magFunction)
+}
+
+// Sets the field probFunction to f, which need not be registered in mathfuncs. The name identifies f in the
+// parameters of the anomaly, so must be registered for these to be unmarshalled.
+func (s *spikeAnomaly) SetProbFunction(f mathfuncs.MathsFunction, name string) error {
+	return s.SetFunction(f, name, &s.probFuncName, &s.probFunction)
+}
+
+// Sets the function used to vary the probability over a 24 hour period of the emulator clock to f, which
+// need not be registered in mathfuncs. The name identifies f in the parameters of the anomaly.
+func (s *spikeAnomaly) SetDailyProbFunction(f mathfuncs.MathsFunction, name string) error {
+	return s.SetFunction(f, name, &s.dailyProbFuncName, &s.dailyProbFunction)
+}
+
+// Sets the period in seconds passed to the magnitude function if magFuncPeriod >= 0, independently of the
+// duration of the burst. A period of 0 uses the duration of the burst.
+func (s *spikeAnomaly) SetMagFuncPeriod(magFuncPeriod float64) error {
+	if magFuncPeriod < 0 {
+		return errors.New("magnitude function period must be greater than or equal to 0")
+	}
+	s.magFuncPeriod = magFuncPeriod
+	return nil
+}
+
+// Sets the period in seconds passed to the probability function if probFuncPeriod >= 0, independently of
+// the duration of the burst, e.g. for a 1 hour probability cycle within a 24 hour burst. A period of 0
+// uses the duration of the burst.
+func (s *spikeAnomaly) SetProbFuncPeriod(probFuncPeriod float64) error {
+	if probFuncPeriod < 0 {
+		return errors.New("probability function period must be greater than or equal to 0")
+	}
+	s.probFuncPeriod = probFuncPeriod
+	return nil
+}
+
+// Sets the minimum time between consecutive spikes in seconds if minGap >= 0, rounded to a whole number of
+// time steps. No spike occurs until MinGap after the previous spike, regardless of the probability.
+func (s *spikeAnomaly) SetMinGap(minGap float64) error {
+	if minGap < 0 {
+		return errors.New("min gap must be greater than or equal to 0")
+	}
+	s.minGap = minGap
+	return nil
+}
+
+// Returns a new spikeAnomaly with the same parameters, at the start of its schedule, including functions set by
+// SetMagFunction, SetProbFunction or SetDailyProbFunction.
+func (s *spikeAnomaly) clone() (AnomalyInterface, error) {
+	params := s.GetParams()
+	params.MagFuncName = s.registeredName(params.MagFuncName)
+	params.ProbFuncName = s.registeredName(params.ProbFuncName)
+	params.DailyProbFuncName = s.registeredName(params.DailyProbFuncName)
+	clone, err := NewSpikeAnomaly(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.copyFunction(s.magFuncName, clone.SetMagFunction); err != nil {
+		return nil, err
+	}
+	if err := s.copyFunction(s.probFuncName, clone.SetProbFunction); err != nil {
+		return nil, err
+	}
+	if err := s.copyFunction(s.dailyProbFuncName, clone.SetDailyProbFunction); err != nil {
+		return nil, err
+	}
+	return clone, nil
 }
 
 // Getters
 
+// Returns the parameters which define spikeAnomaly, such that NewSpikeAnomaly returns an identical anomaly.
+func (s *spikeAnomaly) GetParams() SpikeParams {
+	return SpikeParams{
+		Repeats:           s.Repeats,
+		Off:               s.Off,
+		StartDelay:        s.startDelay,
+		StartDelayJitter:  s.startDelayJitter,
+		Duration:          max(s.duration, 0), // continuous bursts are stored internally as -1
+		StartTime:         s.startTime,
+		EndTime:           s.endTime,
+		MaxSlewRate:       s.maxSlewRate,
+		BlendMode:         s.blendMode,
+		ExclusiveGroup:    s.exclusiveGroup,
+		TriggeredBy:       s.triggeredBy,
+		TriggerOn:         s.triggerOn,
+		RampIn:            s.rampIn,
+		RampOut:           s.rampOut,
+		Seed:              s.seed,
+		Magnitude:         s.Magnitude,
+		MagnitudePercent:  s.MagnitudePercent,
+		MagFuncName:       s.magFuncName,
+		VaryMagnitude:     s.VaryMagnitude,
+		SpikeSign:         s.spikeSign,
+		Probability:       s.probability,
+		ProbFuncName:      s.probFuncName,
+		ProbProfile:       slices.Clone(s.probProfile),
+		DailyProbFuncName: s.dailyProbFuncName,
+		MinGap:            s.minGap,
+		MagFuncPeriod:     s.magFuncPeriod,
+		ProbFuncPeriod:    s.probFuncPeriod,
+
+		AmplitudeDistribution: s.amplitudeDistribution,
+		AmplitudeSpread:       s.amplitudeSpread,
+	}
+}
+
 func (s *spikeAnomaly) GetProbability() float64 {
 	return s.probability
 }
@@ -239,3 +550,18 @@ func (s *spikeAnomaly) GetMagFunction() mathfuncs.MathsFunction {
 func (s *spikeAnomaly) GetProbFunction() mathfuncs.MathsFunction {
 	return s.probFunction
 }
+
+// Returns the minimum time between consecutive spikes in seconds.
+func (s *spikeAnomaly) GetMinGap() float64 {
+	return s.minGap
+}
+
+// Returns the period in seconds passed to the magnitude function, 0 if the duration of the burst is used.
+func (s *spikeAnomaly) GetMagFuncPeriod() float64 {
+	return s.magFuncPeriod
+}
+
+// Returns the period in seconds passed to the probability function, 0 if the duration of the burst is used.
+func (s *spikeAnomaly) GetProbFuncPeriod() float64 {
+	return s.probFuncPeriod
+}
@@ -0,0 +1,388 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/synaptecltd/emulator/mathfuncs"
+)
+
+// The internal state of an anomaly which changes as it is stepped, as opposed to its parameters, so that a
+// long-running emulation can be checkpointed and resumed exactly after a process restart. States are
+// exported as json, which represents every float64 exactly.
+
+// Internal state of AnomalyBase.
+type baseState struct {
+	Off                   bool         `json:"Off"`
+	Paused                bool         `json:"Paused,omitempty"`
+	IsAnomalyActive       bool         `json:"IsAnomalyActive"`
+	StartDelayIndex       int          `json:"StartDelayIndex"`
+	ElapsedActivatedIndex int          `json:"ElapsedActivatedIndex"`
+	ElapsedActivatedTime  float64      `json:"ElapsedActivatedTime"`
+	CountRepeats          uint64       `json:"CountRepeats"`
+	SlewLimitedDelta      float64      `json:"SlewLimitedDelta"`
+	StartDelayOffset      float64      `json:"StartDelayOffset"`
+	StartDelayDrawn       bool         `json:"StartDelayDrawn"`
+	Armed                 bool         `json:"Armed,omitempty"`
+	ArmedRepeats          uint64       `json:"ArmedRepeats,omitempty"`
+	TriggerCount          uint64       `json:"TriggerCount,omitempty"`
+	TriggerActive         bool         `json:"TriggerActive,omitempty"`
+	NotifiedRepeats       uint64       `json:"NotifiedRepeats"`
+	TotalElapsedTime      float64      `json:"TotalElapsedTime"`
+	TotalActiveTime       float64      `json:"TotalActiveTime"`
+	Stats                 AnomalyStats `json:"Stats"`
+	WasActive             bool         `json:"WasActive"`
+	Rand                  []byte       `json:"Rand,omitempty"` // state of the anomaly's own random number generator, if it has a seed
+}
+
+// Returns the internal state of AnomalyBase.
+func (a *AnomalyBase) getBaseState() (baseState, error) {
+	state := baseState{
+		Off:                   a.Off,
+		Paused:                a.IsPaused(),
+		IsAnomalyActive:       a.isAnomalyActive,
+		StartDelayIndex:       a.startDelayIndex,
+		ElapsedActivatedIndex: a.elapsedActivatedIndex,
+		ElapsedActivatedTime:  a.elapsedActivatedTime,
+		CountRepeats:          a.countRepeats,
+		SlewLimitedDelta:      a.slewLimitedDelta,
+		StartDelayOffset:      a.startDelayOffset,
+		StartDelayDrawn:       a.startDelayDrawn,
+		Armed:                 a.armed,
+		ArmedRepeats:          a.armedRepeats,
+		TriggerCount:          a.triggerCount,
+		TriggerActive:         a.triggerActive,
+		NotifiedRepeats:       a.notifiedRepeats,
+		TotalElapsedTime:      a.totalElapsedTime,
+		TotalActiveTime:       a.totalActiveTime,
+		Stats:                 a.stats,
+		WasActive:             a.stats.wasActive,
+	}
+	if a.pcg != nil {
+		var err error
+		if state.Rand, err = a.pcg.MarshalBinary(); err != nil {
+			return baseState{}, err
+		}
+	}
+	return state, nil
+}
+
+// Restores the internal state of AnomalyBase. The state of the anomaly's own random number generator is only
+// restored if it has a seed.
+func (a *AnomalyBase) setBaseState(state baseState) error {
+	if a.pcg != nil && state.Rand != nil {
+		if err := a.pcg.UnmarshalBinary(state.Rand); err != nil {
+			return err
+		}
+	}
+	a.Off = state.Off
+	if state.Paused {
+		a.Pause()
+	} else {
+		a.Resume()
+	}
+	a.isAnomalyActive = state.IsAnomalyActive
+	a.startDelayIndex = state.StartDelayIndex
+	a.elapsedActivatedIndex = state.ElapsedActivatedIndex
+	a.elapsedActivatedTime = state.ElapsedActivatedTime
+	a.countRepeats = state.CountRepeats
+	a.slewLimitedDelta = state.SlewLimitedDelta
+	a.startDelayOffset = state.StartDelayOffset
+	a.startDelayDrawn = state.StartDelayDrawn
+	a.armed = state.Armed
+	a.armedRepeats = state.ArmedRepeats
+	a.triggerCount = state.TriggerCount
+	a.triggerActive = state.TriggerActive
+	a.notifiedRepeats = state.NotifiedRepeats
+	a.totalElapsedTime = state.TotalElapsedTime
+	a.totalActiveTime = state.TotalActiveTime
+	a.stats = state.Stats
+	a.stats.wasActive = state.WasActive
+	return nil
+}
+
+// Returns the internal state of the anomaly as json, e.g. its elapsed time steps, start delay and repeats, to
+// be restored by ImportState into an anomaly with the same parameters. Parameters are not included. Returns an
+// error if the anomaly uses a stateful function such as random_walk, see mathfuncs.IsStateful, whose state cannot
+// be exported. The state of functions set by SetMagFunction or similar is not exported.
+func (a *AnomalyBase) ExportState() ([]byte, error) {
+	state, err := a.getBaseState()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(state)
+}
+
+// Restores the internal state of the anomaly from json returned by ExportState, so that it continues exactly
+// where the exported anomaly left off, provided that it has the same parameters.
+func (a *AnomalyBase) ImportState(data []byte) error {
+	var state baseState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	return a.setBaseState(state)
+}
+
+// Exports the internal state of an anomaly with further state of type S, returned by extra.
+func exportState[S any](a *AnomalyBase, extra S) ([]byte, error) {
+	base, err := a.getBaseState()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		baseState
+		Extra S `json:"State"`
+	}{base, extra})
+}
+
+// Imports the internal state of an anomaly exported by exportState, restoring its further state with set.
+func importState[S any](a *AnomalyBase, data []byte, set func(S) error) error {
+	var state struct {
+		baseState
+		Extra S `json:"State"`
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if err := a.setBaseState(state.baseState); err != nil {
+		return err
+	}
+	return set(state.Extra)
+}
+
+// Returns an error if any of the named functions is stateful, see mathfuncs.IsStateful, as the hidden state of
+// such a function cannot be exported, so an anomaly which uses one could not be resumed exactly.
+func checkStatelessFunctions(names ...string) error {
+	for _, name := range names {
+		if mathfuncs.IsStateful(name) {
+			return fmt.Errorf("state of stateful function %s cannot be exported", name)
+		}
+	}
+	return nil
+}
+
+// Internal state of trendAnomaly.
+type trendState struct {
+	HeldDelta float64 `json:"HeldDelta"`
+}
+
+// Returns the internal state of the trend anomaly as json, see AnomalyBase.ExportState.
+func (t *trendAnomaly) ExportState() ([]byte, error) {
+	if err := checkStatelessFunctions(t.magFuncName); err != nil {
+		return nil, err
+	}
+	return exportState(&t.AnomalyBase, trendState{HeldDelta: t.heldDelta})
+}
+
+// Restores the internal state of the trend anomaly, see AnomalyBase.ImportState.
+func (t *trendAnomaly) ImportState(data []byte) error {
+	return importState(&t.AnomalyBase, data, func(state trendState) error {
+		t.heldDelta = state.HeldDelta
+		return nil
+	})
+}
+
+// Internal state of spikeAnomaly.
+type spikeState struct {
+	GapRemaining int `json:"GapRemaining"`
+}
+
+// Returns the internal state of the spike anomaly as json, see AnomalyBase.ExportState.
+func (s *spikeAnomaly) ExportState() ([]byte, error) {
+	if err := checkStatelessFunctions(s.magFuncName, s.probFuncName, s.dailyProbFuncName); err != nil {
+		return nil, err
+	}
+	return exportState(&s.AnomalyBase, spikeState{GapRemaining: s.gapRemaining})
+}
+
+// Restores the internal state of the spike anomaly, see AnomalyBase.ImportState.
+func (s *spikeAnomaly) ImportState(data []byte) error {
+	return importState(&s.AnomalyBase, data, func(state spikeState) error {
+		s.gapRemaining = state.GapRemaining
+		return nil
+	})
+}
+
+// Returns the internal state of the harmonic anomaly as json, see AnomalyBase.ExportState.
+func (h *harmonicAnomaly) ExportState() ([]byte, error) {
+	if err := checkStatelessFunctions(h.magFuncName, h.angFuncName); err != nil {
+		return nil, err
+	}
+	return h.AnomalyBase.ExportState()
+}
+
+// Internal state of clockDriftAnomaly.
+type clockDriftState struct {
+	DriftError float64 `json:"DriftError"`
+}
+
+// Returns the internal state of the clock drift anomaly as json, see AnomalyBase.ExportState.
+func (c *clockDriftAnomaly) ExportState() ([]byte, error) {
+	return exportState(&c.AnomalyBase, clockDriftState{DriftError: c.driftError})
+}
+
+// Restores the internal state of the clock drift anomaly, see AnomalyBase.ImportState.
+func (c *clockDriftAnomaly) ImportState(data []byte) error {
+	return importState(&c.AnomalyBase, data, func(state clockDriftState) error {
+		c.driftError = state.DriftError
+		return nil
+	})
+}
+
+// Internal state of undersampleAnomaly.
+type undersampleState struct {
+	Hold bool `json:"Hold"`
+}
+
+// Returns the internal state of the undersample anomaly as json, see AnomalyBase.ExportState.
+func (u *undersampleAnomaly) ExportState() ([]byte, error) {
+	return exportState(&u.AnomalyBase, undersampleState{Hold: u.hold})
+}
+
+// Restores the internal state of the undersample anomaly, see AnomalyBase.ImportState.
+func (u *undersampleAnomaly) ImportState(data []byte) error {
+	return importState(&u.AnomalyBase, data, func(state undersampleState) error {
+		u.hold = state.Hold
+		return nil
+	})
+}
+
+// Internal state of budgetAnomaly.
+type budgetState struct {
+	History []bool `json:"History"`
+	Next    int    `json:"Next"`
+	Count   int    `json:"Count"`
+}
+
+// Returns the internal state of the budget anomaly as json, see AnomalyBase.ExportState.
+func (b *budgetAnomaly) ExportState() ([]byte, error) {
+	return exportState(&b.AnomalyBase, budgetState{History: b.history, Next: b.next, Count: b.count})
+}
+
+// Restores the internal state of the budget anomaly, see AnomalyBase.ImportState.
+func (b *budgetAnomaly) ImportState(data []byte) error {
+	return importState(&b.AnomalyBase, data, func(state budgetState) error {
+		if state.History != nil && (state.Next < 0 || state.Next >= len(state.History)) {
+			return errors.New("index of the oldest sample must be within the history")
+		}
+		b.history = state.History
+		b.next = state.Next
+		b.count = state.Count
+		return nil
+	})
+}
+
+// Internal state of compositeAnomaly.
+type compositeState struct {
+	Children []json.RawMessage `json:"Children"`
+}
+
+// Returns the internal state of the composite anomaly and its children as json, see AnomalyBase.ExportState.
+func (c *compositeAnomaly) ExportState() ([]byte, error) {
+	state := compositeState{Children: make([]json.RawMessage, len(c.Children))}
+	for i, child := range c.Children {
+		var err error
+		if state.Children[i], err = child.ExportState(); err != nil {
+			return nil, err
+		}
+	}
+	return exportState(&c.AnomalyBase, state)
+}
+
+// Restores the internal state of the composite anomaly and its children, see AnomalyBase.ImportState.
+func (c *compositeAnomaly) ImportState(data []byte) error {
+	return importState(&c.AnomalyBase, data, func(state compositeState) error {
+		if len(state.Children) != len(c.Children) {
+			return fmt.Errorf("state has %d children, but the composite anomaly has %d", len(state.Children), len(c.Children))
+		}
+		for i, child := range c.Children {
+			if err := child.ImportState(state.Children[i]); err != nil {
+				return fmt.Errorf("child %d: %w", i, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Internal state of correlatedAnomaly, including its source anomaly and Correlation.
+type correlatedState struct {
+	Source           json.RawMessage `json:"Source"`
+	Steps            uint64          `json:"Steps"`
+	SlewLimitedDelta float64         `json:"SlewLimitedDelta"`
+	CorrelationSteps uint64          `json:"CorrelationSteps"`
+	CorrelationValue float64         `json:"CorrelationValue"`
+}
+
+// Returns the internal state of the target and its source anomaly as json, see AnomalyBase.ExportState.
+func (c *correlatedAnomaly) ExportState() ([]byte, error) {
+	source, err := c.AnomalyInterface.ExportState()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(correlatedState{
+		Source:           source,
+		Steps:            c.steps,
+		SlewLimitedDelta: c.slewLimitedDelta,
+		CorrelationSteps: c.correlation.steps,
+		CorrelationValue: c.correlation.value,
+	})
+}
+
+// Restores the internal state of the target and its source anomaly, which is shared with the other targets
+// of its Correlation, see AnomalyBase.ImportState.
+func (c *correlatedAnomaly) ImportState(data []byte) error {
+	var state correlatedState
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+	if err := c.AnomalyInterface.ImportState(state.Source); err != nil {
+		return err
+	}
+	c.steps = state.Steps
+	c.slewLimitedDelta = state.SlewLimitedDelta
+	c.correlation.steps = state.CorrelationSteps
+	c.correlation.value = state.CorrelationValue
+	return nil
+}
+
+// Returns the internal state of every anomaly within the container as a json object keyed by name, to be
+// restored by ImportState into a container with the same anomalies, e.g. one unmarshalled from the same
+// configuration. The random number generator shared by the anomalies of an emulator is not included.
+func (c Container) ExportState() ([]byte, error) {
+	states := make(map[string]json.RawMessage, len(c))
+	for name, anomaly := range c {
+		state, err := anomaly.ExportState()
+		if err != nil {
+			return nil, &FieldError{Path: name, Err: err}
+		}
+		states[name] = state
+	}
+	return json.Marshal(states)
+}
+
+// Restores the internal state of every anomaly within the container from json returned by ExportState.
+// Returns an error if the anomalies within the container and the state do not have the same names.
+func (c Container) ImportState(data []byte) error {
+	var states map[string]json.RawMessage
+	if err := json.Unmarshal(data, &states); err != nil {
+		return err
+	}
+	var errs []error
+	for _, name := range c.Names() {
+		state, ok := states[name]
+		if !ok {
+			errs = append(errs, &FieldError{Path: name, Err: errors.New("anomaly not found in state")})
+			continue
+		}
+		if err := c[name].ImportState(state); err != nil {
+			errs = append(errs, &FieldError{Path: name, Err: err})
+		}
+	}
+	for name := range states {
+		if _, ok := c[name]; !ok {
+			errs = append(errs, &FieldError{Path: name, Err: errors.New("anomaly not found in container")})
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,36 @@
+package anomaly
+
+import "math"
+
+// AnomalyStats are statistics of an anomaly over its lifetime, accumulated as its container is stepped, e.g.
+// to check automatically that a scenario injected what was intended.
+type AnomalyStats struct {
+	Activations   uint64  `yaml:"Activations" json:"Activations"`     // number of time steps in which the anomaly became active after being inactive
+	ActiveSamples uint64  `yaml:"ActiveSamples" json:"ActiveSamples"` // number of time steps in which the anomaly was active
+	SumDelta      float64 `yaml:"SumDelta" json:"SumDelta"`           // sum of the deltas applied by the anomaly, after slew rate limiting
+	PeakDelta     float64 `yaml:"PeakDelta" json:"PeakDelta"`         // delta of the largest magnitude applied by the anomaly, with its sign
+
+	wasActive bool // whether the anomaly was active in the previous time step
+}
+
+// Returns the statistics of the anomaly over its lifetime. Deltas are those combined with the channel, so are 0
+// for anomalies without a scalar effect, e.g. harmonics. The deltas of the source of a Correlation are recorded
+// before they are scaled for each target.
+func (a *AnomalyBase) GetStats() AnomalyStats {
+	return a.stats
+}
+
+// Adds a time step in which the anomaly was active or not, and applied delta, to the statistics.
+func (s *AnomalyStats) record(active bool, delta float64) {
+	if active {
+		s.ActiveSamples += 1
+		if !s.wasActive {
+			s.Activations += 1
+		}
+	}
+	s.wasActive = active
+	s.SumDelta += delta
+	if math.Abs(delta) > math.Abs(s.PeakDelta) {
+		s.PeakDelta = delta
+	}
+}
@@ -1,8 +1,10 @@
 package anomaly
 
 import (
+	"encoding/json"
 	"errors"
 	"math/rand/v2"
+	"time"
 
 	"github.com/synaptecltd/emulator/mathfuncs"
 )
@@ -11,28 +13,46 @@ import (
 type trendAnomaly struct {
 	AnomalyBase
 
-	Magnitude   float64 // magnitude of trend anomaly, default 0
-	magFuncName string  // name of function to use to vary the trend magnitude, defaults to "linear" if empty
-	InvertTrend bool    // true inverts the trend function (multiplies by -1.0), default false (no inverting)
+	Magnitude        float64 // magnitude of trend anomaly, default 0
+	MagnitudePercent float64 // magnitude of trend anomaly as a percentage of the nominal value of the channel, overrides Magnitude when resolved, 0 to use Magnitude
+	magFuncName      string  // name of function to use to vary the trend magnitude, defaults to "linear" if empty
+	InvertTrend      bool    // true inverts the trend function (multiplies by -1.0), default false (no inverting)
+	holdAtEnd        bool    // true holds the final delta of each repeat until the next repeat starts, and after the last repeat
+	accumulate       bool    // true starts each repeat from the final delta of the previous repeat, rather than from 0
 
 	// internal state
 	magFunction mathfuncs.MathsFunction // returns trend anomaly magnitude for a given elapsed time, magntiude and period; set internally from TrendFuncName
+	heldDelta   float64                 // final delta of the last completed repeat, returned while inactive if holdAtEnd is true, and added to each repeat if accumulate is true
 }
 
 // Parameters to use for the trend anomaly. All can be accessed publicly and used to define trendAnomaly.
 type TrendParams struct {
 	// Defined in AnomalyBase
 
-	Repeats    uint64  `yaml:"Repeats"`    // the number of times the trend anomaly repeats, 0 for infinite
-	Off        bool    `yaml:"Off"`        // true: anomaly deactivated, false: activated
-	StartDelay float64 `yaml:"StartDelay"` // the delay before trend anomalies begin (and between anomaly repeats) in seconds
-	Duration   float64 `yaml:"Duration"`   // the duration of each trend anomaly in seconds, 0 for continuous
+	Repeats          uint64    `yaml:"Repeats" json:"Repeats"`                                       // the number of times the trend anomaly repeats, 0 for infinite
+	Off              bool      `yaml:"Off" json:"Off"`                                               // true: anomaly deactivated, false: activated
+	StartDelay       float64   `yaml:"StartDelay" json:"StartDelay"`                                 // the delay before trend anomalies begin (and between anomaly repeats) in seconds
+	StartDelayJitter float64   `yaml:"StartDelayJitter,omitempty" json:"StartDelayJitter,omitempty"` // maximum random perturbation of the delay before each repeat in seconds, drawn uniformly from +/- this value, 0 for periodic repeats
+	Duration         float64   `yaml:"Duration" json:"Duration"`                                     // the duration of each trend anomaly in seconds, 0 for continuous
+	StartTime        time.Time `yaml:"StartTime,omitempty" json:"StartTime,omitempty"`               // wall-clock time at which the anomaly starts, overriding StartDelay, requires an emulator epoch, optional
+	EndTime          time.Time `yaml:"EndTime,omitempty" json:"EndTime,omitempty"`                   // wall-clock time at which the anomaly ends, overriding Duration, requires an emulator epoch, optional
+	MaxSlewRate      float64   `yaml:"MaxSlewRate" json:"MaxSlewRate"`                               // maximum rate of change of the applied delta in units per second, 0 for unlimited
+	Seed             uint64    `yaml:"Seed,omitempty" json:"Seed,omitempty"`                         // seed of the anomaly's own random number generator, 0 to use the emulator's
+	BlendMode        string    `yaml:"BlendMode,omitempty" json:"BlendMode,omitempty"`               // how the delta is combined with the channel: "add", "multiply" (scales by 1+delta), "replace" or "clamp", defaults to "add" if empty
+	ExclusiveGroup   string    `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"`     // name of a group of anomalies within the container of which at most one is active at a time, empty for none
+	TriggeredBy      string    `yaml:"TriggeredBy,omitempty" json:"TriggeredBy,omitempty"`           // name of an anomaly within the container whose events each start one repeat of this anomaly, after StartDelay, empty to follow its own schedule
+	TriggerOn        string    `yaml:"TriggerOn,omitempty" json:"TriggerOn,omitempty"`               // event of TriggeredBy which starts a repeat: "complete" or "activate", defaults to "complete" if empty
+	RampIn           float64   `yaml:"RampIn,omitempty" json:"RampIn,omitempty"`                     // time in seconds over which the delta fades in at the start of each repeat, 0 for an instantaneous start
+	RampOut          float64   `yaml:"RampOut,omitempty" json:"RampOut,omitempty"`                   // time in seconds over which the delta fades out at the end of each repeat, 0 for an instantaneous end
 
 	// Defined in trendAnomaly
 
-	Magnitude   float64 `yaml:"Magnitude"` // magnitude of trend anomaly, default 0
-	MagFuncName string  `yaml:"MagFunc"`   // name of the function used to vary the magnitude of the trend anomaly, empty defaults to "linear"
-	InvertTrend bool    `yaml:"Invert"`    // true inverts the trend function (multiplies by -1.0), default false (no inverting)
+	Magnitude        float64 `yaml:"Magnitude" json:"Magnitude"`                       // magnitude of trend anomaly, default 0
+	MagnitudePercent float64 `yaml:"MagnitudePercent" json:"MagnitudePercent"`         // magnitude of trend anomaly as a percentage of the nominal value of the channel, e.g. MeanTemperature or PosSeqMag, 0 to use Magnitude
+	MagFuncName      string  `yaml:"MagFunc" json:"MagFunc"`                           // name of the function used to vary the magnitude of the trend anomaly, empty defaults to "linear"
+	InvertTrend      bool    `yaml:"Invert" json:"Invert"`                             // true inverts the trend function (multiplies by -1.0), default false (no inverting)
+	HoldAtEnd        bool    `yaml:"HoldAtEnd,omitempty" json:"HoldAtEnd,omitempty"`   // true holds the final offset of each repeat until the next repeat starts, and indefinitely after the last repeat, e.g. for a permanent change of setpoint
+	Accumulate       bool    `yaml:"Accumulate,omitempty" json:"Accumulate,omitempty"` // true starts each repeat from the final offset of the previous repeat rather than from 0, for staircase or compounding trends
 }
 
 // Initialise the internal fields of TrendAnomaly when it is unmarshalled from yaml.
@@ -41,6 +61,36 @@ func (t *trendAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	if err := unmarshal(&params); err != nil {
 		return err
 	}
+	if err := params.Validate(); err != nil {
+		return err // reports every invalid value, rather than the first
+	}
+
+	// This performs checking for invalid values
+	trendAnomaly, err := NewTrendAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to t
+	*t = *trendAnomaly
+
+	return nil
+}
+
+// Returns the parameters of trendAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (t *trendAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[TrendParams]{Type: t.typeName, Uuid: t.uuidString(), Params: t.GetParams()}, nil
+}
+
+// Initialise the internal fields of trendAnomaly when it is unmarshalled from json.
+func (t *trendAnomaly) UnmarshalJSON(data []byte) error {
+	var params TrendParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+	if err := params.Validate(); err != nil {
+		return err // reports every invalid value, rather than the first
+	}
 
 	// This performs checking for invalid values
 	trendAnomaly, err := NewTrendAnomaly(params)
@@ -54,6 +104,11 @@ func (t *trendAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
 	return nil
 }
 
+// Returns the parameters of trendAnomaly, including its "Type" field, when it is marshalled to json.
+func (t *trendAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(t.typeName, t.uuid, t.GetParams())
+}
+
 // Returns a trendAnomaly pointer with the requested parameters, checking for invalid values.
 func NewTrendAnomaly(params TrendParams) (*trendAnomaly, error) {
 	trendAnomaly := &trendAnomaly{}
@@ -65,15 +120,38 @@ func NewTrendAnomaly(params TrendParams) (*trendAnomaly, error) {
 	if err := trendAnomaly.SetStartDelay(params.StartDelay); err != nil {
 		return nil, err
 	}
+	if err := trendAnomaly.SetStartDelayJitter(params.StartDelayJitter); err != nil {
+		return nil, err
+	}
+	if err := trendAnomaly.SetSchedule(params.StartTime, params.EndTime); err != nil {
+		return nil, err
+	}
+	if err := trendAnomaly.SetMaxSlewRate(params.MaxSlewRate); err != nil {
+		return nil, err
+	}
+	if err := trendAnomaly.SetBlendMode(params.BlendMode); err != nil {
+		return nil, err
+	}
+	if err := trendAnomaly.SetTrigger(params.TriggeredBy, params.TriggerOn); err != nil {
+		return nil, err
+	}
+	if err := trendAnomaly.SetRamp(params.RampIn, params.RampOut); err != nil {
+		return nil, err
+	}
 	if err := trendAnomaly.SetMagFunctionByName(params.MagFuncName); err != nil {
 		return nil, err
 	}
 
 	// Fields that can never be invalid set directly
+	trendAnomaly.SetSeed(params.Seed)
+	trendAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
 	trendAnomaly.typeName = "trend"
 	trendAnomaly.Magnitude = params.Magnitude
+	trendAnomaly.MagnitudePercent = params.MagnitudePercent
 	trendAnomaly.Repeats = params.Repeats
 	trendAnomaly.InvertTrend = params.InvertTrend
+	trendAnomaly.SetHoldAtEnd(params.HoldAtEnd)
+	trendAnomaly.SetAccumulate(params.Accumulate)
 	trendAnomaly.Off = params.Off
 
 	return trendAnomaly, nil
@@ -82,15 +160,22 @@ func NewTrendAnomaly(params TrendParams) (*trendAnomaly, error) {
 // Returns the change in signal caused by the trend anomaly this timestep.
 // Manages internal indices to track the progress of trend cycles, and delays between trend cycles.
 // Ts is the sampling period of the data.
-func (t *trendAnomaly) stepAnomaly(_ *rand.Rand, Ts float64) float64 {
+func (t *trendAnomaly) stepAnomaly(r *rand.Rand, Ts float64) float64 {
 	if t.Off {
+		if t.Repeats != 0 && t.countRepeats >= t.Repeats {
+			return t.finalDelta() // switched off by completing its repeats, rather than by the user
+		}
 		return 0.0
 	}
+	r = t.randSource(r)
+	t.jitterStartDelay(r)
+	t.setFunctionRand(r)
+
 	// Check if the trend anomaly is active this timestep
 	t.isAnomalyActive = t.CheckAnomalyActive(Ts)
 	if !t.isAnomalyActive {
 		t.startDelayIndex += 1 // increment to keep track of the delay between trend repeats
-		return 0.0
+		return t.finalDelta()
 	}
 
 	// Update the index after logging the current time
@@ -98,18 +183,39 @@ func (t *trendAnomaly) stepAnomaly(_ *rand.Rand, Ts float64) float64 {
 	t.elapsedActivatedIndex += 1
 
 	trendAnomalyMagnitude := t.magFunction(t.elapsedActivatedTime, t.Magnitude, t.duration)
-	trendAnomalyDelta := t.getSign() * trendAnomalyMagnitude
+	trendAnomalyDelta := t.getSign() * trendAnomalyMagnitude * t.envelopeGain(Ts)
+	if t.accumulate {
+		trendAnomalyDelta += t.heldDelta // continue from the end of the previous repeat
+	}
 
 	// If the trend anomaly is complete, reset the index and increment the repeat counter
 	if t.elapsedActivatedIndex == int(t.duration/Ts) {
 		t.elapsedActivatedIndex = 0
 		t.startDelayIndex = 0
 		t.countRepeats += 1
+		t.startDelayDrawn = false // the next repeat has a new start delay
+		t.heldDelta = trendAnomalyDelta
 	}
 
 	return trendAnomalyDelta
 }
 
+// Returns the delta of the trend anomaly while it is inactive, which is the final delta of the last
+// completed repeat if holdAtEnd is true, or 0 otherwise.
+func (t *trendAnomaly) finalDelta() float64 {
+	if t.holdAtEnd {
+		return t.heldDelta
+	}
+	return 0.0
+}
+
+// Sets Magnitude to MagnitudePercent of the nominal value of the channel, if MagnitudePercent is set.
+func (t *trendAnomaly) resolveMagnitude(nominal float64) {
+	if t.MagnitudePercent != 0 {
+		t.Magnitude = t.MagnitudePercent / 100 * nominal
+	}
+}
+
 // Returns -1.0 if InvertTrend is true, or +1.0 if false.
 func (t *trendAnomaly) getSign() float64 {
 	if t.InvertTrend {
@@ -133,15 +239,75 @@ func (t *trendAnomaly) SetDuration(duration float64) error {
 	return nil
 }
 
+// Sets whether the final delta of each repeat is held until the next repeat starts, and after the last repeat,
+// rather than returning to 0.
+func (t *trendAnomaly) SetHoldAtEnd(holdAtEnd bool) {
+	t.holdAtEnd = holdAtEnd
+}
+
+// Sets whether each repeat starts from the final delta of the previous repeat, such that the repeats
+// accumulate, rather than from 0.
+func (t *trendAnomaly) SetAccumulate(accumulate bool) {
+	t.accumulate = accumulate
+}
+
 func (t *trendAnomaly) SetMagFunctionByName(name string) error {
 	if name == "" {
 		name = "linear" // default to linear if no name is provided
 	}
-	return t.SetFunctionByName(name, mathfuncs.GetTrendFunctionFromName, &t.magFuncName, &t.magFunction)
+	return t.SetFunctionByName(name, t.lookupFunction, &t.magFuncName, &t.magFunction)
+}
+
+// Sets the function used to vary the trend magnitude to f, which need not be registered in mathfuncs.
+// The name identifies f in the parameters of the anomaly, so must be registered for these to be unmarshalled.
+func (t *trendAnomaly) SetMagFunction(f mathfuncs.MathsFunction, name string) error {
+	return t.SetFunction(f, name, &t.magFuncName, &t.magFunction)
+}
+
+// Returns a new trendAnomaly with the same parameters, at the start of its schedule, including a function set
+// by SetMagFunction.
+func (t *trendAnomaly) clone() (AnomalyInterface, error) {
+	params := t.GetParams()
+	params.MagFuncName = t.registeredName(params.MagFuncName)
+	clone, err := NewTrendAnomaly(params)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.copyFunction(t.magFuncName, clone.SetMagFunction); err != nil {
+		return nil, err
+	}
+	return clone, nil
 }
 
 // Getters
 
+// Returns the parameters which define trendAnomaly, such that NewTrendAnomaly returns an identical anomaly.
+func (t *trendAnomaly) GetParams() TrendParams {
+	return TrendParams{
+		Repeats:          t.Repeats,
+		Off:              t.Off,
+		StartDelay:       t.startDelay,
+		StartDelayJitter: t.startDelayJitter,
+		Duration:         t.duration,
+		StartTime:        t.startTime,
+		EndTime:          t.endTime,
+		MaxSlewRate:      t.maxSlewRate,
+		BlendMode:        t.blendMode,
+		ExclusiveGroup:   t.exclusiveGroup,
+		TriggeredBy:      t.triggeredBy,
+		TriggerOn:        t.triggerOn,
+		RampIn:           t.rampIn,
+		RampOut:          t.rampOut,
+		Seed:             t.seed,
+		Magnitude:        t.Magnitude,
+		MagnitudePercent: t.MagnitudePercent,
+		MagFuncName:      t.magFuncName,
+		InvertTrend:      t.InvertTrend,
+		HoldAtEnd:        t.holdAtEnd,
+		Accumulate:       t.accumulate,
+	}
+}
+
 func (t *trendAnomaly) GetMagFuncName() string {
 	return t.magFuncName
 }
@@ -150,3 +316,13 @@ func (t *trendAnomaly) GetMagFuncName() string {
 func (t *trendAnomaly) GetMagFunction() mathfuncs.MathsFunction {
 	return t.magFunction
 }
+
+// Returns true if the final delta of each repeat is held while the trend anomaly is inactive.
+func (t *trendAnomaly) GetHoldAtEnd() bool {
+	return t.holdAtEnd
+}
+
+// Returns true if each repeat of the trend anomaly starts from the final delta of the previous repeat.
+func (t *trendAnomaly) GetAccumulate() bool {
+	return t.accumulate
+}
@@ -0,0 +1,78 @@
+package anomaly
+
+import "errors"
+
+// Trigger events, which determine when an anomaly triggered by another anomaly within the same container
+// starts. Each event of the trigger starts a single repeat of the triggered anomaly, after its start delay,
+// from the next time step. Events while the triggered anomaly is already running are ignored.
+const (
+	TriggerOnComplete = "complete" // the triggered anomaly starts when the trigger completes a repeat
+	TriggerOnActivate = "activate" // the triggered anomaly starts when the trigger becomes active
+)
+
+// Sets the anomaly to be triggered by the events of the anomaly named triggeredBy within the same container,
+// on TriggerOnComplete, TriggerOnActivate or "" for TriggerOnComplete. An anomaly triggered by an anomaly
+// which is not in its container never starts, which Container.Validate reports. If triggeredBy is "", the
+// anomaly follows its own schedule. Budget anomalies, which have no schedule, cannot be triggered.
+func (a *AnomalyBase) SetTrigger(triggeredBy string, on string) error {
+	switch on {
+	case "", TriggerOnComplete, TriggerOnActivate:
+	default:
+		return errors.New("trigger event must be \"complete\" or \"activate\"")
+	}
+	if triggeredBy != "" {
+		if err := a.checkSupported("TriggeredBy"); err != nil {
+			return err
+		}
+	}
+	a.triggeredBy = triggeredBy
+	a.triggerOn = on
+	a.armed = false
+	a.triggerCount = 0
+	a.triggerActive = false
+	return nil
+}
+
+// Returns the name of the anomaly which triggers the anomaly, or "" if it follows its own schedule.
+func (a *AnomalyBase) GetTriggeredBy() string {
+	return a.triggeredBy
+}
+
+// Returns the event of the trigger which starts the anomaly, TriggerOnComplete or TriggerOnActivate.
+func (a *AnomalyBase) GetTriggerOn() string {
+	if a.triggerOn == "" {
+		return TriggerOnComplete
+	}
+	return a.triggerOn
+}
+
+// Arms the anomaly to start a repeat if its trigger completed a repeat or became active in the previous
+// time step. trigger is nil if the trigger is not in the container.
+func (a *AnomalyBase) updateTrigger(trigger AnomalyInterface) {
+	if trigger == nil {
+		return
+	}
+	event := false
+	if a.GetTriggerOn() == TriggerOnComplete {
+		event = trigger.GetCountRepeats() > a.triggerCount
+		a.triggerCount = trigger.GetCountRepeats()
+	} else {
+		event = trigger.GetIsAnomalyActive() && !a.triggerActive
+		a.triggerActive = trigger.GetIsAnomalyActive()
+	}
+	if event && !a.armed {
+		a.armed = true
+		a.armedRepeats = a.countRepeats
+	}
+}
+
+// Returns whether the anomaly is waiting for its trigger, in which case it is not stepped.
+func (a *AnomalyBase) waitingForTrigger() bool {
+	if a.triggeredBy == "" {
+		return false
+	}
+	if a.armed && a.countRepeats != a.armedRepeats {
+		a.armed = false // the triggered repeat is complete
+	}
+	return !a.armed
+}
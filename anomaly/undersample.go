@@ -0,0 +1,207 @@
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"time"
+)
+
+// Emulates an incorrectly configured decimator by holding and repeating output samples at a lower
+// effective sampling rate for the duration of the anomaly, producing aliasing artefacts.
+type undersampleAnomaly struct {
+	AnomalyBase
+
+	factor int // ratio of the sampling rate to the effective sampling rate while active, e.g. 4 to update outputs every 4th sample
+
+	// internal state
+	hold bool // whether the present sample repeats the previous output
+}
+
+// sampleHolder is implemented by anomalies which cause outputs to repeat previous samples rather than changing their value.
+type sampleHolder interface {
+	getHold() bool // Returns whether the present sample should repeat the previous output
+}
+
+// Parameters used to request an undersample anomaly. These map onto the fields of undersampleAnomaly.
+type UndersampleParams struct {
+	// Defined in AnomalyBase
+
+	Repeats        uint64    `yaml:"Repeats" json:"Repeats"`                                   // the number of times undersampling repeats, 0 for infinite
+	Off            bool      `yaml:"Off" json:"Off"`                                           // true: anomaly deactivated, false: activated
+	StartDelay     float64   `yaml:"StartDelay" json:"StartDelay"`                             // the delay before undersampling begins (and between anomaly repeats) in seconds
+	Duration       float64   `yaml:"Duration" json:"Duration"`                                 // the duration of each period of undersampling in seconds, 0 for continuous
+	StartTime      time.Time `yaml:"StartTime,omitempty" json:"StartTime,omitempty"`           // wall-clock time at which the anomaly starts, overriding StartDelay, requires an emulator epoch, optional
+	EndTime        time.Time `yaml:"EndTime,omitempty" json:"EndTime,omitempty"`               // wall-clock time at which the anomaly ends, overriding Duration, requires an emulator epoch, optional
+	ExclusiveGroup string    `yaml:"ExclusiveGroup,omitempty" json:"ExclusiveGroup,omitempty"` // name of a group of anomalies within the container of which at most one is active at a time, empty for none
+	TriggeredBy    string    `yaml:"TriggeredBy,omitempty" json:"TriggeredBy,omitempty"`       // name of an anomaly within the container whose events each start one repeat of this anomaly, after StartDelay, empty to follow its own schedule
+	TriggerOn      string    `yaml:"TriggerOn,omitempty" json:"TriggerOn,omitempty"`           // event of TriggeredBy which starts a repeat: "complete" or "activate", defaults to "complete" if empty
+
+	// Defined in undersampleAnomaly
+
+	Factor int `yaml:"Factor" json:"Factor"` // ratio of the sampling rate to the effective sampling rate while active, must be at least 2
+}
+
+// Initialise the internal fields of undersampleAnomaly when it is unmarshalled from yaml.
+func (u *undersampleAnomaly) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params UndersampleParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	undersampleAnomaly, err := NewUndersampleAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to u
+	*u = *undersampleAnomaly
+
+	return nil
+}
+
+// Returns the parameters of undersampleAnomaly, including its "Type" field, when it is marshalled to yaml.
+func (u *undersampleAnomaly) MarshalYAML() (interface{}, error) {
+	return typedParams[UndersampleParams]{Type: u.typeName, Uuid: u.uuidString(), Params: u.GetParams()}, nil
+}
+
+// Initialise the internal fields of undersampleAnomaly when it is unmarshalled from json.
+func (u *undersampleAnomaly) UnmarshalJSON(data []byte) error {
+	var params UndersampleParams
+	if err := json.Unmarshal(data, &params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	undersampleAnomaly, err := NewUndersampleAnomaly(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to u
+	*u = *undersampleAnomaly
+
+	return nil
+}
+
+// Returns the parameters of undersampleAnomaly, including its "Type" field, when it is marshalled to json.
+func (u *undersampleAnomaly) MarshalJSON() ([]byte, error) {
+	return marshalTypedJSON(u.typeName, u.uuid, u.GetParams())
+}
+
+// Returns an undersampleAnomaly pointer with the requested parameters, checking for invalid values.
+func NewUndersampleAnomaly(params UndersampleParams) (*undersampleAnomaly, error) {
+	undersampleAnomaly := &undersampleAnomaly{}
+
+	// Invalid values checked by setters
+	if err := undersampleAnomaly.SetStartDelay(params.StartDelay); err != nil {
+		return nil, err
+	}
+	if err := undersampleAnomaly.SetSchedule(params.StartTime, params.EndTime); err != nil {
+		return nil, err
+	}
+	if err := undersampleAnomaly.SetTrigger(params.TriggeredBy, params.TriggerOn); err != nil {
+		return nil, err
+	}
+	if err := undersampleAnomaly.SetDuration(params.Duration); err != nil {
+		return nil, err
+	}
+	if err := undersampleAnomaly.SetFactor(params.Factor); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	undersampleAnomaly.SetExclusiveGroup(params.ExclusiveGroup)
+	undersampleAnomaly.typeName = "undersample"
+	undersampleAnomaly.Repeats = params.Repeats
+	undersampleAnomaly.Off = params.Off
+
+	return undersampleAnomaly, nil
+}
+
+// Undersample anomalies do not change the signal value, so always return 0. Whether the present sample
+// repeats the previous output is available from the container using GetHold.
+func (u *undersampleAnomaly) stepAnomaly(_ *rand.Rand, Ts float64) float64 {
+	u.hold = false
+	if u.Off {
+		u.isAnomalyActive = false
+		return 0.0
+	}
+
+	// Check if the undersample anomaly is active this timestep
+	u.isAnomalyActive = u.CheckAnomalyActive(Ts)
+	if !u.isAnomalyActive {
+		u.startDelayIndex += 1 // increment to keep track of the delay between undersample repeats
+		return 0.0
+	}
+
+	// Only every factor-th sample of the active period updates the output
+	u.hold = u.elapsedActivatedIndex%u.factor != 0
+
+	// Update the index after logging the current time
+	u.elapsedActivatedTime = float64(u.elapsedActivatedIndex) * Ts
+	u.elapsedActivatedIndex += 1
+
+	// If the undersample period is complete, reset the index and increment the repeat counter
+	if u.duration > 0 && u.elapsedActivatedIndex == int(u.duration/Ts) {
+		u.elapsedActivatedIndex = 0
+		u.startDelayIndex = 0
+		u.countRepeats += 1
+	}
+
+	return 0.0
+}
+
+// Marks the anomaly as inactive, and not holding the present sample, in a time step in which it is not stepped.
+func (u *undersampleAnomaly) skipStep() {
+	u.isAnomalyActive = false
+	u.hold = false
+}
+
+// Returns whether the present sample should repeat the previous output.
+func (u *undersampleAnomaly) getHold() bool {
+	return u.hold
+}
+
+// Setters
+
+// Sets the duration of each period of undersampling in seconds if duration >= 0. If duration=0, undersampling is continuous.
+func (u *undersampleAnomaly) SetDuration(duration float64) error {
+	if duration < 0 {
+		return errors.New("duration must be positive value")
+	}
+	u.duration = duration
+	return nil
+}
+
+// Sets the ratio of the sampling rate to the effective sampling rate if factor >= 2.
+func (u *undersampleAnomaly) SetFactor(factor int) error {
+	if factor < 2 {
+		return errors.New("undersample factor must be at least 2")
+	}
+	u.factor = factor
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define undersampleAnomaly, such that NewUndersampleAnomaly returns an identical anomaly.
+func (u *undersampleAnomaly) GetParams() UndersampleParams {
+	return UndersampleParams{
+		Repeats:        u.Repeats,
+		Off:            u.Off,
+		StartDelay:     u.startDelay,
+		Duration:       u.duration,
+		StartTime:      u.startTime,
+		EndTime:        u.endTime,
+		ExclusiveGroup: u.exclusiveGroup,
+		TriggeredBy:    u.triggeredBy,
+		TriggerOn:      u.triggerOn,
+		Factor:         u.factor,
+	}
+}
+
+func (u *undersampleAnomaly) GetFactor() int {
+	return u.factor
+}
@@ -0,0 +1,127 @@
+package anomaly
+
+import (
+	"errors"
+	"fmt"
+)
+
+// FieldError is a problem with the value of a single field of a configuration, found by Validate.
+type FieldError struct {
+	Path string // path of the field, e.g. "V.PosSeqMagAnomaly.drift.Duration"
+	Err  error  // the problem with the value of the field
+}
+
+// Returns the problem prefixed by the path of the field.
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Err.Error()
+}
+
+// Returns the problem with the value of the field.
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+// Returns the errors within err, which may have been joined by errors.Join, as FieldErrors whose paths are
+// prefixed by prefix, so that the errors of a nested configuration can be joined with those of its parent.
+// Errors which are not FieldErrors are given the path prefix. Returns nil if err is nil.
+func FieldErrors(prefix string, err error) []error {
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		var errs []error
+		for _, e := range joined.Unwrap() {
+			errs = append(errs, FieldErrors(prefix, e)...)
+		}
+		return errs
+	}
+	var fieldErr *FieldError
+	if errors.As(err, &fieldErr) {
+		return []error{&FieldError{Path: prefix + "." + fieldErr.Path, Err: fieldErr.Err}}
+	}
+	return []error{&FieldError{Path: prefix, Err: err}}
+}
+
+// fieldCheck is the result of checking the value of a single field, nil if the value is valid.
+type fieldCheck struct {
+	path string
+	err  error
+}
+
+// Returns the errors of the failed checks joined as FieldErrors, in order, or nil if every check passed.
+func validateFields(checks ...fieldCheck) error {
+	var errs []error
+	for _, check := range checks {
+		errs = append(errs, FieldErrors(check.path, check.err)...)
+	}
+	return errors.Join(errs...)
+}
+
+// Validate returns every problem with the parameters, as FieldErrors joined by errors.Join, or nil if
+// NewTrendAnomaly accepts them. Unlike NewTrendAnomaly, it does not stop at the first problem.
+func (p TrendParams) Validate() error {
+	var t trendAnomaly
+	return validateFields(
+		fieldCheck{"Duration", t.SetDuration(p.Duration)},
+		fieldCheck{"StartDelay", t.SetStartDelay(p.StartDelay)},
+		fieldCheck{"StartDelayJitter", t.SetStartDelayJitter(p.StartDelayJitter)},
+		fieldCheck{"EndTime", t.SetSchedule(p.StartTime, p.EndTime)},
+		fieldCheck{"MaxSlewRate", t.SetMaxSlewRate(p.MaxSlewRate)},
+		fieldCheck{"BlendMode", t.SetBlendMode(p.BlendMode)},
+		fieldCheck{"TriggerOn", t.SetTrigger(p.TriggeredBy, p.TriggerOn)},
+		fieldCheck{"RampIn", t.SetRamp(p.RampIn, 0)},
+		fieldCheck{"RampOut", t.SetRamp(0, p.RampOut)},
+		fieldCheck{"MagFunc", t.SetMagFunctionByName(p.MagFuncName)},
+	)
+}
+
+// Validate returns every problem with the parameters, as FieldErrors joined by errors.Join, or nil if
+// NewSpikeAnomaly accepts them. Unlike NewSpikeAnomaly, it does not stop at the first problem.
+func (p SpikeParams) Validate() error {
+	var s spikeAnomaly
+	return validateFields(
+		fieldCheck{"StartDelay", s.SetStartDelay(p.StartDelay)},
+		fieldCheck{"StartDelayJitter", s.SetStartDelayJitter(p.StartDelayJitter)},
+		fieldCheck{"EndTime", s.SetSchedule(p.StartTime, p.EndTime)},
+		fieldCheck{"MaxSlewRate", s.SetMaxSlewRate(p.MaxSlewRate)},
+		fieldCheck{"BlendMode", s.SetBlendMode(p.BlendMode)},
+		fieldCheck{"TriggerOn", s.SetTrigger(p.TriggeredBy, p.TriggerOn)},
+		fieldCheck{"RampIn", s.SetRamp(p.RampIn, 0)},
+		fieldCheck{"RampOut", s.SetRamp(0, p.RampOut)},
+		fieldCheck{"Probability", s.SetProbability(p.Probability)},
+		fieldCheck{"MagFunc", s.SetMagFunctionByName(p.MagFuncName)},
+		fieldCheck{"ProbFunc", s.SetProbFunctionByName(p.ProbFuncName)},
+		fieldCheck{"ProbProfile", s.SetProbProfile(p.ProbProfile)},
+		fieldCheck{"DailyProbFunc", s.SetDailyProbFunctionByName(p.DailyProbFuncName)},
+		fieldCheck{"Sign", s.SetSpikeSign(p.SpikeSign)},
+		fieldCheck{"MinGap", s.SetMinGap(p.MinGap)},
+		fieldCheck{"AmplitudeDistribution", s.SetAmplitudeDistribution(p.AmplitudeDistribution, p.AmplitudeSpread)},
+		fieldCheck{"MagFuncPeriod", s.SetMagFuncPeriod(p.MagFuncPeriod)},
+		fieldCheck{"ProbFuncPeriod", s.SetProbFuncPeriod(p.ProbFuncPeriod)},
+		fieldCheck{"Duration", s.SetDuration(p.Duration)},
+	)
+}
+
+// Validate returns every problem with the anomalies within the container, as FieldErrors joined by
+// errors.Join with paths prefixed by the names of the anomalies, or nil if there are none. This includes
+// problems between anomalies, such as triggers which are not in the container.
+func (c Container) Validate() error {
+	var errs []error
+	for _, name := range c.Names() {
+		switch anomaly := c[name].(type) {
+		case *trendAnomaly:
+			errs = append(errs, FieldErrors(name, anomaly.GetParams().Validate())...)
+		case *spikeAnomaly:
+			errs = append(errs, FieldErrors(name, anomaly.GetParams().Validate())...)
+		}
+
+		trigger := c[name].GetTriggeredBy()
+		if trigger == name {
+			errs = append(errs, &FieldError{Path: name + ".TriggeredBy", Err: errors.New("anomaly cannot trigger itself")})
+		} else if trigger != "" && c[trigger] == nil {
+			errs = append(errs, &FieldError{Path: name + ".TriggeredBy", Err: fmt.Errorf("anomaly not found in container: %s", trigger)})
+		}
+	}
+	errs = append(errs, c.duplicateUUIDs()...)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,79 @@
+package emulator
+
+import (
+	"time"
+)
+
+// Sets the time zone of the emulator clock from an IANA time zone name, e.g. "Europe/London".
+// An empty name selects UTC. Calendar-based quantities such as TimeOfDay use the local time of
+// this zone, including daylight saving transitions unless DisableDST is set.
+func (e *Emulator) SetTimeZone(name string) error {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	e.TimeZone = name
+	e.location = location
+
+	// standard time has the smaller offset in both hemispheres, so compare midwinter and midsummer
+	year := e.Epoch.Year()
+	if e.Epoch.IsZero() {
+		year = time.Now().Year()
+	}
+	_, offsetJan := time.Date(year, time.January, 1, 0, 0, 0, 0, location).Zone()
+	_, offsetJul := time.Date(year, time.July, 1, 0, 0, 0, 0, location).Zone()
+	e.standardLocation = time.FixedZone(name, min(offsetJan, offsetJul))
+
+	return nil
+}
+
+// Returns the location used for local time, which is UTC if no time zone has been set.
+// If DisableDST is set, this is a fixed zone at the standard (non-daylight saving) offset of the time zone.
+func (e *Emulator) GetLocation() *time.Location {
+	if e.location == nil {
+		return time.UTC
+	}
+	if e.DisableDST {
+		return e.standardLocation
+	}
+	return e.location
+}
+
+// Returns the nominal time of the present sample (excluding any TimeError) in the emulator's time zone.
+func (e *Emulator) LocalTime() time.Time {
+	return e.Epoch.Add(time.Duration(e.elapsedTime * float64(time.Second))).In(e.GetLocation())
+}
+
+// Returns the local time of day of the present sample in hours, in the range [0, 24).
+func (e *Emulator) TimeOfDay() float64 {
+	local := e.LocalTime()
+	hour, minute, second := local.Clock()
+	return float64(hour) + float64(minute)/60 + (float64(second)+float64(local.Nanosecond())/1e9)/3600
+}
+
+// Returns the local day of the week of the present sample.
+func (e *Emulator) Weekday() time.Weekday {
+	return e.LocalTime().Weekday()
+}
+
+// Finds the anomaly containers with anomalies which depend on the local time of day, e.g. spikes with a
+// time-of-day probability profile, so that only those containers are updated from the clock each time step.
+func (e *Emulator) findClockFollowers() {
+	e.clockFollowers = e.clockFollowers[:0]
+	for _, name := range e.ContainerNames() {
+		if container, err := e.GetContainer(name); err == nil && container.FollowsClock() {
+			e.clockFollowers = append(e.clockFollowers, container)
+		}
+	}
+}
+
+// Sets the local time of day of the present sample for anomalies which depend on it.
+func (e *Emulator) stepClockFollowers() {
+	if len(e.clockFollowers) == 0 {
+		return
+	}
+	timeOfDay := e.TimeOfDay()
+	for _, container := range e.clockFollowers {
+		container.SetTimeOfDay(timeOfDay)
+	}
+}
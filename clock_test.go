@@ -0,0 +1,81 @@
+package emulator
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // ensure time zones are available on all platforms
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that local time follows daylight saving transitions, unless disabled
+func TestLocalTime_DST(t *testing.T) {
+	// one hour before clocks go forward in the UK
+	epoch := time.Date(2024, 3, 31, 0, 30, 0, 0, time.UTC)
+
+	for _, disableDST := range []bool{false, true} {
+		emulator := NewEmulator(1, 50.0)
+		emulator.Epoch = epoch
+		emulator.DisableDST = disableDST
+		assert.NoError(t, emulator.SetTimeZone("Europe/London"))
+
+		emulator.Step()
+		assert.InDelta(t, 0.5, emulator.TimeOfDay(), 1e-9)
+		assert.Equal(t, time.Sunday, emulator.Weekday())
+
+		for i := 0; i < 3600; i++ {
+			emulator.Step()
+		}
+		if disableDST {
+			assert.InDelta(t, 1.5, emulator.TimeOfDay(), 1e-9)
+		} else {
+			assert.InDelta(t, 2.5, emulator.TimeOfDay(), 1e-9)
+		}
+	}
+}
+
+// Assert that the time zone is loaded when an emulator is unmarshalled from yaml
+func TestUnmarshalYAML_TimeZone(t *testing.T) {
+	var emulator Emulator
+	err := yaml.Unmarshal([]byte("SamplingRate: 10\nEpoch: 2024-07-01T12:00:00Z\nTimeZone: Australia/Sydney\n"), &emulator)
+	assert.NoError(t, err)
+	assert.Equal(t, 0.1, emulator.Ts)
+
+	emulator.Step()
+	assert.InDelta(t, 22.0, emulator.TimeOfDay(), 1e-9)
+
+	err = yaml.Unmarshal([]byte("TimeZone: Not/AZone\n"), &emulator)
+	assert.Error(t, err)
+}
+
+// Assert that the probability of spikes follows a time-of-day profile anchored to the local time of the emulator clock
+func TestSpikeAnomaly_ProbProfile(t *testing.T) {
+	yamlStr := `
+SamplingRate: 1
+Fnom: 50
+Epoch: 2024-06-01T00:00:00Z
+TimeZone: Europe/London
+TemperatureEmulator:
+  MeanTemperature: 20
+  Anomaly:
+    daytime:
+      Type: spike
+      Magnitude: 1
+      ProbProfile:
+        - {Hour: 18, Probability: 0}
+        - {Hour: 6, Probability: 1}
+`
+	var emulator Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &emulator))
+
+	// local time is one hour ahead of UTC in summer
+	for i := 0; i < 2*24*3600; i += 60 {
+		emulator.Step()
+		hour := (i/3600 + 1) % 24
+		assert.Equal(t, hour >= 6 && hour < 18, emulator.T.Anomaly["daytime"].GetIsAnomalyActive(), "hour %d", hour)
+		for j := 0; j < 59; j++ {
+			emulator.Step()
+		}
+	}
+}
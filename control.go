@@ -0,0 +1,47 @@
+package emulator
+
+import (
+	"errors"
+
+	"github.com/synaptecltd/emulator/anomaly"
+)
+
+// Subscribes the anomaly container with the given name, see GetContainer, to a channel of control messages, e.g.
+// from an external orchestrator. Pending messages are applied in order at the start of each time step by the
+// goroutine calling Step, so that anomalies can be switched on or off, replaced or added without locking, and each
+// time step sees every change sent before it started. The subscription ends when the channel is closed or
+// Unsubscribe is called, and a container is subscribed to at most one channel at a time.
+func (e *Emulator) Subscribe(containerName string, messages <-chan anomaly.ControlMessage) error {
+	container, err := e.GetContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if messages == nil {
+		return errors.New("channel of control messages must not be nil")
+	}
+	if *container == nil {
+		*container = anomaly.Container{} // so that anomalies can be added by ControlUpdate
+	}
+	if e.subscriptions == nil {
+		e.subscriptions = make(map[string]<-chan anomaly.ControlMessage)
+	}
+	e.subscriptions[containerName] = messages
+	return nil
+}
+
+// Ends the subscription of the anomaly container with the given name to a channel of control messages, if any.
+// Messages which are pending are not applied.
+func (e *Emulator) Unsubscribe(containerName string) {
+	delete(e.subscriptions, containerName)
+}
+
+// Applies the control messages pending on the channels subscribed to by containers, ending the subscriptions of
+// channels which are closed.
+func (e *Emulator) applyControl() {
+	for name, messages := range e.subscriptions {
+		container, err := e.GetContainer(name)
+		if err != nil || !container.ApplyControl(messages) {
+			delete(e.subscriptions, name) // the emulation of the container has been removed, or the channel is closed
+		}
+	}
+}
@@ -0,0 +1,72 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/synaptecltd/emulator/anomaly"
+)
+
+// Assert that control messages sent to a subscribed container are applied at the start of the next time step
+func TestEmulator_Subscribe(t *testing.T) {
+	newSpike := func(magnitude float64) anomaly.AnomalyInterface {
+		spike, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Probability: 1, Magnitude: magnitude, SpikeSign: 1})
+		assert.NoError(t, err)
+		return spike
+	}
+	emu := NewEmulator(4000, 50)
+	emu.T = &TemperatureEmulation{MeanTemperature: 30}
+	messages := make(chan anomaly.ControlMessage, 10)
+	assert.NoError(t, emu.Subscribe("T.Anomaly", messages)) // the nil container is initialised
+	assert.EqualError(t, emu.Subscribe("V.FreqAnomaly", messages), "emulation not defined for anomaly container: V.FreqAnomaly")
+	assert.Error(t, emu.Subscribe("T.Anomaly", nil))
+
+	errs := make(chan error, 10)
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlUpdate, Anomaly: newSpike(1), Err: errs}
+	emu.Step()
+	assert.NoError(t, <-errs)
+	assert.Equal(t, 31.0, emu.T.T)
+
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlDisable}
+	emu.Step()
+	assert.Equal(t, 30.0, emu.T.T)
+
+	// messages sent concurrently with stepping are applied without data races
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			action := anomaly.ControlEnable
+			if i%2 == 0 {
+				action = anomaly.ControlDisable
+			}
+			messages <- anomaly.ControlMessage{Name: "spike", Action: action}
+		}
+	}()
+	for stepping := true; stepping; {
+		select {
+		case <-done:
+			stepping = false
+		default:
+			emu.Step()
+		}
+	}
+	emu.Step()
+	emu.Step()
+	assert.Equal(t, 31.0, emu.T.T)
+
+	// closing the channel ends the subscription
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlDisable}
+	close(messages)
+	emu.Step()
+	assert.Equal(t, 30.0, emu.T.T)
+	assert.Empty(t, emu.subscriptions)
+
+	// messages pending when the container is unsubscribed are not applied
+	messages = make(chan anomaly.ControlMessage, 10)
+	assert.NoError(t, emu.Subscribe("T.Anomaly", messages))
+	messages <- anomaly.ControlMessage{Name: "spike", Action: anomaly.ControlEnable}
+	emu.Unsubscribe("T.Anomaly")
+	emu.Step()
+	assert.Equal(t, 30.0, emu.T.T)
+}
@@ -0,0 +1,155 @@
+package emulator
+
+import (
+	"errors"
+	"math"
+)
+
+// CTSaturation models the saturation of the current transformer of a current emulation, which distorts the
+// secondary current when the flux of its core exceeds the saturation level. The flux is the integral of the
+// secondary current, scaled so that a symmetrical current of peak I gives a flux of peak I, so saturation is
+// driven both by the magnitude of the current and by its DC offset, e.g. the decaying DC offset of a fault with
+// FaultXR set, which can saturate the core at up to 1+X/R times the symmetrical current. The saturated core is
+// ideal: while the flux is at the saturation level, the secondary current collapses towards zero, until the primary
+// current reverses and desaturates the core, giving the characteristic waveform of a saturated CT.
+type CTSaturation struct {
+	saturationLevel float64 // peak of a symmetrical current which saturates the core, in the units of the current
+	timeConstant    float64 // time constant of the decay of the flux in seconds, e.g. of remanence after a fault, 0 for no decay
+
+	// internal state
+	flux        [3]float64 // present flux of the cores of phases A, B and C, in the units of saturationLevel
+	previous    [3]float64 // primary currents of phases A, B and C in the previous time step
+	initialised int        // number of time steps which have elapsed, up to 2, after which the flux is in steady state
+}
+
+// Parameters used to request CT saturation. These map onto the fields of CTSaturation.
+type CTSaturationParams struct {
+	SaturationLevel float64 `yaml:"SaturationLevel"`        // peak of a symmetrical current which saturates the core, in the units of the current, must be greater than 0
+	TimeConstant    float64 `yaml:"TimeConstant,omitempty"` // time constant of the decay of the flux in seconds, e.g. of remanence after a fault, 0 for no decay
+}
+
+// Initialise the internal fields of CTSaturation when it is unmarshalled from yaml.
+func (c *CTSaturation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params CTSaturationParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	saturation, err := NewCTSaturation(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to c
+	*c = *saturation
+
+	return nil
+}
+
+// Returns the parameters of CTSaturation when it is marshalled to yaml.
+func (c *CTSaturation) MarshalYAML() (interface{}, error) {
+	return c.GetParams(), nil
+}
+
+// Returns a CTSaturation pointer with the requested parameters, checking for invalid values.
+func NewCTSaturation(params CTSaturationParams) (*CTSaturation, error) {
+	saturation := &CTSaturation{}
+	if err := saturation.SetSaturationLevel(params.SaturationLevel); err != nil {
+		return nil, err
+	}
+	if err := saturation.SetTimeConstant(params.TimeConstant); err != nil {
+		return nil, err
+	}
+	return saturation, nil
+}
+
+// Returns the secondary currents of phases A, B and C given their primary currents, and steps the flux forward by
+// Ts at the frequency f. The flux starts in the steady state of the primary currents, so that the CT is transparent
+// from the start of the emulation unless the currents exceed the saturation level.
+func (c *CTSaturation) step(a, b, cc float64, f float64, Ts float64) (float64, float64, float64) {
+	primary := [3]float64{a, b, cc}
+	delta := 2 * math.Pi * f * Ts // angle of the fundamental in each time step
+	if c.initialised < 2 {
+		c.initialised++
+		if c.initialised == 2 {
+			for i := range primary {
+				c.flux[i] = steadyStateFlux(c.previous[i], primary[i], delta)
+			}
+		}
+		c.previous = primary
+		return a, b, cc
+	}
+
+	decay := 1.0
+	if c.timeConstant > 0 {
+		decay = math.Exp(-Ts / c.timeConstant)
+	}
+	var secondary [3]float64
+	for i, current := range primary {
+		flux := c.flux[i]*decay + delta*current
+		limited := max(-c.saturationLevel, min(c.saturationLevel, flux))
+
+		// the saturated core diverts the current which would take the flux beyond the saturation level
+		secondary[i] = current - (flux-limited)/delta
+		c.flux[i] = limited
+	}
+	c.previous = primary
+	return secondary[0], secondary[1], secondary[2]
+}
+
+// Returns the flux of a core in steady state, given the present and previous samples of a sinusoidal current which
+// advances by the angle delta in each time step. The flux of the sinusoid I*sin(theta), integrated by summing
+// delta*I*sin(theta) at each sample, is -I*cos(theta+delta/2)*delta/(2*sin(delta/2)).
+func steadyStateFlux(previous, present float64, delta float64) float64 {
+	cosine := (present*math.Cos(delta) - previous) / math.Sin(delta) // I*cos(theta) at the present sample
+	return -(cosine*math.Cos(delta/2) - present*math.Sin(delta/2)) * delta / (2 * math.Sin(delta/2))
+}
+
+// Setters
+
+// Sets the peak of a symmetrical current which saturates the core if saturationLevel > 0.
+func (c *CTSaturation) SetSaturationLevel(saturationLevel float64) error {
+	if saturationLevel <= 0 {
+		return errors.New("saturation level must be greater than 0")
+	}
+	c.saturationLevel = saturationLevel
+	return nil
+}
+
+// Sets the time constant of the decay of the flux in seconds if timeConstant >= 0, or 0 for no decay.
+func (c *CTSaturation) SetTimeConstant(timeConstant float64) error {
+	if timeConstant < 0 {
+		return errors.New("time constant must be greater than or equal to 0")
+	}
+	c.timeConstant = timeConstant
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define CTSaturation, such that NewCTSaturation returns an identical CT model.
+func (c *CTSaturation) GetParams() CTSaturationParams {
+	return CTSaturationParams{
+		SaturationLevel: c.saturationLevel,
+		TimeConstant:    c.timeConstant,
+	}
+}
+
+func (c *CTSaturation) GetSaturationLevel() float64 {
+	return c.saturationLevel
+}
+
+func (c *CTSaturation) GetTimeConstant() float64 {
+	return c.timeConstant
+}
+
+// Returns whether the core of any phase is saturated in the present time step.
+func (c *CTSaturation) IsSaturated() bool {
+	for _, flux := range c.flux {
+		if math.Abs(flux) >= c.saturationLevel {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,63 @@
+package emulator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that an unsaturated CT is transparent, and that a fault with a DC offset saturates it, reducing the
+// secondary current
+func TestCTSaturation_Fault(t *testing.T) {
+	yamlStr := `
+PosSeqMag: 100
+FaultXR: 10
+CTSaturation:
+  SaturationLevel: 300
+  TimeConstant: 1
+`
+	var saturating ThreePhaseEmulation
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &saturating))
+	assert.Equal(t, CTSaturationParams{SaturationLevel: 300, TimeConstant: 1}, saturating.CTSaturation.GetParams())
+
+	emu := NewEmulator(4000, 50.0)
+	emu.I = &saturating
+	reference := NewEmulator(4000, 50.0)
+	reference.I = &ThreePhaseEmulation{PosSeqMag: 100, FaultXR: 10}
+
+	// the symmetrical current does not saturate the CT
+	for i := 0; i < 800; i++ {
+		emu.Step()
+		reference.Step()
+		assert.Equal(t, reference.I.A, emu.I.A, "sample %d", i)
+		assert.False(t, emu.I.CTSaturation.IsSaturated())
+	}
+
+	// the DC offset of a fault current of 220 peak saturates the CT
+	assert.NoError(t, emu.StartEvent(EventParams{Type: ThreePhaseFault, DurationSamples: 4000}))
+	assert.NoError(t, reference.StartEvent(EventParams{Type: ThreePhaseFault, DurationSamples: 4000}))
+	saturated := 0
+	for i := 0; i < 4000; i++ {
+		emu.Step()
+		reference.Step()
+		primary := [3]float64{reference.I.A, reference.I.B, reference.I.C}
+		secondary := [3]float64{emu.I.A, emu.I.B, emu.I.C}
+		for phase := range primary {
+			// the secondary current is reduced towards zero, but does not change sign
+			assert.LessOrEqual(t, math.Abs(secondary[phase]), math.Abs(primary[phase])+1e-9)
+			assert.GreaterOrEqual(t, secondary[phase]*primary[phase], -1e-9)
+			if math.Abs(primary[phase]) > 100 && math.Abs(secondary[phase]) < 0.5*math.Abs(primary[phase]) {
+				saturated++
+			}
+		}
+	}
+	assert.Greater(t, saturated, 0)
+
+	_, err := NewCTSaturation(CTSaturationParams{SaturationLevel: 0})
+	assert.Error(t, err)
+	_, err = NewCTSaturation(CTSaturationParams{SaturationLevel: 300, TimeConstant: -1})
+	assert.Error(t, err)
+	assert.Error(t, yaml.Unmarshal([]byte("PosSeqMag: 100\nCTSaturation:\n  TimeConstant: 1\n"), &ThreePhaseEmulation{}))
+}
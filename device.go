@@ -0,0 +1,25 @@
+package emulator
+
+// DeviceInfo identifies an emulated device, so that outputs from multiple emulators can be distinguished and routed.
+type DeviceInfo struct {
+	ID       string `yaml:"ID,omitempty"`       // unique identifier of the device
+	Model    string `yaml:"Model,omitempty"`    // device model
+	Location string `yaml:"Location,omitempty"` // installed location of the device
+	Firmware string `yaml:"Firmware,omitempty"` // firmware version of the device
+}
+
+// Returns the non-empty fields of the emulator's device identity as tags, which exporters attach to their outputs.
+func (e *Emulator) Tags() map[string]string {
+	tags := make(map[string]string)
+	for key, value := range map[string]string{
+		"DeviceID":       e.Device.ID,
+		"DeviceModel":    e.Device.Model,
+		"DeviceLocation": e.Device.Location,
+		"DeviceFirmware": e.Device.Firmware,
+	} {
+		if value != "" {
+			tags[key] = value
+		}
+	}
+	return tags
+}
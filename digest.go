@@ -0,0 +1,178 @@
+package emulator
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"time"
+)
+
+// Categories of digest entries
+const (
+	DigestAnomaly   = "anomaly"   // an anomaly was active
+	DigestEvent     = "event"     // an emulated event, see StartEvent
+	DigestThreshold = "threshold" // the alarm of a threshold detector was raised
+)
+
+// Formats of event digests
+const (
+	DigestCSV  = "csv"
+	DigestJSON = "json"
+)
+
+// DigestEntry records a single occurrence of an anomaly, emulated event or threshold alarm during a run.
+type DigestEntry struct {
+	Category    string  `json:"Category"`            // DigestAnomaly, DigestEvent or DigestThreshold
+	Name        string  `json:"Name"`                // name of the anomaly, emulated event type or threshold detector
+	Source      string  `json:"Source,omitempty"`    // container of an anomaly, or channel of a threshold detector
+	Type        string  `json:"Type,omitempty"`      // type of an anomaly, e.g. "spike"
+	StartSample uint64  `json:"StartSample"`         // index of the first sample of the occurrence, since the start of the emulation
+	StartTime   float64 `json:"StartTime"`           // nominal time of the first sample since the start of the emulation, in seconds
+	Timestamp   string  `json:"Timestamp,omitempty"` // RFC 3339 timestamp of the first sample, if the emulator has an Epoch
+	Duration    float64 `json:"Duration"`            // duration of the occurrence in seconds
+	Ongoing     bool    `json:"Ongoing,omitempty"`   // true if the occurrence had not ended by the end of the run
+}
+
+// DigestWriter records the anomaly activations, emulated events and threshold alarms of a run, and writes
+// them as an event digest file when closed, for systems which only ingest event data. Unlike sample-level
+// exporters, the digest is written once, at the end of the run, as the duration of each entry is only
+// known once it has ended. Memory use grows with the number of entries, not the number of samples.
+type DigestWriter struct {
+	w       io.Writer
+	format  string         // DigestCSV or DigestJSON
+	entries []DigestEntry  // recorded entries, in the order they started
+	open    map[string]int // index within entries of each occurrence which has not ended, keyed by category and name
+	written bool           // whether the digest has been written by Close
+
+	anomalies *EventLog // tracks when anomalies start and stop
+	endTime   float64   // nominal time of the end of the latest sample, in seconds
+}
+
+// Returns a DigestWriter which writes to w in the given format, DigestCSV or DigestJSON.
+func NewDigestWriter(w io.Writer, format string) (*DigestWriter, error) {
+	if format != DigestCSV && format != DigestJSON {
+		return nil, errors.New("digest format must be csv or json")
+	}
+	return &DigestWriter{
+		w:         w,
+		format:    format,
+		entries:   []DigestEntry{},
+		open:      make(map[string]int),
+		anomalies: NewEventLog(),
+	}, nil
+}
+
+// Records the anomalies, emulated events and threshold alarms which started or ended in the present time step.
+func (d *DigestWriter) WriteSample(e *Emulator) error {
+	d.endTime = e.elapsedTime + e.EffectiveTs
+
+	d.anomalies.record(e, e.SampleIndex-1) // the sample index has already been incremented by Step
+	for _, event := range d.anomalies.events {
+		key := DigestAnomaly + "/" + event.Container + "/" + event.Name
+		if event.Kind == AnomalyStarted {
+			d.start(e, key, DigestEntry{Category: DigestAnomaly, Name: event.Name, Source: event.Container, Type: event.Type})
+		} else {
+			d.end(key, event.ElapsedTime)
+		}
+	}
+	d.anomalies.events = d.anomalies.events[:0]
+
+	for i, eventType := range e.StartedEvents {
+		name := EventTypeName(eventType)
+		if name == "" {
+			continue
+		}
+		durationSamples := eventDurationSamples(eventType)
+		if i < len(e.startedDurations) {
+			durationSamples = e.startedDurations[i]
+		}
+		d.start(e, "", DigestEntry{Category: DigestEvent, Name: name, Duration: float64(durationSamples) * e.EffectiveTs})
+	}
+
+	for _, event := range e.ThresholdEvents {
+		key := DigestThreshold + "/" + event.Detector + "/" + event.Channel
+		if event.Kind == ThresholdRaised {
+			d.start(e, key, DigestEntry{Category: DigestThreshold, Name: event.Detector, Source: event.Channel})
+		} else {
+			d.end(key, event.ElapsedTime)
+		}
+	}
+	return nil
+}
+
+// Records the start of an entry at the present sample. If key is not empty, the entry is open until ended with the same key.
+func (d *DigestWriter) start(e *Emulator, key string, entry DigestEntry) {
+	entry.StartSample = e.SampleIndex - 1
+	entry.StartTime = e.elapsedTime
+	if !e.Epoch.IsZero() {
+		entry.Timestamp = e.Timestamp().Format(time.RFC3339Nano)
+	}
+	if key != "" {
+		d.open[key] = len(d.entries)
+	}
+	d.entries = append(d.entries, entry)
+}
+
+// Records the end of the open entry with the given key at the given time, if there is one.
+func (d *DigestWriter) end(key string, endTime float64) {
+	if i, ok := d.open[key]; ok {
+		d.entries[i].Duration = endTime - d.entries[i].StartTime
+		delete(d.open, key)
+	}
+}
+
+// Returns the recorded entries, in the order they started. Entries which have not ended have a duration of 0.
+func (d *DigestWriter) Entries() []DigestEntry {
+	return d.entries
+}
+
+// Does nothing, the digest is written by Close once the run is complete.
+func (d *DigestWriter) Flush() error {
+	return nil
+}
+
+// Writes the digest, ending open entries at the end of the latest sample and marking them as ongoing.
+// The digest is only written on the first call.
+func (d *DigestWriter) Close() error {
+	if d.written {
+		return nil
+	}
+	d.written = true
+
+	for key, i := range d.open {
+		d.entries[i].Duration = d.endTime - d.entries[i].StartTime
+		d.entries[i].Ongoing = true
+		delete(d.open, key)
+	}
+	for i, entry := range d.entries {
+		if entry.StartTime+entry.Duration > d.endTime {
+			d.entries[i].Duration = d.endTime - entry.StartTime // emulated events may outlast the run
+			d.entries[i].Ongoing = true
+		}
+	}
+	if d.format == DigestJSON {
+		encoder := json.NewEncoder(d.w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(d.entries)
+	}
+
+	w := csv.NewWriter(d.w)
+	w.Write([]string{"Category", "Name", "Source", "Type", "StartSample", "StartTime", "Timestamp", "Duration", "Ongoing"})
+	for _, entry := range d.entries {
+		w.Write([]string{
+			entry.Category,
+			entry.Name,
+			entry.Source,
+			entry.Type,
+			strconv.FormatUint(entry.StartSample, 10),
+			strconv.FormatFloat(entry.StartTime, 'g', -1, 64),
+			entry.Timestamp,
+			strconv.FormatFloat(entry.Duration, 'g', -1, 64),
+			strconv.FormatBool(entry.Ongoing),
+		})
+	}
+	w.Flush()
+	return w.Error()
+}
@@ -0,0 +1,71 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/synaptecltd/emulator/anomaly"
+)
+
+// Assert that the digest records anomaly activations, emulated events and threshold alarms with durations
+func TestDigestWriter(t *testing.T) {
+	_, err := NewDigestWriter(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+
+	trendAnomaly, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 10.0, StartDelay: 1, Duration: 1, Repeats: 1})
+	assert.NoError(t, err)
+	emulator := NewEmulator(10, 50.0)
+	emulator.Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	emulator.T = &TemperatureEmulation{MeanTemperature: 20.0, Anomaly: anomaly.Container{anomalyKey: trendAnomaly}}
+	assert.NoError(t, emulator.AddThresholdDetector(&ThresholdDetector{Name: "hot", Channel: ChannelT, Threshold: 25}))
+
+	var buf bytes.Buffer
+	digest, err := NewDigestWriter(&buf, DigestJSON)
+	assert.NoError(t, err)
+	assert.NoError(t, emulator.Run(10, digest))
+	emulator.StartEvent(EventParams{Type: OverFrequency})
+	assert.NoError(t, emulator.Run(30, digest))
+	assert.NoError(t, digest.Close())
+
+	var entries []DigestEntry
+	assert.NoError(t, json.Unmarshal(buf.Bytes(), &entries))
+	assert.Equal(t, digest.Entries(), entries)
+	assert.Len(t, entries, 3)
+
+	assert.Equal(t, DigestAnomaly, entries[0].Category)
+	assert.Equal(t, "T.Anomaly", entries[0].Source)
+	assert.Equal(t, "trend", entries[0].Type)
+	assert.InDelta(t, 1.0, entries[0].Duration, 0.11)
+	assert.False(t, entries[0].Ongoing)
+
+	// the fault starts at the 11th sample and outlasts the run
+	assert.Equal(t, DigestEntry{
+		Category:    DigestEvent,
+		Name:        "OverFrequency",
+		StartSample: 10,
+		StartTime:   1,
+		Timestamp:   "2024-01-01T00:00:01Z",
+		Duration:    3,
+		Ongoing:     true,
+	}, entries[1])
+
+	assert.Equal(t, DigestThreshold, entries[2].Category)
+	assert.Equal(t, "hot", entries[2].Name)
+	assert.Greater(t, entries[2].StartSample, entries[0].StartSample)
+	assert.Greater(t, entries[2].Duration, 0.0)
+
+	// the digest is only written once
+	written := buf.Len()
+	assert.NoError(t, digest.Close())
+	assert.Equal(t, written, buf.Len())
+	var csvBuf bytes.Buffer
+	csvDigest, err := NewDigestWriter(&csvBuf, DigestCSV)
+	assert.NoError(t, err)
+	assert.NoError(t, emulator.Run(1, csvDigest))
+	assert.NoError(t, csvDigest.Close())
+	assert.Equal(t, "Category,Name,Source,Type,StartSample,StartTime,Timestamp,Duration,Ongoing", strings.Split(csvBuf.String(), "\n")[0])
+}
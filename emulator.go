@@ -1,18 +1,75 @@
 package emulator
 
-import "math/rand/v2"
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/synaptecltd/emulator/anomaly"
+	"gopkg.in/yaml.v2"
+)
 
 // Emulated event types
 const (
-	SinglePhaseFault     = iota
-	ThreePhaseFault      = iota
-	OverVoltage          = iota
-	UnderVoltage         = iota
-	OverFrequency        = iota
-	UnderFrequency       = iota
-	CapacitorOverCurrent = iota
+	SinglePhaseFault         = iota
+	ThreePhaseFault          = iota
+	OverVoltage              = iota
+	UnderVoltage             = iota
+	OverFrequency            = iota
+	UnderFrequency           = iota
+	CapacitorOverCurrent     = iota
+	PowerDown                = iota
+	PhaseToPhaseFault        = iota
+	DoublePhaseToGroundFault = iota
+	EvolvingFault            = iota
 )
 
+// Names of the emulated event types, as reported in event digests
+var eventTypeNames = map[int]string{
+	SinglePhaseFault:         "SinglePhaseFault",
+	ThreePhaseFault:          "ThreePhaseFault",
+	OverVoltage:              "OverVoltage",
+	UnderVoltage:             "UnderVoltage",
+	OverFrequency:            "OverFrequency",
+	UnderFrequency:           "UnderFrequency",
+	CapacitorOverCurrent:     "CapacitorOverCurrent",
+	PowerDown:                "PowerDown",
+	PhaseToPhaseFault:        "PhaseToPhaseFault",
+	DoublePhaseToGroundFault: "DoublePhaseToGroundFault",
+	EvolvingFault:            "EvolvingFault",
+}
+
+// Returns the name of an emulated event type, e.g. "ThreePhaseFault", or an empty string if it is unknown.
+func EventTypeName(eventType int) string {
+	eventTypesMutex.RLock()
+	defer eventTypesMutex.RUnlock()
+	return eventTypeNames[eventType]
+}
+
+// Returns the duration of an emulated event type in samples, or 0 if it is unknown.
+func eventDurationSamples(eventType int) int {
+	switch eventType {
+	case SinglePhaseFault, PhaseToPhaseFault, DoublePhaseToGroundFault, ThreePhaseFault, OverVoltage, UnderVoltage:
+		return MaxEmulatedFaultDurationSamples
+	case EvolvingFault:
+		return 3 * EmulatedEvolvingFaultStageSamples
+	case OverFrequency, UnderFrequency:
+		return MaxEmulatedFrequencyDurationSamples
+	case CapacitorOverCurrent:
+		return MaxEmulatedCapacitorOverCurrentSamples
+	case PowerDown:
+		return math.MaxInt // the device remains powered down until the end of the run
+	}
+	if custom, ok := lookupCustomEventType(eventType); ok {
+		return custom.defaultDurationSamples
+	}
+	return 0
+}
+
 // EmulatedFaultStartSamples is the number of samples before initiating an emulated fault
 const EmulatedFaultStartSamples = 1000
 
@@ -31,84 +88,415 @@ const EmulatedFaultCurrentMagnitude = 80
 // Emulator encapsulates the waveform emulation of three-phase voltage, three-phase current, or temperature
 type Emulator struct {
 	// common inputs
-	SamplingRate int     `yaml:"SamplingRate"` // The sampling rate of the emulator
-	Ts           float64 `yaml:"Ts"`           // The time step or sampling period (=1/SamplingRate)
-	Fnom         float64 `yaml:"Fnom"`         // Nominal frequency
-	Fdeviation   float64 `yaml:"Fdeviation"`   // Frequency deviation
+	Version      int       `yaml:"Version"`              // Version of the configuration schema, see CurrentConfigVersion; older configurations are upgraded when unmarshalled
+	SamplingRate int       `yaml:"SamplingRate"`         // The sampling rate of the emulator
+	Ts           float64   `yaml:"Ts"`                   // The time step or sampling period (=1/SamplingRate)
+	Fnom         float64   `yaml:"Fnom"`                 // Nominal frequency
+	Fdeviation   float64   `yaml:"Fdeviation"`           // Frequency deviation
+	Epoch        time.Time `yaml:"Epoch,omitempty"`      // Timestamp of the first sample, optional
+	TimeZone     string    `yaml:"TimeZone,omitempty"`   // IANA name of the time zone used for local time, defaults to UTC; use SetTimeZone to change
+	DisableDST   bool      `yaml:"DisableDST,omitempty"` // true: local time ignores daylight saving transitions, false: local time follows the time zone
+
+	SamplesPerCycle int `yaml:"SamplesPerCycle,omitempty"` // Number of samples per cycle if the sampling rate tracks the emulated frequency, 0 for a fixed sampling rate
+
+	Device DeviceInfo `yaml:"Device,omitempty"` // Identity of the emulated device, attached to exported outputs as tags
+
+	TimeAnomaly anomaly.Container `yaml:"TimeAnomaly,omitempty"` // Sample timestamp anomalies, e.g. clock drift, in seconds
+
+	CorrelatedAnomalies map[string]*anomaly.Correlation `yaml:"CorrelatedAnomalies,omitempty"` // Anomalies shared between containers, see AddCorrelatedAnomaly
+
+	Outages []OutageWindow `yaml:"Outages,omitempty"` // Scheduled periods during which emulations produce no valid data, see AddOutage
+
+	SoftStart float64           `yaml:"SoftStart,omitempty"` // Time in seconds over which voltage and current outputs ramp up from zero at the start of the run, emulating device power-on, 0 for none
+	Shutdown  *ShutdownSequence `yaml:"Shutdown,omitempty"`  // Power-down of the device, scheduled or triggered by StartEvent(PowerDown), optional
+
+	Events []ScheduledEvent `yaml:"Events,omitempty"` // Emulated events which start at scheduled times, see ScheduleEvent
 
 	V *ThreePhaseEmulation `yaml:"VoltageEmulator,omitempty"` // Voltage Emulator
 	I *ThreePhaseEmulation `yaml:"CurrentEmulator,omitempty"` // Current Emulator
 
 	T *TemperatureEmulation `yaml:"TemperatureEmulator,omitempty"` // Temperature Emulation
 
+	Thresholds      []*ThresholdDetector `yaml:"Thresholds,omitempty"` // Alarms raised when output channels cross thresholds, see AddThresholdDetector
+	ThresholdEvents []ThresholdEvent     `yaml:"-"`                    // Threshold alarms raised or cleared in the present time step
+
+	EventLog      *EventLog `yaml:"-"` // Records when anomalies start and stop, optional
+	StartedEvents []int     `yaml:"-"` // Types of the emulated events which started in the present time step, see StartEvent
+
 	// common state
-	SmpCnt                     int `yaml:"-"`
-	fDeviationRemainingSamples int `yaml:"-"`
+	SmpCnt                     int                                      `yaml:"-"`
+	SampleIndex                uint64                                   `yaml:"-"` // Number of samples emulated since the start of the emulation
+	TimeError                  float64                                  `yaml:"-"` // Time error of the present sample caused by TimeAnomaly, in seconds
+	EffectiveTs                float64                                  `yaml:"-"` // Sampling period of the present sample in seconds, equal to Ts unless SamplesPerCycle is set
+	fDeviationRemainingSamples int                                      `yaml:"-"`
+	frequencyEventType         int                                      `yaml:"-"` // Type of the frequency event in progress, if fDeviationRemainingSamples > 0
+	faultEventType             int                                      `yaml:"-"` // Type of the event in progress in the voltage and current emulations, e.g. a fault, if either has stages remaining
+	customEvents               []*customEvent                           `yaml:"-"` // Custom events in progress, see RegisterEventType
+	subscriptions              map[string]<-chan anomaly.ControlMessage `yaml:"-"` // Channels of control messages keyed by the name of the container to which they apply, see Subscribe
+	pendingEvents              []int                                    `yaml:"-"` // Types of the emulated events started since the latest time step
+	pendingDurations           []int                                    `yaml:"-"` // Durations in samples of pendingEvents
+	startedDurations           []int                                    `yaml:"-"` // Durations in samples of StartedEvents
+	elapsedTime                float64                                  `yaml:"-"` // Nominal time of the present sample since the start of the emulation, in seconds
+
+	seed             uint64         `yaml:"-"` // random seed from which the seed of each module's random number generator is derived
+	rTime            *rand.Rand     `yaml:"-"` // random number generator of TimeAnomaly
+	rV               *rand.Rand     `yaml:"-"` // random number generator of the voltage emulation
+	rI               *rand.Rand     `yaml:"-"` // random number generator of the current emulation
+	rT               *rand.Rand     `yaml:"-"` // random number generator of the temperature emulation
+	location         *time.Location `yaml:"-"` // time zone used for local time, loaded from TimeZone
+	standardLocation *time.Location `yaml:"-"` // fixed zone at the standard offset of location, used if DisableDST is set
+
+	clockFollowers []*anomaly.Container `yaml:"-"` // containers with anomalies which depend on the local time of day, found before the first sample
 
-	r *rand.Rand `yaml:"-"`
+	initialConfig    yaml.MapSlice `yaml:"-"` // configuration before the first sample, recorded for Manifest
+	initialConfigErr error         `yaml:"-"` // error recording initialConfig, returned by Manifest
+
+	onAnomalyStart []AnomalyCallback `yaml:"-"` // called when an anomaly becomes active, see OnAnomalyStart
+	onAnomalyEnd   []AnomalyCallback `yaml:"-"` // called when an anomaly becomes inactive, see OnAnomalyEnd
+	callbackLog    *EventLog         `yaml:"-"` // tracks when anomalies start and stop for callbacks
 }
 
-// StartEvent initiates an emulated event
-func (e *Emulator) StartEvent(eventType int) {
-	// fmt.Println("StartEvent()", eventType)
+// StartEvent initiates an emulated event with the given parameters, returning an error if they are invalid.
+// Faults add to the current of the faulted phases and subtract from their voltage: phase A for SinglePhaseFault,
+// phases B and C for PhaseToPhaseFault and DoublePhaseToGroundFault, and all phases for ThreePhaseFault, unless
+// other phases are given. An EvolvingFault develops through each of its stages, see StartEvolvingFault. Custom
+// events, see RegisterEventType, replace any custom event of the same type in progress.
+func (e *Emulator) StartEvent(params EventParams) error {
+	if err := params.validate(); err != nil {
+		return err
+	}
+	magnitude := params.Magnitude
+	if magnitude == 0 {
+		magnitude = eventDefaultMagnitude(params.Type)
+	}
+	voltageMagnitude := params.VoltageMagnitude
+	if voltageMagnitude == 0 {
+		voltageMagnitude = -emulatedFaultVoltageFactor
+	}
+	durationSamples := params.DurationSamples
+	if durationSamples == 0 {
+		durationSamples = eventDurationSamples(params.Type)
+	}
+	phases, _ := faultPhases(params.Type, params.Phases)
 
-	switch eventType {
-	case SinglePhaseFault:
-		// TODO
-		// e.I.FaultPosSeqMag = EmulatedFaultCurrentMagnitude
-		// e.I.FaultRemainingSamples = MaxEmulatedFaultDurationSamples
-		e.I.faultPhaseAMag = e.I.PosSeqMag * 1.2 // EmulatedFaultCurrentMagnitude
-		e.I.faultRemainingSamples = MaxEmulatedFaultDurationSamples
-		e.V.faultPhaseAMag = e.V.PosSeqMag * -0.2
-		e.V.faultRemainingSamples = MaxEmulatedFaultDurationSamples
-	case ThreePhaseFault:
-		e.I.faultPosSeqMag = e.I.PosSeqMag * 1.2 // EmulatedFaultCurrentMagnitude
-		e.I.faultRemainingSamples = MaxEmulatedFaultDurationSamples
-		e.V.faultPosSeqMag = e.V.PosSeqMag * -0.2
-		e.V.faultRemainingSamples = MaxEmulatedFaultDurationSamples
+	switch params.Type {
+	case SinglePhaseFault, PhaseToPhaseFault, DoublePhaseToGroundFault, ThreePhaseFault, EvolvingFault, OverVoltage, UnderVoltage, CapacitorOverCurrent:
+		e.faultEventType = params.Type
+	case OverFrequency, UnderFrequency:
+		e.frequencyEventType = params.Type
+	}
+
+	if params.Type == EvolvingFault {
+		stageSamples := params.StageSamples
+		if stageSamples == [3]int{} {
+			stage := durationSamples / 3
+			stageSamples = [3]int{stage, stage, durationSamples - 2*stage}
+		}
+		durationSamples = stageSamples[0] + stageSamples[1] + stageSamples[2]
+		if e.I != nil {
+			e.I.startFault(evolvingFaultStages(e.I.PosSeqMag*magnitude, stageSamples, phases))
+		}
+		if e.V != nil {
+			e.V.startFault(evolvingFaultStages(-e.V.PosSeqMag*voltageMagnitude, stageSamples, phases))
+		}
+	}
+	e.pendingEvents = append(e.pendingEvents, params.Type)
+	e.pendingDurations = append(e.pendingDurations, durationSamples)
+
+	switch params.Type {
+	case SinglePhaseFault, PhaseToPhaseFault, DoublePhaseToGroundFault, ThreePhaseFault:
+		if e.I != nil {
+			e.I.startFault(faultCurrentStages(params.Type, e.I.PosSeqMag*magnitude, durationSamples, phases))
+		}
+		if e.V != nil {
+			e.V.startFault(faultVoltageStages(-e.V.PosSeqMag*voltageMagnitude, durationSamples, phases))
+		}
 	case OverVoltage:
-		e.V.faultPosSeqMag = e.V.PosSeqMag * 0.2
-		e.V.faultRemainingSamples = MaxEmulatedFaultDurationSamples
+		if e.V != nil {
+			e.V.startFault([]faultStage{faultStageOf(e.V.PosSeqMag*magnitude, durationSamples, 0, 1, 2)})
+		}
 	case UnderVoltage:
-		e.V.faultPosSeqMag = e.V.PosSeqMag * -0.2
-		e.V.faultRemainingSamples = MaxEmulatedFaultDurationSamples
+		if e.V != nil {
+			e.V.startFault([]faultStage{faultStageOf(-e.V.PosSeqMag*magnitude, durationSamples, 0, 1, 2)})
+		}
 	case OverFrequency:
-		e.Fdeviation = 0.1
-		e.fDeviationRemainingSamples = MaxEmulatedFrequencyDurationSamples
+		e.Fdeviation = magnitude
+		e.fDeviationRemainingSamples = durationSamples
 	case UnderFrequency:
-		e.Fdeviation = -0.1
-		e.fDeviationRemainingSamples = MaxEmulatedFrequencyDurationSamples
+		e.Fdeviation = -magnitude
+		e.fDeviationRemainingSamples = durationSamples
 	case CapacitorOverCurrent:
 		// TODO
-		e.I.faultPosSeqMag = e.I.PosSeqMag * 0.01
-		e.I.faultRemainingSamples = MaxEmulatedCapacitorOverCurrentSamples
+		if e.I != nil {
+			e.I.startFault([]faultStage{faultStageOf(e.I.PosSeqMag*magnitude, durationSamples, 0, 1, 2)})
+		}
+	case PowerDown:
+		e.triggerShutdown()
 	default:
+		if custom, ok := lookupCustomEventType(params.Type); ok {
+			params.DurationSamples = durationSamples
+			e.customEvents = slices.DeleteFunc(e.customEvents, func(event *customEvent) bool { return event.params.Type == params.Type })
+			e.customEvents = append(e.customEvents, &customEvent{params: params, step: custom.step})
+		}
 	}
+	return nil
+}
+
+// StartEventType initiates an emulated event of the given type with its default parameters.
+//
+// Deprecated: use StartEvent(EventParams{Type: eventType}), which can also set the parameters of the event.
+func (e *Emulator) StartEventType(eventType int) {
+	e.StartEvent(EventParams{Type: eventType})
+}
+
+// StartEvolvingFault initiates an emulated fault which evolves from a single-phase fault on phase A, to a
+// double-phase-to-ground fault on phases A and B, to a three-phase fault, with the given durations of each
+// stage in samples.
+func (e *Emulator) StartEvolvingFault(stageSamples [3]int) {
+	e.StartEvent(EventParams{Type: EvolvingFault, StageSamples: stageSamples})
 }
 
 // Returns a new Emulator instance with a given sampling rate and frequency.
 // The emulator's random seed is initialized with a random value.
 func NewEmulator(samplingRate int, frequency float64) *Emulator {
 	emu := &Emulator{
+		Version:      CurrentConfigVersion,
 		SamplingRate: samplingRate,
 		Fnom:         frequency,
 		Fdeviation:   0.0,
 		Ts:           1 / float64(samplingRate),
 	}
 
-	emu.r = rand.New(rand.NewPCG(rand.Uint64(), rand.Uint64()))
+	emu.SetRandomSeed(rand.Uint64())
 
 	return emu
 }
 
+// Unmarshals an emulator from yaml, loading the time zone and initialising the random number
+// generators with a random seed if it has not been set already.
+func (e *Emulator) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	type emulatorFields Emulator // prevents recursive calls to UnmarshalYAML
+	if err := unmarshalMigrated(unmarshal, (*emulatorFields)(e)); err != nil {
+		return err
+	}
+	e.Version = latestConfigVersion()
+
+	if e.SamplingRate > 0 && e.Ts == 0 {
+		e.Ts = 1 / float64(e.SamplingRate)
+	}
+	if e.rT == nil {
+		e.SetRandomSeed(rand.Uint64())
+	}
+	if e.TimeZone != "" {
+		if err := e.SetTimeZone(e.TimeZone); err != nil {
+			return err
+		}
+	}
+
+	// Add targets of correlated anomalies to their containers
+	correlations := e.CorrelatedAnomalies
+	e.CorrelatedAnomalies = nil
+	for name, correlation := range correlations {
+		if err := e.AddCorrelatedAnomaly(name, correlation); err != nil {
+			return err
+		}
+	}
+
+	if err := e.Validate(); err != nil {
+		return err
+	}
+	return e.ResolveSchedules()
+}
+
+// Names of the anomaly container fields of each three-phase emulation.
+var threePhaseContainerNames = []string{
+	"PosSeqMagAnomaly", "PosSeqAngAnomaly", "PhaseAMagAnomaly", "FreqAnomaly", "HarmonicsAnomaly", "WiringAnomaly",
+}
+
+// Returns the names of the anomaly containers of the initialised emulations, in a fixed order. See GetContainer.
+func (e *Emulator) ContainerNames() []string {
+	names := []string{"TimeAnomaly"}
+	if e.V != nil {
+		for _, field := range threePhaseContainerNames {
+			names = append(names, "V."+field)
+		}
+	}
+	if e.I != nil {
+		for _, field := range threePhaseContainerNames {
+			names = append(names, "I."+field)
+		}
+	}
+	if e.T != nil {
+		names = append(names, "T.Anomaly")
+	}
+	return names
+}
+
+// Converts the wall-clock schedules of anomalies in all containers into start delays and durations
+// relative to the Epoch. This is called automatically before the first sample, but may be called
+// earlier to check for errors, e.g. wall-clock schedules without an Epoch.
+func (e *Emulator) ResolveSchedules() error {
+	var errs []error
+	for _, name := range e.ContainerNames() {
+		container, err := e.GetContainer(name)
+		if err != nil {
+			return err
+		}
+		if err := container.ResolveSchedules(e.Epoch); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Returns a pointer to the anomaly container with the given name, which is the name of the container
+// field prefixed by the emulation, e.g. "V.PosSeqMagAnomaly", "I.FreqAnomaly", "T.Anomaly" or "TimeAnomaly".
+func (e *Emulator) GetContainer(name string) (*anomaly.Container, error) {
+	if name == "TimeAnomaly" {
+		return &e.TimeAnomaly, nil
+	}
+
+	emulation, field, _ := strings.Cut(name, ".")
+	switch emulation {
+	case "V", "I":
+		threePhase := e.V
+		if emulation == "I" {
+			threePhase = e.I
+		}
+		if threePhase == nil {
+			return nil, fmt.Errorf("emulation not defined for anomaly container: %s", name)
+		}
+		switch field {
+		case "PosSeqMagAnomaly":
+			return &threePhase.PosSeqMagAnomaly, nil
+		case "PosSeqAngAnomaly":
+			return &threePhase.PosSeqAngAnomaly, nil
+		case "PhaseAMagAnomaly":
+			return &threePhase.PhaseAMagAnomaly, nil
+		case "FreqAnomaly":
+			return &threePhase.FreqAnomaly, nil
+		case "HarmonicsAnomaly":
+			return &threePhase.HarmonicsAnomaly, nil
+		case "WiringAnomaly":
+			return &threePhase.WiringAnomaly, nil
+		}
+	case "T":
+		if e.T == nil {
+			return nil, fmt.Errorf("emulation not defined for anomaly container: %s", name)
+		}
+		if field == "Anomaly" {
+			return &e.T.Anomaly, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown anomaly container: %s", name)
+}
+
+// Adds a correlated anomaly to the emulator. A target of the correlation is added with the given name
+// to each container listed in its Targets (see GetContainer for container names), with the listed scale factor.
+func (e *Emulator) AddCorrelatedAnomaly(name string, correlation *anomaly.Correlation) error {
+	for containerName, scale := range correlation.Targets {
+		container, err := e.GetContainer(containerName)
+		if err != nil {
+			return err
+		}
+		if *container == nil {
+			*container = make(anomaly.Container)
+		}
+		(*container)[name] = correlation.NewTarget(scale)
+	}
+
+	if e.CorrelatedAnomalies == nil {
+		e.CorrelatedAnomalies = make(map[string]*anomaly.Correlation)
+	}
+	e.CorrelatedAnomalies[name] = correlation
+	return nil
+}
+
+// Names of the modules which have independent random number generators, in the order their seeds are derived.
+var randomModules = []string{"TimeAnomaly", "V", "I", "T"}
+
 // Sets the random seed for the emulator. This can be used to
 // generate identical random events across multiple runs.
+// Each module is given its own random number generator, with a seed derived from seed, so that
+// the random values of one module do not depend on which other modules are initialised.
 func (e *Emulator) SetRandomSeed(seed uint64) {
-	e.r = rand.New(rand.NewPCG(seed, seed))
+	e.seed = seed
+	seeds := e.GetModuleSeeds()
+	e.rTime = rand.New(rand.NewPCG(seeds["TimeAnomaly"], seeds["TimeAnomaly"]))
+	e.rV = rand.New(rand.NewPCG(seeds["V"], seeds["V"]))
+	e.rI = rand.New(rand.NewPCG(seeds["I"], seeds["I"]))
+	e.rT = rand.New(rand.NewPCG(seeds["T"], seeds["T"]))
+}
+
+// Returns the random seed of the emulator, which was either set by SetRandomSeed or chosen randomly.
+func (e *Emulator) GetRandomSeed() uint64 {
+	return e.seed
+}
+
+// Returns the seed of each module's random number generator, derived from the random seed of the
+// emulator, keyed by module name: "TimeAnomaly", "V", "I" and "T".
+func (e *Emulator) GetModuleSeeds() map[string]uint64 {
+	r := rand.New(rand.NewPCG(e.seed, e.seed))
+	seeds := make(map[string]uint64, len(randomModules))
+	for _, module := range randomModules {
+		seeds[module] = r.Uint64()
+	}
+	return seeds
+}
+
+// Returns the nominal time of the present sample since the start of the emulation, in seconds.
+func (e *Emulator) GetElapsedTime() float64 {
+	return e.elapsedTime
+}
+
+// Returns the frequency tracked by frequency-locked sampling: the frequency of the voltage emulation in the
+// latest time step, including frequency anomalies, or else the nominal frequency plus any deviation.
+func (e *Emulator) trackedFrequency() float64 {
+	if e.V != nil && e.V.frequency > 0 {
+		return e.V.frequency
+	}
+	return e.Fnom + e.Fdeviation
+}
+
+// Returns the timestamp of the present sample, which is the Epoch plus the nominal elapsed time,
+// perturbed by the TimeError caused by any TimeAnomaly.
+func (e *Emulator) Timestamp() time.Time {
+	return e.Epoch.Add(time.Duration((e.elapsedTime + e.TimeError) * float64(time.Second)))
 }
 
 // Step performs one iteration of the waveform generation for the given time step, Ts
 func (e *Emulator) Step() {
+	if e.SampleIndex == 0 {
+		// the configuration is recorded before it is changed by the emulation, e.g. by frequency events
+		e.initialConfig, e.initialConfigErr = e.config()
+		e.ResolveSchedules() // errors switch off anomalies which cannot be scheduled, and are reported by UnmarshalYAML
+		e.findClockFollowers()
+	}
+
+	if e.SamplesPerCycle > 0 {
+		// the sampling period of each sample follows the frequency emulated in the previous time step
+		if e.SampleIndex == 0 {
+			e.elapsedTime = 0
+		} else {
+			e.elapsedTime += e.EffectiveTs
+		}
+		e.EffectiveTs = 1 / (e.trackedFrequency() * float64(e.SamplesPerCycle))
+	} else {
+		e.elapsedTime = float64(e.SampleIndex) / float64(e.SamplingRate)
+		e.EffectiveTs = e.Ts
+	}
+	Ts := e.EffectiveTs
+	e.stepClockFollowers()
+
+	e.applyControl()
+	e.startScheduledEvents()
+	e.StartedEvents = append(e.StartedEvents[:0], e.pendingEvents...)
+	e.pendingEvents = e.pendingEvents[:0]
+	e.startedDurations = append(e.startedDurations[:0], e.pendingDurations...)
+	e.pendingDurations = e.pendingDurations[:0]
+	e.TimeError = e.TimeAnomaly.StepAll(e.rTime, Ts)
+	e.stepCustomEvents()
+
 	f := e.Fnom + e.Fdeviation
 
 	if e.fDeviationRemainingSamples > 0 {
@@ -118,16 +506,44 @@ func (e *Emulator) Step() {
 		}
 	}
 
+	power := e.powerState()
 	if e.V != nil {
-		e.V.stepThreePhase(e.r, f, e.Ts)
+		if outage := e.getActiveOutage("V"); outage != nil {
+			e.V.stepOutage(f, Ts, outage.Flatline)
+		} else if power.off {
+			e.V.stepOutage(f, Ts, false)
+		} else {
+			e.V.stepThreePhase(e.rV, f, Ts, power)
+		}
 	}
 	if e.I != nil {
-		e.I.stepThreePhase(e.r, f, e.Ts)
+		if outage := e.getActiveOutage("I"); outage != nil {
+			e.I.stepOutage(f, Ts, outage.Flatline)
+		} else if power.off {
+			e.I.stepOutage(f, Ts, false)
+		} else {
+			e.I.stepThreePhase(e.rI, f, Ts, power)
+		}
 	}
 	if e.T != nil {
-		e.T.stepTemperature(e.r, e.Ts)
+		if outage := e.getActiveOutage("T"); outage != nil {
+			e.T.stepOutage(outage.Flatline)
+		} else if power.off {
+			e.T.stepOutage(false)
+		} else {
+			e.T.stepTemperature(e.rT, Ts)
+		}
+	}
+
+	e.stepThresholds()
+	if e.EventLog != nil {
+		e.EventLog.record(e, e.SampleIndex)
+	}
+	if e.callbackLog != nil {
+		e.runAnomalyCallbacks()
 	}
 
+	e.SampleIndex++
 	e.SmpCnt++
 	if int(e.SmpCnt) >= e.SamplingRate {
 		e.SmpCnt = 0
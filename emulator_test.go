@@ -3,9 +3,11 @@ package emulator
 import (
 	"math"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/synaptecltd/emulator/anomaly"
+	"gopkg.in/yaml.v2"
 )
 
 var anomalyKey = "test"
@@ -229,3 +231,536 @@ func TestCurrentPosSeqAnomalies_RisingTrend(t *testing.T) {
 	targetMag := emulator.I.PosSeqMag + trendParams.Magnitude
 	assert.InDelta(t, targetMag, maxMag, 50)
 }
+
+// Assert that a harmonic anomaly injects a harmonic of the requested order and magnitude
+// into current emulation, independently of the configured harmonics
+func TestCurrentHarmonicsAnomalies_Injection(t *testing.T) {
+	harmonicParams := anomaly.HarmonicParams{
+		Order:     5,
+		Magnitude: 0.1,
+	}
+	harmonicAnomaly, err := anomaly.NewHarmonicAnomaly(harmonicParams)
+	assert.NoError(t, err)
+
+	emulator := NewEmulator(4000, 50.0)
+	emulator.I = &ThreePhaseEmulation{
+		PosSeqMag: 500.0,
+		HarmonicsAnomaly: anomaly.Container{
+			anomalyKey: harmonicAnomaly,
+		},
+	}
+
+	reference := NewEmulator(4000, 50.0)
+	reference.I = &ThreePhaseEmulation{
+		PosSeqMag: 500.0,
+	}
+
+	maxDiff := 0.0
+	for step := 0; step < emulator.SamplingRate; step++ {
+		emulator.Step()
+		reference.Step()
+		maxDiff = math.Max(maxDiff, math.Abs(emulator.I.A-reference.I.A))
+	}
+
+	assert.InDelta(t, harmonicParams.Magnitude*emulator.I.PosSeqMag, maxDiff, 1.0)
+}
+
+// Assert that timestamps advance from the epoch by the sampling period, perturbed by clock drift anomalies
+func TestTimestamp_ClockDrift(t *testing.T) {
+	epoch := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	emulator := NewEmulator(1000, 50.0)
+	emulator.Epoch = epoch
+	emulator.T = &TemperatureEmulation{MeanTemperature: 20.0}
+
+	emulator.Step()
+	assert.Equal(t, epoch, emulator.Timestamp())
+
+	driftPPM := 1000.0
+	clockDrift, err := anomaly.NewClockDriftAnomaly(anomaly.ClockDriftParams{DriftPPM: driftPPM})
+	assert.NoError(t, err)
+	emulator.TimeAnomaly = anomaly.Container{anomalyKey: clockDrift}
+
+	for i := 0; i < emulator.SamplingRate; i++ {
+		emulator.Step()
+	}
+	assert.Equal(t, uint64(emulator.SamplingRate+1), emulator.SampleIndex)
+
+	elapsed := float64(emulator.SamplingRate) * emulator.Ts
+	assert.InDelta(t, elapsed, emulator.GetElapsedTime(), 1e-9)
+	expected := epoch.Add(time.Duration(elapsed * float64(time.Second)))
+	assert.WithinDuration(t, expected, emulator.Timestamp(), time.Duration(elapsed*driftPPM*1e-6*float64(time.Second)))
+	assert.True(t, emulator.Timestamp().After(expected))
+}
+
+// Assert that invalid data anomalies replace outputs with NaN, or flag them while retaining their values
+func TestInvalidAnomalies_Quality(t *testing.T) {
+	emulator := NewEmulator(100, 50.0)
+
+	missing, err := anomaly.NewInvalidAnomaly(anomaly.InvalidParams{Duration: 0.1, Repeats: 1})
+	assert.NoError(t, err)
+	flagged, err := anomaly.NewInvalidAnomaly(anomaly.InvalidParams{KeepValue: true})
+	assert.NoError(t, err)
+
+	emulator.I = &ThreePhaseEmulation{
+		PosSeqMag:        500.0,
+		PhaseAMagAnomaly: anomaly.Container{anomalyKey: missing},
+	}
+	emulator.T = &TemperatureEmulation{
+		MeanTemperature: 30.0,
+		Anomaly:         anomaly.Container{anomalyKey: flagged},
+	}
+
+	for i := 0; i < 10; i++ {
+		emulator.Step()
+		assert.Equal(t, anomaly.QualityMissing, emulator.I.Quality)
+		assert.True(t, math.IsNaN(emulator.I.A) && math.IsNaN(emulator.I.B) && math.IsNaN(emulator.I.C))
+		assert.Equal(t, anomaly.QualityInvalid, emulator.T.Quality)
+		assert.Equal(t, 30.0, emulator.T.T)
+	}
+
+	emulator.Step()
+	assert.Equal(t, anomaly.QualityGood, emulator.I.Quality)
+	assert.False(t, math.IsNaN(emulator.I.A))
+}
+
+// Assert that a correlated anomaly defined in yaml perturbs several channels together
+func TestCorrelatedAnomalies_UnmarshalYAML(t *testing.T) {
+	yamlStr := `
+SamplingRate: 10
+Fnom: 50
+VoltageEmulator:
+  PosSeqMag: 1000
+TemperatureEmulator:
+  MeanTemperature: 20
+CorrelatedAnomalies:
+  heatwave:
+    Type: trend
+    Magnitude: 1
+    Duration: 10
+    Targets:
+      T.Anomaly: 5
+      V.PosSeqMagAnomaly: -100
+`
+	var emulator Emulator
+	err := yaml.Unmarshal([]byte(yamlStr), &emulator)
+	assert.NoError(t, err)
+	assert.Contains(t, emulator.T.Anomaly, "heatwave")
+	assert.Contains(t, emulator.V.PosSeqMagAnomaly, "heatwave")
+
+	for i := 0; i < 20; i++ {
+		emulator.Step()
+		delta := 0.1 * float64(i) / 10 // linear ramp of magnitude 1 over 10 s
+		assert.InDelta(t, 20+5*delta, emulator.T.T, 1e-9)
+	}
+	source := emulator.CorrelatedAnomalies["heatwave"].GetSource()
+	assert.Equal(t, 20, source.GetElapsedActivatedIndex())
+
+	// unknown containers are rejected
+	_, err = emulator.GetContainer("T.NotAContainer")
+	assert.Error(t, err)
+	_, err = emulator.GetContainer("I.FreqAnomaly")
+	assert.Error(t, err)
+}
+
+// Assert that a phase swap anomaly swaps the outputs of phases B and C
+func TestWiringAnomalies_PhaseSwap(t *testing.T) {
+	phaseSwap, err := anomaly.NewPhaseSwapAnomaly(anomaly.PhaseSwapParams{Order: "ACB"})
+	assert.NoError(t, err)
+
+	emulator := NewEmulator(4000, 50.0)
+	emulator.I = &ThreePhaseEmulation{
+		PosSeqMag:     500.0,
+		WiringAnomaly: anomaly.Container{anomalyKey: phaseSwap},
+	}
+
+	reference := NewEmulator(4000, 50.0)
+	reference.I = &ThreePhaseEmulation{
+		PosSeqMag: 500.0,
+	}
+
+	for step := 0; step < 100; step++ {
+		emulator.Step()
+		reference.Step()
+		assert.Equal(t, reference.I.A, emulator.I.A)
+		assert.Equal(t, reference.I.C, emulator.I.B)
+		assert.Equal(t, reference.I.B, emulator.I.C)
+	}
+}
+
+// Assert that an undersample anomaly repeats temperature values at a lower effective sampling rate
+func TestTemperatureEmulationAnomalies_Undersample(t *testing.T) {
+	factor := 4
+	undersample, err := anomaly.NewUndersampleAnomaly(anomaly.UndersampleParams{Factor: factor})
+	assert.NoError(t, err)
+
+	emulator := NewEmulator(100, 50.0)
+	emulator.T = &TemperatureEmulation{
+		MeanTemperature: 30.0,
+		NoiseMag:        0.01,
+		Anomaly:         anomaly.Container{anomalyKey: undersample},
+	}
+
+	var updated float64
+	for i := 0; i < 100; i++ {
+		emulator.Step()
+		if i%factor == 0 {
+			assert.NotEqual(t, updated, emulator.T.T)
+			updated = emulator.T.T
+		} else {
+			assert.Equal(t, updated, emulator.T.T)
+		}
+	}
+}
+
+// Assert that an emulator with anomalies, correlations and aging is unmarshalled identically after marshalling to yaml
+func TestEmulator_MarshalYAML(t *testing.T) {
+	yamlStr := `
+SamplingRate: 10
+Fnom: 50
+TemperatureEmulator:
+  MeanTemperature: 20
+  NoiseMag: 0.1
+  Anomaly:
+    spikes:
+      Type: spike
+      Probability: 0.1
+      Magnitude: 3
+  Aging:
+    Lifetime: 5
+    Drift: 0.1
+    Curve: sine
+CorrelatedAnomalies:
+  heatwave:
+    Type: trend
+    Magnitude: 1
+    Duration: 10
+    Targets:
+      T.Anomaly: 5
+`
+	var original Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &original))
+	emulatorYAML, err := yaml.Marshal(&original)
+	assert.NoError(t, err)
+
+	var loaded Emulator
+	assert.NoError(t, yaml.Unmarshal(emulatorYAML, &loaded))
+	assert.Equal(t, original.T.Aging.GetParams(), loaded.T.Aging.GetParams())
+	assert.Contains(t, loaded.T.Anomaly, "heatwave")
+
+	original.SetRandomSeed(1)
+	loaded.SetRandomSeed(1)
+	for i := 0; i < 100; i++ {
+		original.Step()
+		loaded.Step()
+		assert.Equal(t, original.T.T, loaded.T.T)
+	}
+}
+
+// Assert that stochastic anomaly functions are reproducible with the random seed of the emulator
+func TestEmulator_SeededMathsFunctions(t *testing.T) {
+	yamlStr := `
+SamplingRate: 10
+Fnom: 50
+TemperatureEmulator:
+  MeanTemperature: 20
+  Anomaly:
+    noise:
+      Type: trend
+      Magnitude: 1
+      Duration: 5
+      MagFunc: gaussian_noise
+    walk:
+      Type: trend
+      Magnitude: 1
+      Duration: 5
+      MagFunc: random_walk
+`
+	var first, second Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &first))
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &second))
+	first.SetRandomSeed(1)
+	second.SetRandomSeed(1)
+	for i := 0; i < 100; i++ {
+		first.Step()
+		second.Step()
+		assert.Equal(t, first.T.T, second.T.T)
+	}
+}
+
+// Assert that magnitudes specified as a percentage of the nominal value are resolved for each channel
+func TestAnomalies_MagnitudePercent(t *testing.T) {
+	params := anomaly.TrendParams{MagnitudePercent: 10, Duration: 1}
+	tTrend, err := anomaly.NewTrendAnomaly(params)
+	assert.NoError(t, err)
+	vTrend, err := anomaly.NewTrendAnomaly(params)
+	assert.NoError(t, err)
+	spikes, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{MagnitudePercent: -5, Probability: 1})
+	assert.NoError(t, err)
+
+	emu := NewEmulator(10, 50.0)
+	emu.T = &TemperatureEmulation{MeanTemperature: 20, Anomaly: anomaly.Container{"trend": tTrend}}
+	emu.V = &ThreePhaseEmulation{
+		PosSeqMag:        1000,
+		PosSeqMagAnomaly: anomaly.Container{"trend": vTrend},
+		PhaseAMagAnomaly: anomaly.Container{"spikes": spikes},
+	}
+	emu.Step()
+
+	assert.Equal(t, 2.0, tTrend.Magnitude)
+	assert.Equal(t, 100.0, vTrend.Magnitude)
+	assert.Equal(t, -50.0, spikes.Magnitude)
+
+	// magnitudes are resolved once, at construction, not as the nominal value changes
+	emu.T.MeanTemperature = 40
+	emu.Step()
+	assert.Equal(t, 2.0, tTrend.Magnitude)
+}
+
+// Assert that the total anomaly delta of a channel changes no faster than its maximum slew rate
+func TestTemperatureEmulationAnomalies_MaxSlewRate(t *testing.T) {
+	step, err := anomaly.NewSpikeAnomaly(anomaly.SpikeParams{Magnitude: 5, Probability: 1, SpikeSign: 1})
+	assert.NoError(t, err)
+
+	emu := NewEmulator(10, 50.0)
+	emu.T = &TemperatureEmulation{MeanTemperature: 20, MaxAnomalySlewRate: 2, Anomaly: anomaly.Container{"step": step}}
+	for i := 1; i <= 40; i++ {
+		emu.Step()
+		assert.InDelta(t, 20+math.Min(0.2*float64(i), 5), emu.T.T, 1e-9)
+	}
+}
+
+// Assert that anomalies scheduled at wall-clock times are active between their start and end times
+func TestAnomalies_WallClockSchedule(t *testing.T) {
+	yamlStr := `
+SamplingRate: 10
+Fnom: 50
+Epoch: 2024-03-01T12:00:00Z
+TemperatureEmulator:
+  MeanTemperature: 20
+  Anomaly:
+    incident:
+      Type: spike
+      Probability: 1
+      Magnitude: 5
+      Sign: 1
+      StartTime: 2024-03-01T12:00:02Z
+      EndTime: 2024-03-01T12:00:03Z
+    relative:
+      Type: spike
+      Probability: 1
+      Magnitude: 1
+      Sign: 1
+      StartDelay: 4
+      Duration: 1
+      Repeats: 1
+`
+	var emu Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &emu))
+
+	incident, _ := anomaly.AsSpikeAnomaly(emu.T.Anomaly["incident"])
+	assert.InDelta(t, 2.0, incident.GetStartDelay(), 1e-9)
+	assert.InDelta(t, 1.0, incident.GetDuration(), 1e-9)
+	assert.Equal(t, uint64(1), incident.Repeats)
+
+	var incidentTimes, relativeTimes []float64
+	for i := 0; i < 60; i++ {
+		emu.Step()
+		switch emu.T.T {
+		case 25:
+			incidentTimes = append(incidentTimes, emu.GetElapsedTime())
+		case 21:
+			relativeTimes = append(relativeTimes, emu.GetElapsedTime())
+		}
+	}
+
+	// the wall-clock anomaly is scheduled in the same way as the equivalent relative anomaly
+	assert.NotEmpty(t, incidentTimes)
+	assert.Len(t, incidentTimes, len(relativeTimes))
+	assert.InDelta(t, relativeTimes[0]-2, incidentTimes[0], 1e-9)
+	assert.Equal(t, uint64(1), incident.GetCountRepeats())
+
+	// wall-clock schedules require an epoch
+	emu.Epoch = time.Time{}
+	assert.Error(t, emu.ResolveSchedules())
+}
+
+// Assert that phase jitter perturbs each phase independently without changing the waveform magnitude
+func TestThreePhaseEmulation_PhaseJitter(t *testing.T) {
+	newEmulator := func(jitter float64) *Emulator {
+		emu := NewEmulator(4000, 50.0)
+		emu.SetRandomSeed(1)
+		emu.V = &ThreePhaseEmulation{PosSeqMag: 1000, PhaseJitter: jitter}
+		return emu
+	}
+	reference := newEmulator(0)
+	jittered := newEmulator(0.01)
+
+	var diffA, diffB float64
+	for i := 0; i < 400; i++ {
+		reference.Step()
+		jittered.Step()
+		assert.InDelta(t, reference.V.A, jittered.V.A, 1000*0.06)
+		assert.InDelta(t, reference.V.B, jittered.V.B, 1000*0.06)
+		diffA += math.Abs(reference.V.A - jittered.V.A)
+		diffB += math.Abs(reference.V.B - jittered.V.B)
+		assert.NotEqual(t, jittered.V.A-reference.V.A, jittered.V.B-reference.V.B)
+	}
+	assert.Greater(t, diffA, 0.0)
+	assert.Greater(t, diffB, 0.0)
+}
+
+// Assert that per-phase unbalance offsets the magnitude and angle of only the configured phases
+func TestThreePhaseEmulation_PhaseUnbalance(t *testing.T) {
+	newEmulator := func(v *ThreePhaseEmulation) *Emulator {
+		emu := NewEmulator(4000, 50.0)
+		emu.SetRandomSeed(1)
+		emu.V = v
+		return emu
+	}
+	reference := newEmulator(&ThreePhaseEmulation{PosSeqMag: 1000})
+	shifted := newEmulator(&ThreePhaseEmulation{PosSeqMag: 1000, PhaseOffset: 0.1})
+	unbalanced := newEmulator(&ThreePhaseEmulation{PosSeqMag: 1000, PhaseMagOffsets: []float64{0, 0, 0.02}, PhaseAngOffsets: []float64{0, 0, 0.1}})
+
+	for i := 0; i < 400; i++ {
+		reference.Step()
+		shifted.Step()
+		unbalanced.Step()
+		assert.InDelta(t, reference.V.A, unbalanced.V.A, 1e-9)
+		assert.InDelta(t, reference.V.B, unbalanced.V.B, 1e-9)
+		assert.InDelta(t, shifted.V.C*1.02, unbalanced.V.C, 1e-9)
+	}
+
+	unbalanced.V.PhaseMagOffsets = []float64{0.02}
+	assert.EqualError(t, unbalanced.V.Validate(), "PhaseMagOffsets: 1 phase magnitude offsets given, instead of 3")
+}
+
+// Assert that harmonic magnitudes vary over time by their named functions, without changing their angles
+func TestThreePhaseEmulation_HarmonicMagFuncs(t *testing.T) {
+	yamlStr := `
+PosSeqMag: 1000
+HarmonicNumbers: [5, 7]
+HarmonicMags: [0.1, 0.05]
+HarmonicAngs: [0, 0]
+HarmonicMagFuncs: ["scale(sine, 0.5)", ""]
+HarmonicMagPeriods: [1, 0]
+`
+	var varying ThreePhaseEmulation
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &varying))
+	assert.NoError(t, varying.Validate())
+
+	emu := NewEmulator(4000, 50.0)
+	emu.V = &varying
+	reference := NewEmulator(4000, 50.0)
+	reference.V = &ThreePhaseEmulation{PosSeqMag: 1000, HarmonicNumbers: []float64{5, 7}, HarmonicMags: []float64{0.1, 0.05}, HarmonicAngs: []float64{0, 0}}
+
+	for i := 0; i < 4000; i++ {
+		emu.Step()
+		reference.Step()
+		ts := float64(i) / 4000
+		assert.InDelta(t, 0.1*(1+0.5*math.Sin(2*math.Pi*ts)), varying.harmonicMag(0, ts), 1e-3)
+		assert.Equal(t, 0.05, varying.harmonicMag(1, ts))
+		if i == 1000 {
+			// a quarter of the way through the period, the 5th harmonic is 50% larger
+			assert.NotEqual(t, reference.V.A, emu.V.A)
+		}
+	}
+
+	varying.HarmonicMagFuncs = []string{"not_a_function"}
+	assert.EqualError(t, varying.Validate(), "HarmonicMagFuncs: 1 harmonic magnitude functions given for 2 harmonic numbers\n"+
+		"HarmonicMagFuncs[0]: trend function not found")
+}
+
+// Assert that a fault initiates at its point on wave with a DC offset which decays with the X/R ratio of the system
+func TestThreePhaseEmulation_FaultDCOffset(t *testing.T) {
+	newEmulator := func(xr float64, fault bool) *Emulator {
+		emu := NewEmulator(4000, 50.0)
+		emu.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+		emu.I = &ThreePhaseEmulation{PosSeqMag: 100, FaultXR: xr}
+		if fault {
+			emu.StartEvent(EventParams{Type: ThreePhaseFault})
+		}
+		return emu
+	}
+	reference := newEmulator(0, false)
+	symmetrical := newEmulator(1e-9, true) // the DC offset decays within one time step
+	asymmetrical := newEmulator(10, true)
+
+	inception := -1
+	var dcB []float64
+	for i := 0; i < 400; i++ {
+		reference.Step()
+		symmetrical.Step()
+		asymmetrical.Step()
+		if inception < 0 && asymmetrical.I.faultInitiated {
+			inception = i
+		}
+		if inception < 0 {
+			assert.Equal(t, reference.I.A, asymmetrical.I.A)
+			continue
+		}
+		if i == inception {
+			// the DC offset cancels the step change of the fault current
+			assert.InDelta(t, reference.I.B, asymmetrical.I.B, 1e-9)
+			continue
+		}
+		dcB = append(dcB, asymmetrical.I.B-symmetrical.I.B)
+		assert.InDelta(t, 0, asymmetrical.I.A-symmetrical.I.A, 120*2*math.Pi/80) // phase A initiates close to its zero crossing
+	}
+
+	// the fault initiates at the next zero crossing of phase A
+	assert.InDelta(t, 79, inception, 1)
+	assert.Greater(t, math.Abs(dcB[0]), 50.0)
+	assert.InDelta(t, math.Exp(-math.Pi/5), dcB[80]/dcB[0], 1e-9) // time constant of X/R cycles over 2*pi
+}
+
+// Assert that voltage and current outputs ramp up from zero over the soft-start period
+func TestEmulator_SoftStart(t *testing.T) {
+	newEmulator := func(softStart float64) *Emulator {
+		emu := NewEmulator(4000, 50.0)
+		emu.SetRandomSeed(1)
+		emu.SoftStart = softStart
+		emu.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+		return emu
+	}
+	reference := newEmulator(0)
+	ramped := newEmulator(0.05)
+
+	for i := 0; i < 400; i++ {
+		reference.Step()
+		ramped.Step()
+		gain := min(1, float64(i)/4000/0.05)
+		assert.InDelta(t, reference.V.A*gain, ramped.V.A, 1e-9)
+		assert.InDelta(t, reference.V.B*gain, ramped.V.B, 1e-9)
+	}
+	assert.Equal(t, reference.V.A, ramped.V.A)
+
+	var emu Emulator
+	assert.Error(t, yaml.Unmarshal([]byte("SamplingRate: 4000\nSoftStart: -1\n"), &emu))
+}
+
+// Assert that frequency-locked sampling keeps a constant number of samples per cycle as the frequency changes
+func TestEmulator_SamplesPerCycle(t *testing.T) {
+	emu := NewEmulator(4000, 50.0)
+	emu.SamplesPerCycle = 80
+	emu.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+
+	emu.Step()
+	assert.Equal(t, 1/4000.0, emu.EffectiveTs)
+	emu.StartEvent(EventParams{Type: OverFrequency})
+	for i := 0; i < 10; i++ {
+		emu.Step()
+	}
+	assert.InDelta(t, 1/(50.1*80), emu.EffectiveTs, 1e-12)
+	assert.InDelta(t, 2/4000.0+8/(50.1*80), emu.GetElapsedTime(), 1e-9) // the sampling rate follows the frequency of the previous sample
+
+	// the waveform repeats every 80 samples despite the frequency deviation
+	values := make([]float64, 160)
+	for i := range values {
+		emu.Step()
+		values[i] = emu.V.A
+	}
+	for i := 0; i < 80; i++ {
+		assert.InDelta(t, values[i], values[i+80], 1e-6)
+	}
+}
@@ -0,0 +1,160 @@
+package emulator
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Kinds of anomaly events
+const (
+	AnomalyStarted = "start" // the anomaly became active
+	AnomalyStopped = "stop"  // the anomaly became inactive
+)
+
+// AnomalyEvent records an anomaly of an emulator starting or stopping.
+type AnomalyEvent struct {
+	Container   string  // name of the container holding the anomaly, e.g. "V.PosSeqMagAnomaly", see GetContainer
+	Name        string  // name of the anomaly within its container
+	Type        string  // type of the anomaly, e.g. "spike"
+	Kind        string  // AnomalyStarted or AnomalyStopped
+	SampleIndex uint64  // index of the first sample at which the anomaly was active, or inactive, since the start of the emulation
+	ElapsedTime float64 // nominal time of the sample since the start of the emulation, in seconds
+	Repeat      uint64  // number of times the anomaly had repeated at the time of the event
+}
+
+// eventKey identifies an anomaly within the containers of an emulator.
+type eventKey struct {
+	container string
+	name      string
+}
+
+// EventLog records when each anomaly of an emulator starts and stops, so that the times at which
+// anomalies actually fired can be reconstructed without polling every anomaly each time step. Attach
+// an event log to an emulator by setting its EventLog field. Events are either retained in memory, or
+// streamed to a writer as comma-separated values so that memory use is independent of run length.
+type EventLog struct {
+	w      io.Writer      // writer to which events are streamed, nil if events are retained
+	err    error          // first error returned by w
+	line   []byte         // formatted event, reused between events
+	events []AnomalyEvent // retained events, in the order they occurred
+
+	active map[eventKey]bool // anomalies which were active in the latest time step
+}
+
+// Returns an EventLog which retains all events in memory, see Events.
+func NewEventLog() *EventLog {
+	return &EventLog{active: make(map[eventKey]bool)}
+}
+
+// Returns an EventLog which writes each event to w as it occurs, as a row of comma-separated values, with
+// a header row before the first event. Events are not retained. Errors returned by w are reported by Err.
+func NewEventLogWriter(w io.Writer) *EventLog {
+	log := NewEventLog()
+	log.w = w
+	log.line = append(log.line, "SampleIndex,ElapsedTime,Container,Name,Type,Kind,Repeat\n"...)
+	return log
+}
+
+// Returns the events recorded so far, in the order they occurred, if the log retains events.
+func (l *EventLog) Events() []AnomalyEvent {
+	return l.events
+}
+
+// Returns the first error which occurred writing events, if any.
+func (l *EventLog) Err() error {
+	return l.err
+}
+
+// Records an event for every anomaly of the emulator which started or stopped in the present time step,
+// in order of container and then anomaly name. sampleIndex is the index of the present sample.
+func (l *EventLog) record(e *Emulator, sampleIndex uint64) {
+	for _, containerName := range e.ContainerNames() {
+		container, err := e.GetContainer(containerName)
+		if err != nil {
+			continue
+		}
+		for _, name := range container.Names() {
+			anom := (*container)[name]
+			key := eventKey{container: containerName, name: name}
+			active := anom.GetIsAnomalyActive()
+			if active == l.active[key] {
+				continue
+			}
+			l.active[key] = active
+
+			kind := AnomalyStopped
+			if active {
+				kind = AnomalyStarted
+			}
+			l.add(AnomalyEvent{
+				Container:   containerName,
+				Name:        name,
+				Type:        anom.GetTypeAsString(),
+				Kind:        kind,
+				SampleIndex: sampleIndex,
+				ElapsedTime: e.elapsedTime,
+				Repeat:      anom.GetCountRepeats(),
+			})
+		}
+	}
+}
+
+// Retains the event, or writes it to the writer of the log.
+func (l *EventLog) add(event AnomalyEvent) {
+	if l.w == nil {
+		l.events = append(l.events, event)
+		return
+	}
+	if l.err != nil {
+		return
+	}
+
+	l.line = strconv.AppendUint(l.line, event.SampleIndex, 10)
+	l.line = append(l.line, ',')
+	l.line = strconv.AppendFloat(l.line, event.ElapsedTime, 'g', -1, 64)
+	l.line = fmt.Appendf(l.line, ",%s,", event.Container)
+	l.line = appendCSVField(l.line, event.Name)
+	l.line = fmt.Appendf(l.line, ",%s,%s,", event.Type, event.Kind)
+	l.line = strconv.AppendUint(l.line, event.Repeat, 10)
+	l.line = append(l.line, '\n')
+	_, l.err = l.w.Write(l.line)
+	l.line = l.line[:0]
+}
+
+// AnomalyCallback is called with the name of an anomaly within its container and the index of the sample
+// at which it started or ended.
+type AnomalyCallback func(name string, sampleIdx int)
+
+// Registers a callback which is called synchronously by Step whenever an anomaly burst begins, i.e. the first
+// sample at which an anomaly is active, e.g. to trigger external actions in a test harness.
+func (e *Emulator) OnAnomalyStart(callback AnomalyCallback) {
+	e.onAnomalyStart = append(e.onAnomalyStart, callback)
+	if e.callbackLog == nil {
+		e.callbackLog = NewEventLog()
+	}
+}
+
+// Registers a callback which is called synchronously by Step whenever an anomaly burst ends, i.e. the first
+// sample at which an anomaly is no longer active.
+func (e *Emulator) OnAnomalyEnd(callback AnomalyCallback) {
+	e.onAnomalyEnd = append(e.onAnomalyEnd, callback)
+	if e.callbackLog == nil {
+		e.callbackLog = NewEventLog()
+	}
+}
+
+// Calls the registered callbacks for every anomaly which started or ended in the present time step.
+func (e *Emulator) runAnomalyCallbacks() {
+	e.callbackLog.record(e, e.SampleIndex)
+	for _, event := range e.callbackLog.events {
+		callbacks := e.onAnomalyEnd
+		if event.Kind == AnomalyStarted {
+			callbacks = e.onAnomalyStart
+		}
+		for _, callback := range callbacks {
+			callback(event.Name, int(event.SampleIndex))
+		}
+	}
+	e.callbackLog.events = e.callbackLog.events[:0]
+}
@@ -0,0 +1,106 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/synaptecltd/emulator/anomaly"
+)
+
+// Returns an emulator with a temperature trend which is active once, for about a second.
+func createEventLogEmulator(t *testing.T) *Emulator {
+	trendAnomaly, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1.0, StartDelay: 1, Duration: 1, Repeats: 1})
+	assert.NoError(t, err)
+
+	emulator := NewEmulator(10, 50.0)
+	emulator.T = &TemperatureEmulation{MeanTemperature: 20.0, Anomaly: anomaly.Container{anomalyKey: trendAnomaly}}
+	return emulator
+}
+
+// Assert that the event log records the samples at which an anomaly starts and stops
+func TestEventLog_Events(t *testing.T) {
+	emulator := createEventLogEmulator(t)
+	emulator.EventLog = NewEventLog()
+
+	var activeSamples []uint64
+	for i := 0; i < 40; i++ {
+		emulator.Step()
+		if emulator.T.Anomaly[anomalyKey].GetIsAnomalyActive() {
+			activeSamples = append(activeSamples, emulator.SampleIndex-1)
+		}
+	}
+
+	events := emulator.EventLog.Events()
+	assert.Len(t, events, 2)
+	assert.Equal(t, AnomalyEvent{
+		Container:   "T.Anomaly",
+		Name:        anomalyKey,
+		Type:        "trend",
+		Kind:        AnomalyStarted,
+		SampleIndex: activeSamples[0],
+		ElapsedTime: float64(activeSamples[0]) / 10,
+	}, events[0])
+	assert.Equal(t, AnomalyStopped, events[1].Kind)
+	assert.Equal(t, activeSamples[len(activeSamples)-1]+1, events[1].SampleIndex)
+	assert.Equal(t, uint64(1), events[1].Repeat)
+}
+
+// Assert that the event log can stream events to a writer instead of retaining them
+func TestEventLog_Writer(t *testing.T) {
+	emulator := createEventLogEmulator(t)
+	var buf bytes.Buffer
+	emulator.EventLog = NewEventLogWriter(&buf)
+
+	for i := 0; i < 40; i++ {
+		emulator.Step()
+	}
+
+	assert.NoError(t, emulator.EventLog.Err())
+	assert.Empty(t, emulator.EventLog.Events())
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, "SampleIndex,ElapsedTime,Container,Name,Type,Kind,Repeat", lines[0])
+	assert.True(t, strings.HasSuffix(lines[1], ",T.Anomaly,test,trend,start,0"))
+	assert.True(t, strings.HasSuffix(lines[2], ",T.Anomaly,test,trend,stop,1"))
+
+	// names containing commas, quotes or line breaks are quoted, so that they are read back as a single field
+	emulator = createEventLogEmulator(t)
+	name := "trend, \"slow\"\n1"
+	emulator.T.Anomaly[name] = emulator.T.Anomaly[anomalyKey]
+	delete(emulator.T.Anomaly, anomalyKey)
+	buf.Reset()
+	emulator.EventLog = NewEventLogWriter(&buf)
+	for i := 0; i < 40; i++ {
+		emulator.Step()
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	assert.NoError(t, err)
+	assert.Len(t, records, 3)
+	assert.Equal(t, []string{"T.Anomaly", name, "trend", "start", "0"}, records[1][2:])
+}
+
+// Assert that callbacks are called at the samples at which an anomaly starts and ends
+func TestOnAnomalyStartEnd(t *testing.T) {
+	emulator := createEventLogEmulator(t)
+	var starts, ends []int
+	emulator.OnAnomalyStart(func(name string, sampleIdx int) {
+		assert.Equal(t, anomalyKey, name)
+		assert.True(t, emulator.T.Anomaly[name].GetIsAnomalyActive())
+		starts = append(starts, sampleIdx)
+	})
+	emulator.OnAnomalyEnd(func(name string, sampleIdx int) {
+		ends = append(ends, sampleIdx)
+	})
+
+	emulator.EventLog = NewEventLog()
+	for i := 0; i < 40; i++ {
+		emulator.Step()
+	}
+
+	events := emulator.EventLog.Events()
+	assert.Equal(t, []int{int(events[0].SampleIndex)}, starts)
+	assert.Equal(t, []int{int(events[1].SampleIndex)}, ends)
+}
@@ -0,0 +1,287 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sync"
+)
+
+// CustomEventFunc is the behaviour of a custom event type, see RegisterEventType. It is called once per sample while
+// the event is in progress, before the emulations are stepped, with the parameters of the event, whose
+// DurationSamples are resolved, and the number of samples since the event started, from 0 to DurationSamples-1. It
+// may change any state of the emulator or its emulations, e.g. emu.V.PosSeqMag, and should restore that state at the
+// last sample of the event if required.
+type CustomEventFunc func(emu *Emulator, params EventParams, sample int)
+
+// A custom event type, see RegisterEventType.
+type customEventType struct {
+	defaultDurationSamples int
+	step                   CustomEventFunc
+}
+
+// Custom event types registered by applications, keyed by event type
+var customEventTypes = map[int]customEventType{}
+
+// Guards customEventTypes and eventTypeNames, which are written by RegisterEventType while emulators may be
+// looking up event types
+var eventTypesMutex sync.RWMutex
+
+// Returns the custom event type of the given type, if it is registered.
+func lookupCustomEventType(eventType int) (customEventType, bool) {
+	eventTypesMutex.RLock()
+	defer eventTypesMutex.RUnlock()
+	custom, ok := customEventTypes[eventType]
+	return custom, ok
+}
+
+// A custom event in progress.
+type customEvent struct {
+	params EventParams
+	step   CustomEventFunc
+	sample int // number of samples since the event started
+}
+
+// Registers a custom event type with the given name and default duration in samples, whose behaviour is given by
+// step, and returns the new event type. Custom events are started by StartEvent, StartNamedEvent or scheduled
+// events like the built-in event types, and are reported by name in event digests. Event types should be
+// registered once, before emulators are run, e.g. in an init function, but registration is safe while emulators
+// are running.
+func RegisterEventType(name string, defaultDurationSamples int, step CustomEventFunc) (int, error) {
+	if name == "" {
+		return 0, errors.New("name of event type must not be empty")
+	}
+	if defaultDurationSamples <= 0 {
+		return 0, errors.New("default duration of event type must be greater than 0")
+	}
+	if step == nil {
+		return 0, errors.New("event type must have a step function")
+	}
+
+	eventTypesMutex.Lock()
+	defer eventTypesMutex.Unlock()
+	for _, eventName := range eventTypeNames {
+		if eventName == name {
+			return 0, fmt.Errorf("event type already exists: %s", name)
+		}
+	}
+	eventType := EvolvingFault + 1 + len(customEventTypes)
+	customEventTypes[eventType] = customEventType{defaultDurationSamples: defaultDurationSamples, step: step}
+	eventTypeNames[eventType] = name
+	return eventType, nil
+}
+
+// StartNamedEvent initiates an emulated event of the type with the given name, e.g. a custom event type, with the
+// given parameters, whose Type is ignored. See StartEvent.
+func (e *Emulator) StartNamedEvent(name string, params EventParams) error {
+	eventType, err := EventTypeFromName(name)
+	if err != nil {
+		return err
+	}
+	params.Type = eventType
+	return e.StartEvent(params)
+}
+
+// Steps the custom events in progress, removing those which have ended. The functions of the events may start or
+// stop events, so the events in progress at the start of the time step are stepped from a snapshot: events which
+// are stopped are not stepped, and events which are started are first stepped in the next time step.
+func (e *Emulator) stepCustomEvents() {
+	for _, event := range slices.Clone(e.customEvents) {
+		if !slices.Contains(e.customEvents, event) {
+			continue // stopped by an earlier event in this time step
+		}
+		event.step(e, event.params, event.sample)
+		event.sample++
+		if event.sample >= event.params.DurationSamples {
+			e.customEvents = slices.DeleteFunc(e.customEvents, func(other *customEvent) bool { return other == event })
+		}
+	}
+}
+
+// Parameters of an emulated event, see StartEvent. Parameters which are 0 or empty take the defaults of the event type.
+type EventParams struct {
+	Type             int     // event type, e.g. ThreePhaseFault
+	Magnitude        float64 // fault current or voltage change in pu of PosSeqMag, or frequency deviation in Hz
+	VoltageMagnitude float64 // reduction of the voltage of the faulted phases during a fault in pu of PosSeqMag, defaults to 0.2
+	DurationSamples  int     // duration of the event in samples
+	Phases           string  // faulted phases of a fault, e.g. "B" or "CA"; the phases of an EvolvingFault become faulted in the order given
+	StageSamples     [3]int  // durations of the stages of an EvolvingFault in samples, which override DurationSamples if any are given
+}
+
+// Returns an error if the event parameters have invalid values.
+func (p *EventParams) validate() error {
+	if EventTypeName(p.Type) == "" {
+		return fmt.Errorf("unknown event type: %d", p.Type)
+	}
+	if p.Magnitude < 0 {
+		return errors.New("event magnitude must be greater than or equal to 0")
+	}
+	if p.VoltageMagnitude < 0 {
+		return errors.New("event voltage magnitude must be greater than or equal to 0")
+	}
+	if p.DurationSamples < 0 {
+		return errors.New("event duration must be greater than or equal to 0")
+	}
+	for _, samples := range p.StageSamples {
+		if samples < 0 {
+			return errors.New("event stage durations must be greater than or equal to 0")
+		}
+	}
+	_, err := faultPhases(p.Type, p.Phases)
+	return err
+}
+
+// ScheduledEvent is an emulated event, see StartEvent, which starts at a scheduled time, so that a disturbance
+// scenario can be described in yaml and replayed. The event starts at the first sample at which both the elapsed
+// time has reached Start and the sample index has reached StartSample, so either may be given.
+type ScheduledEvent struct {
+	Type        string  `yaml:"Type"`                  // name of the event type, e.g. "ThreePhaseFault", see EventTypeName
+	Start       float64 `yaml:"Start,omitempty"`       // time of the start of the event since the start of the emulation in seconds
+	StartSample uint64  `yaml:"StartSample,omitempty"` // index of the sample at which the event starts
+	Duration    float64 `yaml:"Duration,omitempty"`    // duration of the event in seconds, defaults to the duration of the event type if 0
+	Magnitude   float64 `yaml:"Magnitude,omitempty"`   // fault current or voltage change in pu of PosSeqMag, or frequency deviation in Hz, defaults to that of the event type if 0
+	Phases      string  `yaml:"Phases,omitempty"`      // faulted phases of a fault, e.g. "CA", defaults to those of the event type if empty
+
+	// internal state
+	started bool // whether the event has started
+}
+
+// Returns the event type with the given name, e.g. ThreePhaseFault for "ThreePhaseFault".
+func EventTypeFromName(name string) (int, error) {
+	eventTypesMutex.RLock()
+	defer eventTypesMutex.RUnlock()
+	for eventType, eventName := range eventTypeNames {
+		if eventName == name {
+			return eventType, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown event type: %s", name)
+}
+
+// Returns the default magnitude of an emulated event type: the fault current or voltage change in pu of PosSeqMag,
+// or the frequency deviation in Hz.
+func eventDefaultMagnitude(eventType int) float64 {
+	switch eventType {
+	case SinglePhaseFault, PhaseToPhaseFault, DoublePhaseToGroundFault, ThreePhaseFault, EvolvingFault:
+		return emulatedFaultCurrentFactor
+	case OverVoltage, UnderVoltage:
+		return 0.2
+	case OverFrequency, UnderFrequency:
+		return 0.1
+	case CapacitorOverCurrent:
+		return 0.01
+	}
+	return 0
+}
+
+// Returns an error if the scheduled event has invalid values.
+func (s *ScheduledEvent) validate() error {
+	eventType, err := EventTypeFromName(s.Type)
+	if err != nil {
+		return err
+	}
+	if s.Start < 0 {
+		return errors.New("event start must be greater than or equal to 0")
+	}
+	if s.Duration < 0 {
+		return errors.New("event duration must be greater than or equal to 0")
+	}
+	params := EventParams{Type: eventType, Magnitude: s.Magnitude, Phases: s.Phases}
+	return params.validate()
+}
+
+// Adds a scheduled event to the emulator, checking for invalid values.
+func (e *Emulator) ScheduleEvent(event ScheduledEvent) error {
+	if err := event.validate(); err != nil {
+		return err
+	}
+	e.Events = append(e.Events, event)
+	return nil
+}
+
+// Starts the scheduled events which are due at the present sample.
+func (e *Emulator) startScheduledEvents() {
+	for i := range e.Events {
+		event := &e.Events[i]
+		if event.started || e.elapsedTime < event.Start || e.SampleIndex < event.StartSample {
+			continue
+		}
+		event.started = true
+		eventType, err := EventTypeFromName(event.Type)
+		if err != nil {
+			continue
+		}
+		e.StartEvent(EventParams{
+			Type:            eventType,
+			Magnitude:       event.Magnitude,
+			DurationSamples: int(math.Round(event.Duration / e.Ts)),
+			Phases:          event.Phases,
+		}) // errors are reported by Validate
+	}
+}
+
+// Returns whether an event of the given type is in progress. Only faults, evolving faults, voltage, frequency,
+// capacitor over-current and custom events are tracked, and events which are waiting for their point on wave are
+// in progress.
+func (e *Emulator) IsEventActive(eventType int) bool {
+	return e.GetEventRemainingSamples(eventType) > 0
+}
+
+// Returns the number of samples remaining of the event of the given type in progress, or 0 if there is none. See
+// IsEventActive.
+func (e *Emulator) GetEventRemainingSamples(eventType int) int {
+	switch eventType {
+	case OverFrequency, UnderFrequency:
+		if e.frequencyEventType == eventType {
+			return e.fDeviationRemainingSamples
+		}
+	case SinglePhaseFault, PhaseToPhaseFault, DoublePhaseToGroundFault, ThreePhaseFault, EvolvingFault, OverVoltage, UnderVoltage, CapacitorOverCurrent:
+		if e.faultEventType != eventType {
+			return 0
+		}
+		remaining := 0
+		for _, emulation := range []*ThreePhaseEmulation{e.V, e.I} {
+			if emulation != nil {
+				remaining = max(remaining, emulation.faultRemainingSamples())
+			}
+		}
+		return remaining
+	}
+	for _, event := range e.customEvents {
+		if event.params.Type == eventType {
+			return event.params.DurationSamples - event.sample
+		}
+	}
+	return 0
+}
+
+// Stops the event of the given type in progress, if there is one, returning whether it was in progress. See
+// IsEventActive for the event types which can be stopped.
+func (e *Emulator) StopEvent(eventType int) bool {
+	if !e.IsEventActive(eventType) {
+		return false
+	}
+	switch eventType {
+	case OverFrequency, UnderFrequency:
+		e.Fdeviation = 0
+		e.fDeviationRemainingSamples = 0
+	case SinglePhaseFault, PhaseToPhaseFault, DoublePhaseToGroundFault, ThreePhaseFault, EvolvingFault, OverVoltage, UnderVoltage, CapacitorOverCurrent:
+		for _, emulation := range []*ThreePhaseEmulation{e.V, e.I} {
+			if emulation != nil {
+				emulation.startFault(nil)
+			}
+		}
+	}
+	e.customEvents = slices.DeleteFunc(e.customEvents, func(event *customEvent) bool { return event.params.Type == eventType })
+	return true
+}
+
+// Stops all events in progress, see StopEvent. Scheduled events which have not started are not affected.
+func (e *Emulator) ClearEvents() {
+	if e.fDeviationRemainingSamples > 0 {
+		e.StopEvent(e.frequencyEventType)
+	}
+	e.StopEvent(e.faultEventType)
+	e.customEvents = nil
+}
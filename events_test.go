@@ -0,0 +1,222 @@
+package emulator
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that events listed in yaml start at their scheduled times with their durations and magnitudes
+func TestEmulator_ScheduledEvents(t *testing.T) {
+	yamlStr := `
+SamplingRate: 4000
+Fnom: 50
+Events:
+  - Type: ThreePhaseFault
+    Start: 0.01
+    Duration: 0.02
+    Magnitude: 2
+  - Type: OverFrequency
+    StartSample: 200
+    Magnitude: 0.5
+VoltageEmulator:
+  PosSeqMag: 1000
+CurrentEmulator:
+  PosSeqMag: 100
+`
+	var emu Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &emu))
+	reference := NewEmulator(4000, 50)
+	reference.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+	reference.I = &ThreePhaseEmulation{PosSeqMag: 100}
+
+	peak := 0.0
+	for i := 0; i < 200; i++ {
+		emu.Step()
+		reference.Step()
+		diff := emu.I.A - reference.I.A
+		if i < 40 || i >= 120 {
+			assert.Zero(t, diff)
+		}
+		peak = max(peak, diff)
+		if i == 40 {
+			assert.Equal(t, []int{ThreePhaseFault}, emu.StartedEvents)
+		}
+	}
+	assert.InDelta(t, 200, peak, 1)
+
+	assert.Zero(t, emu.Fdeviation)
+	emu.Step()
+	assert.Equal(t, []int{OverFrequency}, emu.StartedEvents)
+	assert.Equal(t, 0.5, emu.Fdeviation)
+
+	assert.EqualError(t, emu.ScheduleEvent(ScheduledEvent{Type: "Earthquake"}), "unknown event type: Earthquake")
+	assert.Error(t, yaml.Unmarshal([]byte("SamplingRate: 4000\nEvents:\n  - Type: Earthquake\n"), &Emulator{}))
+}
+
+// Assert that events report their progress, and can be stopped before they end
+func TestEmulator_StopEvent(t *testing.T) {
+	emu := NewEmulator(4000, 50)
+	emu.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+	emu.I = &ThreePhaseEmulation{PosSeqMag: 100}
+	assert.NoError(t, emu.StartEvent(EventParams{Type: ThreePhaseFault, DurationSamples: 100}))
+	assert.NoError(t, emu.StartEvent(EventParams{Type: UnderFrequency, DurationSamples: 200}))
+
+	for i := 0; i < 40; i++ {
+		emu.Step()
+	}
+	assert.True(t, emu.IsEventActive(ThreePhaseFault))
+	assert.False(t, emu.IsEventActive(SinglePhaseFault))
+	assert.Equal(t, 60, emu.GetEventRemainingSamples(ThreePhaseFault))
+	assert.Equal(t, 160, emu.GetEventRemainingSamples(UnderFrequency))
+	assert.Zero(t, emu.GetEventRemainingSamples(OverFrequency))
+
+	assert.True(t, emu.StopEvent(ThreePhaseFault))
+	assert.False(t, emu.StopEvent(ThreePhaseFault))
+	assert.False(t, emu.IsEventActive(ThreePhaseFault))
+	assert.True(t, emu.IsEventActive(UnderFrequency))
+	for i := 0; i < 80; i++ {
+		emu.Step()
+		assert.LessOrEqual(t, math.Abs(emu.I.A), 100.1) // the fault current has stopped
+	}
+
+	emu.ClearEvents()
+	assert.False(t, emu.IsEventActive(UnderFrequency))
+	assert.Zero(t, emu.Fdeviation)
+}
+
+// A custom event type which raises the positive sequence voltage by the magnitude of the event, restoring it at the
+// end of the event
+var voltageStepEventType, voltageStepEventErr = RegisterEventType("VoltageStep", 50, func(emu *Emulator, params EventParams, sample int) {
+	switch sample {
+	case 0:
+		emu.V.PosSeqMag += params.Magnitude
+	case params.DurationSamples - 1:
+		emu.V.PosSeqMag -= params.Magnitude
+	}
+})
+
+// Assert that custom event types can be registered, started by name or by schedule, and stopped
+func TestEmulator_CustomEvent(t *testing.T) {
+	assert.NoError(t, voltageStepEventErr)
+	assert.Equal(t, "VoltageStep", EventTypeName(voltageStepEventType))
+	_, err := RegisterEventType("VoltageStep", 50, func(*Emulator, EventParams, int) {})
+	assert.EqualError(t, err, "event type already exists: VoltageStep")
+	_, err = RegisterEventType("ThreePhaseFault", 50, func(*Emulator, EventParams, int) {})
+	assert.Error(t, err)
+	_, err = RegisterEventType("NoStep", 50, nil)
+	assert.Error(t, err)
+
+	emu := NewEmulator(4000, 50)
+	emu.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+	assert.NoError(t, emu.StartNamedEvent("VoltageStep", EventParams{Magnitude: 200}))
+	assert.EqualError(t, emu.StartNamedEvent("Earthquake", EventParams{}), "unknown event type: Earthquake")
+	for i := 0; i < 60; i++ {
+		emu.Step()
+		if i == 0 {
+			assert.Equal(t, []int{voltageStepEventType}, emu.StartedEvents)
+		}
+		if i < 49 {
+			assert.Equal(t, 1200.0, emu.V.PosSeqMag, "sample %d", i)
+			assert.Equal(t, 49-i, emu.GetEventRemainingSamples(voltageStepEventType))
+		} else {
+			assert.Equal(t, 1000.0, emu.V.PosSeqMag, "sample %d", i)
+			assert.False(t, emu.IsEventActive(voltageStepEventType))
+		}
+	}
+
+	yamlStr := `
+SamplingRate: 4000
+Fnom: 50
+VoltageEmulator:
+  PosSeqMag: 1000
+Events:
+  - Type: VoltageStep
+    StartSample: 10
+    Duration: 0.05
+    Magnitude: 100
+    Phases: A
+`
+	emu = &Emulator{}
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), emu))
+	for i := 0; i < 20; i++ {
+		emu.Step()
+	}
+	assert.Equal(t, 1100.0, emu.V.PosSeqMag)
+	assert.Equal(t, 190, emu.GetEventRemainingSamples(voltageStepEventType))
+	assert.True(t, emu.StopEvent(voltageStepEventType))
+	assert.False(t, emu.IsEventActive(voltageStepEventType))
+}
+
+// Custom event types which start and stop each other, and the number of samples for which each has been stepped
+var (
+	chainFirstSamples, chainSecondSamples int
+	chainFirstEventType, _                = RegisterEventType("ChainFirst", 10, func(emu *Emulator, params EventParams, sample int) {
+		chainFirstSamples++
+		if sample == params.DurationSamples-1 {
+			emu.StartNamedEvent("ChainSecond", EventParams{})
+		}
+	})
+	chainSecondEventType, _ = RegisterEventType("ChainSecond", 5, func(emu *Emulator, params EventParams, sample int) {
+		chainSecondSamples++
+	})
+	chainStopEventType, _ = RegisterEventType("ChainStop", 1, func(emu *Emulator, params EventParams, sample int) {
+		emu.StopEvent(chainFirstEventType)
+	})
+)
+
+// Assert that custom events can start and stop other events from their step functions
+func TestEmulator_CustomEventChain(t *testing.T) {
+	chainFirstSamples, chainSecondSamples = 0, 0
+	emu := NewEmulator(4000, 50)
+	assert.NoError(t, emu.StartEvent(EventParams{Type: chainFirstEventType}))
+	for i := 0; i < 10; i++ {
+		emu.Step()
+	}
+	assert.Equal(t, 10, chainFirstSamples)
+	assert.False(t, emu.IsEventActive(chainFirstEventType))
+	assert.Equal(t, 5, emu.GetEventRemainingSamples(chainSecondEventType)) // started by the last sample of ChainFirst
+	for i := 0; i < 10; i++ {
+		emu.Step()
+		if i == 0 {
+			assert.Equal(t, []int{chainSecondEventType}, emu.StartedEvents)
+		}
+	}
+	assert.Equal(t, 5, chainSecondSamples)
+	assert.False(t, emu.IsEventActive(chainSecondEventType))
+
+	// events after an event which is stopped by an earlier event in the same time step are stepped once
+	chainFirstSamples, chainSecondSamples = 0, 0
+	assert.NoError(t, emu.StartEvent(EventParams{Type: chainStopEventType}))
+	assert.NoError(t, emu.StartEvent(EventParams{Type: chainFirstEventType}))
+	assert.NoError(t, emu.StartEvent(EventParams{Type: chainSecondEventType}))
+	emu.Step()
+	assert.Zero(t, chainFirstSamples)
+	assert.Equal(t, 1, chainSecondSamples)
+	assert.False(t, emu.IsEventActive(chainStopEventType))
+	assert.False(t, emu.IsEventActive(chainFirstEventType))
+	assert.Equal(t, 4, emu.GetEventRemainingSamples(chainSecondEventType))
+}
+
+// Assert that event types can be registered while event types are looked up concurrently
+func TestRegisterEventType_Concurrent(t *testing.T) {
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			RegisterEventType(fmt.Sprintf("Concurrent%d", i), 1, func(*Emulator, EventParams, int) {}) // fails if the test is repeated
+		}()
+		go func() {
+			defer wg.Done()
+			assert.Equal(t, "ThreePhaseFault", EventTypeName(ThreePhaseFault))
+			_, err := EventTypeFromName("SinglePhaseFault")
+			assert.NoError(t, err)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,150 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ManifestFileName is the name of the manifest file written by Experiment.Run
+const ManifestFileName = "manifest.yaml"
+
+// Parameter is a named parameter of an experiment, with the values to be swept.
+type Parameter struct {
+	Name   string    // name of the parameter, passed to Experiment.Configure
+	Values []float64 // values of the parameter to be swept
+}
+
+// Experiment sweeps every combination of a grid of parameters and random seeds, running a newly
+// configured emulator for each combination and writing its outputs to a separate file.
+type Experiment struct {
+	Name       string      // name of the experiment, used as the prefix of output file names, defaults to "run"
+	Parameters []Parameter // parameters to sweep; every combination of values is run
+	Seeds      []uint64    // random seeds to run for every combination of parameters, a random seed is used if empty
+	Samples    int         // number of samples to emulate in each run
+
+	// Returns an emulator configured with the given value of each parameter, keyed by parameter name.
+	// Must return a new emulator for each call.
+	Configure func(values map[string]float64) (*Emulator, error)
+
+	// Returns the writer for the outputs of a run, defaults to NewCSVWriter if nil.
+	NewWriter func(w io.Writer) SampleWriter
+}
+
+// ExperimentRun records the configuration and output file of a single run of an experiment.
+type ExperimentRun struct {
+	File       string             `yaml:"File"`       // name of the output file, relative to the output directory
+	Seed       uint64             `yaml:"Seed"`       // random seed of the emulator
+	Parameters map[string]float64 `yaml:"Parameters"` // value of each parameter, keyed by parameter name
+}
+
+// ExperimentManifest lists all runs of an experiment, and is written alongside their output files.
+type ExperimentManifest struct {
+	Name    string          `yaml:"Name"`    // name of the experiment
+	Version string          `yaml:"Version"` // version of this module which generated the outputs
+	Samples int             `yaml:"Samples"` // number of samples emulated in each run
+	Runs    []ExperimentRun `yaml:"Runs"`    // configuration of each run
+}
+
+// Runs every combination of parameters and seeds, writing the outputs of each run to its own file within
+// dir, which is created if necessary. A manifest of all runs is written to ManifestFileName in dir and returned.
+func (x *Experiment) Run(dir string) (*ExperimentManifest, error) {
+	if x.Configure == nil {
+		return nil, errors.New("experiment must have a Configure function")
+	}
+	if x.Samples <= 0 {
+		return nil, errors.New("experiment samples must be greater than 0")
+	}
+	for _, parameter := range x.Parameters {
+		if len(parameter.Values) == 0 {
+			return nil, fmt.Errorf("experiment parameter has no values: %s", parameter.Name)
+		}
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	name := x.Name
+	if name == "" {
+		name = "run"
+	}
+	seeds := x.Seeds
+	if len(seeds) == 0 {
+		seeds = []uint64{rand.Uint64()}
+	}
+
+	manifest := &ExperimentManifest{Name: name, Version: Version(), Samples: x.Samples}
+	for _, values := range x.combinations() {
+		for _, seed := range seeds {
+			run := ExperimentRun{
+				File:       fmt.Sprintf("%s_%04d.csv", name, len(manifest.Runs)),
+				Seed:       seed,
+				Parameters: values,
+			}
+			if err := x.runOne(filepath.Join(dir, run.File), run); err != nil {
+				return nil, err
+			}
+			manifest.Runs = append(manifest.Runs, run)
+		}
+	}
+
+	manifestYAML, err := yaml.Marshal(manifest)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(filepath.Join(dir, ManifestFileName), manifestYAML, 0o644); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// Configures and runs an emulator for a single run, writing its outputs to the named file.
+func (x *Experiment) runOne(path string, run ExperimentRun) error {
+	emu, err := x.Configure(run.Parameters)
+	if err != nil {
+		return err
+	}
+	emu.SetRandomSeed(run.Seed)
+
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	var w SampleWriter
+	if x.NewWriter != nil {
+		w = x.NewWriter(f)
+	} else {
+		w = NewCSVWriter(f)
+	}
+	if err := emu.Run(x.Samples, w); err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Returns every combination of parameter values, with the last parameter varying fastest.
+func (x *Experiment) combinations() []map[string]float64 {
+	combinations := []map[string]float64{{}}
+	for _, parameter := range x.Parameters {
+		var next []map[string]float64
+		for _, combination := range combinations {
+			for _, value := range parameter.Values {
+				values := make(map[string]float64, len(combination)+1)
+				for k, v := range combination {
+					values[k] = v
+				}
+				values[parameter.Name] = value
+				next = append(next, values)
+			}
+		}
+		combinations = next
+	}
+	return combinations
+}
@@ -0,0 +1,61 @@
+package emulator
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that an experiment runs every combination of parameters and seeds, and records each run in a manifest
+func TestExperiment_Run(t *testing.T) {
+	dir := t.TempDir()
+	x := Experiment{
+		Name:    "noise",
+		Samples: 50,
+		Parameters: []Parameter{
+			{Name: "NoiseMag", Values: []float64{0.1, 1.0}},
+			{Name: "Mean", Values: []float64{20, 30, 40}},
+		},
+		Seeds: []uint64{1, 2},
+		Configure: func(values map[string]float64) (*Emulator, error) {
+			emu := NewEmulator(1000, 50.0)
+			emu.T = &TemperatureEmulation{MeanTemperature: values["Mean"], NoiseMag: values["NoiseMag"]}
+			return emu, nil
+		},
+	}
+
+	manifest, err := x.Run(dir)
+	assert.NoError(t, err)
+	assert.Len(t, manifest.Runs, 12)
+	assert.Equal(t, "noise_0000.csv", manifest.Runs[0].File)
+	assert.Equal(t, map[string]float64{"NoiseMag": 0.1, "Mean": 20}, manifest.Runs[0].Parameters)
+	assert.Equal(t, uint64(2), manifest.Runs[1].Seed)
+	assert.Equal(t, map[string]float64{"NoiseMag": 1.0, "Mean": 40}, manifest.Runs[11].Parameters)
+
+	// the manifest is written alongside the outputs of every run
+	manifestYAML, err := os.ReadFile(filepath.Join(dir, ManifestFileName))
+	assert.NoError(t, err)
+	var written ExperimentManifest
+	assert.NoError(t, yaml.Unmarshal(manifestYAML, &written))
+	assert.Equal(t, *manifest, written)
+
+	// runs with the same parameters and seed are reproducible, and different seeds differ
+	again, err := x.Run(t.TempDir())
+	assert.NoError(t, err)
+	for i, run := range manifest.Runs {
+		assert.Equal(t, run, again.Runs[i])
+	}
+	first, err := os.ReadFile(filepath.Join(dir, manifest.Runs[0].File))
+	assert.NoError(t, err)
+	second, err := os.ReadFile(filepath.Join(dir, manifest.Runs[1].File))
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	// invalid experiments are rejected
+	x.Parameters = append(x.Parameters, Parameter{Name: "Empty"})
+	_, err = x.Run(t.TempDir())
+	assert.Error(t, err)
+}
@@ -0,0 +1,402 @@
+package emulator
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Names of the output channels available to exporters
+const (
+	ChannelVA = "V.A"
+	ChannelVB = "V.B"
+	ChannelVC = "V.C"
+	ChannelIA = "I.A"
+	ChannelIB = "I.B"
+	ChannelIC = "I.C"
+	ChannelT  = "T"
+)
+
+// SampleWriter consumes emulator outputs one time step at a time. Implementations must not
+// accumulate an unbounded history of samples, so that memory use is independent of run length,
+// and should attach the emulator's Tags and Manifest to their outputs.
+type SampleWriter interface {
+	WriteSample(e *Emulator) error // Writes the present outputs of the emulator
+	Flush() error                  // Writes any buffered data to the underlying sink
+}
+
+// ChannelAlias selects an output channel for export, optionally under a different name, e.g. to match
+// the naming conventions of a consuming system.
+type ChannelAlias struct {
+	Channel string `yaml:"Channel"` // name of the output channel, e.g. ChannelIA
+	Name    string `yaml:"Name"`    // name under which the channel is exported, defaults to Channel if empty
+}
+
+// channelSelection maps the output channels of an emulator onto the channels written by an exporter.
+type channelSelection struct {
+	aliases []ChannelAlias // channels to export, in order, or all channels under their own names if empty
+	count   int            // number of output channels of the emulator, set by resolve
+	indices []int          // index of each exported channel within the output channels, set by resolve
+	all     []float64      // values of all output channels for the present time step, reused between steps
+}
+
+// Returns the names of the exported channels, checking that the selected channels are outputs of the emulator.
+func (s *channelSelection) resolve(e *Emulator) ([]string, error) {
+	channels := e.ChannelNames()
+	s.count = len(channels)
+	if len(s.aliases) == 0 {
+		return channels, nil
+	}
+
+	names := make([]string, len(s.aliases))
+	s.indices = make([]int, len(s.aliases))
+	for i, alias := range s.aliases {
+		index := slices.Index(channels, alias.Channel)
+		if index < 0 {
+			return nil, fmt.Errorf("channel not found: %s", alias.Channel)
+		}
+		s.indices[i] = index
+		names[i] = alias.Name
+		if names[i] == "" {
+			names[i] = alias.Channel
+		}
+	}
+	return names, nil
+}
+
+// Appends the present values of the exported channels to dst, and returns the extended slice. Returns an
+// error if the output channels of the emulator have changed since resolve.
+func (s *channelSelection) appendValues(dst []float64, e *Emulator) ([]float64, error) {
+	s.all = e.AppendChannelValues(s.all[:0])
+	if len(s.all) != s.count {
+		return dst, errors.New("emulator channels changed after the first sample was written")
+	}
+	if len(s.aliases) == 0 {
+		return append(dst, s.all...), nil
+	}
+	for _, index := range s.indices {
+		dst = append(dst, s.all[index])
+	}
+	return dst, nil
+}
+
+// Returns the names of the output channels of the initialised emulations, in a fixed order.
+func (e *Emulator) ChannelNames() []string {
+	var names []string
+	if e.V != nil {
+		names = append(names, ChannelVA, ChannelVB, ChannelVC)
+	}
+	if e.I != nil {
+		names = append(names, ChannelIA, ChannelIB, ChannelIC)
+	}
+	if e.T != nil {
+		names = append(names, ChannelT)
+	}
+	return names
+}
+
+// Appends the present output values of the initialised emulations to dst, in the same order as
+// ChannelNames, and returns the extended slice. Pass a reused slice of zero length to avoid allocating.
+func (e *Emulator) AppendChannelValues(dst []float64) []float64 {
+	if e.V != nil {
+		dst = append(dst, e.V.A, e.V.B, e.V.C)
+	}
+	if e.I != nil {
+		dst = append(dst, e.I.A, e.I.B, e.I.C)
+	}
+	if e.T != nil {
+		dst = append(dst, e.T.T)
+	}
+	return dst
+}
+
+// Run steps the emulator the given number of times, passing the outputs of every time step to w.
+// This should be preferred to appending outputs to a slice each step for long runs, as memory use
+// is bounded by the writer rather than growing with the number of samples. A Shutdown sequence with
+// AtEnd set is scheduled so that the final sample of the run has dropped out.
+func (e *Emulator) Run(samples int, w SampleWriter) error {
+	e.scheduleShutdownAtEnd(samples)
+	for i := 0; i < samples; i++ {
+		e.Step()
+		if err := w.WriteSample(e); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// multiWriter passes the outputs of every time step to several writers.
+type multiWriter []SampleWriter
+
+// Returns a SampleWriter which passes the outputs of every time step to each of writers in turn, e.g. to
+// write samples and threshold events to separate streams in a single Run.
+func NewMultiWriter(writers ...SampleWriter) SampleWriter {
+	return multiWriter(writers)
+}
+
+// Writes the present outputs of the emulator to each writer, stopping at the first error.
+func (m multiWriter) WriteSample(e *Emulator) error {
+	for _, w := range m {
+		if err := w.WriteSample(e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flushes each writer, stopping at the first error.
+func (m multiWriter) Flush() error {
+	for _, w := range m {
+		if err := w.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CSVWriter streams emulator outputs to an io.Writer as comma-separated values, with a header
+// row of channel names followed by one row per time step. Nothing is retained between rows.
+// If the emulator has an Epoch, each row begins with the RFC 3339 timestamp of the sample.
+// Tags are written before the header as comment lines of the form "# key=value", with values containing
+// control characters quoted, followed by the manifest of the emulator as yaml under a "# Manifest:"
+// comment line, indented and commented.
+type CSVWriter struct {
+	w             *bufio.Writer
+	headerWritten bool
+	channels      channelSelection // channels written to each row
+	timestamps    bool             // whether rows begin with a timestamp column
+	values        []float64        // channel values for the present time step, reused between steps
+	line          []byte           // formatted row for the present time step, reused between steps
+}
+
+// Returns a CSVWriter which writes to w.
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{w: bufio.NewWriter(w)}
+}
+
+// Selects the channels written to each row, in order, and the names under which they are written. All
+// channels are written under their own names by default. Must be called before the first sample is written.
+func (c *CSVWriter) SetChannels(aliases ...ChannelAlias) {
+	c.channels = channelSelection{aliases: aliases}
+}
+
+// Appends a tag value to a "# key=value" comment line. A value containing control characters, such as a
+// newline which would otherwise end the comment and inject a row, or beginning with a double quote is
+// appended as a quoted Go string literal, see strconv.Quote.
+func appendTagValue(line []byte, value string) []byte {
+	if strings.ContainsFunc(value, unicode.IsControl) || strings.HasPrefix(value, `"`) {
+		return strconv.AppendQuote(line, value)
+	}
+	return append(line, value...)
+}
+
+// Appends a field of a comma-separated row, quoted by the rules of encoding/csv if it contains a comma, double
+// quote or line break, or begins with a space, so that names given in configuration cannot split or inject rows.
+func appendCSVField(line []byte, field string) []byte {
+	needsQuotes := field == `\.` || strings.ContainsAny(field, ",\"\r\n")
+	if r, _ := utf8.DecodeRuneInString(field); field != "" && unicode.IsSpace(r) {
+		needsQuotes = true
+	}
+	if !needsQuotes {
+		return append(line, field...)
+	}
+	line = append(line, '"')
+	line = append(line, strings.ReplaceAll(field, `"`, `""`)...)
+	return append(line, '"')
+}
+
+// Writes the present outputs of the emulator as a row, preceded by the header on the first call.
+func (c *CSVWriter) WriteSample(e *Emulator) error {
+	if !c.headerWritten {
+		names, err := c.channels.resolve(e)
+		if err != nil {
+			return err
+		}
+		c.timestamps = !e.Epoch.IsZero()
+		c.line = c.line[:0]
+		tags := e.Tags()
+		keys := make([]string, 0, len(tags))
+		for key := range tags {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			c.line = append(c.line, "# "...)
+			c.line = append(c.line, key...)
+			c.line = append(c.line, '=')
+			c.line = appendTagValue(c.line, tags[key])
+			c.line = append(c.line, '\n')
+		}
+		manifest, err := e.Manifest()
+		if err != nil {
+			return err
+		}
+		manifestYAML, err := yaml.Marshal(manifest)
+		if err != nil {
+			return err
+		}
+		c.line = append(c.line, "# Manifest:\n"...)
+		for _, line := range bytes.SplitAfter(bytes.TrimSpace(manifestYAML), []byte{'\n'}) {
+			c.line = append(c.line, "#   "...)
+			c.line = append(c.line, line...)
+		}
+		c.line = append(c.line, '\n')
+		if c.timestamps {
+			c.line = append(c.line, "Timestamp,"...)
+		}
+		for i, name := range names {
+			if i > 0 {
+				c.line = append(c.line, ',')
+			}
+			c.line = append(c.line, name...)
+		}
+		c.line = append(c.line, '\n')
+		if _, err := c.w.Write(c.line); err != nil {
+			return err
+		}
+		c.headerWritten = true
+	}
+
+	values, err := c.channels.appendValues(c.values[:0], e)
+	if err != nil {
+		return err
+	}
+	c.values = values
+	c.line = c.line[:0]
+	if c.timestamps {
+		c.line = e.Timestamp().AppendFormat(c.line, time.RFC3339Nano)
+		c.line = append(c.line, ',')
+	}
+	for i, value := range c.values {
+		if i > 0 {
+			c.line = append(c.line, ',')
+		}
+		c.line = strconv.AppendFloat(c.line, value, 'g', -1, 64)
+	}
+	c.line = append(c.line, '\n')
+	_, err = c.w.Write(c.line)
+	return err
+}
+
+// Writes any buffered rows to the underlying writer.
+func (c *CSVWriter) Flush() error {
+	return c.w.Flush()
+}
+
+// RingBuffer retains the most recent samples of each channel in storage of fixed size. Once full,
+// each new sample overwrites the oldest, so memory use is bounded regardless of the length of a run.
+type RingBuffer struct {
+	capacity int               // maximum number of samples retained per channel
+	channels channelSelection  // channels retained by the buffer
+	names    []string          // channel names, set from the first sample written
+	tags     map[string]string // emulator tags, set from the first sample written
+	manifest *Manifest         // emulator manifest, set from the first sample written
+	data     []float64         // retained samples, stored row-wise with one row of len(names) values per time step
+	values   []float64         // channel values for the present time step, reused between steps
+	next     int               // row to be written by the next sample
+	count    int               // number of rows written, up to capacity
+}
+
+// Returns a RingBuffer which retains the latest capacity samples of each channel, if capacity > 0.
+func NewRingBuffer(capacity int) (*RingBuffer, error) {
+	if capacity <= 0 {
+		return nil, errors.New("ring buffer capacity must be greater than 0")
+	}
+	return &RingBuffer{capacity: capacity}, nil
+}
+
+// Selects the channels retained by the buffer, and the names under which they are retained. All channels
+// are retained under their own names by default. Must be called before the first sample is written.
+func (b *RingBuffer) SetChannels(aliases ...ChannelAlias) {
+	b.channels = channelSelection{aliases: aliases}
+}
+
+// Stores the present outputs of the emulator, overwriting the oldest sample if the buffer is full.
+func (b *RingBuffer) WriteSample(e *Emulator) error {
+	if b.names == nil {
+		names, err := b.channels.resolve(e)
+		if err != nil {
+			return err
+		}
+		manifest, err := e.Manifest()
+		if err != nil {
+			return err
+		}
+		b.manifest = manifest
+		b.names = names
+		b.tags = e.Tags()
+		b.data = make([]float64, b.capacity*len(b.names))
+	}
+
+	values, err := b.channels.appendValues(b.values[:0], e)
+	if err != nil {
+		return err
+	}
+	b.values = values
+	row := b.next * len(b.names)
+	copy(b.data[row:row+len(b.names)], b.values)
+
+	b.next = (b.next + 1) % b.capacity
+	b.count = min(b.count+1, b.capacity)
+	return nil
+}
+
+// Does nothing, samples are always held in memory.
+func (b *RingBuffer) Flush() error {
+	return nil
+}
+
+// Returns the number of samples retained per channel.
+func (b *RingBuffer) Len() int {
+	return b.count
+}
+
+// Returns the names of the channels stored by the buffer.
+func (b *RingBuffer) ChannelNames() []string {
+	return b.names
+}
+
+// Returns the tags of the emulator which wrote the samples.
+func (b *RingBuffer) Tags() map[string]string {
+	return b.tags
+}
+
+// Returns the manifest of the emulator which wrote the samples, from which they can be regenerated.
+func (b *RingBuffer) Manifest() *Manifest {
+	return b.manifest
+}
+
+// Appends the retained samples of the named channel to dst, oldest first, and returns the extended slice.
+func (b *RingBuffer) AppendChannel(dst []float64, name string) ([]float64, error) {
+	channel := -1
+	for i, n := range b.names {
+		if n == name {
+			channel = i
+			break
+		}
+	}
+	if channel < 0 {
+		return dst, fmt.Errorf("channel not found: %s", name)
+	}
+
+	oldest := 0
+	if b.count == b.capacity {
+		oldest = b.next
+	}
+	for i := 0; i < b.count; i++ {
+		row := (oldest + i) % b.capacity
+		dst = append(dst, b.data[row*len(b.names)+channel])
+	}
+	return dst, nil
+}
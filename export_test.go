@@ -0,0 +1,206 @@
+package emulator
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that the CSV writer emits a header followed by one row per time step
+func TestCSVWriter(t *testing.T) {
+	emu := createEmulator(4000, 0)
+	emu.T = &TemperatureEmulation{MeanTemperature: 30.0}
+
+	var buf bytes.Buffer
+	err := emu.Run(100, NewCSVWriter(&buf))
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(stripComments(buf.String())), "\n")
+	assert.Len(t, lines, 101)
+	assert.Equal(t, "V.A,V.B,V.C,I.A,I.B,I.C,T", lines[0])
+	assert.Len(t, strings.Split(lines[100], ","), 7)
+}
+
+// Assert that the ring buffer retains only the most recent samples, oldest first
+func TestRingBuffer(t *testing.T) {
+	_, err := NewRingBuffer(0)
+	assert.Error(t, err)
+
+	emu := NewEmulator(10, 50.0)
+	emu.T = &TemperatureEmulation{MeanTemperature: 30.0}
+
+	buffer, err := NewRingBuffer(5)
+	assert.NoError(t, err)
+
+	var expected []float64
+	for i := 0; i < 12; i++ {
+		emu.T.MeanTemperature = float64(i) // noise free, so the output tracks the mean
+		emu.Step()
+		assert.NoError(t, buffer.WriteSample(emu))
+		expected = append(expected, emu.T.T)
+	}
+
+	assert.Equal(t, 5, buffer.Len())
+	assert.Equal(t, []string{ChannelT}, buffer.ChannelNames())
+
+	values, err := buffer.AppendChannel(nil, ChannelT)
+	assert.NoError(t, err)
+	assert.Equal(t, expected[7:], values)
+
+	_, err = buffer.AppendChannel(nil, ChannelIA)
+	assert.Error(t, err)
+
+	// changing the channels part way through a run is an error
+	emu.I = &ThreePhaseEmulation{PosSeqMag: 1.0}
+	emu.Step()
+	assert.Error(t, buffer.WriteSample(emu))
+}
+
+// Assert that the CSV writer begins each row with a timestamp if the emulator has an epoch
+func TestCSVWriter_Timestamps(t *testing.T) {
+	emu := NewEmulator(4, 50.0)
+	emu.Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	emu.T = &TemperatureEmulation{MeanTemperature: 30.0}
+
+	var buf bytes.Buffer
+	err := emu.Run(2, NewCSVWriter(&buf))
+	assert.NoError(t, err)
+
+	expected := "Timestamp,T\n2024-01-01T00:00:00Z,30\n2024-01-01T00:00:00.25Z,30\n"
+	assert.Equal(t, expected, stripComments(buf.String()))
+}
+
+// Assert that exporters write only the selected channels, under their aliases
+func TestExportChannelAliases(t *testing.T) {
+	emu := NewEmulator(4, 50.0)
+	emu.I = &ThreePhaseEmulation{PosSeqMag: 1.0}
+	emu.T = &TemperatureEmulation{MeanTemperature: 30.0}
+
+	var buf bytes.Buffer
+	writer := NewCSVWriter(&buf)
+	writer.SetChannels(ChannelAlias{Channel: ChannelT, Name: "temperature"}, ChannelAlias{Channel: ChannelIA})
+	assert.NoError(t, emu.Run(2, writer))
+	lines := strings.Split(strings.TrimSpace(stripComments(buf.String())), "\n")
+	assert.Equal(t, "temperature,I.A", lines[0])
+	assert.True(t, strings.HasPrefix(lines[1], "30,"))
+
+	buffer, err := NewRingBuffer(2)
+	assert.NoError(t, err)
+	buffer.SetChannels(ChannelAlias{Channel: ChannelT, Name: "temperature"})
+	assert.NoError(t, emu.Run(2, buffer))
+	assert.Equal(t, []string{"temperature"}, buffer.ChannelNames())
+	values, err := buffer.AppendChannel(nil, "temperature")
+	assert.NoError(t, err)
+	assert.Equal(t, []float64{30, 30}, values)
+
+	// selecting a channel which is not an output of the emulator is an error
+	writer = NewCSVWriter(&buf)
+	writer.SetChannels(ChannelAlias{Channel: ChannelVA})
+	assert.Error(t, emu.Run(1, writer))
+}
+
+// Assert that device identity is attached to exported outputs as tags
+func TestExportTags(t *testing.T) {
+	emu := NewEmulator(4, 50.0)
+	emu.Device = DeviceInfo{ID: "pmu-01", Location: "substation A"}
+	emu.T = &TemperatureEmulation{MeanTemperature: 30.0}
+
+	expectedTags := map[string]string{"DeviceID": "pmu-01", "DeviceLocation": "substation A"}
+	assert.Equal(t, expectedTags, emu.Tags())
+
+	var buf bytes.Buffer
+	err := emu.Run(1, NewCSVWriter(&buf))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), "# DeviceID=pmu-01\n# DeviceLocation=substation A\n# Manifest:\n"))
+	assert.Equal(t, "T\n30\n", stripComments(buf.String()))
+
+	buffer, err := NewRingBuffer(1)
+	assert.NoError(t, err)
+	err = emu.Run(1, buffer)
+	assert.NoError(t, err)
+	assert.Equal(t, expectedTags, buffer.Tags())
+
+	// values which would end the comment line are quoted, so that they cannot inject rows
+	emu = NewEmulator(4, 50.0)
+	emu.Device = DeviceInfo{ID: "pmu-01\n1000", Model: `"quoted"`}
+	emu.T = &TemperatureEmulation{MeanTemperature: 30.0}
+	buf.Reset()
+	err = emu.Run(1, NewCSVWriter(&buf))
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(buf.String(), `# DeviceID="pmu-01\n1000"`+"\n"+`# DeviceModel="\"quoted\""`+"\n# Manifest:\n"))
+	assert.Equal(t, "T\n30\n", stripComments(buf.String()))
+}
+
+// Assert that the manifest embedded in exports regenerates the exported samples exactly
+func TestExportManifest(t *testing.T) {
+	emu := NewEmulator(100, 50.0)
+	emu.Epoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	emu.V = &ThreePhaseEmulation{PosSeqMag: 1.0, NoiseMag: 0.1}
+	emu.T = &TemperatureEmulation{MeanTemperature: 30.0, NoiseMag: 0.5}
+	emu.SetRandomSeed(42)
+	for i := 0; i < 10; i++ {
+		emu.Step() // samples before the start of the export
+	}
+
+	var buf bytes.Buffer
+	assert.NoError(t, emu.Run(50, NewCSVWriter(&buf)))
+
+	// the manifest is embedded in the CSV as commented yaml
+	var manifestYAML strings.Builder
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if strings.HasPrefix(line, "#   ") {
+			manifestYAML.WriteString(strings.TrimPrefix(line, "#   ") + "\n")
+		}
+	}
+	var manifest Manifest
+	assert.NoError(t, yaml.Unmarshal([]byte(manifestYAML.String()), &manifest))
+	assert.Equal(t, uint64(42), manifest.Seed)
+	assert.Equal(t, emu.GetModuleSeeds(), manifest.ModuleSeeds)
+	assert.Equal(t, uint64(10), manifest.FirstSample)
+	assert.Equal(t, Version(), manifest.Version)
+
+	regenerated, err := manifest.NewEmulator()
+	assert.NoError(t, err)
+	var regeneratedBuf bytes.Buffer
+	assert.NoError(t, regenerated.Run(50, NewCSVWriter(&regeneratedBuf)))
+	assert.Equal(t, buf.String(), regeneratedBuf.String())
+}
+
+// Assert that the manifest regenerates the outputs of an emulator while a scheduled event is in progress, which
+// changes the frequency deviation of the emulator
+func TestManifest_EventInProgress(t *testing.T) {
+	emu := NewEmulator(4000, 50.0)
+	emu.V = &ThreePhaseEmulation{PosSeqMag: 1.0, NoiseMag: 0.01}
+	emu.SetRandomSeed(7)
+	assert.NoError(t, emu.ScheduleEvent(ScheduledEvent{Type: "OverFrequency", StartSample: 10, Duration: 0.1, Magnitude: 0.5}))
+	for i := 0; i < 20; i++ {
+		emu.Step()
+	}
+	assert.True(t, emu.IsEventActive(OverFrequency))
+	manifest, err := emu.Manifest()
+	assert.NoError(t, err)
+
+	regenerated, err := manifest.NewEmulator()
+	assert.NoError(t, err)
+	// the manifest is taken after the first exported sample, which is the next output of the regenerated emulator
+	for i := 0; i < 200; i++ {
+		regenerated.Step()
+		assert.Equal(t, emu.V.A, regenerated.V.A, "sample %d", emu.SampleIndex)
+		emu.Step()
+	}
+}
+
+// Returns the lines of a CSV export which are not comments.
+func stripComments(csv string) string {
+	var b strings.Builder
+	for _, line := range strings.SplitAfter(csv, "\n") {
+		if !strings.HasPrefix(line, "#") {
+			b.WriteString(line)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,173 @@
+package emulator
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strings"
+
+	"github.com/stevenblair/sigourney/fast"
+)
+
+// EmulatedEvolvingFaultStageSamples is the number of samples of each stage of an emulated evolving fault
+const EmulatedEvolvingFaultStageSamples = 2000
+
+// Factors of the fault current and voltage magnitudes added to the faulted phases, relative to PosSeqMag
+const (
+	emulatedFaultCurrentFactor = 1.2
+	emulatedFaultVoltageFactor = -0.2
+)
+
+// A stage of an emulated event, which adds a component at the fundamental frequency to each phase, e.g. the
+// fault current of the faulted phases.
+type faultStage struct {
+	mags    [3]float64 // magnitudes of the components added to phases A, B and C
+	angs    [3]float64 // angles of the components relative to the angles of phases A, B and C, in radians
+	samples int        // duration of the stage in samples
+}
+
+// Returns a stage which adds mag to each of the given phases: 0, 1 or 2 for A, B or C.
+func faultStageOf(mag float64, samples int, phases ...int) faultStage {
+	stage := faultStage{samples: samples}
+	for _, phase := range phases {
+		stage.mags[phase] = mag
+	}
+	return stage
+}
+
+// Returns the stages of a fault of the given type in a current emulation, adding mag to the faulted phases, or nil
+// if the event type is not a fault. Phase-to-phase fault currents are equal and opposite, in the direction of the
+// voltage between the faulted phases.
+func faultCurrentStages(eventType int, mag float64, samples int, phases []int) []faultStage {
+	switch eventType {
+	case SinglePhaseFault, DoublePhaseToGroundFault, ThreePhaseFault:
+		return []faultStage{faultStageOf(mag, samples, phases...)}
+	case PhaseToPhaseFault:
+		stage := faultStageOf(mag, samples, phases...)
+		leading, lagging := phases[0], phases[1]
+		if (leading+1)%3 != lagging {
+			leading, lagging = lagging, leading
+		}
+		stage.angs[leading] = math.Pi / 6
+		stage.angs[lagging] = -math.Pi / 6
+		return []faultStage{stage}
+	}
+	return nil
+}
+
+// Returns the stages of a fault in a voltage emulation, adding mag to the faulted phases.
+func faultVoltageStages(mag float64, samples int, phases []int) []faultStage {
+	return []faultStage{faultStageOf(mag, samples, phases...)}
+}
+
+// Returns the stages of an evolving fault, adding mag to the faulted phases, which develops from a single-phase
+// fault on the first of the phases, to a double-phase-to-ground fault on the first two, to a three-phase fault,
+// with the given durations of each stage in samples.
+func evolvingFaultStages(mag float64, stageSamples [3]int, phases []int) []faultStage {
+	return []faultStage{
+		faultStageOf(mag, stageSamples[0], phases[:1]...),
+		faultStageOf(mag, stageSamples[1], phases[:2]...),
+		faultStageOf(mag, stageSamples[2], phases...),
+	}
+}
+
+// Returns the faulted phases of a fault of the given type, 0, 1 or 2 for A, B or C, given by letters such as "CA",
+// or else the default phases of the fault type if phases is empty. Returns an error if the number of phases does not
+// suit the fault type, or phases are given for a built-in event type which is not a fault. The phases of custom
+// event types are interpreted by the event type itself.
+func faultPhases(eventType int, phases string) ([]int, error) {
+	var defaults string
+	switch eventType {
+	case SinglePhaseFault:
+		defaults = "A"
+	case PhaseToPhaseFault, DoublePhaseToGroundFault:
+		defaults = "BC"
+	case ThreePhaseFault, EvolvingFault:
+		defaults = "ABC"
+	default:
+		if _, custom := lookupCustomEventType(eventType); phases != "" && !custom {
+			return nil, fmt.Errorf("phases cannot be given for event type %s", EventTypeName(eventType))
+		}
+		return nil, nil
+	}
+	if phases == "" {
+		phases = defaults
+	}
+
+	indices := make([]int, 0, len(phases))
+	for _, phase := range phases {
+		index := strings.IndexRune("ABC", phase)
+		if index < 0 {
+			return nil, fmt.Errorf("unknown phase: %c", phase)
+		}
+		if slices.Contains(indices, index) {
+			return nil, fmt.Errorf("phase %c is given more than once", phase)
+		}
+		indices = append(indices, index)
+	}
+	if len(indices) != len(defaults) {
+		return nil, fmt.Errorf("%s has %d faulted phases, not %d", EventTypeName(eventType), len(defaults), len(indices))
+	}
+	return indices, nil
+}
+
+// Starts the given stages of an event, replacing any event in progress.
+func (e *ThreePhaseEmulation) startFault(stages []faultStage) {
+	e.faultStages = stages
+	e.faultInitiated = false
+	e.faultStageSamples = 0
+	e.faultPrevious = faultStage{}
+	e.faultDCOffsets = [3]float64{}
+}
+
+// Returns the components added to phases A, B and C by the present event, including their DC offsets, given the
+// angle of phase A without jitter and the angles of each phase, and steps the event forward by Ts. Events initiate
+// immediately, or when phase A passes FaultPointOnWave if FaultXR is set. Each stage of an event then adds DC
+// offsets which cancel its step change, so that each phase is continuous, and which decay with the time constant
+// X/(R*2*pi*f) of the system.
+func (e *ThreePhaseEmulation) stepFault(angle float64, phaseA, phaseB, phaseC float64, Ts float64) (float64, float64, float64) {
+	if len(e.faultStages) == 0 {
+		return 0, 0, 0
+	}
+	if !e.faultInitiated {
+		e.faultInitiated = e.FaultXR == 0 || passedPointOnWave(angle, e.FaultPointOnWave, e.frequency, Ts)
+		if !e.faultInitiated {
+			return 0, 0, 0
+		}
+	}
+
+	phases := [3]float64{phaseA, phaseB - TwoPiOverThree, phaseC + TwoPiOverThree}
+	stage := &e.faultStages[0]
+	var components [3]float64
+	for i, phase := range phases {
+		components[i] = fast.Sin(phase+stage.angs[i]) * stage.mags[i]
+		if e.FaultXR > 0 {
+			if e.faultStageSamples == 0 {
+				previous := fast.Sin(phase+e.faultPrevious.angs[i]) * e.faultPrevious.mags[i]
+				e.faultDCOffsets[i] -= components[i] - previous
+			}
+			components[i] += e.faultDCOffsets[i]
+			e.faultDCOffsets[i] *= math.Exp(-Ts * 2 * math.Pi * e.frequency / e.FaultXR)
+		}
+	}
+
+	e.faultStageSamples++
+	if e.faultStageSamples >= stage.samples {
+		e.faultPrevious = *stage
+		e.faultStages = e.faultStages[1:]
+		e.faultStageSamples = 0
+		if len(e.faultStages) == 0 {
+			e.startFault(nil)
+		}
+	}
+	return components[0], components[1], components[2]
+}
+
+// Returns the number of samples remaining of the present event, including those of stages which have not started.
+func (e *ThreePhaseEmulation) faultRemainingSamples() int {
+	remaining := -e.faultStageSamples
+	for _, stage := range e.faultStages {
+		remaining += stage.samples
+	}
+	return max(remaining, 0)
+}
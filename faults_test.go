@@ -0,0 +1,109 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// Steps emulators with and without an event started by start together, calling check with the differences
+// of the currents of each phase caused by the event.
+func stepWithEvent(samples int, start func(emu *Emulator), check func(i int, diff [3]float64)) {
+	newEmulator := func() *Emulator {
+		emu := NewEmulator(4000, 50.0)
+		emu.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+		emu.I = &ThreePhaseEmulation{PosSeqMag: 100}
+		return emu
+	}
+	reference := newEmulator()
+	faulted := newEmulator()
+	start(faulted)
+	for i := 0; i < samples; i++ {
+		reference.Step()
+		faulted.Step()
+		check(i, [3]float64{faulted.I.A - reference.I.A, faulted.I.B - reference.I.B, faulted.I.C - reference.I.C})
+	}
+}
+
+// Assert that each fault type adds fault current only to its faulted phases
+func TestEmulator_FaultTypes(t *testing.T) {
+	tests := []struct {
+		eventType int
+		faulted   [3]bool
+	}{
+		{SinglePhaseFault, [3]bool{true, false, false}},
+		{PhaseToPhaseFault, [3]bool{false, true, true}},
+		{DoublePhaseToGroundFault, [3]bool{false, true, true}},
+		{ThreePhaseFault, [3]bool{true, true, true}},
+	}
+	for _, test := range tests {
+		t.Run(EventTypeName(test.eventType), func(t *testing.T) {
+			var peak [3]float64
+			stepWithEvent(80, func(emu *Emulator) { emu.StartEvent(EventParams{Type: test.eventType}) }, func(i int, diff [3]float64) {
+				for phase := range diff {
+					peak[phase] = max(peak[phase], diff[phase])
+				}
+				if test.eventType == PhaseToPhaseFault {
+					// phase-to-phase fault currents are equal and opposite
+					assert.InDelta(t, -diff[1], diff[2], 1e-9)
+				}
+			})
+			for phase, faulted := range test.faulted {
+				if faulted {
+					assert.InDelta(t, 120, peak[phase], 1)
+				} else {
+					assert.Zero(t, peak[phase])
+				}
+			}
+		})
+	}
+}
+
+// Assert that an evolving fault adds fault current to each phase in turn, for the durations of its stages
+func TestEmulator_EvolvingFault(t *testing.T) {
+	stepWithEvent(100, func(emu *Emulator) { emu.StartEvolvingFault([3]int{10, 20, 30}) }, func(i int, diff [3]float64) {
+		assert.Equal(t, i < 60, diff[0] != 0, "phase A at sample %d", i)
+		assert.Equal(t, i >= 10 && i < 60, diff[1] != 0, "phase B at sample %d", i)
+		assert.Equal(t, i >= 30 && i < 60, diff[2] != 0, "phase C at sample %d", i)
+	})
+	assert.Equal(t, "EvolvingFault", EventTypeName(EvolvingFault))
+}
+
+// Assert that the parameters of an event set its faulted phases, magnitude and duration
+func TestEmulator_StartEventParams(t *testing.T) {
+	var peak [3]float64
+	stepWithEvent(200, func(emu *Emulator) {
+		assert.NoError(t, emu.StartEvent(EventParams{Type: SinglePhaseFault, Phases: "C", Magnitude: 3, DurationSamples: 100}))
+	}, func(i int, diff [3]float64) {
+		assert.Zero(t, diff[0])
+		assert.Zero(t, diff[1])
+		if i >= 100 {
+			assert.Zero(t, diff[2])
+		}
+		peak[2] = max(peak[2], diff[2])
+	})
+	assert.InDelta(t, 300, peak[2], 1)
+
+	stepWithEvent(80, func(emu *Emulator) {
+		assert.NoError(t, emu.StartEvent(EventParams{Type: PhaseToPhaseFault, Phases: "CA"}))
+	}, func(i int, diff [3]float64) {
+		assert.Zero(t, diff[1])
+		assert.InDelta(t, -diff[0], diff[2], 1e-9)
+	})
+
+	stepWithEvent(100, func(emu *Emulator) {
+		emu.StartEventType(EvolvingFault)
+		assert.NoError(t, emu.StartEvent(EventParams{Type: EvolvingFault, Phases: "CBA", StageSamples: [3]int{10, 20, 30}}))
+	}, func(i int, diff [3]float64) {
+		assert.Equal(t, i >= 30 && i < 60, diff[0] != 0, "phase A at sample %d", i)
+		assert.Equal(t, i >= 10 && i < 60, diff[1] != 0, "phase B at sample %d", i)
+		assert.Equal(t, i < 60, diff[2] != 0, "phase C at sample %d", i)
+	})
+
+	emu := NewEmulator(4000, 50)
+	assert.EqualError(t, emu.StartEvent(EventParams{Type: 99}), "unknown event type: 99")
+	assert.EqualError(t, emu.StartEvent(EventParams{Type: SinglePhaseFault, Phases: "AB"}), "SinglePhaseFault has 1 faulted phases, not 2")
+	assert.EqualError(t, emu.StartEvent(EventParams{Type: ThreePhaseFault, Phases: "AAB"}), "phase A is given more than once")
+	assert.EqualError(t, emu.StartEvent(EventParams{Type: OverFrequency, Phases: "A"}), "phases cannot be given for event type OverFrequency")
+	assert.Empty(t, emu.pendingEvents)
+}
@@ -0,0 +1,162 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A point of the flickermeter response to rectangular voltage fluctuations: the relative voltage change which
+// gives a short-term flicker severity Pst of 1 at a number of changes per minute.
+type flickerResponsePoint struct {
+	changesPerMinute float64
+	depth            float64 // relative voltage change in pu
+}
+
+// The rectangular voltage fluctuations which give Pst=1 for a 230 V, 50 Hz lamp, as specified by IEC 61000-4-15
+// for testing flickermeters.
+var flickerResponse = []flickerResponsePoint{
+	{1, 0.02724},
+	{2, 0.02211},
+	{7, 0.01459},
+	{39, 0.00906},
+	{110, 0.00725},
+	{1620, 0.00402},
+}
+
+// Returns the relative voltage change in pu of rectangular voltage fluctuations at changesPerMinute which gives
+// a short-term flicker severity of pst, where Pst is proportional to the voltage change. Only the test points of
+// IEC 61000-4-15 are supported, 1, 2, 7, 39, 110 and 1620 changes per minute, as the response of the flickermeter
+// is not monotonic between them, e.g. it has a minimum near 1056 changes per minute (8.8 Hz), so it cannot be
+// interpolated accurately.
+func FlickerDepth(changesPerMinute float64, pst float64) (float64, error) {
+	i := slices.IndexFunc(flickerResponse, func(p flickerResponsePoint) bool { return p.changesPerMinute == changesPerMinute })
+	if i < 0 {
+		return 0, fmt.Errorf("changes per minute must be a test point of IEC 61000-4-15: %s", flickerTestPoints())
+	}
+	if pst < 0 {
+		return 0, errors.New("Pst must be greater than or equal to 0")
+	}
+	return pst * flickerResponse[i].depth, nil
+}
+
+// Returns the numbers of changes per minute of the test points of IEC 61000-4-15, e.g. "1, 2, 7".
+func flickerTestPoints() string {
+	points := make([]string, len(flickerResponse))
+	for i, p := range flickerResponse {
+		points[i] = strconv.FormatFloat(p.changesPerMinute, 'g', -1, 64)
+	}
+	return strings.Join(points, ", ")
+}
+
+// Flicker modulates the positive sequence magnitude of a three phase emulation by rectangular voltage fluctuations
+// which give a target short-term flicker severity Pst, e.g. to validate flickermeters against the test points of
+// IEC 61000-4-15. The magnitude alternates between 1+depth/2 and 1-depth/2 of PosSeqMag, changing
+// changesPerMinute times per minute, where depth is given by FlickerDepth. As the fluctuations are steady, the
+// long-term flicker severity Plt equals Pst.
+type Flicker struct {
+	changesPerMinute float64 // number of voltage changes per minute, two per period of the fluctuations
+	pst              float64 // target short-term flicker severity
+
+	// internal state
+	depth        float64 // relative voltage change in pu; set internally from changesPerMinute and pst
+	elapsedIndex int     // number of time steps since the start of the emulation
+}
+
+// Parameters used to request flicker. These map onto the fields of Flicker.
+type FlickerParams struct {
+	ChangesPerMinute float64 `yaml:"ChangesPerMinute"` // number of voltage changes per minute, one of the test points 1, 2, 7, 39, 110 or 1620
+	Pst              float64 `yaml:"Pst"`              // target short-term flicker severity, and long-term flicker severity Plt, must be greater than or equal to 0
+}
+
+// Initialise the internal fields of Flicker when it is unmarshalled from yaml.
+func (f *Flicker) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params FlickerParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	flicker, err := NewFlicker(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to f
+	*f = *flicker
+
+	return nil
+}
+
+// Returns the parameters of Flicker when it is marshalled to yaml.
+func (f *Flicker) MarshalYAML() (interface{}, error) {
+	return f.GetParams(), nil
+}
+
+// Returns a Flicker pointer with the requested parameters, checking for invalid values.
+func NewFlicker(params FlickerParams) (*Flicker, error) {
+	depth, err := FlickerDepth(params.ChangesPerMinute, params.Pst)
+	if err != nil {
+		return nil, err
+	}
+	return &Flicker{changesPerMinute: params.ChangesPerMinute, pst: params.Pst, depth: depth}, nil
+}
+
+// Returns the factor by which the magnitude is scaled this time step, and steps the flicker forward by Ts.
+func (f *Flicker) stepFactor(Ts float64) float64 {
+	t := float64(f.elapsedIndex) * Ts
+	f.elapsedIndex += 1
+	if int(t*f.changesPerMinute/60)%2 == 0 {
+		return 1 + f.depth/2
+	}
+	return 1 - f.depth/2
+}
+
+// Setters
+
+// Sets the number of voltage changes per minute if it is a test point of IEC 61000-4-15, keeping the target Pst.
+func (f *Flicker) SetChangesPerMinute(changesPerMinute float64) error {
+	depth, err := FlickerDepth(changesPerMinute, f.pst)
+	if err != nil {
+		return err
+	}
+	f.changesPerMinute = changesPerMinute
+	f.depth = depth
+	return nil
+}
+
+// Sets the target short-term flicker severity if pst >= 0, keeping the number of changes per minute.
+func (f *Flicker) SetPst(pst float64) error {
+	depth, err := FlickerDepth(f.changesPerMinute, pst)
+	if err != nil {
+		return err
+	}
+	f.pst = pst
+	f.depth = depth
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define Flicker, such that NewFlicker returns an identical flicker.
+func (f *Flicker) GetParams() FlickerParams {
+	return FlickerParams{
+		ChangesPerMinute: f.changesPerMinute,
+		Pst:              f.pst,
+	}
+}
+
+func (f *Flicker) GetChangesPerMinute() float64 {
+	return f.changesPerMinute
+}
+
+func (f *Flicker) GetPst() float64 {
+	return f.pst
+}
+
+// Returns the relative voltage change in pu which gives the target Pst.
+func (f *Flicker) GetDepth() float64 {
+	return f.depth
+}
@@ -0,0 +1,64 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that the depth of flicker follows the test points of IEC 61000-4-15, is proportional to Pst, and is only
+// given at the test points
+func TestFlickerDepth(t *testing.T) {
+	depth, err := FlickerDepth(110, 1)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.00725, depth, 1e-12)
+
+	depth, err = FlickerDepth(110, 2)
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.0145, depth, 1e-12)
+
+	// the response between test points, e.g. near its minimum at 1056 changes per minute, is not interpolated
+	_, err = FlickerDepth(1056, 1)
+	assert.EqualError(t, err, "changes per minute must be a test point of IEC 61000-4-15: 1, 2, 7, 39, 110, 1620")
+	_, err = FlickerDepth(60, 1)
+	assert.Error(t, err)
+	_, err = FlickerDepth(0.5, 1)
+	assert.Error(t, err)
+	_, err = FlickerDepth(2000, 1)
+	assert.Error(t, err)
+	_, err = FlickerDepth(110, -1)
+	assert.Error(t, err)
+}
+
+// Assert that flicker alternates the magnitude of a three phase emulation at the requested rate
+func TestFlicker_Envelope(t *testing.T) {
+	yamlStr := `
+PosSeqMag: 1000
+Flicker:
+  ChangesPerMinute: 1620
+  Pst: 1
+`
+	var flickering ThreePhaseEmulation
+	err := yaml.Unmarshal([]byte(yamlStr), &flickering)
+	assert.NoError(t, err)
+	assert.Equal(t, FlickerParams{ChangesPerMinute: 1620, Pst: 1}, flickering.Flicker.GetParams())
+
+	emulator := NewEmulator(4000, 50.0)
+	emulator.V = &flickering
+	emulator.I = &ThreePhaseEmulation{PosSeqMag: 1000}
+
+	// 27 changes per second, so the magnitude changes every 4000/27 samples
+	for i := 0; i < 4000; i++ {
+		emulator.Step()
+		if emulator.I.A > 100 || emulator.I.A < -100 {
+			envelope := 1 + 0.00402/2
+			if (i*27/4000)%2 == 1 {
+				envelope = 1 - 0.00402/2
+			}
+			assert.InDelta(t, envelope, emulator.V.A/emulator.I.A, 1e-9)
+		}
+	}
+
+	assert.Error(t, yaml.Unmarshal([]byte("ChangesPerMinute: 0\nPst: 1\n"), &Flicker{}))
+}
@@ -1,6 +1,6 @@
 module github.com/synaptecltd/emulator
 
-go 1.22
+go 1.23
 
 require (
 	github.com/google/uuid v1.6.0
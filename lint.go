@@ -0,0 +1,95 @@
+package emulator
+
+import (
+	"fmt"
+
+	"github.com/synaptecltd/emulator/anomaly"
+)
+
+// LintSeverity describes how likely a lint finding is to be a mistake.
+type LintSeverity int
+
+// Severities of lint findings
+const (
+	LintInfo    LintSeverity = iota // unusual, but often intended
+	LintWarning                     // likely to be a mistake
+)
+
+// Returns the name of the severity, "info" or "warning".
+func (s LintSeverity) String() string {
+	if s == LintWarning {
+		return "warning"
+	}
+	return "info"
+}
+
+// LintFinding describes a suspicious, but valid, setting in the configuration of an emulator.
+type LintFinding struct {
+	Severity LintSeverity // how likely the setting is to be a mistake
+	Location string       // location of the setting, e.g. "V" or "V.PosSeqMagAnomaly.spike"
+	Message  string       // description of the problem
+}
+
+// Returns the finding formatted as "severity: location: message".
+func (f LintFinding) String() string {
+	return fmt.Sprintf("%s: %s: %s", f.Severity, f.Location, f.Message)
+}
+
+// Lint checks the configuration of the emulator for settings which are valid but commonly mistaken,
+// so that they can be caught before a long generation run. runDuration is the intended length of the run
+// in seconds, or 0 to skip checks against the length of the run. Findings are returned in a fixed order.
+func (e *Emulator) Lint(runDuration float64) []LintFinding {
+	var findings []LintFinding
+	add := func(severity LintSeverity, location string, format string, args ...any) {
+		findings = append(findings, LintFinding{Severity: severity, Location: location, Message: fmt.Sprintf(format, args...)})
+	}
+
+	for _, emulation := range []struct {
+		name string
+		e    *ThreePhaseEmulation
+	}{{"V", e.V}, {"I", e.I}} {
+		if emulation.e == nil {
+			continue
+		}
+		if emulation.e.NoiseMag == 0 {
+			add(LintInfo, emulation.name, "noise magnitude is zero, so outputs are unrealistically clean")
+		}
+		for _, mag := range emulation.e.HarmonicMags {
+			if mag > 1 {
+				add(LintWarning, emulation.name, "harmonic magnitude %g is greater than 1 pu, HarmonicMags are relative to PosSeqMag", mag)
+			}
+		}
+	}
+	if e.T != nil && e.T.NoiseMag == 0 {
+		add(LintInfo, "T", "noise magnitude is zero, so outputs are unrealistically clean")
+	}
+
+	for _, containerName := range e.ContainerNames() {
+		container, err := e.GetContainer(containerName)
+		if err != nil {
+			continue
+		}
+		for _, name := range container.Names() {
+			lintAnomaly((*container)[name], containerName+"."+name, runDuration, add)
+		}
+	}
+	return findings
+}
+
+// Checks the settings of a single anomaly, adding any findings with add.
+func lintAnomaly(anom anomaly.AnomalyInterface, location string, runDuration float64, add func(LintSeverity, string, string, ...any)) {
+	if spike, ok := anomaly.AsSpikeAnomaly(anom); ok && spike.GetProbability() > 0.5 {
+		add(LintWarning, location, "spike probability %g is greater than 0.5, so most samples of each burst are anomalous", spike.GetProbability())
+	}
+	if harmonic, ok := anomaly.AsHarmonicAnomaly(anom); ok && harmonic.Magnitude > 1 {
+		add(LintWarning, location, "harmonic magnitude %g is greater than 1 pu, magnitudes are relative to PosSeqMag", harmonic.Magnitude)
+	}
+	if runDuration <= 0 {
+		return
+	}
+	if anom.GetStartDelay() >= runDuration {
+		add(LintWarning, location, "anomaly starts after %g s, which is not before the end of the run", anom.GetStartDelay())
+	} else if anom.GetDuration() > runDuration {
+		add(LintInfo, location, "anomaly duration %g s is longer than the run, so it never completes", anom.GetDuration())
+	}
+}
@@ -0,0 +1,53 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that suspicious settings are reported with their severity and location
+func TestLint(t *testing.T) {
+	yamlStr := `
+SamplingRate: 4000
+Fnom: 50
+VoltageEmulator:
+  PosSeqMag: 1000
+  HarmonicNumbers: [5]
+  HarmonicMags: [5]
+  HarmonicAngs: [0]
+  PosSeqMagAnomaly:
+    frequent:
+      Type: spike
+      Probability: 0.8
+      Magnitude: 10
+    late:
+      Type: trend
+      StartDelay: 100
+      Duration: 10
+      Magnitude: 10
+    long:
+      Type: trend
+      Duration: 100
+      Magnitude: 10
+TemperatureEmulator:
+  MeanTemperature: 20
+  NoiseMag: 0.01
+`
+	var emu Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &emu))
+
+	findings := emu.Lint(60)
+	assert.Equal(t, []LintFinding{
+		{Severity: LintInfo, Location: "V", Message: "noise magnitude is zero, so outputs are unrealistically clean"},
+		{Severity: LintWarning, Location: "V", Message: "harmonic magnitude 5 is greater than 1 pu, HarmonicMags are relative to PosSeqMag"},
+		{Severity: LintWarning, Location: "V.PosSeqMagAnomaly.frequent", Message: "spike probability 0.8 is greater than 0.5, so most samples of each burst are anomalous"},
+		{Severity: LintWarning, Location: "V.PosSeqMagAnomaly.late", Message: "anomaly starts after 100 s, which is not before the end of the run"},
+		{Severity: LintInfo, Location: "V.PosSeqMagAnomaly.long", Message: "anomaly duration 100 s is longer than the run, so it never completes"},
+	}, findings)
+	assert.Equal(t, "warning: V: harmonic magnitude 5 is greater than 1 pu, HarmonicMags are relative to PosSeqMag", findings[1].String())
+
+	// checks against the length of the run are skipped if it is unknown
+	assert.Len(t, emu.Lint(0), 3)
+}
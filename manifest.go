@@ -0,0 +1,94 @@
+package emulator
+
+import (
+	"runtime/debug"
+
+	"gopkg.in/yaml.v2"
+)
+
+// modulePath is the import path of this module, used to look up its version in the build information.
+const modulePath = "github.com/synaptecltd/emulator"
+
+// Manifest records everything required to regenerate the outputs of an emulator exactly: the resolved
+// configuration, the random seeds and the version of this module. Exporters embed the manifest of the
+// emulator in their outputs.
+type Manifest struct {
+	Version     string            `yaml:"Version"`     // version of this module which generated the outputs
+	Seed        uint64            `yaml:"Seed"`        // random seed of the emulator
+	ModuleSeeds map[string]uint64 `yaml:"ModuleSeeds"` // seed of each module's random number generator, derived from Seed
+	FirstSample uint64            `yaml:"FirstSample"` // index of the first exported sample since the start of the emulation
+	Config      yaml.MapSlice     `yaml:"Config"`      // resolved configuration of the emulator
+}
+
+// Returns the version of this module, or "(devel)" if it is not known, e.g. when built from a local checkout.
+func Version() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "(devel)"
+	}
+	if info.Main.Path == modulePath && info.Main.Version != "" {
+		return info.Main.Version
+	}
+	for _, dep := range info.Deps {
+		if dep.Path == modulePath {
+			if dep.Replace != nil && dep.Replace.Version != "" {
+				return dep.Replace.Version
+			}
+			return dep.Version
+		}
+	}
+	return "(devel)"
+}
+
+// Returns the manifest of the emulator, with a snapshot of its configuration before the first sample, so that
+// changes made by the emulation itself, e.g. the frequency deviation of a frequency event, are not replayed from
+// the start. The first sample is taken to be the present sample, so the manifest should be created after the
+// first call to Step.
+func (e *Emulator) Manifest() (*Manifest, error) {
+	config, err := e.initialConfig, e.initialConfigErr
+	if e.SampleIndex == 0 {
+		config, err = e.config()
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return &Manifest{
+		Version:     Version(),
+		Seed:        e.seed,
+		ModuleSeeds: e.GetModuleSeeds(),
+		FirstSample: max(e.SampleIndex, 1) - 1,
+		Config:      config,
+	}, nil
+}
+
+// Returns a snapshot of the present configuration of the emulator.
+func (e *Emulator) config() (yaml.MapSlice, error) {
+	configYAML, err := yaml.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	var config yaml.MapSlice
+	if err := yaml.Unmarshal(configYAML, &config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// Returns a new emulator with the configuration and random seed recorded in the manifest, stepped up to
+// the sample before the first exported sample, so that its next outputs regenerate the exported samples.
+func (m *Manifest) NewEmulator() (*Emulator, error) {
+	configYAML, err := yaml.Marshal(m.Config)
+	if err != nil {
+		return nil, err
+	}
+	emu := &Emulator{}
+	if err := yaml.Unmarshal(configYAML, emu); err != nil {
+		return nil, err
+	}
+	emu.SetRandomSeed(m.Seed)
+	for emu.SampleIndex < m.FirstSample {
+		emu.Step()
+	}
+	return emu, nil
+}
@@ -0,0 +1,183 @@
+package mathfuncs
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+)
+
+// Returns the function y=f(t,A,T)+g(t,A,T), e.g. a linear ramp plus a sine ripple.
+func Sum(f, g MathsFunction) MathsFunction {
+	return func(t, A, T float64) float64 {
+		return f(t, A, T) + g(t, A, T)
+	}
+}
+
+// Returns the function y=f(t,A,T)*g(t,A,T). Both functions are passed the amplitude A, so the amplitude of
+// one of them is usually normalised, e.g. by Scale(g, 1/A).
+func Product(f, g MathsFunction) MathsFunction {
+	return func(t, A, T float64) float64 {
+		return f(t, A, T) * g(t, A, T)
+	}
+}
+
+// Returns the function y=k*f(t,A,T).
+func Scale(f MathsFunction, k float64) MathsFunction {
+	return func(t, A, T float64) float64 {
+		return k * f(t, A, T)
+	}
+}
+
+// Returns the function y=f(t-dt,A,T), which is delayed by dt seconds.
+func Shift(f MathsFunction, dt float64) MathsFunction {
+	return func(t, A, T float64) float64 {
+		return f(t-dt, A, T)
+	}
+}
+
+// Returns the function y=f(t+(phase/360)*T,A,T), which leads f by phase degrees of its period T, e.g. a phase
+// of 90 turns a sine into a cosine. Unlike Shift, the offset follows T if the period changes.
+func Phase(f MathsFunction, phase float64) MathsFunction {
+	return func(t, A, T float64) float64 {
+		return f(t+phase/360*T, A, T)
+	}
+}
+
+// Returns a combinator of two named functions.
+func combineFunctions(combine func(f, g MathsFunction) MathsFunction, r *rand.Rand) func([]string) (MathsFunction, error) {
+	return func(args []string) (MathsFunction, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("takes 2 functions, not %d arguments", len(args))
+		}
+		f, err := GetTrendFunctionWithRand(args[0], r)
+		if err != nil {
+			return nil, err
+		}
+		g, err := GetTrendFunctionWithRand(args[1], r)
+		if err != nil {
+			return nil, err
+		}
+		return combine(f, g), nil
+	}
+}
+
+// Returns a combinator of a named function and a number.
+func combineNumber(combine func(f MathsFunction, x float64) MathsFunction, r *rand.Rand) func([]string) (MathsFunction, error) {
+	return func(args []string) (MathsFunction, error) {
+		if len(args) != 2 {
+			return nil, fmt.Errorf("takes a function and a number, not %d arguments", len(args))
+		}
+		f, err := GetTrendFunctionWithRand(args[0], r)
+		if err != nil {
+			return nil, err
+		}
+		x, err := strconv.ParseFloat(args[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid number %q", args[1])
+		}
+		return combine(f, x), nil
+	}
+}
+
+// Returns the function defined by a combinator name such as "sum(linear, sine)", and true if the name is of
+// that form. The arguments within the parentheses are those of the corresponding Go function, with functions
+// referenced by name and stochastic functions drawing from r:
+//
+//   - sum, product, scale, shift and phase: Sum, Product, Scale, Shift and Phase
+//   - piecewise and spline: PiecewiseLinear and CubicSpline, with breakpoints of the form time:value
+//   - fourier: FourierSeries, with coefficients of the form order:magnitude:phase
+//   - pulse, trapezoid, sine_burst, damped_sine, chirp and chirp_exp: Pulse, Trapezoid, SineBurst, DampedSine,
+//     Chirp and ExponentialChirp
+//   - ou, poisson and random_walk: NewOrnsteinUhlenbeck, NewPoissonImpulses and NewRandomWalk, each with its
+//     own state
+//   - weibull_noise and lognormal_noise: the shapes of WeibullNoise and LognormalNoise
+//   - ar and arma: the coefficients of NewARMA, with its own state
+func combinedFunction(name string, r *rand.Rand) (MathsFunction, bool, error) {
+	open := strings.IndexByte(name, '(')
+	if open < 0 || !strings.HasSuffix(name, ")") {
+		return nil, false, nil
+	}
+	var combinator func(args []string) (MathsFunction, error)
+	switch strings.TrimSpace(name[:open]) {
+	case "sum":
+		combinator = combineFunctions(Sum, r)
+	case "product":
+		combinator = combineFunctions(Product, r)
+	case "scale":
+		combinator = combineNumber(Scale, r)
+	case "shift":
+		combinator = combineNumber(Shift, r)
+	case "phase":
+		combinator = combineNumber(Phase, r)
+	case "piecewise":
+		combinator = piecewiseFromArguments
+	case "spline":
+		combinator = splineFromArguments
+	case "fourier":
+		combinator = fourierFromArguments
+	case "pulse":
+		combinator = generateFromNumbers(1, func(args []float64) (MathsFunction, error) { return Pulse(args[0]) })
+	case "trapezoid":
+		combinator = generateFromNumbers(3, func(args []float64) (MathsFunction, error) { return Trapezoid(args[0], args[1], args[2]) })
+	case "sine_burst":
+		combinator = generateFromNumbers(1, func(args []float64) (MathsFunction, error) { return SineBurst(args[0]) })
+	case "damped_sine":
+		combinator = generateFromNumbers(1, func(args []float64) (MathsFunction, error) { return DampedSine(args[0]) })
+	case "chirp":
+		combinator = generateFromNumbers(2, func(args []float64) (MathsFunction, error) { return Chirp(args[0], args[1]) })
+	case "chirp_exp":
+		combinator = generateFromNumbers(2, func(args []float64) (MathsFunction, error) { return ExponentialChirp(args[0], args[1]) })
+	case "ou":
+		combinator = generateFromNumbers(2, func(args []float64) (MathsFunction, error) { return NewOrnsteinUhlenbeckWithRand(r, args[0], args[1]) })
+	case "poisson":
+		combinator = generateFromNumbers(1, func(args []float64) (MathsFunction, error) { return NewPoissonImpulsesWithRand(r, args[0]) })
+	case "weibull_noise":
+		combinator = generateFromNumbers(1, func(args []float64) (MathsFunction, error) { return WeibullNoiseWithRand(r, args[0]) })
+	case "lognormal_noise":
+		combinator = generateFromNumbers(1, func(args []float64) (MathsFunction, error) { return LognormalNoiseWithRand(r, args[0]) })
+	case "random_walk":
+		combinator = generateFromNumbers(1, func(args []float64) (MathsFunction, error) { return NewRandomWalk(r, args[0]) })
+	case "ar":
+		combinator = generateFromAnyNumbers(func(args []float64) (MathsFunction, error) { return NewARMAWithRand(r, args, nil) })
+	case "arma":
+		combinator = func(args []string) (MathsFunction, error) { return armaFromArguments(args, r) }
+	default:
+		return nil, false, nil
+	}
+	args, err := splitArguments(name[open+1 : len(name)-1])
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", name, err)
+	}
+	f, err := combinator(args)
+	if err != nil {
+		return nil, true, fmt.Errorf("%s: %w", name, err)
+	}
+	return f, true, nil
+}
+
+// Splits the arguments of a combinator at commas which are not within nested parentheses.
+func splitArguments(s string) ([]string, error) {
+	var args []string
+	depth, start := 0, 0
+	for i, c := range s {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("unbalanced parentheses")
+			}
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(s[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("unbalanced parentheses")
+	}
+	return append(args, strings.TrimSpace(s[start:])), nil
+}
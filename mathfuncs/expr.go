@@ -0,0 +1,362 @@
+package mathfuncs
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Prefix of a function name which defines the function by an expression, e.g. "expr: A*sin(2*pi*t/T) + 0.1*t".
+const ExpressionPrefix = "expr:"
+
+// Constants which may be referenced by name within an expression.
+var expressionConstants = map[string]float64{
+	"pi": math.Pi,
+	"e":  math.E,
+}
+
+// Functions of one argument which may be called within an expression.
+var expressionFunctions1 = map[string]func(float64) float64{
+	"sin":   math.Sin,
+	"cos":   math.Cos,
+	"tan":   math.Tan,
+	"asin":  math.Asin,
+	"acos":  math.Acos,
+	"atan":  math.Atan,
+	"sinh":  math.Sinh,
+	"cosh":  math.Cosh,
+	"tanh":  math.Tanh,
+	"exp":   math.Exp,
+	"log":   math.Log,
+	"log10": math.Log10,
+	"sqrt":  math.Sqrt,
+	"abs":   math.Abs,
+	"floor": math.Floor,
+	"ceil":  math.Ceil,
+	"round": math.Round,
+	"sign": func(x float64) float64 {
+		switch {
+		case x > 0:
+			return 1
+		case x < 0:
+			return -1
+		}
+		return 0
+	},
+}
+
+// Functions of two arguments which may be called within an expression.
+var expressionFunctions2 = map[string]func(float64, float64) float64{
+	"min":   math.Min,
+	"max":   math.Max,
+	"pow":   math.Pow,
+	"mod":   math.Mod,
+	"atan2": math.Atan2,
+	"hypot": math.Hypot,
+}
+
+// Returns a function defined by an arithmetic expression of elapsed time t, amplitude A and period T, e.g.
+// "A*sin(2*pi*t/T) + 0.1*t". The expression is compiled once, so that the returned function does not parse it
+// again when called. Expressions support numbers, the operators + - * / % ^ (power, right associative) and
+// parentheses, the constants pi and e, and the functions sin, cos, tan, asin, acos, atan, sinh, cosh, tanh,
+// exp, log, log10, sqrt, abs, floor, ceil, round, sign, min, max, pow, mod, atan2 and hypot.
+func ParseExpression(expr string) (MathsFunction, error) {
+	p := &exprParser{src: expr}
+	p.next()
+	n, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	if p.tok.kind != tokenEnd {
+		return nil, p.errorf("unexpected %q", p.tok.text)
+	}
+	return n.f, nil
+}
+
+// Kinds of token within an expression.
+const (
+	tokenEnd = iota
+	tokenNumber
+	tokenIdent
+	tokenOperator
+)
+
+// A token within an expression.
+type exprToken struct {
+	kind  int
+	text  string
+	value float64 // value of a number
+	pos   int     // byte offset of the token within the expression
+}
+
+// A compiled node of an expression. Constant nodes are folded when compiled.
+type exprNode struct {
+	f        MathsFunction
+	constant bool
+	value    float64 // value of a constant node
+}
+
+// Returns a node of constant value v.
+func constantNode(v float64) exprNode {
+	return exprNode{f: func(_, _, _ float64) float64 { return v }, constant: true, value: v}
+}
+
+// Returns a node which applies op to the values of the nodes x and y, folded if both are constant.
+func binaryNode(x, y exprNode, op func(float64, float64) float64) exprNode {
+	if x.constant && y.constant {
+		return constantNode(op(x.value, y.value))
+	}
+	fx, fy := x.f, y.f
+	return exprNode{f: func(t, A, T float64) float64 { return op(fx(t, A, T), fy(t, A, T)) }}
+}
+
+// Returns a node which applies op to the value of the node x, folded if it is constant.
+func unaryNode(x exprNode, op func(float64) float64) exprNode {
+	if x.constant {
+		return constantNode(op(x.value))
+	}
+	fx := x.f
+	return exprNode{f: func(t, A, T float64) float64 { return op(fx(t, A, T)) }}
+}
+
+// Recursive descent parser of an expression, which compiles it as it is parsed.
+type exprParser struct {
+	src string
+	pos int // byte offset of the next token
+	tok exprToken
+}
+
+// Returns an error at the position of the current token.
+func (p *exprParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("expression %q at position %d: %s", p.src, p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// Advances to the next token.
+func (p *exprParser) next() {
+	for p.pos < len(p.src) && unicode.IsSpace(rune(p.src[p.pos])) {
+		p.pos++
+	}
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = exprToken{kind: tokenEnd, pos: start}
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case isDigit(c) || c == '.':
+		for p.pos < len(p.src) && (isDigit(p.src[p.pos]) || p.src[p.pos] == '.') {
+			p.pos++
+		}
+		// exponent, e.g. 1e-3, which is not confused with the constant e as a number cannot be followed by an identifier
+		if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.src) && (p.src[end] == '+' || p.src[end] == '-') {
+				end++
+			}
+			if end < len(p.src) && isDigit(p.src[end]) {
+				for end < len(p.src) && isDigit(p.src[end]) {
+					end++
+				}
+				p.pos = end
+			}
+		}
+		text := p.src[start:p.pos]
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			// reported as an invalid token by the caller
+			p.tok = exprToken{kind: tokenOperator, text: text, pos: start}
+			return
+		}
+		p.tok = exprToken{kind: tokenNumber, text: text, value: value, pos: start}
+	case isLetter(c):
+		for p.pos < len(p.src) && (isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = exprToken{kind: tokenIdent, text: p.src[start:p.pos], pos: start}
+	default:
+		p.pos++
+		p.tok = exprToken{kind: tokenOperator, text: string(c), pos: start}
+	}
+}
+
+// Returns true if the current token is the operator op.
+func (p *exprParser) isOperator(op string) bool {
+	return p.tok.kind == tokenOperator && p.tok.text == op
+}
+
+// Parses a sum of terms: term (('+' | '-') term)*
+func (p *exprParser) parseSum() (exprNode, error) {
+	x, err := p.parseProduct()
+	if err != nil {
+		return exprNode{}, err
+	}
+	for p.isOperator("+") || p.isOperator("-") {
+		op := p.tok.text
+		p.next()
+		y, err := p.parseProduct()
+		if err != nil {
+			return exprNode{}, err
+		}
+		if op == "+" {
+			x = binaryNode(x, y, func(a, b float64) float64 { return a + b })
+		} else {
+			x = binaryNode(x, y, func(a, b float64) float64 { return a - b })
+		}
+	}
+	return x, nil
+}
+
+// Parses a product of factors: unary (('*' | '/' | '%') unary)*
+func (p *exprParser) parseProduct() (exprNode, error) {
+	x, err := p.parseUnary()
+	if err != nil {
+		return exprNode{}, err
+	}
+	for p.isOperator("*") || p.isOperator("/") || p.isOperator("%") {
+		op := p.tok.text
+		p.next()
+		y, err := p.parseUnary()
+		if err != nil {
+			return exprNode{}, err
+		}
+		switch op {
+		case "*":
+			x = binaryNode(x, y, func(a, b float64) float64 { return a * b })
+		case "/":
+			x = binaryNode(x, y, func(a, b float64) float64 { return a / b })
+		default:
+			x = binaryNode(x, y, math.Mod)
+		}
+	}
+	return x, nil
+}
+
+// Parses a signed power: ('-' | '+') unary | power. The sign binds more loosely than '^', so that -x^2 is -(x^2).
+func (p *exprParser) parseUnary() (exprNode, error) {
+	if p.isOperator("-") || p.isOperator("+") {
+		negate := p.tok.text == "-"
+		p.next()
+		x, err := p.parseUnary()
+		if err != nil || !negate {
+			return x, err
+		}
+		return unaryNode(x, func(a float64) float64 { return -a }), nil
+	}
+	return p.parsePower()
+}
+
+// Parses a power, which is right associative: primary ('^' unary)?
+func (p *exprParser) parsePower() (exprNode, error) {
+	x, err := p.parsePrimary()
+	if err != nil {
+		return exprNode{}, err
+	}
+	if !p.isOperator("^") {
+		return x, nil
+	}
+	p.next()
+	y, err := p.parseUnary()
+	if err != nil {
+		return exprNode{}, err
+	}
+	return binaryNode(x, y, math.Pow), nil
+}
+
+// Parses a number, variable, constant, function call or parenthesised expression.
+func (p *exprParser) parsePrimary() (exprNode, error) {
+	tok := p.tok
+	switch tok.kind {
+	case tokenNumber:
+		p.next()
+		return constantNode(tok.value), nil
+	case tokenIdent:
+		p.next()
+		if p.isOperator("(") {
+			return p.parseCall(tok)
+		}
+		switch tok.text {
+		case "t":
+			return exprNode{f: func(t, _, _ float64) float64 { return t }}, nil
+		case "A":
+			return exprNode{f: func(_, A, _ float64) float64 { return A }}, nil
+		case "T":
+			return exprNode{f: func(_, _, T float64) float64 { return T }}, nil
+		}
+		if v, ok := expressionConstants[tok.text]; ok {
+			return constantNode(v), nil
+		}
+		p.tok = tok
+		return exprNode{}, p.errorf("unknown variable %q", tok.text)
+	case tokenOperator:
+		if tok.text == "(" {
+			p.next()
+			x, err := p.parseSum()
+			if err != nil {
+				return exprNode{}, err
+			}
+			if !p.isOperator(")") {
+				return exprNode{}, p.errorf("expected )")
+			}
+			p.next()
+			return x, nil
+		}
+		return exprNode{}, p.errorf("unexpected %q", tok.text)
+	}
+	return exprNode{}, p.errorf("unexpected end of expression")
+}
+
+// Parses the arguments of a call of the function named by tok, the current token being the opening parenthesis.
+func (p *exprParser) parseCall(tok exprToken) (exprNode, error) {
+	p.next()
+	var args []exprNode
+	if !p.isOperator(")") {
+		for {
+			x, err := p.parseSum()
+			if err != nil {
+				return exprNode{}, err
+			}
+			args = append(args, x)
+			if !p.isOperator(",") {
+				break
+			}
+			p.next()
+		}
+	}
+	if !p.isOperator(")") {
+		return exprNode{}, p.errorf("expected ) after the arguments of %s", tok.text)
+	}
+	p.next()
+
+	if f, ok := expressionFunctions1[tok.text]; ok {
+		if len(args) != 1 {
+			p.tok = tok
+			return exprNode{}, p.errorf("function %s takes 1 argument, not %d", tok.text, len(args))
+		}
+		return unaryNode(args[0], f), nil
+	}
+	if f, ok := expressionFunctions2[tok.text]; ok {
+		if len(args) != 2 {
+			p.tok = tok
+			return exprNode{}, p.errorf("function %s takes 2 arguments, not %d", tok.text, len(args))
+		}
+		return binaryNode(args[0], args[1], f), nil
+	}
+	p.tok = tok
+	return exprNode{}, p.errorf("unknown function %q", tok.text)
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isLetter(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+// Returns the function defined by a name with ExpressionPrefix, see ParseExpression.
+func expressionFunction(name string) (MathsFunction, error) {
+	return ParseExpression(strings.TrimSpace(strings.TrimPrefix(name, ExpressionPrefix)))
+}
@@ -0,0 +1,64 @@
+package mathfuncs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// A term of a Fourier series, a sinusoid at a multiple of the fundamental frequency.
+type FourierCoefficient struct {
+	Order     float64 // multiple of the fundamental frequency 1/T, e.g. 3 for the third harmonic
+	Magnitude float64 // magnitude of the term as a multiple of the amplitude A
+	Phase     float64 // phase of the term in degrees, relative to a sine
+}
+
+// Returns a periodic function y=A*sum(m*sin(2*pi*n*t/T + phi)), the Fourier series with a term of order n,
+// magnitude m and phase phi (degrees) for each coefficient, where A is the amplitude, T is the fundamental
+// period, and t is elapsed time, so that arbitrary periodic profiles can be specified.
+func FourierSeries(coefficients []FourierCoefficient) (MathsFunction, error) {
+	if len(coefficients) == 0 {
+		return nil, errors.New("Fourier series must have at least one coefficient")
+	}
+	for _, c := range coefficients {
+		if c.Order < 0 {
+			return nil, errors.New("orders of Fourier coefficients must not be negative")
+		}
+	}
+
+	terms := slices.Clone(coefficients)
+	for i := range terms {
+		terms[i].Phase *= math.Pi / 180
+	}
+	return func(t, A, T float64) float64 {
+		var sum float64
+		for _, c := range terms {
+			sum += c.Magnitude * math.Sin(2*math.Pi*c.Order*t/T+c.Phase)
+		}
+		return A * sum
+	}, nil
+}
+
+// Returns a Fourier series from a name such as "fourier(1:1:0, 3:0.2:90)", whose arguments are coefficients of
+// the form order:magnitude:phase.
+func fourierFromArguments(args []string) (MathsFunction, error) {
+	coefficients := make([]FourierCoefficient, len(args))
+	for i, arg := range args {
+		fields := strings.Split(arg, ":")
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("coefficient %q must be of the form order:magnitude:phase", arg)
+		}
+		values := make([]float64, 3)
+		for j, field := range fields {
+			var err error
+			if values[j], err = strconv.ParseFloat(strings.TrimSpace(field), 64); err != nil {
+				return nil, fmt.Errorf("invalid number in coefficient %q", arg)
+			}
+		}
+		coefficients[i] = FourierCoefficient{Order: values[0], Magnitude: values[1], Phase: values[2]}
+	}
+	return FourierSeries(coefficients)
+}
@@ -0,0 +1,151 @@
+package mathfuncs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Returns a pulse train y=A for the first fraction duty of each period T, and y=0 for the rest of the period,
+// where t is elapsed time. The duty cycle must be between 0 and 1, e.g. 0.2 for pulses which are on for 20% of
+// each period. Unlike step, which is off for the first half of each period, pulses start on.
+func Pulse(duty float64) (MathsFunction, error) {
+	if duty < 0 || duty > 1 {
+		return nil, errors.New("duty cycle must be between 0 and 1")
+	}
+	return func(t, A, T float64) float64 {
+		if math.Mod(t, T) < duty*T {
+			return A
+		}
+		return 0
+	}, nil
+}
+
+// Returns a pulse train with a 50% duty cycle, see Pulse.
+func pulseTrain(t, A, T float64) float64 {
+	if math.Mod(t, T) < 0.5*T {
+		return A
+	}
+	return 0
+}
+
+// Returns a trapezoidal pulse which rises linearly from 0 to A over the fraction rise of each period T, holds A
+// for the fraction hold, falls linearly back to 0 over the fraction fall, and is zero for the rest of the
+// period, where t is elapsed time, e.g. a load step or generator setpoint test. The fractions must not be
+// negative and must sum to at most 1.
+func Trapezoid(rise, hold, fall float64) (MathsFunction, error) {
+	if rise < 0 || hold < 0 || fall < 0 {
+		return nil, errors.New("fractions of trapezoid must not be negative")
+	}
+	if rise+hold+fall > 1 {
+		return nil, errors.New("fractions of trapezoid must sum to at most 1")
+	}
+	return func(t, A, T float64) float64 {
+		x := math.Mod(t, T) / T // fraction of the period
+		switch {
+		case x < rise:
+			return A * x / rise
+		case x < rise+hold:
+			return A
+		case x < rise+hold+fall:
+			return A * (rise + hold + fall - x) / fall
+		}
+		return 0
+	}, nil
+}
+
+// Returns a trapezoidal pulse which rises over the first quarter of each period T, holds A for half of the
+// period and falls over the last quarter, see Trapezoid.
+var trapezoid, _ = Trapezoid(0.25, 0.5, 0.25)
+
+// Returns a tone burst y=A*w(x)*sin(2*pi*cycles*x), x=t/T, a sine wave of the given number of cycles per period
+// T multiplied by a Hann window w(x)=(1-cos(2*pi*x))/2 across each period, where t is elapsed time, so that each
+// burst starts and ends at zero without discontinuities.
+func SineBurst(cycles float64) (MathsFunction, error) {
+	if cycles <= 0 {
+		return nil, errors.New("number of cycles of sine burst must be positive")
+	}
+	return func(t, A, T float64) float64 {
+		x := math.Mod(t, T) / T // fraction of the period
+		return A * (1 - math.Cos(2*math.Pi*x)) / 2 * math.Sin(2*math.Pi*cycles*x)
+	}, nil
+}
+
+// Returns a tone burst of 5 cycles per period T, see SineBurst.
+var sineBurst, _ = SineBurst(5)
+
+// Returns a damped sinusoid y=A*exp(-t/tau)*sin(2*pi*t/T), where A is the initial amplitude, T is the period,
+// tau is the decay time constant in seconds, and t is elapsed time, e.g. the transient following a fault. If tau
+// is zero, the time constant is the period T, so that the oscillation decays to about 1% of A within five cycles.
+func DampedSine(tau float64) (MathsFunction, error) {
+	if tau < 0 {
+		return nil, errors.New("decay time constant must not be negative")
+	}
+	return func(t, A, T float64) float64 {
+		decay := tau
+		if decay == 0 {
+			decay = T
+		}
+		return A * math.Exp(-t/decay) * math.Sin(2*math.Pi*t/T)
+	}, nil
+}
+
+// Returns a damped sinusoid whose decay time constant is its period, see DampedSine.
+func dampedSine(t, A, T float64) float64 {
+	return A * math.Exp(-t/T) * math.Sin(2*math.Pi*t/T)
+}
+
+// Returns a linear chirp y=A*sin(phi(t)), whose frequency sweeps linearly from f0 to f1 (Hz) across each
+// period T, where A is the amplitude and t is elapsed time. The sweep restarts at the start of each period.
+func Chirp(f0, f1 float64) (MathsFunction, error) {
+	if f0 < 0 || f1 < 0 {
+		return nil, errors.New("frequencies of chirp must not be negative")
+	}
+	return func(t, A, T float64) float64 {
+		t = math.Mod(t, T)
+		return A * math.Sin(2*math.Pi*(f0*t+(f1-f0)*t*t/(2*T)))
+	}, nil
+}
+
+// Returns an exponential chirp y=A*sin(phi(t)), whose frequency sweeps geometrically from f0 to f1 (Hz) across
+// each period T, so that each octave takes the same time, where A is the amplitude and t is elapsed time. The
+// sweep restarts at the start of each period.
+func ExponentialChirp(f0, f1 float64) (MathsFunction, error) {
+	if f0 <= 0 || f1 <= 0 {
+		return nil, errors.New("frequencies of exponential chirp must be positive")
+	}
+	return func(t, A, T float64) float64 {
+		t = math.Mod(t, T)
+		rate := math.Log(f1/f0) / T // rate of change of the logarithm of frequency
+		if rate == 0 {
+			return A * math.Sin(2*math.Pi*f0*t)
+		}
+		return A * math.Sin(2*math.Pi*f0*math.Expm1(rate*t)/rate)
+	}, nil
+}
+
+// Returns a combinator which parses its n arguments as numbers and passes them to generate, e.g. for "pulse(0.2)".
+func generateFromNumbers(n int, generate func(args []float64) (MathsFunction, error)) func([]string) (MathsFunction, error) {
+	return func(args []string) (MathsFunction, error) {
+		if len(args) != n {
+			return nil, fmt.Errorf("takes %d numbers, not %d arguments", n, len(args))
+		}
+		numbers := make([]float64, n)
+		for i, arg := range args {
+			var err error
+			if numbers[i], err = strconv.ParseFloat(arg, 64); err != nil {
+				return nil, fmt.Errorf("invalid number %q", arg)
+			}
+		}
+		return generate(numbers)
+	}
+}
+
+// Returns a combinator which parses any number of arguments as numbers and passes them to generate, e.g. for
+// "ar(0.9, -0.2)".
+func generateFromAnyNumbers(generate func(args []float64) (MathsFunction, error)) func([]string) (MathsFunction, error) {
+	return func(args []string) (MathsFunction, error) {
+		return generateFromNumbers(len(args), generate)(args)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"math"
 	"math/rand/v2"
+	"slices"
+	"strings"
 
 	"github.com/stevenblair/sigourney/fast"
 )
@@ -14,24 +16,65 @@ type MathsFunction func(t, A, T float64) float64
 
 // A map between string name and trendFunction pairs
 var mathsFunctions = map[string]MathsFunction{
-	"linear":            linearRamp,
-	"sine":              sineWave,
-	"cosine":            cosineWave,
-	"exponential":       exponentialRamp,
-	"parabolic":         parabolicRamp,
-	"step":              stepFunction,
-	"square":            squareWave,
-	"sawtooth":          sawtoothWave,
-	"impulse":           impulseTrain,
-	"impulse_varying":   impulseTrainVaryingMagnitude,
-	"random_noise":      randomNoise,
-	"gaussian_noise":    gaussianNoise,
-	"exponential_noise": exponentialNoise,
-	"random_walk":       randomWalk,
-}
-
-// Returns the named trend function. Defaults to linear if name is empty.
+	"linear":              linearRamp,
+	"sine":                sineWave,
+	"cosine":              cosineWave,
+	"rectified_sine":      fullWaveRectifiedSine,
+	"half_rectified_sine": halfWaveRectifiedSine,
+	"damped_sine":         dampedSine,
+	"sine_burst":          sineBurst,
+	"half_sine":           halfSinePulse,
+	"haversine":           haversinePulse,
+	"exponential":         exponentialRamp,
+	"parabolic":           parabolicRamp,
+	"smoothstep":          smoothstep,
+	"smootherstep":        smootherstep,
+	"raised_cosine":       raisedCosineStep,
+	"step":                stepFunction,
+	"pulse":               pulseTrain,
+	"trapezoid":           trapezoid,
+	"square":              squareWave,
+	"sawtooth":            sawtoothWave,
+	"impulse":             impulseTrain,
+}
+
+// A map between string name and constructors of stochastic functions, which return a new function drawing
+// random numbers from r, with its own state if it is stateful, each time the function is looked up by name
+var randomFunctions = map[string]func(r *rand.Rand) MathsFunction{
+	"impulse_varying":   newImpulseTrainVaryingMagnitude,
+	"random_noise":      newRandomNoise,
+	"gaussian_noise":    newGaussianNoise,
+	"exponential_noise": newExponentialNoise,
+	"weibull_noise":     newWeibullNoise,
+	"lognormal_noise":   newLognormalNoise,
+	"random_walk":       newRandomWalk,
+	"pink_noise":        NewPinkNoiseWithRand,
+	"ou":                newOrnsteinUhlenbeckOverPeriod,
+	"poisson":           newPoissonImpulsesOverPeriod,
+}
+
+// Returns the named trend function. Defaults to linear if name is empty. A name with ExpressionPrefix defines
+// the function by an expression, see ParseExpression, and a name such as "sum(linear, scale(sine, 0.1))"
+// combines other named functions with Sum, Product, Scale or Shift. Stochastic functions draw from the global
+// source of random numbers, see GetTrendFunctionWithRand.
 func GetTrendFunctionFromName(name string) (MathsFunction, error) {
+	return GetTrendFunctionWithRand(name, nil)
+}
+
+// Returns the named trend function, see GetTrendFunctionFromName, with stochastic functions drawing their random
+// numbers from r, or from the global source if r is nil, so that they are reproducible if r is seeded.
+func GetTrendFunctionWithRand(name string, r *rand.Rand) (MathsFunction, error) {
+	if strings.HasPrefix(name, ExpressionPrefix) {
+		return expressionFunction(name)
+	}
+	if f, ok, err := combinedFunction(name, r); ok {
+		return f, err
+	}
+
+	if newFunc, ok := randomFunctions[name]; ok {
+		return newFunc(randOrGlobal(r)), nil
+	}
+
 	trendFunc, ok := mathsFunctions[name]
 	if !ok {
 		return nil, errors.New("trend function not found")
@@ -40,6 +83,31 @@ func GetTrendFunctionFromName(name string) (MathsFunction, error) {
 	return trendFunc, nil
 }
 
+// Names of the stateful functions, whose outputs depend on their previous calls, either as a named function such
+// as "random_walk" or as a combinator such as "random_walk(10)"
+var statefulFunctions = []string{"random_walk", "pink_noise", "ou", "poisson", "ar", "arma"}
+
+// Returns whether the named function, see GetTrendFunctionFromName, is stateful or combines a stateful function,
+// e.g. "pink_noise" or "sum(linear, random_walk)", so that its output depends on its previous calls as well as
+// its arguments. The hidden state of such a function is not exposed, so it cannot be checkpointed.
+func IsStateful(name string) bool {
+	name = strings.TrimSpace(name)
+	if strings.HasPrefix(name, ExpressionPrefix) {
+		return false // expressions only use stateless functions
+	}
+	open := strings.IndexByte(name, '(')
+	if open < 0 || !strings.HasSuffix(name, ")") {
+		return slices.Contains(statefulFunctions, name)
+	}
+	combinator := strings.TrimSpace(name[:open])
+	switch combinator {
+	case "sum", "product", "scale", "shift", "phase":
+		args, err := splitArguments(name[open+1 : len(name)-1])
+		return err == nil && slices.ContainsFunc(args, IsStateful)
+	}
+	return slices.Contains(statefulFunctions, combinator)
+}
+
 // Returns a linear ramp y=(A/T)*t where A is the magntiude of the ramp, T is
 // its duration, and t is elapsed time.
 func linearRamp(t, A, T float64) float64 {
@@ -59,6 +127,37 @@ func cosineWave(t, A, T float64) float64 {
 	return A * fast.Cos(2*math.Pi*t/T)
 }
 
+// Returns a full-wave rectified sine wave y=A*|sin(2*pi*t/T)| where A is the amplitude,
+// T is the period of the sine wave before rectification, and t is elapsed time, e.g. the
+// ripple of a full-wave rectifier load.
+func fullWaveRectifiedSine(t, A, T float64) float64 {
+	return A * math.Abs(math.Sin(2*math.Pi*t/T))
+}
+
+// Returns a half-wave rectified sine wave y=A*max(sin(2*pi*t/T), 0) where A is the amplitude,
+// T is the period, and t is elapsed time, e.g. the ripple of a half-wave rectifier load.
+func halfWaveRectifiedSine(t, A, T float64) float64 {
+	return A * max(math.Sin(2*math.Pi*t/T), 0)
+}
+
+// Returns a half-sine pulse y=A*sin(pi*t/T), a single positive half-cycle lasting T, where A is the peak
+// amplitude and t is elapsed time, and zero thereafter, e.g. a standard shock-test profile.
+func halfSinePulse(t, A, T float64) float64 {
+	if t < 0 || t > T {
+		return 0
+	}
+	return A * math.Sin(math.Pi*t/T)
+}
+
+// Returns a haversine pulse y=A*(1-cos(2*pi*t/T))/2, a single pulse lasting T which starts and ends with
+// zero slope, where A is the peak amplitude and t is elapsed time, and zero thereafter.
+func haversinePulse(t, A, T float64) float64 {
+	if t < 0 || t > T {
+		return 0
+	}
+	return A * (1 - math.Cos(2*math.Pi*t/T)) / 2
+}
+
 // Returns an exponential ramp y=A*exp(t/T) - A where A is the amplitude,
 // T is the time constant, and t is elapsed time.
 func exponentialRamp(t, A, T float64) float64 {
@@ -70,6 +169,27 @@ func parabolicRamp(t, A, T float64) float64 {
 	return A * (t / T) * (t / T) // faster power of two compared to math.Pow(t/T, 2)
 }
 
+// Returns a cubic Hermite ease y=A*(3x^2-2x^3), x=t/T, which rises from 0 to A over T with zero
+// slope at both ends, and holds A thereafter.
+func smoothstep(t, A, T float64) float64 {
+	x := min(max(t/T, 0), 1)
+	return A * x * x * (3 - 2*x)
+}
+
+// Returns a quintic Hermite ease y=A*(6x^5-15x^4+10x^3), x=t/T, which rises from 0 to A over T with
+// zero slope and curvature at both ends, and holds A thereafter.
+func smootherstep(t, A, T float64) float64 {
+	x := min(max(t/T, 0), 1)
+	return A * x * x * x * (x*(6*x-15) + 10)
+}
+
+// Returns a raised-cosine step y=A*(1-cos(pi*t/T))/2, which rises from 0 to A over T with
+// zero slope at both ends, and holds A thereafter, e.g. for bump-free setpoint changes.
+func raisedCosineStep(t, A, T float64) float64 {
+	x := min(max(t/T, 0), 1)
+	return A * (1 - math.Cos(math.Pi*x)) / 2
+}
+
 // Returns a step function of amplitude A every period T.
 func stepFunction(t, A, T float64) float64 {
 	if math.Mod(t, T) < T/2 {
@@ -108,36 +228,57 @@ func impulseTrain(t, A, T float64) float64 {
 
 // Returns a spike every period T, with an amplitude which is
 // normally distributed about A. Each spike has a width of 1 microsecond.
-func impulseTrainVaryingMagnitude(t, A, T float64) float64 {
-	fixedAmplitudeImpulse := impulseTrain(t, A, T)
-	return fixedAmplitudeImpulse * rand.NormFloat64()
+func newImpulseTrainVaryingMagnitude(r *rand.Rand) MathsFunction {
+	return func(t, A, T float64) float64 {
+		fixedAmplitudeImpulse := impulseTrain(t, A, T)
+		return fixedAmplitudeImpulse * r.NormFloat64()
+	}
 }
 
 // Returns additional random (uniform) noise of amplitude A.
-func randomNoise(_, A, _ float64) float64 {
-	return A * (rand.Float64()*2 - 1) // A random number between -A and A
+func newRandomNoise(r *rand.Rand) MathsFunction {
+	return func(_, A, _ float64) float64 {
+		return A * (r.Float64()*2 - 1) // A random number between -A and A
+	}
 }
 
 // Returns additional Gaussian noise of amplitude A.
-func gaussianNoise(_, A, _ float64) float64 {
-	return rand.NormFloat64() * A
+func newGaussianNoise(r *rand.Rand) MathsFunction {
+	return func(_, A, _ float64) float64 {
+		return r.NormFloat64() * A
+	}
 }
 
 // Returns additional exponential noise of amplitude A.
-func exponentialNoise(_, A, _ float64) float64 {
-	return -A * math.Log(rand.Float64())
+func newExponentialNoise(r *rand.Rand) MathsFunction {
+	return func(_, A, _ float64) float64 {
+		return -A * math.Log(r.Float64())
+	}
 }
 
 // Returns a random walk that lasts for period T. The walk is bounded
 // to within +/- amplitude A, and can make steps of maximum size A/20.
-// The returned function is stateful, it remembers the previous value.
-// This prevents stack overflow errors that occur with recursive implementations.
-var randomWalk = func() func(float64, float64, float64) float64 {
-	stepFactor := 20.0
+// The returned function is stateful, it remembers the previous value, see NewRandomWalk.
+func newRandomWalk(r *rand.Rand) MathsFunction {
+	walk, _ := NewRandomWalk(r, 20)
+	return walk
+}
+
+// Returns a random walk, which starts at zero and is bounded to within +/- amplitude A, and can make steps of
+// maximum size A/stepFactor each time it is called, drawing from r, or from the global source if r is nil. The
+// walk holds its value when called with t=0, and the period T is not used. The returned function is stateful,
+// it remembers the previous value, and each call of NewRandomWalk returns an independent walk, so that anomalies
+// which use random walks do not affect each other. This prevents stack overflow errors that occur with recursive
+// implementations.
+func NewRandomWalk(r *rand.Rand, stepFactor float64) (MathsFunction, error) {
+	if stepFactor <= 0 {
+		return nil, errors.New("step factor of random walk must be positive")
+	}
+	r = randOrGlobal(r)
 	var previousValue float64 = 0
 	return func(t, A, T float64) float64 {
 		if t != 0 {
-			step := A / stepFactor * (rand.Float64()*2 - 1)
+			step := A / stepFactor * (r.Float64()*2 - 1)
 			proposedValue := previousValue + step
 
 			// Hold the value within the bounds of +/- A
@@ -150,5 +291,5 @@ var randomWalk = func() func(float64, float64, float64) float64 {
 			}
 		}
 		return previousValue
-	}
-}()
+	}, nil
+}
@@ -50,6 +50,110 @@ func TestDeterministicTrendFunctions(t *testing.T) {
 			expected: 0.0, // M*cos(pi/2) = 0
 			isError:  false,
 		},
+		{
+			name:     "damped_sine",
+			t:        x,
+			A:        M,
+			T:        4 * x,
+			expected: M * math.Exp(-0.25), // M*exp(-x/4x)*sin(pi/2)
+			isError:  false,
+		},
+		{
+			name:     "damped_sine(2)",
+			t:        x,
+			A:        M,
+			T:        4 * x,
+			expected: M * math.Exp(-x/2), // decay time constant of 2 seconds
+			isError:  false,
+		},
+		{
+			name:    "damped_sine(-1)",
+			isError: true,
+		},
+		{
+			name:     "rectified_sine",
+			t:        3 * x,
+			A:        M,
+			T:        4 * x,
+			expected: M, // M*|sin(3*pi/2)|
+			isError:  false,
+		},
+		{
+			name:     "half_rectified_sine",
+			t:        3 * x,
+			A:        M,
+			T:        4 * x,
+			expected: 0.0, // negative half-cycle removed
+			isError:  false,
+		},
+		{
+			name:     "half_rectified_sine",
+			t:        x,
+			A:        M,
+			T:        4 * x,
+			expected: M, // positive half-cycle unchanged
+			isError:  false,
+		},
+		{
+			name:     "half_sine",
+			t:        x,
+			A:        M,
+			T:        2 * x,
+			expected: M, // peak at T/2
+			isError:  false,
+		},
+		{
+			name:     "half_sine",
+			t:        3 * x,
+			A:        M,
+			T:        2 * x,
+			expected: 0.0, // zero after T
+			isError:  false,
+		},
+		{
+			name:     "haversine",
+			t:        x,
+			A:        M,
+			T:        4 * x,
+			expected: M / 2, // M*(1-cos(pi/2))/2
+			isError:  false,
+		},
+		{
+			name:     "haversine",
+			t:        5 * x,
+			A:        M,
+			T:        4 * x,
+			expected: 0.0, // zero after T
+			isError:  false,
+		},
+		{
+			name:     "sine_burst",
+			t:        x / 20,
+			A:        M,
+			T:        x,
+			expected: M * (1 - math.Cos(math.Pi/10)) / 2, // first peak of 5 cycles, within the Hann window
+			isError:  false,
+		},
+		{
+			name:     "sine_burst(2)",
+			t:        x * 3 / 8,
+			A:        M,
+			T:        x,
+			expected: M * (1 - math.Cos(3*math.Pi/4)) / 2 * math.Sin(3*math.Pi/2), // negative peak of the second cycle
+			isError:  false,
+		},
+		{
+			name:     "sine_burst",
+			t:        x,
+			A:        M,
+			T:        x,
+			expected: 0.0, // starts and ends at zero
+			isError:  false,
+		},
+		{
+			name:    "sine_burst(0)",
+			isError: true,
+		},
 		{
 			name:     "exponential",
 			t:        x,
@@ -66,6 +170,62 @@ func TestDeterministicTrendFunctions(t *testing.T) {
 			expected: M / 4, // M*(x/2x)^2 = M*(1/2)^2 = M/4
 			isError:  false,
 		},
+		{
+			name:     "smoothstep",
+			t:        x,
+			A:        M,
+			T:        4 * x,
+			expected: M * 5 / 32, // M*(3/16 - 2/64)
+			isError:  false,
+		},
+		{
+			name:     "smoothstep",
+			t:        2 * x,
+			A:        M,
+			T:        x,
+			expected: M, // holds A after T
+			isError:  false,
+		},
+		{
+			name:     "smootherstep",
+			t:        x,
+			A:        M,
+			T:        2 * x,
+			expected: M / 2, // symmetric about T/2
+			isError:  false,
+		},
+		{
+			name:     "smootherstep",
+			t:        x,
+			A:        M,
+			T:        4 * x,
+			expected: M * 53 / 512, // M*(6/1024 - 15/256 + 10/64)
+			isError:  false,
+		},
+		{
+			name:     "raised_cosine",
+			t:        x,
+			A:        M,
+			T:        2 * x,
+			expected: M / 2, // half way through the transition
+			isError:  false,
+		},
+		{
+			name:     "raised_cosine",
+			t:        x,
+			A:        M,
+			T:        3 * x,
+			expected: M / 4, // M*(1-cos(pi/3))/2
+			isError:  false,
+		},
+		{
+			name:     "raised_cosine",
+			t:        3 * x,
+			A:        M,
+			T:        x,
+			expected: M, // holds A after T
+			isError:  false,
+		},
 		{
 			name:     "step",
 			t:        1.5 * x,
@@ -82,6 +242,78 @@ func TestDeterministicTrendFunctions(t *testing.T) {
 			expected: 0.0, // zero value for t < T/2
 			isError:  false,
 		},
+		{
+			name:     "pulse",
+			t:        0.25 * x,
+			A:        M,
+			T:        x,
+			expected: M, // positive value for t < T/2
+			isError:  false,
+		},
+		{
+			name:     "pulse",
+			t:        0.75 * x,
+			A:        M,
+			T:        x,
+			expected: 0.0, // zero value for t > T/2
+			isError:  false,
+		},
+		{
+			name:     "pulse(0.2)",
+			t:        0.25 * x,
+			A:        M,
+			T:        x,
+			expected: 0.0, // zero value after the first 20% of the period
+			isError:  false,
+		},
+		{
+			name:     "pulse(0.2)",
+			t:        2.1 * x,
+			A:        M,
+			T:        x,
+			expected: M, // positive value within the first 20% of each period
+			isError:  false,
+		},
+		{
+			name:    "pulse(1.2)",
+			isError: true,
+		},
+		{
+			name:     "trapezoid",
+			t:        x / 8,
+			A:        M,
+			T:        x,
+			expected: M / 2, // half way up the rise over the first quarter
+			isError:  false,
+		},
+		{
+			name:     "trapezoid(0.1, 0.6, 0.2)",
+			t:        2.5 * x,
+			A:        M,
+			T:        x,
+			expected: M, // holds A from 10% to 70% of each period
+			isError:  false,
+		},
+		{
+			name:     "trapezoid(0.1, 0.6, 0.2)",
+			t:        0.8 * x,
+			A:        M,
+			T:        x,
+			expected: M / 2, // half way down the fall from 70% to 90% of the period
+			isError:  false,
+		},
+		{
+			name:     "trapezoid(0.1, 0.6, 0.2)",
+			t:        0.95 * x,
+			A:        M,
+			T:        x,
+			expected: 0.0, // zero for the rest of the period
+			isError:  false,
+		},
+		{
+			name:    "trapezoid(0.5, 0.5, 0.5)",
+			isError: true,
+		},
 		{
 			name:     "square",
 			t:        0.0,
@@ -209,6 +441,39 @@ func TestNoiseFunctions(t *testing.T) {
 			upperBound:      math.Inf(1), // exponential distribution is unbounded at the upper end
 			checkNoiseDelta: false,
 		},
+		{
+			name:            "weibull_noise",
+			numSamples:      nSamples,
+			checkStatistics: true,
+			expectedMean:    A * math.Gamma(1.5),                           // by definition of Weibull distribution of shape 2
+			expectedStdDev:  A * math.Sqrt(1-math.Pow(math.Gamma(1.5), 2)), // by definition of Weibull distribution of shape 2
+			checkBounds:     true,
+			lowerBound:      0,
+			upperBound:      math.Inf(1),
+			checkNoiseDelta: false,
+		},
+		{
+			name:            "weibull_noise(1)",
+			numSamples:      nSamples,
+			checkStatistics: true,
+			expectedMean:    A, // Weibull distribution of shape 1 is exponential
+			expectedStdDev:  A,
+			checkBounds:     true,
+			lowerBound:      0,
+			upperBound:      math.Inf(1),
+			checkNoiseDelta: false,
+		},
+		{
+			name:            "lognormal_noise(0.25)",
+			numSamples:      nSamples,
+			checkStatistics: true,
+			expectedMean:    A * math.Exp(0.25*0.25/2),                                  // by definition of lognormal distribution
+			expectedStdDev:  A * math.Sqrt((math.Exp(0.25*0.25)-1)*math.Exp(0.25*0.25)), // by definition of lognormal distribution
+			checkBounds:     true,
+			lowerBound:      0, // lognormal distribution always positive values
+			upperBound:      math.Inf(1),
+			checkNoiseDelta: false,
+		},
 		{
 			name:            "random_walk",
 			numSamples:      100, // statistics not being checked so fewer samples required
@@ -253,3 +518,417 @@ func TestNoiseFunctions(t *testing.T) {
 		})
 	}
 }
+
+// Tests for functions defined by expressions
+func TestExpressionFunctions(t *testing.T) {
+	testCases := []struct {
+		expr     string  // expression, without ExpressionPrefix
+		t        float64 // time in seconds
+		A        float64 // amplitude
+		T        float64 // period in seconds
+		expected float64 // expected value of the function at time t
+	}{
+		{expr: "A*sin(2*pi*t/T) + 0.1*t", t: 1, A: 2, T: 4, expected: 2.1},
+		{expr: "1 + 2*3 - 4/2", expected: 5},
+		{expr: "-2^2", expected: -4},
+		{expr: "2^3^2", expected: 512},
+		{expr: "(1 + 2) * 3", expected: 9},
+		{expr: "t % T", t: 7, T: 3, expected: 1},
+		{expr: "max(t, A) + min(t, A)", t: 1, A: 5, expected: 6},
+		{expr: "1.5e-1 * e", expected: 0.15 * math.E},
+		{expr: "  sqrt( abs(-16) )  ", expected: 4},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.expr, func(t *testing.T) {
+			f, err := mathfuncs.GetTrendFunctionFromName(mathfuncs.ExpressionPrefix + tc.expr)
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.expected, f(tc.t, tc.A, tc.T), 1e-9)
+		})
+	}
+
+	for _, expr := range []string{"", "1 +", "(1 + 2", "foo(t)", "x * 2", "sin(1, 2)", "max(1)", "1 2", "1..2", "t $ 2"} {
+		_, err := mathfuncs.ParseExpression(expr)
+		assert.Error(t, err, expr)
+	}
+}
+
+// Tests for combinators of functions, and for referencing them by name
+func TestCombinators(t *testing.T) {
+	sine, err := mathfuncs.GetTrendFunctionFromName("sine")
+	assert.NoError(t, err)
+	linear, err := mathfuncs.GetTrendFunctionFromName("linear")
+	assert.NoError(t, err)
+
+	assert.InDelta(t, 0.5+2, mathfuncs.Sum(linear, sine)(1, 2, 4), 1e-9)
+	assert.InDelta(t, 0.5*2, mathfuncs.Product(linear, sine)(1, 2, 4), 1e-9)
+	assert.InDelta(t, 0.2, mathfuncs.Scale(sine, 0.1)(1, 2, 4), 1e-9)
+	assert.InDelta(t, 0, mathfuncs.Shift(sine, 1)(1, 2, 4), 1e-9)
+	assert.InDelta(t, 0, mathfuncs.Phase(sine, 90)(1, 2, 4), 1e-9) // cos(pi/2)
+
+	testCases := []struct {
+		name     string  // name of the combined function
+		t        float64 // time in seconds
+		A        float64 // amplitude
+		T        float64 // period in seconds
+		expected float64 // expected value of the function at time t
+	}{
+		{name: "sum(linear, scale(sine, 0.1))", t: 1, A: 2, T: 4, expected: 0.5 + 0.2},
+		{name: "product(linear, linear)", t: 1, A: 2, T: 4, expected: 0.25},
+		{name: "shift(linear, -1)", t: 1, A: 2, T: 4, expected: 1},
+		{name: "phase(sine, 90)", t: 0, A: 2, T: 4, expected: 2},
+		{name: "phase(sine, -90)", t: 3, A: 2, T: 8, expected: math.Sqrt2}, // 2*sin(2*pi*(3-2)/8) = 2*sin(pi/4)
+		{name: "sum(expr: max(t, A), step)", t: 3, A: 2, T: 4, expected: 5},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			f, err := mathfuncs.GetTrendFunctionFromName(tc.name)
+			assert.NoError(t, err)
+			assert.InDelta(t, tc.expected, f(tc.t, tc.A, tc.T), 1e-9)
+		})
+	}
+
+	for _, name := range []string{"sum(linear)", "sum(linear, nope)", "scale(sine, x)", "sum(linear, (sine)", "nope(linear, sine)"} {
+		_, err := mathfuncs.GetTrendFunctionFromName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+// Tests for piecewise-linear functions, including their behaviour outside the breakpoints
+func TestPiecewiseLinear(t *testing.T) {
+	breakpoints := []mathfuncs.Breakpoint{{Time: 0, Value: 0}, {Time: 10, Value: 1}, {Time: 20, Value: 0.5}}
+
+	testCases := []struct {
+		outside  string    // behaviour outside the breakpoints
+		times    []float64 // times at which to evaluate the function
+		expected []float64 // expected values of the function with amplitude 2
+	}{
+		{outside: mathfuncs.OutsideHold, times: []float64{-5, 0, 5, 10, 15, 20, 25}, expected: []float64{0, 0, 1, 2, 1.5, 1, 1}},
+		{outside: mathfuncs.OutsideWrap, times: []float64{-5, 5, 25, 30, 55}, expected: []float64{1.5, 1, 1, 2, 1.5}},
+		{outside: mathfuncs.OutsideZero, times: []float64{-5, 5, 25}, expected: []float64{0, 1, 0}},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.outside, func(t *testing.T) {
+			f, err := mathfuncs.PiecewiseLinear(breakpoints, tc.outside)
+			assert.NoError(t, err)
+			for i, x := range tc.times {
+				assert.InDelta(t, tc.expected[i], f(x, 2, 0), 1e-9, "t=%v", x)
+			}
+		})
+	}
+
+	f, err := mathfuncs.GetTrendFunctionFromName("piecewise(hold, 0:0, 10:1, 20:0.5)")
+	assert.NoError(t, err)
+	assert.InDelta(t, 1.5, f(15, 2, 0), 1e-9)
+
+	_, err = mathfuncs.PiecewiseLinear(nil, mathfuncs.OutsideHold)
+	assert.Error(t, err)
+	_, err = mathfuncs.PiecewiseLinear([]mathfuncs.Breakpoint{{Time: 1}, {Time: 1}}, mathfuncs.OutsideHold)
+	assert.Error(t, err)
+	_, err = mathfuncs.PiecewiseLinear(breakpoints[:1], mathfuncs.OutsideWrap)
+	assert.Error(t, err)
+	_, err = mathfuncs.PiecewiseLinear(breakpoints, "extrapolate")
+	assert.Error(t, err)
+	_, err = mathfuncs.GetTrendFunctionFromName("piecewise(hold, 0-0)")
+	assert.Error(t, err)
+}
+
+// Tests that cubic splines pass through their breakpoints with continuous slope
+func TestCubicSpline(t *testing.T) {
+	breakpoints := []mathfuncs.Breakpoint{{Time: 0, Value: 0}, {Time: 1, Value: 1}, {Time: 3, Value: -1}, {Time: 4, Value: 0.5}}
+	f, err := mathfuncs.CubicSpline(breakpoints, mathfuncs.OutsideZero)
+	assert.NoError(t, err)
+
+	for _, p := range breakpoints {
+		assert.InDelta(t, 2*p.Value, f(p.Time, 2, 0), 1e-9, "t=%v", p.Time)
+	}
+
+	// slopes either side of each interior breakpoint match
+	h := 1e-6
+	for _, p := range breakpoints[1:3] {
+		before := (f(p.Time, 1, 0) - f(p.Time-h, 1, 0)) / h
+		after := (f(p.Time+h, 1, 0) - f(p.Time, 1, 0)) / h
+		assert.InDelta(t, before, after, 1e-4, "t=%v", p.Time)
+	}
+	assert.Equal(t, 0.0, f(5, 1, 0))
+
+	// two breakpoints give a straight line
+	line, err := mathfuncs.GetTrendFunctionFromName("spline(hold, 0:0, 2:1)")
+	assert.NoError(t, err)
+	assert.InDelta(t, 0.5, line(1, 1, 0), 1e-9)
+	assert.InDelta(t, 1, line(3, 1, 0), 1e-9)
+
+	_, err = mathfuncs.CubicSpline(breakpoints[:1], mathfuncs.OutsideHold)
+	assert.Error(t, err)
+}
+
+// Tests that chirps sweep between their start and end frequencies
+func TestChirp(t *testing.T) {
+	linear, err := mathfuncs.GetTrendFunctionFromName("chirp(1, 9)")
+	assert.NoError(t, err)
+	exponential, err := mathfuncs.GetTrendFunctionFromName("chirp_exp(1, 9)")
+	assert.NoError(t, err)
+
+	// instantaneous frequency from the derivative of the phase of a unit chirp, away from its peaks
+	frequencyAt := func(f mathfuncs.MathsFunction, t float64) float64 {
+		h := 1e-6
+		phase := func(t float64) float64 { return math.Asin(f(t, 1, 2)) }
+		return math.Abs(phase(t+h)-phase(t-h)) / (2 * h) / (2 * math.Pi)
+	}
+
+	// linear: f(t) = 1 + 8t/2 over a period of 2 s; exponential: f(t) = 9^(t/2)
+	assert.InDelta(t, 1, frequencyAt(linear, 0.01), 0.1)
+	assert.InDelta(t, 5, frequencyAt(linear, 1), 0.01)
+	assert.InDelta(t, 3, frequencyAt(exponential, 1), 0.01)
+	assert.InDelta(t, linear(0.5, 1, 2), linear(2.5, 1, 2), 1e-9) // restarts each period
+
+	_, err = mathfuncs.GetTrendFunctionFromName("chirp(-1, 9)")
+	assert.Error(t, err)
+	_, err = mathfuncs.GetTrendFunctionFromName("chirp_exp(0, 9)")
+	assert.Error(t, err)
+	_, err = mathfuncs.GetTrendFunctionFromName("chirp(1)")
+	assert.Error(t, err)
+}
+
+// Tests that pink noise has the expected standard deviation and is correlated from one sample to the next,
+// unlike white noise
+func TestPinkNoise(t *testing.T) {
+	f, err := mathfuncs.GetTrendFunctionFromName("pink_noise")
+	assert.NoError(t, err)
+
+	n := int(1e6)
+	samples := make([]float64, n)
+	var sum, sumSq float64
+	for i := range samples {
+		samples[i] = f(float64(i), 1, 0)
+		sum += samples[i]
+		sumSq += samples[i] * samples[i]
+	}
+	mean := sum / float64(n)
+	variance := sumSq/float64(n) - mean*mean
+	assert.InDelta(t, 0, mean, 0.1)
+	assert.InDelta(t, 1, math.Sqrt(variance), 0.1)
+
+	var lag1 float64
+	for i := 1; i < n; i++ {
+		lag1 += (samples[i] - mean) * (samples[i-1] - mean)
+	}
+	assert.InDelta(t, 0.82, lag1/float64(n-1)/variance, 0.05) // lag 1 autocorrelation of the filter
+}
+
+// Tests that an Ornstein-Uhlenbeck process reverts to zero with the expected standard deviation and
+// autocorrelation, independently of the rate at which it is called
+func TestOrnsteinUhlenbeck(t *testing.T) {
+	for _, name := range []string{"ou", "ou(1, 1.4142135623730951)"} {
+		t.Run(name, func(t *testing.T) {
+			f, err := mathfuncs.GetTrendFunctionFromName(name)
+			assert.NoError(t, err)
+
+			n, dt := int(1e6), 0.01
+			samples := make([]float64, n)
+			var sum, sumSq float64
+			for i := range samples {
+				samples[i] = f(float64(i)*dt, 2, 1) // time constant of 1 s, standard deviation tends to 2
+				sum += samples[i]
+				sumSq += samples[i] * samples[i]
+			}
+			assert.Equal(t, 0.0, samples[0])
+			mean := sum / float64(n)
+			variance := sumSq/float64(n) - mean*mean
+			assert.InDelta(t, 0, mean, 0.1)
+			assert.InDelta(t, 2, math.Sqrt(variance), 0.1)
+
+			var lag float64
+			for i := 100; i < n; i++ {
+				lag += (samples[i] - mean) * (samples[i-100] - mean)
+			}
+			assert.InDelta(t, math.Exp(-1), lag/float64(n-100)/variance, 0.05) // autocorrelation after 1 s
+
+			assert.Equal(t, 0.0, f(0, 2, 1)) // restarts when time decreases
+		})
+	}
+
+	_, err := mathfuncs.NewOrnsteinUhlenbeck(0, 1)
+	assert.Error(t, err)
+	_, err = mathfuncs.NewOrnsteinUhlenbeck(1, -1)
+	assert.Error(t, err)
+}
+
+// Tests that Poisson impulses arrive at the expected mean rate, independently of the rate at which they are
+// sampled
+func TestPoissonImpulses(t *testing.T) {
+	for _, dt := range []float64{0.01, 0.5} {
+		f, err := mathfuncs.GetTrendFunctionFromName("poisson(2)")
+		assert.NoError(t, err)
+
+		var total, remainder float64
+		duration := 2000.0
+		for i := 0; i < int(duration/dt); i++ {
+			x := f(float64(i)*dt, 3, 0)
+			remainder += math.Mod(x, 3)
+			total += x / 3
+		}
+		assert.Equal(t, 0.0, remainder) // multiples of the amplitude
+		assert.InDelta(t, 2, total/duration, 0.1, "dt=%v", dt)
+	}
+
+	f, err := mathfuncs.GetTrendFunctionFromName("poisson")
+	assert.NoError(t, err)
+	var total float64
+	for i := 0; i < 100000; i++ {
+		total += f(float64(i), 1, 10) // one impulse every 10 s on average
+	}
+	assert.InDelta(t, 10000, total, 500)
+
+	_, err = mathfuncs.NewPoissonImpulses(0)
+	assert.Error(t, err)
+}
+
+// Tests the shapes of noise functions which are checked by name
+func TestNoiseShapes(t *testing.T) {
+	for _, name := range []string{"weibull_noise(0)", "lognormal_noise(-1)", "weibull_noise(1, 2)"} {
+		_, err := mathfuncs.GetTrendFunctionFromName(name)
+		assert.Error(t, err, name)
+	}
+
+	f, err := mathfuncs.GetTrendFunctionFromName("lognormal_noise")
+	assert.NoError(t, err)
+	var below int
+	for i := 0; i < 10000; i++ {
+		if f(0, 3, 0) < 3 {
+			below++
+		}
+	}
+	assert.InDelta(t, 5000, below, 300) // median of A
+}
+
+// Tests that ARMA noise has the autocorrelation set by its coefficients
+func TestARMA(t *testing.T) {
+	// returns the standard deviation and autocorrelations at lags 1 and 2 of noise with unit innovations
+	statistics := func(f mathfuncs.MathsFunction) (float64, float64, float64) {
+		n := int(1e6)
+		samples := make([]float64, n)
+		var sumSq float64
+		for i := range samples {
+			samples[i] = f(0, 1, 0)
+			sumSq += samples[i] * samples[i]
+		}
+		var lag1, lag2 float64
+		for i := 2; i < n; i++ {
+			lag1 += samples[i] * samples[i-1]
+			lag2 += samples[i] * samples[i-2]
+		}
+		return math.Sqrt(sumSq / float64(n)), lag1 / sumSq, lag2 / sumSq
+	}
+
+	ar, err := mathfuncs.GetTrendFunctionFromName("ar(0.9)")
+	assert.NoError(t, err)
+	stdDev, lag1, lag2 := statistics(ar)
+	assert.InDelta(t, 1/math.Sqrt(1-0.81), stdDev, 0.05)
+	assert.InDelta(t, 0.9, lag1, 0.02)
+	assert.InDelta(t, 0.81, lag2, 0.02)
+
+	ma, err := mathfuncs.GetTrendFunctionFromName("arma(, 0.5)")
+	assert.NoError(t, err)
+	stdDev, lag1, lag2 = statistics(ma)
+	assert.InDelta(t, math.Sqrt(1.25), stdDev, 0.02)
+	assert.InDelta(t, 0.4, lag1, 0.02) // 0.5/(1+0.5^2)
+	assert.InDelta(t, 0, lag2, 0.02)
+
+	_, err = mathfuncs.GetTrendFunctionFromName("arma(0.5 -0.3, 0.2 0.1)")
+	assert.NoError(t, err)
+	for _, name := range []string{"ar(1.1)", "ar(0.5, 0.6)", "arma(0.5)", "arma(x, 0.5)", "ar()"} {
+		_, err := mathfuncs.GetTrendFunctionFromName(name)
+		assert.Error(t, err, name)
+	}
+}
+
+// Tests that stochastic functions looked up with the same seeded random number generator are reproducible
+func TestGetTrendFunctionWithRand(t *testing.T) {
+	for _, name := range []string{"gaussian_noise", "random_walk", "pink_noise", "sum(random_noise, ou(1, 1))", "expr: t"} {
+		t.Run(name, func(t *testing.T) {
+			f, err := mathfuncs.GetTrendFunctionWithRand(name, rand.New(rand.NewPCG(1, 2)))
+			assert.NoError(t, err)
+			g, err := mathfuncs.GetTrendFunctionWithRand(name, rand.New(rand.NewPCG(1, 2)))
+			assert.NoError(t, err)
+			for i := 0; i < 100; i++ {
+				assert.Equal(t, f(float64(i)*0.1, 1, 10), g(float64(i)*0.1, 1, 10))
+			}
+		})
+	}
+
+	// a switchable source draws from whichever generator is set
+	source := &mathfuncs.SwitchableSource{}
+	f, err := mathfuncs.GetTrendFunctionWithRand("gaussian_noise", rand.New(source))
+	assert.NoError(t, err)
+	source.Set(rand.New(rand.NewPCG(3, 4)))
+	first := f(0, 1, 0)
+	source.Set(rand.New(rand.NewPCG(3, 4)))
+	assert.Equal(t, first, f(0, 1, 0))
+}
+
+// Tests that stateful functions are identified, including within combinators
+func TestIsStateful(t *testing.T) {
+	for _, name := range []string{"random_walk", "pink_noise", "ou", "poisson", "random_walk(5)", "ou(1, 2)", "ar(0.9)", "arma(0.5, 0.2)", "sum(linear, random_walk)", "scale(product(sine, pink_noise), 2)"} {
+		assert.True(t, mathfuncs.IsStateful(name), name)
+	}
+	for _, name := range []string{"", "linear", "gaussian_noise", "sum(linear, sine)", "scale(gaussian_noise, 2)", "piecewise(hold, 0:0, 1:1)", "expr: sin(t)"} {
+		assert.False(t, mathfuncs.IsStateful(name), name)
+	}
+}
+
+// Tests that random walks are independent of each other, and bounded by their step factor
+func TestNewRandomWalk(t *testing.T) {
+	r := rand.New(rand.NewPCG(1, 2))
+	walk, err := mathfuncs.NewRandomWalk(r, 20)
+	assert.NoError(t, err)
+	other, err := mathfuncs.GetTrendFunctionWithRand("random_walk", r)
+	assert.NoError(t, err)
+
+	// each walk steps from its own previous value by its own draw from the shared source, which is replayed
+	replay := rand.New(rand.NewPCG(1, 2))
+	step := func(previous float64) float64 {
+		return max(-1, min(1, previous+1.0/20*(replay.Float64()*2-1)))
+	}
+	previousWalk, previousOther := 0.0, 0.0
+	for i := 1; i < 100; i++ {
+		x := walk(float64(i), 1, 0)
+		assert.Equal(t, step(previousWalk), x)
+		y := other(float64(i), 1, 0)
+		assert.Equal(t, step(previousOther), y)
+		previousWalk, previousOther = x, y
+	}
+	assert.NotEqual(t, previousWalk, previousOther)
+
+	coarse, err := mathfuncs.GetTrendFunctionFromName("random_walk(2)")
+	assert.NoError(t, err)
+	previous := 0.0
+	for i := 1; i < 100; i++ {
+		x := coarse(float64(i), 1, 0)
+		assert.LessOrEqual(t, math.Abs(x-previous), 0.5)
+		assert.LessOrEqual(t, math.Abs(x), 1.0)
+		previous = x
+	}
+
+	_, err = mathfuncs.NewRandomWalk(nil, 0)
+	assert.Error(t, err)
+}
+
+// Tests that Fourier series sum their terms
+func TestFourierSeries(t *testing.T) {
+	f, err := mathfuncs.GetTrendFunctionFromName("fourier(1:1:0, 3:0.2:90)")
+	assert.NoError(t, err)
+	for _, x := range []float64{0, 0.3, 1.7} {
+		expected := 2 * (math.Sin(2*math.Pi*x/4) + 0.2*math.Cos(2*math.Pi*3*x/4))
+		assert.InDelta(t, expected, f(x, 2, 4), 1e-9, "t=%v", x)
+	}
+
+	constant, err := mathfuncs.FourierSeries([]mathfuncs.FourierCoefficient{{Order: 0, Magnitude: 0.5, Phase: 90}})
+	assert.NoError(t, err)
+	assert.InDelta(t, 1, constant(1.2, 2, 4), 1e-9) // a term of order 0 with phase 90 is a constant
+
+	for _, name := range []string{"fourier()", "fourier(1:1)", "fourier(-1:1:0)", "fourier(1:x:0)"} {
+		_, err := mathfuncs.GetTrendFunctionFromName(name)
+		assert.Error(t, err, name)
+	}
+}
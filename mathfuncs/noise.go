@@ -0,0 +1,274 @@
+package mathfuncs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// Noise functions, which draw random numbers from the global source, or from r with the WithRand variants of
+// their constructors. Stateful noise functions remember previous values, and each call of their constructor
+// returns a function with its own state, so that anomalies which use the same noise function are independent.
+
+// Standard deviation of the output of the pink noise filter for white noise of unit standard deviation.
+const pinkNoiseStdDev = 3.0525275463333412
+
+// Returns a function which generates pink (1/f) noise of standard deviation A, by filtering Gaussian white noise
+// with Paul Kellet's refined filter. Each call returns the next sample of the noise, so its spectrum falls at
+// 3 dB per octave from about 1/20000 of the rate at which it is called up to half of that rate. The time t
+// and period T are not used.
+func NewPinkNoise() MathsFunction {
+	return NewPinkNoiseWithRand(nil)
+}
+
+// Returns a function like NewPinkNoise, which draws random numbers from r, or from the global source if r is nil.
+func NewPinkNoiseWithRand(r *rand.Rand) MathsFunction {
+	r = randOrGlobal(r)
+	var b [7]float64 // states of the filter
+	return func(_, A, _ float64) float64 {
+		white := r.NormFloat64()
+		b[0] = 0.99886*b[0] + white*0.0555179
+		b[1] = 0.99332*b[1] + white*0.0750759
+		b[2] = 0.96900*b[2] + white*0.1538520
+		b[3] = 0.86650*b[3] + white*0.3104856
+		b[4] = 0.55000*b[4] + white*0.5329522
+		b[5] = -0.7616*b[5] - white*0.0168980
+		pink := b[0] + b[1] + b[2] + b[3] + b[4] + b[5] + b[6] + white*0.5362
+		b[6] = white * 0.115926
+		return A * pink / pinkNoiseStdDev
+	}
+}
+
+// Returns a function which generates an Ornstein-Uhlenbeck process, noise which wanders slowly and reverts to
+// zero at rate (per second) with volatility (per square root second), scaled by the amplitude A, e.g. for
+// ambient temperature or frequency. Its standard deviation tends to A*volatility/sqrt(2*rate). The process is
+// updated exactly over the elapsed time t since the previous call, so it does not depend on the rate at which
+// it is called, and restarts from zero whenever t decreases, e.g. at the start of each repeat of an anomaly.
+// The period T is not used.
+func NewOrnsteinUhlenbeck(rate, volatility float64) (MathsFunction, error) {
+	return NewOrnsteinUhlenbeckWithRand(nil, rate, volatility)
+}
+
+// Returns a function like NewOrnsteinUhlenbeck, which draws random numbers from r, or from the global
+// source if r is nil.
+func NewOrnsteinUhlenbeckWithRand(r *rand.Rand, rate, volatility float64) (MathsFunction, error) {
+	if rate <= 0 {
+		return nil, errors.New("rate of mean reversion must be positive")
+	}
+	if volatility < 0 {
+		return nil, errors.New("volatility must not be negative")
+	}
+	r = randOrGlobal(r)
+	var x, previousTime float64
+	started := false
+	return func(t, A, _ float64) float64 {
+		if !started || t < previousTime {
+			x, previousTime, started = 0, t, true
+			return 0
+		}
+		decay := math.Exp(-rate * (t - previousTime))
+		x = x*decay + volatility*math.Sqrt((1-decay*decay)/(2*rate))*r.NormFloat64()
+		previousTime = t
+		return A * x
+	}, nil
+}
+
+// Returns an Ornstein-Uhlenbeck process which reverts over a time constant of the period T, with a standard
+// deviation which tends to A, see NewOrnsteinUhlenbeck. Returns zero if T is not positive.
+func newOrnsteinUhlenbeckOverPeriod(r *rand.Rand) MathsFunction {
+	var process MathsFunction
+	var period float64
+	return func(t, A, T float64) float64 {
+		if T <= 0 {
+			return 0
+		}
+		if process == nil || T != period {
+			process, _ = NewOrnsteinUhlenbeckWithRand(r, 1/T, math.Sqrt(2/T))
+			period = T
+		}
+		return process(t, A, T)
+	}
+}
+
+// Returns a function which generates impulses of amplitude A at random times with a mean rate (per second), so
+// that the times between impulses are exponentially distributed, as for Poisson arrivals such as lightning
+// strikes or switching events. Each call returns A times the number of impulses since the previous call at
+// elapsed time t, usually zero or one, so each impulse lasts for one sample. Unlike a spike anomaly, which
+// draws whether to spike at each sample, the arrivals do not depend on the rate at which the function is
+// called. The process restarts whenever t decreases. The period T is not used.
+func NewPoissonImpulses(rate float64) (MathsFunction, error) {
+	return NewPoissonImpulsesWithRand(nil, rate)
+}
+
+// Returns a function like NewPoissonImpulses, which draws random numbers from r, or from the global
+// source if r is nil.
+func NewPoissonImpulsesWithRand(r *rand.Rand, rate float64) (MathsFunction, error) {
+	if rate <= 0 {
+		return nil, errors.New("rate of impulses must be positive")
+	}
+	r = randOrGlobal(r)
+	var nextArrival, previousTime float64
+	started := false
+	return func(t, A, _ float64) float64 {
+		if !started || t < previousTime {
+			nextArrival, started = t+r.ExpFloat64()/rate, true
+		}
+		previousTime = t
+		count := 0
+		for nextArrival <= t {
+			count++
+			nextArrival += r.ExpFloat64() / rate
+		}
+		return A * float64(count)
+	}, nil
+}
+
+// Returns Poisson impulses with a mean of one impulse per period T, see NewPoissonImpulses. Returns zero if T is
+// not positive.
+func newPoissonImpulsesOverPeriod(r *rand.Rand) MathsFunction {
+	var process MathsFunction
+	var period float64
+	return func(t, A, T float64) float64 {
+		if T <= 0 {
+			return 0
+		}
+		if process == nil || T != period {
+			process, _ = NewPoissonImpulsesWithRand(r, 1/T)
+			period = T
+		}
+		return process(t, A, T)
+	}
+}
+
+// Returns a function which generates Weibull noise of scale A and shape k, e.g. wind speeds, whose shape is
+// typically about 2. A shape of 1 is exponential noise. The time t and period T are not used.
+func WeibullNoise(k float64) (MathsFunction, error) {
+	return WeibullNoiseWithRand(nil, k)
+}
+
+// Returns a function like WeibullNoise, which draws random numbers from r, or from the global source if r is nil.
+func WeibullNoiseWithRand(r *rand.Rand, k float64) (MathsFunction, error) {
+	if k <= 0 {
+		return nil, errors.New("shape of Weibull noise must be positive")
+	}
+	r = randOrGlobal(r)
+	return func(_, A, _ float64) float64 {
+		return A * math.Pow(r.ExpFloat64(), 1/k)
+	}, nil
+}
+
+// Returns a function which generates lognormal noise of median A, whose logarithm has standard deviation
+// sigma, e.g. times to insulation breakdown. The time t and period T are not used.
+func LognormalNoise(sigma float64) (MathsFunction, error) {
+	return LognormalNoiseWithRand(nil, sigma)
+}
+
+// Returns a function like LognormalNoise, which draws random numbers from r, or from the global source if r is nil.
+func LognormalNoiseWithRand(r *rand.Rand, sigma float64) (MathsFunction, error) {
+	if sigma < 0 {
+		return nil, errors.New("shape of lognormal noise must not be negative")
+	}
+	r = randOrGlobal(r)
+	return func(_, A, _ float64) float64 {
+		return A * math.Exp(sigma*r.NormFloat64())
+	}, nil
+}
+
+// Returns Weibull noise of scale A and shape 2, see WeibullNoise.
+func newWeibullNoise(r *rand.Rand) MathsFunction {
+	return func(_, A, _ float64) float64 {
+		return A * math.Sqrt(r.ExpFloat64())
+	}
+}
+
+// Returns lognormal noise of median A whose logarithm has standard deviation 1, see LognormalNoise.
+func newLognormalNoise(r *rand.Rand) MathsFunction {
+	return func(_, A, _ float64) float64 {
+		return A * math.Exp(r.NormFloat64())
+	}
+}
+
+// Returns a function which generates autoregressive moving-average (ARMA) noise
+// x[n] = ar[0]*x[n-1] + ... + ar[p-1]*x[n-p] + e[n] + ma[0]*e[n-1] + ... + ma[q-1]*e[n-q], where the innovations e
+// are Gaussian white noise of standard deviation A, so that the autocorrelation of the noise is set precisely
+// by its coefficients, e.g. ar = {0.9} for AR(1) noise with an autocorrelation of 0.9 between samples. Each
+// call returns the next sample of the noise. The autoregressive coefficients must give a stationary process.
+// The time t and period T are not used.
+func NewARMA(ar, ma []float64) (MathsFunction, error) {
+	return NewARMAWithRand(nil, ar, ma)
+}
+
+// Returns a function like NewARMA, which draws random numbers from r, or from the global source if r is nil.
+func NewARMAWithRand(r *rand.Rand, ar, ma []float64) (MathsFunction, error) {
+	if !isStationary(ar) {
+		return nil, errors.New("autoregressive coefficients must give a stationary process")
+	}
+	r = randOrGlobal(r)
+	ar, ma = slices.Clone(ar), slices.Clone(ma)
+	x := make([]float64, len(ar)) // previous outputs, most recent first
+	e := make([]float64, len(ma)) // previous innovations, most recent first
+	return func(_, A, _ float64) float64 {
+		innovation := A * r.NormFloat64()
+		next := innovation
+		for i, c := range ar {
+			next += c * x[i]
+		}
+		for i, c := range ma {
+			next += c * e[i]
+		}
+		if len(x) > 0 {
+			copy(x[1:], x)
+			x[0] = next
+		}
+		if len(e) > 0 {
+			copy(e[1:], e)
+			e[0] = innovation
+		}
+		return next
+	}, nil
+}
+
+// Returns true if the autoregressive coefficients give a stationary process, i.e. the roots of their
+// characteristic polynomial lie outside the unit circle, by checking that every reflection coefficient of the
+// Levinson step-down recursion has magnitude less than one.
+func isStationary(ar []float64) bool {
+	a := make([]float64, len(ar))
+	for i, c := range ar {
+		a[i] = -c
+	}
+	for m := len(a); m > 0; m-- {
+		k := a[m-1]
+		if math.Abs(k) >= 1 {
+			return false
+		}
+		next := make([]float64, m-1)
+		for i := range next {
+			next[i] = (a[i] - k*a[m-2-i]) / (1 - k*k)
+		}
+		a = next
+	}
+	return true
+}
+
+// Returns ARMA noise from a name such as "arma(0.9 -0.2, 0.5)", whose arguments are lists of the autoregressive
+// and moving-average coefficients separated by spaces, either of which may be empty.
+func armaFromArguments(args []string, r *rand.Rand) (MathsFunction, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("takes the autoregressive and moving-average coefficients, not %d arguments", len(args))
+	}
+	var coefficients [2][]float64
+	for i, arg := range args {
+		for _, field := range strings.Fields(arg) {
+			c, err := strconv.ParseFloat(field, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid coefficient %q", field)
+			}
+			coefficients[i] = append(coefficients[i], c)
+		}
+	}
+	return NewARMAWithRand(r, coefficients[0], coefficients[1])
+}
@@ -0,0 +1,125 @@
+package mathfuncs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Behaviours of a piecewise-linear function outside the range of its breakpoints.
+const (
+	OutsideHold = "hold" // holds the value of the first or last breakpoint
+	OutsideWrap = "wrap" // repeats the breakpoints, with a period from the first to the last breakpoint
+	OutsideZero = "zero" // returns zero
+)
+
+// A breakpoint of a piecewise-linear function, at which the function has a value relative to its amplitude.
+type Breakpoint struct {
+	Time  float64 // time in seconds
+	Value float64 // value of the function at Time as a multiple of the amplitude A
+}
+
+// Returns a function y=A*v(t) which interpolates linearly between the values v of breakpoints at increasing
+// times t, e.g. a load profile or a test ramp. The period T is not used. Outside the range of the breakpoints
+// the function behaves as given by outside, which is one of OutsideHold (the default, if empty), OutsideWrap
+// or OutsideZero.
+func PiecewiseLinear(breakpoints []Breakpoint, outside string) (MathsFunction, error) {
+	if err := checkBreakpoints(breakpoints, outside, 1); err != nil {
+		return nil, err
+	}
+
+	points := slices.Clone(breakpoints)
+	return func(t, A, _ float64) float64 {
+		t, ok := timeWithinBreakpoints(points, outside, t)
+		if !ok {
+			return 0
+		}
+		i := segmentOf(points, t)
+		if points[i].Time == t {
+			return A * points[i].Value
+		}
+		p0, p1 := points[i-1], points[i]
+		return A * (p0.Value + (p1.Value-p0.Value)*(t-p0.Time)/(p1.Time-p0.Time))
+	}, nil
+}
+
+// Returns an error if there are fewer than minimum breakpoints, their times are not strictly increasing, or the
+// behaviour outside the breakpoints is unknown.
+func checkBreakpoints(breakpoints []Breakpoint, outside string, minimum int) error {
+	if outside == OutsideWrap {
+		minimum = max(minimum, 2)
+	}
+	if len(breakpoints) < minimum {
+		return fmt.Errorf("number of breakpoints must be at least %d", minimum)
+	}
+	for i := 1; i < len(breakpoints); i++ {
+		if breakpoints[i].Time <= breakpoints[i-1].Time {
+			return errors.New("times of breakpoints must be strictly increasing")
+		}
+	}
+	if outside != "" && outside != OutsideHold && outside != OutsideWrap && outside != OutsideZero {
+		return fmt.Errorf("unknown behaviour outside breakpoints: %s", outside)
+	}
+	return nil
+}
+
+// Returns the time within the range of the breakpoints at which to evaluate a function at time t, given its
+// behaviour outside the breakpoints, or false if the function is zero at t.
+func timeWithinBreakpoints(points []Breakpoint, outside string, t float64) (float64, bool) {
+	first, last := points[0].Time, points[len(points)-1].Time
+	if t >= first && t <= last {
+		return t, true
+	}
+	switch outside {
+	case OutsideWrap:
+		t = first + math.Mod(t-first, last-first)
+		if t < first {
+			t = min(t+last-first, last)
+		}
+		return t, true
+	case OutsideZero:
+		return 0, false
+	}
+	return min(max(t, first), last), true
+}
+
+// Returns the index of the first breakpoint at or after t, which is within the range of the breakpoints.
+func segmentOf(points []Breakpoint, t float64) int {
+	return sort.Search(len(points), func(i int) bool { return points[i].Time >= t })
+}
+
+// Returns a piecewise-linear function from a name such as "piecewise(hold, 0:0, 10:1, 20:0.5)", whose
+// arguments are the behaviour outside the breakpoints followed by breakpoints of the form time:value.
+func piecewiseFromArguments(args []string) (MathsFunction, error) {
+	if len(args) < 2 {
+		return nil, errors.New("takes the behaviour outside the breakpoints and at least one breakpoint")
+	}
+	breakpoints, err := parseBreakpoints(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return PiecewiseLinear(breakpoints, args[0])
+}
+
+// Parses breakpoints of the form time:value.
+func parseBreakpoints(args []string) ([]Breakpoint, error) {
+	breakpoints := make([]Breakpoint, len(args))
+	for i, arg := range args {
+		timeText, valueText, ok := strings.Cut(arg, ":")
+		if !ok {
+			return nil, fmt.Errorf("breakpoint %q must be of the form time:value", arg)
+		}
+		var err error
+		if breakpoints[i].Time, err = strconv.ParseFloat(strings.TrimSpace(timeText), 64); err != nil {
+			return nil, fmt.Errorf("invalid time of breakpoint %q", arg)
+		}
+		if breakpoints[i].Value, err = strconv.ParseFloat(strings.TrimSpace(valueText), 64); err != nil {
+			return nil, fmt.Errorf("invalid value of breakpoint %q", arg)
+		}
+	}
+	return breakpoints, nil
+}
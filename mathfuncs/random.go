@@ -0,0 +1,41 @@
+package mathfuncs
+
+import "math/rand/v2"
+
+// Stochastic functions draw their random numbers from a *rand.Rand given when they are looked up, so that
+// they are reproducible if it is seeded, or from the global source of math/rand/v2 if it is nil.
+
+// Generator of random numbers which draws from the global source of math/rand/v2.
+var globalRand = rand.New(globalSource{})
+
+// Source of random numbers which draws from the global source of math/rand/v2, which is safe for concurrent use.
+type globalSource struct{}
+
+func (globalSource) Uint64() uint64 {
+	return rand.Uint64()
+}
+
+// Returns r, or a generator which draws from the global source if r is nil.
+func randOrGlobal(r *rand.Rand) *rand.Rand {
+	if r == nil {
+		return globalRand
+	}
+	return r
+}
+
+// A source of random numbers which draws from a generator that can be switched between calls, e.g. to the
+// generator of whatever steps a function at each time step, so that stochastic functions which are looked up
+// once with rand.New(source) draw reproducibly from a seeded generator which is only known later. Draws from
+// the global source of math/rand/v2 until a generator is set.
+type SwitchableSource struct {
+	r *rand.Rand
+}
+
+// Sets the generator from which the source draws, nil for the global source.
+func (s *SwitchableSource) Set(r *rand.Rand) {
+	s.r = r
+}
+
+func (s *SwitchableSource) Uint64() uint64 {
+	return randOrGlobal(s.r).Uint64()
+}
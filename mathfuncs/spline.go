@@ -0,0 +1,74 @@
+package mathfuncs
+
+import (
+	"errors"
+	"slices"
+)
+
+// Returns a function y=A*v(t) which interpolates the values v of breakpoints at increasing times t with a
+// natural cubic spline, so that unlike PiecewiseLinear its slope and curvature are continuous between the first
+// and last breakpoints. The period T is not used. Outside the range of the breakpoints the function behaves as
+// given by outside, see PiecewiseLinear; the spline is not periodic, so a wrapped profile is only smooth at the
+// wrap if its first and last breakpoints have the same value and slope.
+func CubicSpline(breakpoints []Breakpoint, outside string) (MathsFunction, error) {
+	if err := checkBreakpoints(breakpoints, outside, 2); err != nil {
+		return nil, err
+	}
+
+	points := slices.Clone(breakpoints)
+	curvatures := splineCurvatures(points)
+	return func(t, A, _ float64) float64 {
+		t, ok := timeWithinBreakpoints(points, outside, t)
+		if !ok {
+			return 0
+		}
+		i := max(segmentOf(points, t), 1)
+		p0, p1 := points[i-1], points[i]
+		m0, m1 := curvatures[i-1], curvatures[i]
+		h := p1.Time - p0.Time
+		a, b := p1.Time-t, t-p0.Time // distances to the ends of the segment
+		v := (m0*a*a*a+m1*b*b*b)/(6*h) + (p0.Value-m0*h*h/6)*a/h + (p1.Value-m1*h*h/6)*b/h
+		return A * v
+	}, nil
+}
+
+// Returns the second derivatives of the natural cubic spline through the breakpoints at each breakpoint, which
+// are zero at the first and last breakpoints, by solving a tridiagonal system with the Thomas algorithm.
+func splineCurvatures(points []Breakpoint) []float64 {
+	n := len(points)
+	curvatures := make([]float64, n)
+	if n < 3 {
+		return curvatures
+	}
+
+	// forward elimination of the equations for the interior breakpoints
+	upper := make([]float64, n) // coefficients of the next curvature after elimination
+	rhs := make([]float64, n)
+	for i := 1; i < n-1; i++ {
+		h0 := points[i].Time - points[i-1].Time
+		h1 := points[i+1].Time - points[i].Time
+		r := 6 * ((points[i+1].Value-points[i].Value)/h1 - (points[i].Value-points[i-1].Value)/h0)
+		diagonal := 2*(h0+h1) - h0*upper[i-1]
+		upper[i] = h1 / diagonal
+		rhs[i] = (r - h0*rhs[i-1]) / diagonal
+	}
+
+	// back substitution
+	for i := n - 2; i >= 1; i-- {
+		curvatures[i] = rhs[i] - upper[i]*curvatures[i+1]
+	}
+	return curvatures
+}
+
+// Returns a cubic spline from a name such as "spline(hold, 0:0, 10:1, 20:0.5)", whose arguments are those of
+// a piecewise-linear function.
+func splineFromArguments(args []string) (MathsFunction, error) {
+	if len(args) < 2 {
+		return nil, errors.New("takes the behaviour outside the breakpoints and at least two breakpoints")
+	}
+	breakpoints, err := parseBreakpoints(args[1:])
+	if err != nil {
+		return nil, err
+	}
+	return CubicSpline(breakpoints, args[0])
+}
@@ -0,0 +1,138 @@
+package emulator
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/synaptecltd/emulator/anomaly"
+	"gopkg.in/yaml.v2"
+)
+
+// CurrentConfigVersion is the version of the configuration schema of this module, which is recorded in the
+// Version field of emulators created by NewEmulator or unmarshalled from yaml. It is shared with anomaly
+// containers and library files, see anomaly.CurrentConfigVersion. Changing the name or structure of a field of
+// an emulator requires incrementing anomaly.CurrentConfigVersion and appending a migration to configMigrations,
+// and to the migrations of anomaly entries, so that existing configuration files still load.
+const CurrentConfigVersion = anomaly.CurrentConfigVersion
+
+// configMigration upgrades a configuration document, unmarshalled from yaml, in place by one version.
+type configMigration func(doc map[string]interface{}) error
+
+// configMigrations[i] upgrades the fields of an emulator in a configuration document from version i+1 to
+// version i+2, so there must be CurrentConfigVersion-1 migrations. Anomaly entries are upgraded by the
+// anomaly package when their containers are unmarshalled.
+var configMigrations []configMigration
+
+var (
+	containerType   = reflect.TypeOf(anomaly.Container{})
+	correlationType = reflect.TypeOf(&anomaly.Correlation{})
+)
+
+// Returns the version to which configuration documents are upgraded, which is CurrentConfigVersion.
+func latestConfigVersion() int {
+	return len(configMigrations) + 1
+}
+
+// Upgrades a configuration document in place from its Version to CurrentConfigVersion. Documents without
+// a Version are version 1. The anomaly containers and correlated anomalies within the document are given the
+// Version of the document, so that their anomaly entries are upgraded from it when they are unmarshalled.
+// Returns an error if the version of the document is not supported by this module.
+func migrateConfig(doc map[string]interface{}) error {
+	version := 1
+	if value, ok := doc["Version"]; ok {
+		v, ok := value.(int)
+		if !ok || v < 1 {
+			return fmt.Errorf("config version must be a positive integer: %v", value)
+		}
+		version = v
+	}
+	latest := latestConfigVersion()
+	if version > latest {
+		return fmt.Errorf("config version %d is newer than the latest supported version %d", version, latest)
+	}
+
+	setEntryVersions(doc, reflect.TypeOf(Emulator{}), version)
+	for v := version; v < latest; v++ {
+		if err := configMigrations[v-1](doc); err != nil {
+			return fmt.Errorf("migrating config from version %d: %w", v, err)
+		}
+	}
+	doc["Version"] = latest
+	return nil
+}
+
+// Sets the Version field of each anomaly container and correlated anomaly within node, the configuration of a
+// value of type t unmarshalled from yaml, to version.
+func setEntryVersions(node interface{}, t reflect.Type, version int) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		value := mapField(node, name)
+		switch {
+		case field.Type == containerType:
+			setMapField(value, "Version", version)
+		case field.Type.Kind() == reflect.Map && field.Type.Elem() == correlationType:
+			if correlations, ok := value.(map[interface{}]interface{}); ok {
+				for _, correlation := range correlations {
+					setMapField(correlation, "Version", version)
+				}
+			}
+		default:
+			setEntryVersions(value, field.Type, version)
+		}
+	}
+}
+
+// Returns the field of m, a map unmarshalled from yaml, with the given key, or nil if m is not a map.
+func mapField(m interface{}, key string) interface{} {
+	switch m := m.(type) {
+	case map[string]interface{}:
+		return m[key]
+	case map[interface{}]interface{}:
+		return m[key]
+	default:
+		return nil
+	}
+}
+
+// Sets the field of m, a map unmarshalled from yaml, with the given key to value, if m is a map.
+func setMapField(m interface{}, key string, value interface{}) {
+	switch m := m.(type) {
+	case map[string]interface{}:
+		m[key] = value
+	case map[interface{}]interface{}:
+		m[key] = value
+	}
+}
+
+// Unmarshals a configuration of any supported version into the fields of the emulator, upgrading it to
+// CurrentConfigVersion first if required.
+func unmarshalMigrated(unmarshal func(interface{}) error, fields interface{}) error {
+	var doc map[string]interface{}
+	if err := unmarshal(&doc); err != nil {
+		return err
+	}
+	if doc == nil {
+		doc = make(map[string]interface{})
+	}
+	if err := migrateConfig(doc); err != nil {
+		return err
+	}
+
+	// The upgraded document differs from the original, so is re-encoded for unmarshalling
+	docYAML, err := yaml.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return yaml.Unmarshal(docYAML, fields)
+}
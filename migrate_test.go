@@ -0,0 +1,88 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that configurations of earlier versions are upgraded by migrations when unmarshalled
+func TestEmulator_ConfigVersion(t *testing.T) {
+	// a hypothetical version 2 which renamed NoiseMax of temperature emulations to NoiseMag
+	defer func(migrations []configMigration) { configMigrations = migrations }(configMigrations)
+	configMigrations = append(configMigrations, func(doc map[string]interface{}) error {
+		if temperature, ok := doc["TemperatureEmulator"].(map[interface{}]interface{}); ok {
+			temperature["NoiseMag"] = temperature["NoiseMax"]
+			delete(temperature, "NoiseMax")
+		}
+		return nil
+	})
+
+	var emu Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte("SamplingRate: 4000\nTemperatureEmulator:\n  MeanTemperature: 20\n  NoiseMax: 0.1\n"), &emu))
+	assert.Equal(t, 0.1, emu.T.NoiseMag)
+	assert.Equal(t, 2, emu.Version)
+
+	assert.NoError(t, migrateConfig(map[string]interface{}{"Version": 2}))
+	for _, version := range []interface{}{3, 0, "1"} {
+		assert.Error(t, migrateConfig(map[string]interface{}{"Version": version}), version)
+	}
+}
+
+// Assert that the migrations of emulators upgrade them to CurrentConfigVersion
+func TestCurrentConfigVersion(t *testing.T) {
+	assert.Equal(t, CurrentConfigVersion, latestConfigVersion())
+}
+
+// Assert that the anomaly containers and correlated anomalies of an emulator are given its version, so that
+// their anomaly entries are upgraded from it
+func TestEmulator_ConfigVersionOfAnomalies(t *testing.T) {
+	var doc map[string]interface{}
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+TimeAnomaly: {}
+VoltageEmulator:
+  PosSeqMagAnomaly: {}
+TemperatureEmulator:
+  Anomaly: {}
+CorrelatedAnomalies:
+  sag: {Type: trend}
+`), &doc))
+	assert.NoError(t, migrateConfig(doc))
+	versionOf := func(path ...string) interface{} {
+		var value interface{} = doc
+		for _, key := range path {
+			value = mapField(value, key)
+		}
+		return mapField(value, "Version")
+	}
+	for _, path := range [][]string{{"TimeAnomaly"}, {"VoltageEmulator", "PosSeqMagAnomaly"}, {"TemperatureEmulator", "Anomaly"}, {"CorrelatedAnomalies", "sag"}} {
+		assert.Equal(t, 1, versionOf(path...), path)
+	}
+
+	var emu Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte(`
+SamplingRate: 4000
+Fnom: 50
+VoltageEmulator:
+  PosSeqMagAnomaly:
+    sag: {Type: trend, Magnitude: -0.1}
+CorrelatedAnomalies:
+  drift:
+    Type: trend
+    Targets: {V.PhaseAMagAnomaly: 1}
+`), &emu))
+	assert.Len(t, emu.V.PosSeqMagAnomaly, 1)
+	assert.Len(t, emu.CorrelatedAnomalies, 1)
+}
+
+// Assert that unmarshalled and new emulators record the current config version
+func TestEmulator_Version(t *testing.T) {
+	var emu Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte("SamplingRate: 4000\nFnom: 50\n"), &emu))
+	assert.Equal(t, CurrentConfigVersion, emu.Version)
+	assert.Equal(t, 4000, emu.SamplingRate)
+	assert.Equal(t, CurrentConfigVersion, NewEmulator(4000, 50).Version)
+
+	assert.Error(t, yaml.Unmarshal([]byte("Version: 99\nSamplingRate: 4000\n"), &emu))
+}
@@ -0,0 +1,131 @@
+package emulator
+
+import (
+	"errors"
+	"math/rand/v2"
+
+	"github.com/synaptecltd/emulator/mathfuncs"
+)
+
+// AmplitudeModulation periodically modulates the positive sequence magnitude of a three phase emulation,
+// e.g. due to nearby cyclic loads. Unlike anomalies, modulation is a steady-state property of the signal
+// which applies for the whole emulation. The modulation waveform is evaluated with an amplitude of Depth
+// and a period of 1/Frequency, and scales the magnitude by one plus its value.
+type AmplitudeModulation struct {
+	frequency        float64 // modulation frequency in Hz
+	Depth            float64 // modulation depth in pu of PosSeqMag, e.g. 0.05 for a modulation of +/-5%
+	waveformFuncName string  // name of the function giving the modulation waveform, defaults to "sine" if empty
+
+	// internal state
+	waveformFunction mathfuncs.MathsFunction // returns the modulation for a given elapsed time; set internally from waveformFuncName
+	elapsedIndex     int                     // number of time steps since the start of the emulation
+
+	// random numbers of a stochastic waveform
+	funcSource *mathfuncs.SwitchableSource // source of the random numbers of waveformFunction, switched to the random number generator of each time step
+}
+
+// Parameters used to request an amplitude modulation. These map onto the fields of AmplitudeModulation.
+type ModulationParams struct {
+	Frequency        float64 `yaml:"Frequency"` // modulation frequency in Hz, must be greater than 0
+	Depth            float64 `yaml:"Depth"`     // modulation depth in pu of PosSeqMag, e.g. 0.05 for a modulation of +/-5%
+	WaveformFuncName string  `yaml:"Waveform"`  // name of the function giving the modulation waveform, defaults to "sine" if empty
+}
+
+// Initialise the internal fields of AmplitudeModulation when it is unmarshalled from yaml.
+func (m *AmplitudeModulation) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var params ModulationParams
+	if err := unmarshal(&params); err != nil {
+		return err
+	}
+
+	// This performs checking for invalid values
+	modulation, err := NewAmplitudeModulation(params)
+	if err != nil {
+		return err
+	}
+
+	// Copy fields to m
+	*m = *modulation
+
+	return nil
+}
+
+// Returns the parameters of AmplitudeModulation when it is marshalled to yaml.
+func (m *AmplitudeModulation) MarshalYAML() (interface{}, error) {
+	return m.GetParams(), nil
+}
+
+// Returns an AmplitudeModulation pointer with the requested parameters, checking for invalid values.
+func NewAmplitudeModulation(params ModulationParams) (*AmplitudeModulation, error) {
+	modulation := &AmplitudeModulation{}
+
+	// Invalid values checked by setters
+	if err := modulation.SetFrequency(params.Frequency); err != nil {
+		return nil, err
+	}
+	if err := modulation.SetWaveformFunctionByName(params.WaveformFuncName); err != nil {
+		return nil, err
+	}
+
+	// Fields that can never be invalid set directly
+	modulation.Depth = params.Depth
+
+	return modulation, nil
+}
+
+// Returns the factor by which the magnitude is scaled this time step, and steps the modulation forward by Ts.
+// A stochastic waveform draws its random numbers from r.
+func (m *AmplitudeModulation) stepFactor(r *rand.Rand, Ts float64) float64 {
+	if m.funcSource != nil {
+		m.funcSource.Set(r)
+	}
+	t := float64(m.elapsedIndex) * Ts
+	m.elapsedIndex += 1
+	return 1 + m.waveformFunction(t, m.Depth, 1/m.frequency)
+}
+
+// Setters
+
+// Sets the modulation frequency in Hz if frequency > 0.
+func (m *AmplitudeModulation) SetFrequency(frequency float64) error {
+	if frequency <= 0 {
+		return errors.New("modulation frequency must be greater than 0")
+	}
+	m.frequency = frequency
+	return nil
+}
+
+// Sets the function giving the modulation waveform by name, defaulting to "sine".
+func (m *AmplitudeModulation) SetWaveformFunctionByName(name string) error {
+	if name == "" {
+		name = "sine" // default to sinusoidal modulation if no name is provided
+	}
+	source := &mathfuncs.SwitchableSource{}
+	waveformFunc, err := mathfuncs.GetTrendFunctionWithRand(name, rand.New(source))
+	if err != nil {
+		return err
+	}
+	m.waveformFunction = waveformFunc
+	m.funcSource = source
+	m.waveformFuncName = name
+	return nil
+}
+
+// Getters
+
+// Returns the parameters which define AmplitudeModulation, such that NewAmplitudeModulation returns an identical modulation.
+func (m *AmplitudeModulation) GetParams() ModulationParams {
+	return ModulationParams{
+		Frequency:        m.frequency,
+		Depth:            m.Depth,
+		WaveformFuncName: m.waveformFuncName,
+	}
+}
+
+func (m *AmplitudeModulation) GetFrequency() float64 {
+	return m.frequency
+}
+
+func (m *AmplitudeModulation) GetWaveformFuncName() string {
+	return m.waveformFuncName
+}
@@ -0,0 +1,47 @@
+package emulator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that invalid modulation parameters are rejected
+func TestNewAmplitudeModulation_InvalidParams(t *testing.T) {
+	_, err := NewAmplitudeModulation(ModulationParams{Frequency: 0})
+	assert.Error(t, err)
+
+	_, err = NewAmplitudeModulation(ModulationParams{Frequency: 1, WaveformFuncName: "not_a_function"})
+	assert.Error(t, err)
+
+	modulation, err := NewAmplitudeModulation(ModulationParams{Frequency: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, "sine", modulation.GetWaveformFuncName())
+}
+
+// Assert that the envelope of a modulated three phase emulation follows the modulation waveform
+func TestAmplitudeModulation_Envelope(t *testing.T) {
+	yamlStr := `
+PosSeqMag: 1000
+Modulation:
+  Frequency: 5
+  Depth: 0.1
+`
+	var modulated ThreePhaseEmulation
+	err := yaml.Unmarshal([]byte(yamlStr), &modulated)
+	assert.NoError(t, err)
+
+	emulator := NewEmulator(4000, 50.0)
+	emulator.V = &modulated
+	emulator.I = &ThreePhaseEmulation{PosSeqMag: 1000}
+
+	for i := 0; i < 4000; i++ {
+		emulator.Step()
+		if math.Abs(emulator.I.A) > 100 {
+			envelope := 1 + 0.1*math.Sin(2*math.Pi*5*float64(i)/4000)
+			assert.InDelta(t, envelope, emulator.V.A/emulator.I.A, 1e-3)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"math"
+
+	"github.com/synaptecltd/emulator/anomaly"
+)
+
+// OutageWindow is a scheduled period, e.g. planned maintenance, during which the selected emulations
+// produce no valid data. Anomalies of affected emulations are paused for the duration of the outage.
+type OutageWindow struct {
+	Start    float64  `yaml:"Start"`                   // time of the start of the outage since the start of the emulation in seconds
+	Duration float64  `yaml:"Duration"`                // duration of the outage in seconds
+	Channels []string `yaml:"Channels,flow,omitempty"` // emulations affected by the outage: "V", "I" and/or "T", empty for all
+	Flatline bool     `yaml:"Flatline,omitempty"`      // true: outputs hold their last values and are flagged invalid, false: outputs are NaN
+}
+
+// Returns an error if the outage window has invalid values.
+func (o *OutageWindow) validate() error {
+	if o.Start < 0 {
+		return errors.New("outage start must be greater than or equal to 0")
+	}
+	if o.Duration <= 0 {
+		return errors.New("outage duration must be greater than 0")
+	}
+	for _, channel := range o.Channels {
+		if channel != "V" && channel != "I" && channel != "T" {
+			return fmt.Errorf("unknown outage channel: %s", channel)
+		}
+	}
+	return nil
+}
+
+// Returns whether the outage affects the given emulation ("V", "I" or "T") at time t in seconds.
+func (o *OutageWindow) affects(channel string, t float64) bool {
+	if t < o.Start || t >= o.Start+o.Duration {
+		return false
+	}
+	if len(o.Channels) == 0 {
+		return true
+	}
+	for _, c := range o.Channels {
+		if c == channel {
+			return true
+		}
+	}
+	return false
+}
+
+// Adds an outage window to the emulator, checking for invalid values.
+func (e *Emulator) AddOutage(outage OutageWindow) error {
+	if err := outage.validate(); err != nil {
+		return err
+	}
+	e.Outages = append(e.Outages, outage)
+	return nil
+}
+
+// Returns the outage affecting the given emulation ("V", "I" or "T") at the present sample, or nil if there is none.
+func (e *Emulator) getActiveOutage(channel string) *OutageWindow {
+	for i := range e.Outages {
+		if e.Outages[i].affects(channel, e.elapsedTime) {
+			return &e.Outages[i]
+		}
+	}
+	return nil
+}
+
+// Steps the three phase emulation forward by one time step during an outage. The phase angle continues
+// to advance, but anomalies are not stepped and the outputs are marked as invalid.
+func (e *ThreePhaseEmulation) stepOutage(f float64, Ts float64, flatline bool) {
+	e.pAngle = wrapAngle(f*2*math.Pi*Ts + e.pAngle)
+	e.frequency = f
+	e.elapsedTime += Ts
+
+	if flatline {
+		e.Quality = anomaly.QualityInvalid
+		return
+	}
+	e.Quality = anomaly.QualityMissing
+	e.A, e.B, e.C = math.NaN(), math.NaN(), math.NaN()
+}
+
+// Steps the temperature emulation forward by one time step during an outage. Anomalies are not
+// stepped and the output is marked as invalid.
+func (t *TemperatureEmulation) stepOutage(flatline bool) {
+	if flatline {
+		t.Quality = anomaly.QualityInvalid
+		return
+	}
+	t.Quality = anomaly.QualityMissing
+	t.T = math.NaN()
+}
@@ -0,0 +1,82 @@
+package emulator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/synaptecltd/emulator/anomaly"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that invalid outage windows are rejected
+func TestAddOutage_InvalidParams(t *testing.T) {
+	emulator := NewEmulator(10, 50.0)
+	assert.Error(t, emulator.AddOutage(OutageWindow{Start: -1, Duration: 1}))
+	assert.Error(t, emulator.AddOutage(OutageWindow{Start: 0, Duration: 0}))
+	assert.Error(t, emulator.AddOutage(OutageWindow{Start: 0, Duration: 1, Channels: []string{"X"}}))
+	assert.NoError(t, emulator.AddOutage(OutageWindow{Start: 0, Duration: 1, Channels: []string{"I"}}))
+	assert.Len(t, emulator.Outages, 1)
+}
+
+// Assert that outputs of the selected emulations are missing during an outage, and their anomalies are paused
+func TestOutage_Missing(t *testing.T) {
+	trendAnomaly, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Magnitude: 1.0, Duration: 10})
+	assert.NoError(t, err)
+
+	emulator := NewEmulator(10, 50.0)
+	emulator.I = &ThreePhaseEmulation{
+		PosSeqMag:        500.0,
+		PosSeqMagAnomaly: anomaly.Container{anomalyKey: trendAnomaly},
+	}
+	emulator.T = &TemperatureEmulation{MeanTemperature: 20.0}
+	assert.NoError(t, emulator.AddOutage(OutageWindow{Start: 1, Duration: 2, Channels: []string{"I"}}))
+
+	for i := 0; i < 40; i++ {
+		emulator.Step()
+		inOutage := i >= 10 && i < 30
+		assert.Equal(t, inOutage, math.IsNaN(emulator.I.A))
+		assert.False(t, math.IsNaN(emulator.T.T))
+		if inOutage {
+			assert.Equal(t, anomaly.QualityMissing, emulator.I.Quality)
+		} else {
+			assert.Equal(t, anomaly.QualityGood, emulator.I.Quality)
+		}
+	}
+
+	// the anomaly was only stepped outside of the outage
+	assert.Equal(t, 20, trendAnomaly.GetElapsedActivatedIndex())
+}
+
+// Assert that flatlined outputs hold their last values and are flagged invalid during an outage defined in yaml
+func TestOutage_Flatline(t *testing.T) {
+	yamlStr := `
+SamplingRate: 10
+Fnom: 50
+TemperatureEmulator:
+  MeanTemperature: 20
+  NoiseMag: 0.01
+Outages:
+  - Start: 1
+    Duration: 1
+    Flatline: true
+`
+	var emulator Emulator
+	err := yaml.Unmarshal([]byte(yamlStr), &emulator)
+	assert.NoError(t, err)
+
+	var held float64
+	for i := 0; i < 20; i++ {
+		emulator.Step()
+		if i == 9 {
+			held = emulator.T.T
+		}
+		if i >= 10 {
+			assert.Equal(t, held, emulator.T.T)
+			assert.Equal(t, anomaly.QualityInvalid, emulator.T.Quality)
+		}
+	}
+
+	err = yaml.Unmarshal([]byte("Outages:\n  - Start: 1\n"), &emulator)
+	assert.Error(t, err)
+}
@@ -0,0 +1,93 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// SagSwell is a voltage sag (dip) or swell, during which the voltage of the affected phases is scaled to a
+// percentage of its value without the event. The event initiates at a point on wave once its start time has
+// passed, and lasts for a number of cycles of the emulated frequency.
+type SagSwell struct {
+	Start           float64 `yaml:"Start"`                 // time since the start of the emulation after which the event initiates, in seconds
+	RetainedVoltage float64 `yaml:"RetainedVoltage"`       // voltage during the event as a percentage, e.g. 70 for a sag to 70% or 120 for a swell
+	DurationCycles  float64 `yaml:"DurationCycles"`        // duration of the event in cycles
+	Phases          string  `yaml:"Phases,omitempty"`      // affected phases, e.g. "A" or "BC", defaults to "ABC" if empty
+	PointOnWave     float64 `yaml:"PointOnWave,omitempty"` // angle of phase A in degrees at which the event initiates, e.g. 0 at a positive-going zero crossing or 90 at the positive peak
+
+	// internal state
+	started bool    // whether the event has initiated
+	endTime float64 // time at which the event ends, in seconds
+}
+
+// Returns an error if the sag or swell has invalid values.
+func (s *SagSwell) validate() error {
+	if s.Start < 0 {
+		return errors.New("sag/swell start must be greater than or equal to 0")
+	}
+	if s.RetainedVoltage < 0 {
+		return errors.New("retained voltage must be greater than or equal to 0")
+	}
+	if s.DurationCycles <= 0 {
+		return errors.New("sag/swell duration must be greater than 0")
+	}
+	for _, phase := range s.Phases {
+		if phase != 'A' && phase != 'B' && phase != 'C' {
+			return fmt.Errorf("unknown sag/swell phase: %c", phase)
+		}
+	}
+	return nil
+}
+
+// Returns whether the event affects the given phase: 'A', 'B' or 'C'.
+func (s *SagSwell) affects(phase rune) bool {
+	return s.Phases == "" || strings.ContainsRune(s.Phases, phase)
+}
+
+// Returns whether the event is active at time t, given the angle of phase A in radians and the frequency f in the
+// present time step of duration Ts, initiating the event when phase A passes its point on wave.
+func (s *SagSwell) step(t float64, angle float64, f float64, Ts float64) bool {
+	if !s.started {
+		if t < s.Start {
+			return false
+		}
+		if !passedPointOnWave(angle, s.PointOnWave, f, Ts) {
+			return false
+		}
+		s.started = true
+		s.endTime = t + s.DurationCycles/f
+	}
+	return t < s.endTime
+}
+
+// Adds a sag or swell to the emulation, checking for invalid values.
+func (e *ThreePhaseEmulation) AddSagSwell(sagSwell SagSwell) error {
+	if err := sagSwell.validate(); err != nil {
+		return err
+	}
+	e.SagSwells = append(e.SagSwells, sagSwell)
+	return nil
+}
+
+// Returns the factors by which the voltage of each phase is scaled by sags and swells at the present time step.
+func (e *ThreePhaseEmulation) stepSagSwells(angle float64, Ts float64) (float64, float64, float64) {
+	scaleA, scaleB, scaleC := 1.0, 1.0, 1.0
+	for i := range e.SagSwells {
+		s := &e.SagSwells[i]
+		if !s.step(e.elapsedTime, angle, e.frequency, Ts) {
+			continue
+		}
+		retained := s.RetainedVoltage / 100
+		if s.affects('A') {
+			scaleA *= retained
+		}
+		if s.affects('B') {
+			scaleB *= retained
+		}
+		if s.affects('C') {
+			scaleC *= retained
+		}
+	}
+	return scaleA, scaleB, scaleC
+}
@@ -0,0 +1,52 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that a sag scales only its affected phases, initiating at its point on wave for its duration in cycles
+func TestSagSwell_Sag(t *testing.T) {
+	yamlStr := `
+PosSeqMag: 1000
+SagSwells:
+  - Start: 0.1
+    RetainedVoltage: 50
+    DurationCycles: 5
+    Phases: A
+    PointOnWave: 90
+`
+	var sagged ThreePhaseEmulation
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &sagged))
+	assert.NoError(t, sagged.Validate())
+
+	emu := NewEmulator(4000, 50.0)
+	emu.V = &sagged
+	reference := NewEmulator(4000, 50.0)
+	reference.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+
+	first, last := -1, -1
+	for i := 0; i < 1200; i++ {
+		emu.Step()
+		reference.Step()
+		assert.InDelta(t, reference.V.B, emu.V.B, 1e-9)
+		assert.InDelta(t, reference.V.C, emu.V.C, 1e-9)
+		if emu.V.A != reference.V.A {
+			assert.InDelta(t, reference.V.A*0.5, emu.V.A, 1e-9)
+			if first < 0 {
+				first = i
+			}
+			last = i
+		}
+	}
+
+	// phase A first passes 90 degrees after 0.1 s at sample 419, and the sag lasts for 5 cycles of 80 samples
+	assert.Equal(t, 419, first)
+	assert.InDelta(t, 419+400-1, last, 1)
+
+	assert.Error(t, emu.V.AddSagSwell(SagSwell{RetainedVoltage: 120, DurationCycles: 0}))
+	assert.Error(t, emu.V.AddSagSwell(SagSwell{RetainedVoltage: 120, DurationCycles: 1, Phases: "AD"}))
+	assert.NoError(t, emu.V.AddSagSwell(SagSwell{RetainedVoltage: 120, DurationCycles: 1}))
+}
@@ -0,0 +1,97 @@
+package emulator
+
+import (
+	"errors"
+	"math"
+)
+
+// DefaultShutdownDuration is the duration of the decay of a shutdown triggered by StartEvent(PowerDown)
+// if the emulator has no Shutdown sequence, in seconds
+const DefaultShutdownDuration = 1.0
+
+// ShutdownSequence emulates a device powering down, mirroring SoftStart, so that recordings can cover the
+// full lifecycle of a device. Once the shutdown begins, the voltage and current outputs decay linearly to
+// zero over Duration while their noise increases, after which all emulations drop out, outputting NaN
+// marked as missing, until the end of the run. A shutdown begins at Start, at the end of the run if AtEnd
+// is set, or when triggered with StartEvent(PowerDown).
+type ShutdownSequence struct {
+	Start         float64 `yaml:"Start,omitempty"`         // time of the start of the shutdown since the start of the emulation in seconds, 0 if not scheduled
+	Duration      float64 `yaml:"Duration"`                // time over which the outputs decay before dropping out in seconds, must be greater than 0
+	NoiseIncrease float64 `yaml:"NoiseIncrease,omitempty"` // increase of noise magnitude at the end of the decay, in the same units as NoiseMag
+	AtEnd         bool    `yaml:"AtEnd,omitempty"`         // true: the shutdown is scheduled by Run so that the final sample of the run has dropped out
+
+	triggered bool // whether the shutdown has been triggered by StartEvent or scheduled by Run
+}
+
+// powerState is the power-on or power-down behaviour of the emulated device in a time step.
+type powerState struct {
+	gain          float64 // gain applied to the voltage and current outputs
+	noiseIncrease float64 // increase of noise magnitude of the voltage and current outputs
+	off           bool    // whether the device has powered down, so that all outputs drop out
+}
+
+// Returns an error if the shutdown sequence has invalid values.
+func (s *ShutdownSequence) validate() error {
+	if s.Start < 0 {
+		return errors.New("shutdown start must be greater than or equal to 0")
+	}
+	if s.Duration <= 0 {
+		return errors.New("shutdown duration must be greater than 0")
+	}
+	if s.NoiseIncrease < 0 {
+		return errors.New("shutdown noise increase must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// Returns the progress of the shutdown at the sample with the given index, from 0 at its start to 1 at the
+// end of the decay, and whether the shutdown has begun. Times are rounded to whole samples, so that the
+// dropout is not delayed by rounding errors.
+func (s *ShutdownSequence) progress(sampleIndex uint64, Ts float64) (float64, bool) {
+	start := math.Round(s.Start / Ts)
+	if (s.Start == 0 && !s.triggered) || float64(sampleIndex) < start {
+		return 0, false
+	}
+	return (float64(sampleIndex) - start) / max(1, math.Round(s.Duration/Ts)), true
+}
+
+// Begins the shutdown sequence of the emulator at the next time step, with a default sequence if it has none.
+func (e *Emulator) triggerShutdown() {
+	if e.Shutdown == nil {
+		e.Shutdown = &ShutdownSequence{Duration: DefaultShutdownDuration}
+	}
+	if _, begun := e.Shutdown.progress(e.SampleIndex, e.Ts); begun {
+		return
+	}
+	e.Shutdown.Start = float64(e.SampleIndex) / float64(e.SamplingRate)
+	e.Shutdown.triggered = true
+}
+
+// Schedules a shutdown sequence with AtEnd set so that the last of the given number of samples, counting
+// from the present sample, has dropped out. Shutdowns which are already scheduled are unaffected.
+func (e *Emulator) scheduleShutdownAtEnd(samples int) {
+	if e.Shutdown == nil || !e.Shutdown.AtEnd || e.Shutdown.Start != 0 || e.Shutdown.triggered || samples == 0 {
+		return
+	}
+	end := float64(e.SampleIndex+uint64(samples)-1) / float64(e.SamplingRate)
+	e.Shutdown.Start = max(0, end-e.Shutdown.Duration)
+	e.Shutdown.triggered = true
+}
+
+// Returns the power-on or power-down behaviour of the emulated device at the present time step, which
+// ramps up during the soft-start period and decays during a shutdown.
+func (e *Emulator) powerState() powerState {
+	power := powerState{gain: 1.0}
+	if e.elapsedTime < e.SoftStart {
+		power.gain = e.elapsedTime / e.SoftStart
+	}
+	if e.Shutdown == nil {
+		return power
+	}
+	if progress, begun := e.Shutdown.progress(e.SampleIndex, e.Ts); begun {
+		power.gain *= max(0, 1-progress)
+		power.noiseIncrease = min(1, progress) * e.Shutdown.NoiseIncrease
+		power.off = progress >= 1
+	}
+	return power
+}
@@ -0,0 +1,94 @@
+package emulator
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/synaptecltd/emulator/anomaly"
+	"gopkg.in/yaml.v2"
+)
+
+// Returns an emulator with voltage and temperature emulations and the given shutdown sequence.
+func createShutdownEmulator(shutdown *ShutdownSequence) *Emulator {
+	emu := NewEmulator(4000, 50.0)
+	emu.SetRandomSeed(1)
+	emu.Shutdown = shutdown
+	emu.V = &ThreePhaseEmulation{PosSeqMag: 1000}
+	emu.T = &TemperatureEmulation{MeanTemperature: 20.0}
+	return emu
+}
+
+// Assert that voltage outputs decay over a scheduled shutdown, after which all outputs drop out
+func TestShutdown_Scheduled(t *testing.T) {
+	reference := createShutdownEmulator(nil)
+	emu := createShutdownEmulator(&ShutdownSequence{Start: 0.05, Duration: 0.025})
+
+	for i := 0; i < 400; i++ {
+		reference.Step()
+		emu.Step()
+		switch {
+		case i < 200:
+			assert.Equal(t, reference.V.A, emu.V.A)
+		case i < 300:
+			gain := 1 - float64(i-200)/100
+			assert.InDelta(t, reference.V.A*gain, emu.V.A, 1e-9)
+			assert.Equal(t, reference.T.T, emu.T.T)
+		default:
+			assert.True(t, math.IsNaN(emu.V.A))
+			assert.True(t, math.IsNaN(emu.T.T))
+			assert.Equal(t, anomaly.QualityMissing, emu.V.Quality)
+			assert.Equal(t, anomaly.QualityMissing, emu.T.Quality)
+		}
+	}
+}
+
+// Assert that a shutdown can be triggered as an event, and that noise increases as the outputs decay
+func TestShutdown_PowerDownEvent(t *testing.T) {
+	quiet := createShutdownEmulator(&ShutdownSequence{Duration: 0.1})
+	noisy := createShutdownEmulator(&ShutdownSequence{Duration: 0.1, NoiseIncrease: 0.01})
+	for i := 0; i < 100; i++ {
+		quiet.Step()
+		noisy.Step()
+		assert.Equal(t, quiet.V.A, noisy.V.A)
+	}
+
+	quiet.StartEvent(EventParams{Type: PowerDown})
+	noisy.StartEvent(EventParams{Type: PowerDown})
+	assert.Equal(t, 0.025, noisy.Shutdown.Start)
+	var earlyNoise, lateNoise float64
+	for i := 0; i <= 400; i++ {
+		quiet.Step()
+		noisy.Step()
+		if i < 100 {
+			earlyNoise += math.Abs(noisy.V.A - quiet.V.A)
+		} else if i < 300 {
+			lateNoise += math.Abs(noisy.V.A - quiet.V.A)
+		}
+	}
+	assert.Greater(t, lateNoise/2, earlyNoise)
+	assert.True(t, math.IsNaN(noisy.V.A))
+
+	// a default shutdown sequence is used if none is configured
+	emu := createShutdownEmulator(nil)
+	emu.StartEvent(EventParams{Type: PowerDown})
+	assert.Equal(t, DefaultShutdownDuration, emu.Shutdown.Duration)
+}
+
+// Assert that a shutdown at the end of a run drops out the final sample of the run
+func TestShutdown_AtEnd(t *testing.T) {
+	emu := createShutdownEmulator(&ShutdownSequence{Duration: 0.01, AtEnd: true})
+	buffer, err := NewRingBuffer(400)
+	assert.NoError(t, err)
+	assert.NoError(t, emu.Run(400, buffer))
+
+	values, err := buffer.AppendChannel(nil, ChannelVA)
+	assert.NoError(t, err)
+	assert.Len(t, values, 400)
+	assert.True(t, math.IsNaN(values[399]))
+	assert.False(t, math.IsNaN(values[358]))
+	assert.InDelta(t, 0.08975, emu.Shutdown.Start, 1e-9)
+
+	var invalid Emulator
+	assert.Error(t, yaml.Unmarshal([]byte("SamplingRate: 4000\nShutdown:\n  Duration: 0\n"), &invalid))
+}
@@ -1,6 +1,7 @@
 package emulator
 
 import (
+	"math"
 	"math/rand/v2"
 
 	"github.com/google/uuid"
@@ -8,19 +9,58 @@ import (
 )
 
 type TemperatureEmulation struct {
-	MeanTemperature float64           `yaml:"MeanTemperature"` // mean temperature
-	NoiseMag        float64           `yaml:"NoiseMag"`        // magnitude of Gaussian noise
-	Anomaly         anomaly.Container `yaml:"Anomaly"`         // anomalies
-	T               float64           `yaml:"-"`               // present value of temperature
+	MeanTemperature    float64           `yaml:"MeanTemperature"`              // mean temperature
+	NoiseMag           float64           `yaml:"NoiseMag"`                     // magnitude of Gaussian noise
+	Anomaly            anomaly.Container `yaml:"Anomaly"`                      // anomalies
+	MaxAnomalySlewRate float64           `yaml:"MaxAnomalySlewRate,omitempty"` // maximum rate of change of the total delta of all anomalies per second, 0 for unlimited
+	Aging              *AgingProfile     `yaml:"Aging,omitempty"`              // long-term degradation of the sensor, optional
+	T                  float64           `yaml:"-"`                            // present value of temperature
+	Quality            anomaly.Quality   `yaml:"-"`                            // quality of the present value of temperature, marked by invalid data anomalies
+
+	anomalyDelta       float64 // total delta of all anomalies in the latest time step, after slew rate limiting
+	magnitudesResolved bool    // whether anomaly magnitudes specified as a percentage of MeanTemperature have been resolved
 }
 
 // Steps the temperature emulation forward by one time step. The new temperature is
-// calculated as the mean temperature + Gaussian noise + anomalies (if present).
+// calculated as the mean temperature + Gaussian noise + anomalies (if present), scaled by any
+// sensor aging gain error, or NaN if an invalid data anomaly or aging dropout marks the value as missing.
+// The previous value is repeated if an anomaly holds the sample.
 func (t *TemperatureEmulation) stepTemperature(r *rand.Rand, Ts float64) {
-	t.T = t.MeanTemperature + r.NormFloat64()*t.NoiseMag*t.MeanTemperature
+	// anomalies specified as a percentage of MeanTemperature are resolved on the first step
+	if !t.magnitudesResolved {
+		t.Anomaly.ResolveMagnitudes(t.MeanTemperature)
+		t.magnitudesResolved = true
+	}
+
+	// sensor aging
+	noiseMag := t.NoiseMag
+	gain := 1.0
+	dropout := false
+	if t.Aging != nil {
+		level := t.Aging.stepLevel(r, Ts)
+		noiseMag += level * t.Aging.NoiseIncrease
+		gain += level * t.Aging.Drift
+		dropout = r.Float64() < level*t.Aging.dropoutProbability
+	}
+
+	temperature := t.MeanTemperature + r.NormFloat64()*noiseMag*t.MeanTemperature
+
+	anomalyValues := t.Anomaly.StepAllBlend(r, Ts, temperature) - temperature
+	t.anomalyDelta = anomaly.LimitSlew(t.anomalyDelta, anomalyValues, t.MaxAnomalySlewRate, Ts)
+	temperature += t.anomalyDelta
+
+	// the output repeats the previous sample if held by any anomaly, e.g. undersampling
+	if !t.Anomaly.GetHold() {
+		t.T = temperature * gain
+	}
 
-	anomalyValues := t.Anomaly.StepAll(r, Ts)
-	t.T += anomalyValues
+	t.Quality = t.Anomaly.GetQuality()
+	if dropout {
+		t.Quality = anomaly.QualityMissing
+	}
+	if t.Quality == anomaly.QualityMissing {
+		t.T = math.NaN()
+	}
 }
 
 // Add an anomaly to the temperature emulation, returning the UUID of the added anomaly.
@@ -6,50 +6,95 @@ import (
 
 	"github.com/stevenblair/sigourney/fast"
 	"github.com/synaptecltd/emulator/anomaly"
+	"github.com/synaptecltd/emulator/mathfuncs"
 )
 
 const TwoPiOverThree = 2 * math.Pi / 3
 
 type ThreePhaseEmulation struct {
 	// inputs
-	PosSeqMag       float64   `yaml:"PosSeqMag,omitempty"`            // positive sequence magnitude
-	PhaseOffset     float64   `yaml:"PhaseOffset,omitempty"`          // phase offset
-	NegSeqMag       float64   `yaml:"NegSeqMag,omitempty"`            // negative sequence magnitude
-	NegSeqAng       float64   `yaml:"NegSeqAng,omitempty"`            // negative sequence angle
-	ZeroSeqMag      float64   `yaml:"ZeroSeqMag,omitempty"`           // zero sequence magnitude
-	ZeroSeqAng      float64   `yaml:"ZeroSeqAng,omitempty"`           // zero sequence angle
-	HarmonicNumbers []float64 `yaml:"HarmonicNumbers,flow,omitempty"` // harmonic numbers
-	HarmonicMags    []float64 `yaml:"HarmonicMags,flow,omitempty"`    // harmonic magnitudes in pu, relative to PosSeqMag
-	HarmonicAngs    []float64 `yaml:"HarmonicAngs,flow,omitempty"`    // harmonic angles
-	NoiseMag        float64   `yaml:"NoiseMag,omitempty"`             // magnitude of Gaussian noise
+	PosSeqMag          float64   `yaml:"PosSeqMag,omitempty"`               // positive sequence magnitude
+	PhaseOffset        float64   `yaml:"PhaseOffset,omitempty"`             // phase offset
+	NegSeqMag          float64   `yaml:"NegSeqMag,omitempty"`               // negative sequence magnitude
+	NegSeqAng          float64   `yaml:"NegSeqAng,omitempty"`               // negative sequence angle
+	ZeroSeqMag         float64   `yaml:"ZeroSeqMag,omitempty"`              // zero sequence magnitude
+	ZeroSeqAng         float64   `yaml:"ZeroSeqAng,omitempty"`              // zero sequence angle
+	HarmonicNumbers    []float64 `yaml:"HarmonicNumbers,flow,omitempty"`    // harmonic numbers
+	HarmonicMags       []float64 `yaml:"HarmonicMags,flow,omitempty"`       // harmonic magnitudes in pu, relative to PosSeqMag
+	HarmonicAngs       []float64 `yaml:"HarmonicAngs,flow,omitempty"`       // harmonic angles
+	HarmonicMagFuncs   []string  `yaml:"HarmonicMagFuncs,flow,omitempty"`   // names of functions which vary each harmonic magnitude over time, empty for a constant magnitude, optional
+	HarmonicMagPeriods []float64 `yaml:"HarmonicMagPeriods,flow,omitempty"` // periods in seconds of the functions in HarmonicMagFuncs
+	NoiseMag           float64   `yaml:"NoiseMag,omitempty"`                // magnitude of Gaussian noise
+	PhaseJitter        float64   `yaml:"PhaseJitter,omitempty"`             // standard deviation of Gaussian phase jitter in radians, independent per phase and sample
+	PhaseMagOffsets    []float64 `yaml:"PhaseMagOffsets,flow,omitempty"`    // static unbalance of the fundamental magnitudes of phases A, B and C in pu, relative to their balanced magnitudes, e.g. [0, 0, 0.02]
+	PhaseAngOffsets    []float64 `yaml:"PhaseAngOffsets,flow,omitempty"`    // static unbalance of the angles of phases A, B and C in radians
 
 	// define anomalies
-	PosSeqMagAnomaly anomaly.Container `yaml:"PosSeqMagAnomaly,omitempty"` // positive sequence magnitude anomalies
-	PosSeqAngAnomaly anomaly.Container `yaml:"PosSeqAngAnomaly,omitempty"` // positive sequence angle anomalies
-	PhaseAMagAnomaly anomaly.Container `yaml:"PhaseAMagAnomaly,omitempty"` // phase A magnitude anomalies
-	FreqAnomaly      anomaly.Container `yaml:"FreqAnomaly,omitempty"`      // frequency anomalies
-	HarmonicsAnomaly anomaly.Container `yaml:"HarmonicsAnomaly,omitempty"` // harmonics anomalies
+	PosSeqMagAnomaly   anomaly.Container `yaml:"PosSeqMagAnomaly,omitempty"`   // positive sequence magnitude anomalies
+	PosSeqAngAnomaly   anomaly.Container `yaml:"PosSeqAngAnomaly,omitempty"`   // positive sequence angle anomalies
+	PhaseAMagAnomaly   anomaly.Container `yaml:"PhaseAMagAnomaly,omitempty"`   // phase A magnitude anomalies
+	FreqAnomaly        anomaly.Container `yaml:"FreqAnomaly,omitempty"`        // frequency anomalies
+	HarmonicsAnomaly   anomaly.Container `yaml:"HarmonicsAnomaly,omitempty"`   // harmonics anomalies
+	WiringAnomaly      anomaly.Container `yaml:"WiringAnomaly,omitempty"`      // wiring anomalies, e.g. phase swaps
+	MaxAnomalySlewRate float64           `yaml:"MaxAnomalySlewRate,omitempty"` // maximum rate of change of the total delta of PosSeqMagAnomaly and of PhaseAMagAnomaly in units per second, 0 for unlimited
+
+	Aging      *AgingProfile        `yaml:"Aging,omitempty"`      // long-term degradation of the sensor, optional
+	Modulation *AmplitudeModulation `yaml:"Modulation,omitempty"` // steady-state modulation of PosSeqMag, e.g. due to nearby cyclic loads, optional
+	Flicker    *Flicker             `yaml:"Flicker,omitempty"`    // rectangular fluctuations of PosSeqMag giving a target flicker severity, optional
+
+	SagSwells []SagSwell `yaml:"SagSwells,omitempty"` // voltage sags and swells, see AddSagSwell
+
+	FaultXR          float64 `yaml:"FaultXR,omitempty"`          // X/R ratio of the system, which gives emulated faults a decaying DC offset, 0 for none
+	FaultPointOnWave float64 `yaml:"FaultPointOnWave,omitempty"` // angle of phase A in degrees at which emulated faults initiate if FaultXR is set
+
+	CTSaturation *CTSaturation `yaml:"CTSaturation,omitempty"` // saturation of the current transformer of a current emulation, optional
 
 	// event emulation
-	faultPhaseAMag        float64
-	faultPosSeqMag        float64
-	faultRemainingSamples int
+	faultStages       []faultStage // remaining stages of the present event, the first of which is in progress
+	faultStageSamples int          // number of samples of the stage in progress which have elapsed
+	faultPrevious     faultStage   // the previous stage of the present event, if any
+	faultInitiated    bool         // whether the present event has initiated at its point on wave
+	faultDCOffsets    [3]float64   // present DC offsets of phases A, B and C
 
 	// internal state, state change
 	pAngle            float64
 	posSeqMagNew      float64
 	posSeqMagRampRate float64
 
+	elapsedTime           float64 // time of the present time step since the start of the emulation, in seconds
+	frequency             float64 // emulated frequency in the latest time step, including frequency anomalies
+	posSeqMagAnomalyDelta float64 // total delta of PosSeqMagAnomaly in the latest time step, after slew rate limiting
+	phaseAMagAnomalyDelta float64 // total delta of PhaseAMagAnomaly in the latest time step, after slew rate limiting
+
+	magnitudesResolved bool                        // whether anomaly magnitudes specified as a percentage of PosSeqMag have been resolved
+	harmonicInjections []anomaly.HarmonicInjection // harmonics injected by HarmonicsAnomaly this time step, reused between steps
+
+	// time-varying harmonic magnitudes
+	harmonicMagFunctions []mathfuncs.MathsFunction   // functions of HarmonicMagFuncs, nil for a constant magnitude; set internally on the first step
+	harmonicFuncSource   *mathfuncs.SwitchableSource // source of the random numbers of harmonicMagFunctions, switched to the random number generator of each time step
+
 	// outputs
-	A, B, C float64 `yaml:"-"`
+	A, B, C float64         `yaml:"-"`
+	Quality anomaly.Quality `yaml:"-"` // quality of the present outputs, marked by invalid data anomalies
 }
 
 // Steps the three phase emulation forward by one time step. The new values are
 // defined based on magntiudes, noise values, anomalies and fault conditions.
-func (e *ThreePhaseEmulation) stepThreePhase(r *rand.Rand, f float64, Ts float64) {
+// The outputs are scaled, and their noise increased, by the power-on or power-down state of the device.
+func (e *ThreePhaseEmulation) stepThreePhase(r *rand.Rand, f float64, Ts float64, power powerState) {
+	// magnitude anomalies specified as a percentage of PosSeqMag are resolved on the first step
+	if !e.magnitudesResolved {
+		e.PosSeqMagAnomaly.ResolveMagnitudes(e.PosSeqMag)
+		e.PhaseAMagAnomaly.ResolveMagnitudes(e.PosSeqMag)
+		e.magnitudesResolved = true
+	}
+	if e.harmonicMagFunctions == nil && len(e.HarmonicMagFuncs) > 0 {
+		e.resolveHarmonicMagFunctions()
+	}
+
 	// frequency anomaly
-	totalAnomalyDeltaFrequency := e.FreqAnomaly.StepAll(r, Ts)
-	freqTotal := f + totalAnomalyDeltaFrequency
+	freqTotal := e.FreqAnomaly.StepAllBlend(r, Ts, f)
+	e.frequency = freqTotal
 
 	angle := (freqTotal*2*math.Pi*Ts + e.pAngle)
 	angle = wrapAngle(angle)
@@ -60,69 +105,207 @@ func (e *ThreePhaseEmulation) stepThreePhase(r *rand.Rand, f float64, Ts float64
 
 	PosSeqPhase := e.PhaseOffset + e.pAngle + (math.Pi * totalAnomalyDeltaPosSeqAng / 180.0)
 
+	// phase jitter, e.g. due to oscillator or sampling phase noise, is uncorrelated across phases
+	phaseA, phaseB, phaseC := PosSeqPhase, PosSeqPhase, PosSeqPhase
+	if e.PhaseJitter > 0 {
+		phaseA += r.NormFloat64() * e.PhaseJitter
+		phaseB += r.NormFloat64() * e.PhaseJitter
+		phaseC += r.NormFloat64() * e.PhaseJitter
+	}
+
+	// static per-phase unbalance, in addition to the sequence components
+	if len(e.PhaseAngOffsets) == 3 {
+		phaseA += e.PhaseAngOffsets[0]
+		phaseB += e.PhaseAngOffsets[1]
+		phaseC += e.PhaseAngOffsets[2]
+	}
+	magA, magB, magC := 1.0, 1.0, 1.0
+	if len(e.PhaseMagOffsets) == 3 {
+		magA += e.PhaseMagOffsets[0]
+		magB += e.PhaseMagOffsets[1]
+		magC += e.PhaseMagOffsets[2]
+	}
+
 	if math.Abs(e.posSeqMagNew-e.PosSeqMag) >= math.Abs(e.posSeqMagRampRate) {
 		e.PosSeqMag = e.PosSeqMag + e.posSeqMagRampRate
 	}
 
 	posSeqMag := e.PosSeqMag
-	// phaseAMag := e.PosSeqMag
-	if /*smpCnt > EmulatedFaultStartSamples && */ e.faultRemainingSamples > 0 {
-		posSeqMag = posSeqMag + e.faultPosSeqMag
-		e.faultRemainingSamples--
+	if e.Modulation != nil {
+		posSeqMag *= e.Modulation.stepFactor(r, Ts)
 	}
+	if e.Flicker != nil {
+		posSeqMag *= e.Flicker.stepFactor(Ts)
+	}
+	// emulated faults and other events
+	faultA, faultB, faultC := e.stepFault(PosSeqPhase, phaseA, phaseB, phaseC, Ts)
 
 	// positive sequence magnitude anomaly
-	totalAnomalyDeltaPosSeqMag := e.PosSeqMagAnomaly.StepAll(r, Ts)
-	posSeqMag += totalAnomalyDeltaPosSeqMag
+	totalAnomalyDeltaPosSeqMag := e.PosSeqMagAnomaly.StepAllBlend(r, Ts, posSeqMag) - posSeqMag
+	e.posSeqMagAnomalyDelta = anomaly.LimitSlew(e.posSeqMagAnomalyDelta, totalAnomalyDeltaPosSeqMag, e.MaxAnomalySlewRate, Ts)
+	posSeqMag += e.posSeqMagAnomalyDelta
 
 	// phase A magnitude anomaly
-	anomalyPhaseA := e.PhaseAMagAnomaly.StepAll(r, Ts)
+	anomalyPhaseA := e.PhaseAMagAnomaly.StepAllBlend(r, Ts, posSeqMag) - posSeqMag
+	e.phaseAMagAnomalyDelta = anomaly.LimitSlew(e.phaseAMagAnomalyDelta, anomalyPhaseA, e.MaxAnomalySlewRate, Ts)
+	anomalyPhaseA = e.phaseAMagAnomalyDelta
+
+	// sags and swells
+	scaleA, scaleB, scaleC := e.stepSagSwells(PosSeqPhase, Ts)
 
 	// positive sequence
-	a1 := fast.Sin(PosSeqPhase) * (posSeqMag + anomalyPhaseA)
-	b1 := fast.Sin(PosSeqPhase-TwoPiOverThree) * posSeqMag
-	c1 := fast.Sin(PosSeqPhase+TwoPiOverThree) * posSeqMag
+	a1 := fast.Sin(phaseA) * (posSeqMag + anomalyPhaseA)
+	b1 := fast.Sin(phaseB-TwoPiOverThree) * posSeqMag
+	c1 := fast.Sin(phaseC+TwoPiOverThree) * posSeqMag
 
 	// negative sequence
-	a2 := fast.Sin(PosSeqPhase+e.NegSeqAng) * e.NegSeqMag * e.PosSeqMag
-	b2 := fast.Sin(PosSeqPhase+TwoPiOverThree+e.NegSeqAng) * e.NegSeqMag * e.PosSeqMag
-	c2 := fast.Sin(PosSeqPhase-TwoPiOverThree+e.NegSeqAng) * e.NegSeqMag * e.PosSeqMag
+	a2 := fast.Sin(phaseA+e.NegSeqAng) * e.NegSeqMag * e.PosSeqMag
+	b2 := fast.Sin(phaseB+TwoPiOverThree+e.NegSeqAng) * e.NegSeqMag * e.PosSeqMag
+	c2 := fast.Sin(phaseC-TwoPiOverThree+e.NegSeqAng) * e.NegSeqMag * e.PosSeqMag
 
 	// zero sequence
-	abc0 := fast.Sin(PosSeqPhase+e.ZeroSeqAng) * e.ZeroSeqMag * e.PosSeqMag
+	a0 := fast.Sin(phaseA+e.ZeroSeqAng) * e.ZeroSeqMag * e.PosSeqMag
+	b0 := fast.Sin(phaseB+e.ZeroSeqAng) * e.ZeroSeqMag * e.PosSeqMag
+	c0 := fast.Sin(phaseC+e.ZeroSeqAng) * e.ZeroSeqMag * e.PosSeqMag
 
 	// harmonics
 	ah := 0.0
 	bh := 0.0
 	ch := 0.0
+	if e.harmonicFuncSource != nil {
+		e.harmonicFuncSource.Set(r)
+	}
 	if len(e.HarmonicNumbers) > 0 {
 		// ensure consistent array sizes have been specified
 		if len(e.HarmonicNumbers) == len(e.HarmonicMags) && len(e.HarmonicNumbers) == len(e.HarmonicAngs) {
 			for i, n := range e.HarmonicNumbers {
-				mag := e.HarmonicMags[i] * e.PosSeqMag
+				mag := e.harmonicMag(i, e.elapsedTime) * e.PosSeqMag
 				ang := e.HarmonicAngs[i] // / 180.0 * math.Pi
 
-				ah = ah + fast.Sin(n*(PosSeqPhase)+ang)*mag
-				bh = bh + fast.Sin(n*(PosSeqPhase-TwoPiOverThree)+ang)*mag
-				ch = ch + fast.Sin(n*(PosSeqPhase+TwoPiOverThree)+ang)*mag
+				ah = ah + fast.Sin(n*(phaseA)+ang)*mag
+				bh = bh + fast.Sin(n*(phaseB-TwoPiOverThree)+ang)*mag
+				ch = ch + fast.Sin(n*(phaseC+TwoPiOverThree)+ang)*mag
 			}
 		}
 	}
 
-	harmonicsScale := e.HarmonicsAnomaly.StepAll(r, Ts)
-	ah = ah * (1 + harmonicsScale)
-	bh = bh * (1 + harmonicsScale)
-	ch = ch * (1 + harmonicsScale)
+	harmonicsScale, injections := e.HarmonicsAnomaly.StepAllHarmonics(r, Ts, 1, e.harmonicInjections[:0])
+	e.harmonicInjections = injections
+	ah = ah * harmonicsScale
+	bh = bh * harmonicsScale
+	ch = ch * harmonicsScale
+
+	// harmonics injected by anomalies are not affected by the harmonics scale factor
+	for _, h := range injections {
+		mag := h.Magnitude * e.PosSeqMag
+
+		ah = ah + fast.Sin(h.Order*(phaseA)+h.Angle)*mag
+		bh = bh + fast.Sin(h.Order*(phaseB-TwoPiOverThree)+h.Angle)*mag
+		ch = ch + fast.Sin(h.Order*(phaseC+TwoPiOverThree)+h.Angle)*mag
+	}
+
+	// sensor aging
+	noiseMag := e.NoiseMag + power.noiseIncrease
+	gain := 1.0
+	dropout := false
+	if e.Aging != nil {
+		level := e.Aging.stepLevel(r, Ts)
+		noiseMag += level * e.Aging.NoiseIncrease
+		gain += level * e.Aging.Drift
+		dropout = r.Float64() < level*e.Aging.dropoutProbability
+	}
+	gain *= power.gain
 
 	// add noise, ensure worst case where noise is uncorrelated across phases
-	ra := r.NormFloat64() * e.NoiseMag * e.PosSeqMag
-	rb := r.NormFloat64() * e.NoiseMag * e.PosSeqMag
-	rc := r.NormFloat64() * e.NoiseMag * e.PosSeqMag
-
-	// combine the output for each phase
-	e.A = a1 + a2 + abc0 + ah + ra
-	e.B = b1 + b2 + abc0 + bh + rb
-	e.C = c1 + c2 + abc0 + ch + rc
+	ra := r.NormFloat64() * noiseMag * e.PosSeqMag
+	rb := r.NormFloat64() * noiseMag * e.PosSeqMag
+	rc := r.NormFloat64() * noiseMag * e.PosSeqMag
+
+	// wiring anomalies
+	order := e.WiringAnomaly.StepAllPhaseOrder(r, Ts)
+
+	// outputs repeat the previous sample if held by any anomaly, e.g. undersampling
+	hold := e.FreqAnomaly.GetHold() ||
+		e.PosSeqAngAnomaly.GetHold() ||
+		e.PosSeqMagAnomaly.GetHold() ||
+		e.PhaseAMagAnomaly.GetHold() ||
+		e.HarmonicsAnomaly.GetHold() ||
+		e.WiringAnomaly.GetHold()
+
+	// primary values of each phase, distorted by CT saturation, which steps even while the outputs are held
+	pa := ((a1+a2+a0)*magA+ah)*scaleA + faultA
+	pb := ((b1+b2+b0)*magB+bh)*scaleB + faultB
+	pc := ((c1+c2+c0)*magC+ch)*scaleC + faultC
+	if e.CTSaturation != nil {
+		pa, pb, pc = e.CTSaturation.step(pa, pb, pc, e.frequency, Ts)
+	}
+
+	if !hold {
+		// combine the output for each phase
+		e.A = (pa + ra) * gain
+		e.B = (pb + rb) * gain
+		e.C = (pc + rc) * gain
+
+		// reassign phases to outputs, e.g. due to wiring errors
+		if order != [3]int{0, 1, 2} {
+			phases := [3]float64{e.A, e.B, e.C}
+			e.A, e.B, e.C = phases[order[0]], phases[order[1]], phases[order[2]]
+		}
+	}
+
+	// mark the outputs with the worst quality of any anomaly
+	e.Quality = max(
+		e.FreqAnomaly.GetQuality(),
+		e.PosSeqAngAnomaly.GetQuality(),
+		e.PosSeqMagAnomaly.GetQuality(),
+		e.PhaseAMagAnomaly.GetQuality(),
+		e.HarmonicsAnomaly.GetQuality(),
+		e.WiringAnomaly.GetQuality(),
+	)
+	if dropout {
+		e.Quality = anomaly.QualityMissing
+	}
+	if e.Quality == anomaly.QualityMissing {
+		e.A, e.B, e.C = math.NaN(), math.NaN(), math.NaN()
+	}
+
+	e.elapsedTime += Ts
+}
+
+// Looks up the functions of HarmonicMagFuncs, which draw their random numbers from harmonicFuncSource. Functions
+// which are not found, as reported by Validate, leave their harmonic magnitudes constant.
+func (e *ThreePhaseEmulation) resolveHarmonicMagFunctions() {
+	e.harmonicFuncSource = &mathfuncs.SwitchableSource{}
+	r := rand.New(e.harmonicFuncSource)
+	e.harmonicMagFunctions = make([]mathfuncs.MathsFunction, len(e.HarmonicMagFuncs))
+	for i, name := range e.HarmonicMagFuncs {
+		if name == "" || i >= len(e.HarmonicMagPeriods) || e.HarmonicMagPeriods[i] <= 0 {
+			continue
+		}
+		e.harmonicMagFunctions[i], _ = mathfuncs.GetTrendFunctionWithRand(name, r)
+	}
+}
+
+// Returns the magnitude in pu of harmonic i at elapsed time t. A time-varying magnitude is HarmonicMags[i] plus
+// the value of its function evaluated with an amplitude of HarmonicMags[i], limited to be non-negative.
+func (e *ThreePhaseEmulation) harmonicMag(i int, t float64) float64 {
+	mag := e.HarmonicMags[i]
+	if i < len(e.harmonicMagFunctions) && e.harmonicMagFunctions[i] != nil {
+		mag = max(0, mag+e.harmonicMagFunctions[i](t, mag, e.HarmonicMagPeriods[i]))
+	}
+	return mag
+}
+
+// Returns whether an angle in radians has passed pointOnWave, in degrees, within the latest time step Ts at
+// frequency f. Angles within a small tolerance before the point on wave have passed it, so that rounding errors
+// of the angle cannot skip over the point on wave between time steps.
+func passedPointOnWave(angle float64, pointOnWave float64, f float64, Ts float64) bool {
+	const tolerance = 1e-6 // degrees
+	sincePointOnWave := math.Mod(angle*180/math.Pi-pointOnWave+tolerance, 360)
+	if sincePointOnWave < 0 {
+		sincePointOnWave += 360
+	}
+	return sincePointOnWave < 360*f*Ts
 }
 
 // Wraps the angle a to the range -pi to pi
@@ -0,0 +1,192 @@
+package emulator
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+)
+
+// Kinds of threshold events
+const (
+	ThresholdRaised  = "raise" // the alarm of a threshold detector was raised
+	ThresholdCleared = "clear" // the alarm of a threshold detector was cleared
+)
+
+// ThresholdDetector raises an alarm when an output channel crosses a threshold, emulating devices which
+// report alarms rather than raw data. Once raised, the alarm clears when the channel returns past the
+// threshold by more than Hysteresis. Both raising and clearing require the condition to persist for
+// Debounce seconds, so that noise around the threshold does not cause repeated alarms.
+type ThresholdDetector struct {
+	Name       string  `yaml:"Name"`                 // name of the detector, reported in its events
+	Channel    string  `yaml:"Channel"`              // name of the monitored output channel, e.g. ChannelT
+	Threshold  float64 `yaml:"Threshold"`            // value above which the alarm is raised, or below if Below is set
+	Below      bool    `yaml:"Below,omitempty"`      // true: alarm raised below Threshold, false: alarm raised above Threshold
+	Hysteresis float64 `yaml:"Hysteresis,omitempty"` // distance the channel must return past Threshold for the alarm to clear
+	Debounce   float64 `yaml:"Debounce,omitempty"`   // time in seconds for which a crossing must persist before the alarm is raised or cleared
+
+	// internal state
+	raised  bool // whether the alarm is raised
+	pending int  // number of consecutive time steps for which the alarm should change state
+}
+
+// ThresholdEvent records the alarm of a threshold detector being raised or cleared.
+type ThresholdEvent struct {
+	Detector    string  // name of the detector
+	Channel     string  // name of the monitored output channel
+	Kind        string  // ThresholdRaised or ThresholdCleared
+	SampleIndex uint64  // index of the sample at which the alarm changed state, since the start of the emulation
+	ElapsedTime float64 // nominal time of the sample since the start of the emulation, in seconds
+	Value       float64 // value of the channel at the sample
+}
+
+// Returns an error if the threshold detector has invalid values.
+func (d *ThresholdDetector) validate() error {
+	if !slices.Contains([]string{ChannelVA, ChannelVB, ChannelVC, ChannelIA, ChannelIB, ChannelIC, ChannelT}, d.Channel) {
+		return fmt.Errorf("unknown threshold channel: %s", d.Channel)
+	}
+	if d.Hysteresis < 0 {
+		return errors.New("threshold hysteresis must be greater than or equal to 0")
+	}
+	if d.Debounce < 0 {
+		return errors.New("threshold debounce must be greater than or equal to 0")
+	}
+	return nil
+}
+
+// Returns whether the alarm should change state given the present value of the channel.
+func (d *ThresholdDetector) shouldChange(value float64) bool {
+	if math.IsNaN(value) {
+		return false
+	}
+	switch {
+	case !d.raised && !d.Below:
+		return value > d.Threshold
+	case !d.raised && d.Below:
+		return value < d.Threshold
+	case d.raised && !d.Below:
+		return value < d.Threshold-d.Hysteresis
+	default:
+		return value > d.Threshold+d.Hysteresis
+	}
+}
+
+// Steps the detector with the present value of its channel, and returns whether its alarm changed state.
+func (d *ThresholdDetector) step(value float64, Ts float64) bool {
+	if !d.shouldChange(value) {
+		d.pending = 0
+		return false
+	}
+	d.pending += 1
+	if d.pending < max(1, int(math.Round(d.Debounce/Ts))) {
+		return false
+	}
+	d.pending = 0
+	d.raised = !d.raised
+	return true
+}
+
+// Returns whether the alarm of the detector is raised.
+func (d *ThresholdDetector) IsRaised() bool {
+	return d.raised
+}
+
+// Adds a threshold detector to the emulator, checking for invalid values.
+func (e *Emulator) AddThresholdDetector(detector *ThresholdDetector) error {
+	if err := detector.validate(); err != nil {
+		return err
+	}
+	e.Thresholds = append(e.Thresholds, detector)
+	return nil
+}
+
+// Returns the present value of the named output channel, or NaN if its emulation is not initialised.
+func (e *Emulator) channelValue(name string) float64 {
+	switch {
+	case e.V != nil && name == ChannelVA:
+		return e.V.A
+	case e.V != nil && name == ChannelVB:
+		return e.V.B
+	case e.V != nil && name == ChannelVC:
+		return e.V.C
+	case e.I != nil && name == ChannelIA:
+		return e.I.A
+	case e.I != nil && name == ChannelIB:
+		return e.I.B
+	case e.I != nil && name == ChannelIC:
+		return e.I.C
+	case e.T != nil && name == ChannelT:
+		return e.T.T
+	}
+	return math.NaN()
+}
+
+// Steps all threshold detectors with the present outputs, replacing ThresholdEvents with the events of this time step.
+func (e *Emulator) stepThresholds() {
+	e.ThresholdEvents = e.ThresholdEvents[:0]
+	for _, detector := range e.Thresholds {
+		value := e.channelValue(detector.Channel)
+		if !detector.step(value, e.EffectiveTs) {
+			continue
+		}
+		kind := ThresholdCleared
+		if detector.raised {
+			kind = ThresholdRaised
+		}
+		e.ThresholdEvents = append(e.ThresholdEvents, ThresholdEvent{
+			Detector:    detector.Name,
+			Channel:     detector.Channel,
+			Kind:        kind,
+			SampleIndex: e.SampleIndex,
+			ElapsedTime: e.elapsedTime,
+			Value:       value,
+		})
+	}
+}
+
+// ThresholdEventWriter streams the threshold events of an emulator to an io.Writer as comma-separated
+// values, with a header row followed by one row per event. Use it alongside a writer of samples with
+// NewMultiWriter to emit alarms as a separate stream.
+type ThresholdEventWriter struct {
+	w             *bufio.Writer
+	headerWritten bool
+	line          []byte // formatted row for the present event, reused between events
+}
+
+// Returns a ThresholdEventWriter which writes to w.
+func NewThresholdEventWriter(w io.Writer) *ThresholdEventWriter {
+	return &ThresholdEventWriter{w: bufio.NewWriter(w)}
+}
+
+// Writes the threshold events of the present time step, preceded by the header on the first call.
+func (t *ThresholdEventWriter) WriteSample(e *Emulator) error {
+	if !t.headerWritten {
+		if _, err := t.w.WriteString("SampleIndex,ElapsedTime,Detector,Channel,Kind,Value\n"); err != nil {
+			return err
+		}
+		t.headerWritten = true
+	}
+
+	for _, event := range e.ThresholdEvents {
+		t.line = strconv.AppendUint(t.line[:0], event.SampleIndex, 10)
+		t.line = append(t.line, ',')
+		t.line = strconv.AppendFloat(t.line, event.ElapsedTime, 'g', -1, 64)
+		t.line = append(t.line, ',')
+		t.line = appendCSVField(t.line, event.Detector)
+		t.line = fmt.Appendf(t.line, ",%s,%s,", event.Channel, event.Kind)
+		t.line = strconv.AppendFloat(t.line, event.Value, 'g', -1, 64)
+		t.line = append(t.line, '\n')
+		if _, err := t.w.Write(t.line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Writes any buffered rows to the underlying writer.
+func (t *ThresholdEventWriter) Flush() error {
+	return t.w.Flush()
+}
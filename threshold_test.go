@@ -0,0 +1,80 @@
+package emulator
+
+import (
+	"bytes"
+	"encoding/csv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that invalid threshold detectors are rejected
+func TestAddThresholdDetector_InvalidParams(t *testing.T) {
+	emulator := NewEmulator(10, 50.0)
+	assert.Error(t, emulator.AddThresholdDetector(&ThresholdDetector{Channel: "X"}))
+	assert.Error(t, emulator.AddThresholdDetector(&ThresholdDetector{Channel: ChannelT, Hysteresis: -1}))
+	assert.Error(t, emulator.AddThresholdDetector(&ThresholdDetector{Channel: ChannelT, Debounce: -1}))
+	assert.NoError(t, emulator.AddThresholdDetector(&ThresholdDetector{Channel: ChannelT}))
+	assert.Len(t, emulator.Thresholds, 1)
+}
+
+// Assert that threshold alarms are raised and cleared with hysteresis and debounce
+func TestThresholdDetector_Events(t *testing.T) {
+	yamlStr := `
+SamplingRate: 10
+Fnom: 50
+TemperatureEmulator:
+  MeanTemperature: 20
+Thresholds:
+  - Name: overtemperature
+    Channel: T
+    Threshold: 25
+    Hysteresis: 2
+    Debounce: 0.2
+`
+	var emulator Emulator
+	assert.NoError(t, yaml.Unmarshal([]byte(yamlStr), &emulator))
+
+	// noise free, so the output tracks the mean
+	temperatures := []float64{20, 26, 20, 26, 26, 24, 24, 22, 22, 22}
+	var events []ThresholdEvent
+	for _, temperature := range temperatures {
+		emulator.T.MeanTemperature = temperature
+		emulator.Step()
+		events = append(events, emulator.ThresholdEvents...)
+	}
+
+	// a single sample above the threshold is debounced, and the alarm does not clear within the hysteresis band
+	assert.Equal(t, []ThresholdEvent{
+		{Detector: "overtemperature", Channel: ChannelT, Kind: ThresholdRaised, SampleIndex: 4, ElapsedTime: 0.4, Value: 26},
+		{Detector: "overtemperature", Channel: ChannelT, Kind: ThresholdCleared, SampleIndex: 8, ElapsedTime: 0.8, Value: 22},
+	}, events)
+	assert.False(t, emulator.Thresholds[0].IsRaised())
+}
+
+// Assert that threshold events can be written as a separate stream alongside samples
+func TestThresholdEventWriter(t *testing.T) {
+	emulator := NewEmulator(10, 50.0)
+	emulator.T = &TemperatureEmulation{MeanTemperature: 30}
+	assert.NoError(t, emulator.AddThresholdDetector(&ThresholdDetector{Name: "low", Channel: ChannelT, Threshold: 40, Below: true}))
+
+	var samples, events bytes.Buffer
+	err := emulator.Run(5, NewMultiWriter(NewCSVWriter(&samples), NewThresholdEventWriter(&events)))
+	assert.NoError(t, err)
+
+	assert.Len(t, strings.Split(strings.TrimSpace(stripComments(samples.String())), "\n"), 6)
+	assert.Equal(t, "SampleIndex,ElapsedTime,Detector,Channel,Kind,Value\n0,0,low,T,raise,30\n", events.String())
+
+	// names containing commas, quotes or line breaks are quoted, so that they are read back as a single field
+	emulator = NewEmulator(10, 50.0)
+	emulator.T = &TemperatureEmulation{MeanTemperature: 30}
+	name := "low, \"cold\"\n1,2"
+	assert.NoError(t, emulator.AddThresholdDetector(&ThresholdDetector{Name: name, Channel: ChannelT, Threshold: 40, Below: true}))
+	events.Reset()
+	assert.NoError(t, emulator.Run(1, NewThresholdEventWriter(&events)))
+	records, err := csv.NewReader(&events).ReadAll()
+	assert.NoError(t, err)
+	assert.Equal(t, [][]string{{"SampleIndex", "ElapsedTime", "Detector", "Channel", "Kind", "Value"}, {"0", "0", name, "T", "raise", "30"}}, records)
+}
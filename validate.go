@@ -0,0 +1,137 @@
+package emulator
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/synaptecltd/emulator/anomaly"
+	"github.com/synaptecltd/emulator/mathfuncs"
+)
+
+// Validate returns every problem with the configuration of the emulator and its emulations, as
+// anomaly.FieldErrors joined by errors.Join, or nil if there are none. Paths of fields within emulations
+// are prefixed by "V", "I" or "T", e.g. "V.PosSeqMagAnomaly.drift.Duration". Unlike unmarshalling, which
+// stops at the first invalid emulation, all problems are reported at once.
+func (e *Emulator) Validate() error {
+	var errs []error
+	check := func(path string, err error) {
+		errs = append(errs, anomaly.FieldErrors(path, err)...)
+	}
+
+	if e.SamplingRate <= 0 && e.Ts <= 0 {
+		check("SamplingRate", errors.New("sampling rate must be greater than 0"))
+	}
+	if (e.V != nil || e.I != nil) && e.Fnom <= 0 {
+		check("Fnom", errors.New("nominal frequency must be greater than 0"))
+	}
+	if e.SamplesPerCycle < 0 {
+		check("SamplesPerCycle", errors.New("samples per cycle must be greater than or equal to 0"))
+	}
+	if e.SoftStart < 0 {
+		check("SoftStart", errors.New("soft start must be greater than or equal to 0"))
+	}
+	if e.Shutdown != nil {
+		check("Shutdown", e.Shutdown.validate())
+	}
+	for i := range e.Outages {
+		check(fmt.Sprintf("Outages[%d]", i), e.Outages[i].validate())
+	}
+	for i := range e.Events {
+		check(fmt.Sprintf("Events[%d]", i), e.Events[i].validate())
+	}
+	for i, detector := range e.Thresholds {
+		check(fmt.Sprintf("Thresholds[%d]", i), detector.validate())
+	}
+
+	check("TimeAnomaly", e.TimeAnomaly.Validate())
+	if e.V != nil {
+		check("V", e.V.Validate())
+	}
+	if e.I != nil {
+		check("I", e.I.Validate())
+	}
+	if e.T != nil {
+		check("T", e.T.Validate())
+	}
+	return errors.Join(errs...)
+}
+
+// Validate returns every problem with the configuration of the emulation and its anomaly containers, as
+// anomaly.FieldErrors joined by errors.Join, or nil if there are none.
+func (e *ThreePhaseEmulation) Validate() error {
+	var errs []error
+	check := func(path string, err error) {
+		errs = append(errs, anomaly.FieldErrors(path, err)...)
+	}
+
+	// harmonics are ignored unless their numbers, magnitudes and angles have equal lengths
+	if len(e.HarmonicMags) != len(e.HarmonicNumbers) {
+		check("HarmonicMags", fmt.Errorf("%d harmonic magnitudes given for %d harmonic numbers", len(e.HarmonicMags), len(e.HarmonicNumbers)))
+	}
+	if len(e.HarmonicAngs) != len(e.HarmonicNumbers) {
+		check("HarmonicAngs", fmt.Errorf("%d harmonic angles given for %d harmonic numbers", len(e.HarmonicAngs), len(e.HarmonicNumbers)))
+	}
+	if len(e.HarmonicMagFuncs) != 0 && len(e.HarmonicMagFuncs) != len(e.HarmonicNumbers) {
+		check("HarmonicMagFuncs", fmt.Errorf("%d harmonic magnitude functions given for %d harmonic numbers", len(e.HarmonicMagFuncs), len(e.HarmonicNumbers)))
+	}
+	for i, name := range e.HarmonicMagFuncs {
+		if name == "" {
+			continue
+		}
+		if _, err := mathfuncs.GetTrendFunctionFromName(name); err != nil {
+			check(fmt.Sprintf("HarmonicMagFuncs[%d]", i), err)
+		}
+		if i >= len(e.HarmonicMagPeriods) || e.HarmonicMagPeriods[i] <= 0 {
+			check(fmt.Sprintf("HarmonicMagPeriods[%d]", i), errors.New("period of harmonic magnitude function must be greater than 0"))
+		}
+	}
+	if e.NoiseMag < 0 {
+		check("NoiseMag", errors.New("noise magnitude must be greater than or equal to 0"))
+	}
+	if e.PhaseJitter < 0 {
+		check("PhaseJitter", errors.New("phase jitter must be greater than or equal to 0"))
+	}
+	// per-phase unbalance is ignored unless given for all three phases
+	if len(e.PhaseMagOffsets) != 0 && len(e.PhaseMagOffsets) != 3 {
+		check("PhaseMagOffsets", fmt.Errorf("%d phase magnitude offsets given, instead of 3", len(e.PhaseMagOffsets)))
+	}
+	for i, offset := range e.PhaseMagOffsets {
+		if offset < -1 {
+			check(fmt.Sprintf("PhaseMagOffsets[%d]", i), errors.New("phase magnitude offset must be greater than or equal to -1"))
+		}
+	}
+	if len(e.PhaseAngOffsets) != 0 && len(e.PhaseAngOffsets) != 3 {
+		check("PhaseAngOffsets", fmt.Errorf("%d phase angle offsets given, instead of 3", len(e.PhaseAngOffsets)))
+	}
+	if e.MaxAnomalySlewRate < 0 {
+		check("MaxAnomalySlewRate", errors.New("max anomaly slew rate must be greater than or equal to 0"))
+	}
+	if e.FaultXR < 0 {
+		check("FaultXR", errors.New("fault X/R ratio must be greater than or equal to 0"))
+	}
+	for i := range e.SagSwells {
+		check(fmt.Sprintf("SagSwells[%d]", i), e.SagSwells[i].validate())
+	}
+
+	check("PosSeqMagAnomaly", e.PosSeqMagAnomaly.Validate())
+	check("PosSeqAngAnomaly", e.PosSeqAngAnomaly.Validate())
+	check("PhaseAMagAnomaly", e.PhaseAMagAnomaly.Validate())
+	check("FreqAnomaly", e.FreqAnomaly.Validate())
+	check("HarmonicsAnomaly", e.HarmonicsAnomaly.Validate())
+	check("WiringAnomaly", e.WiringAnomaly.Validate())
+	return errors.Join(errs...)
+}
+
+// Validate returns every problem with the configuration of the emulation and its anomaly container, as
+// anomaly.FieldErrors joined by errors.Join, or nil if there are none.
+func (t *TemperatureEmulation) Validate() error {
+	var errs []error
+	if t.NoiseMag < 0 {
+		errs = append(errs, &anomaly.FieldError{Path: "NoiseMag", Err: errors.New("noise magnitude must be greater than or equal to 0")})
+	}
+	if t.MaxAnomalySlewRate < 0 {
+		errs = append(errs, &anomaly.FieldError{Path: "MaxAnomalySlewRate", Err: errors.New("max anomaly slew rate must be greater than or equal to 0")})
+	}
+	errs = append(errs, anomaly.FieldErrors("Anomaly", t.Anomaly.Validate())...)
+	return errors.Join(errs...)
+}
@@ -0,0 +1,43 @@
+package emulator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/synaptecltd/emulator/anomaly"
+	"gopkg.in/yaml.v2"
+)
+
+// Assert that every problem with the configuration is reported with its field path
+func TestEmulator_Validate(t *testing.T) {
+	emu := NewEmulator(4000, 50)
+	emu.V = &ThreePhaseEmulation{PosSeqMag: 1000, HarmonicNumbers: []float64{5, 7}, HarmonicMags: []float64{0.1}, HarmonicAngs: []float64{0, 0}}
+	emu.T = &TemperatureEmulation{MeanTemperature: 20, NoiseMag: -1}
+	emu.SoftStart = -1
+	burst, err := anomaly.NewTrendAnomaly(anomaly.TrendParams{Duration: 1, TriggeredBy: "missing"})
+	assert.NoError(t, err)
+	emu.V.PosSeqMagAnomaly = anomaly.Container{"burst": burst}
+
+	assert.EqualError(t, emu.Validate(), "SoftStart: soft start must be greater than or equal to 0\n"+
+		"V.HarmonicMags: 1 harmonic magnitudes given for 2 harmonic numbers\n"+
+		"V.PosSeqMagAnomaly.burst.TriggeredBy: anomaly not found in container: missing\n"+
+		"T.NoiseMag: noise magnitude must be greater than or equal to 0")
+
+	emu.SoftStart = 0
+	emu.V.HarmonicMags = append(emu.V.HarmonicMags, 0.05)
+	emu.T.NoiseMag = 0.01
+	emu.V.PosSeqMagAnomaly.Clear()
+	assert.NoError(t, emu.Validate())
+
+	// unmarshalling reports all problems with the emulator at once
+	yamlStr := `
+SamplingRate: 4000
+Fnom: 50
+SoftStart: -1
+SamplesPerCycle: -1
+`
+	var loaded Emulator
+	err = yaml.Unmarshal([]byte(yamlStr), &loaded)
+	assert.ErrorContains(t, err, "SoftStart: ")
+	assert.ErrorContains(t, err, "SamplesPerCycle: ")
+}